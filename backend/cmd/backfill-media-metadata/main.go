@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io"
+	"log"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/thieugt95/portal-365/backend/internal/config"
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/imaging"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+	"github.com/thieugt95/portal-365/backend/internal/video"
+	"github.com/thieugt95/portal-365/backend/internal/watermark"
+)
+
+var imageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".jfif": true, ".png": true, ".webp": true}
+
+// Strips EXIF/XMP/GPS metadata from images uploaded before uploads were
+// sanitized, rotating them upright, and records the dimensions of image media
+// items and the duration, resolution and codec of video media items.
+// Renditions of rewritten images are regenerated. Run it from the backend
+// directory so a local ./storage resolves like it does for the server.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only list the files that would be rewritten")
+	flag.Parse()
+
+	// Load configuration
+	cfg := config.Load()
+
+	// Initialize database
+	db, err := database.Initialize(cfg.DatabaseDSN)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+
+	repos := database.NewRepositories(db)
+	marks := watermark.New(repos, store, imaging.NewRenderer(cfg, store))
+	ctx := context.Background()
+
+	renditionsPrefix := storage.Key(imaging.RenditionURLPrefix) + "/"
+
+	var rewritten, clean, failed int
+	var images []*storage.ObjectInfo
+	err = store.List(ctx, "uploads/", func(obj *storage.ObjectInfo) error {
+		// Renditions are generated from the originals and never carry metadata
+		if !strings.HasPrefix(obj.Key, renditionsPrefix) && imageExtensions[strings.ToLower(path.Ext(obj.Key))] {
+			images = append(images, obj)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to list uploads: %v", err)
+	}
+
+	for _, obj := range images {
+		key := obj.Key
+		data, err := readObject(ctx, store, key)
+		if err != nil {
+			log.Printf("Failed to read %s: %v", key, err)
+			failed++
+			continue
+		}
+		meta, err := imaging.Inspect(data)
+		if err != nil {
+			log.Printf("Skipping %s: %v", key, err)
+			failed++
+			continue
+		}
+		if !imaging.HasMetadata(meta.Format, data) {
+			clean++
+			continue
+		}
+		if *dryRun {
+			log.Printf("Would rewrite %s", key)
+			continue
+		}
+
+		sanitized, err := imaging.Sanitize(data)
+		if err != nil {
+			log.Printf("Failed to sanitize %s: %v", key, err)
+			failed++
+			continue
+		}
+		if err := store.Put(ctx, key, bytes.NewReader(sanitized.Data), int64(len(sanitized.Data)), mime.TypeByExtension(path.Ext(key))); err != nil {
+			log.Printf("Failed to write %s: %v", key, err)
+			failed++
+			continue
+		}
+		rewritten++
+		log.Printf("Rewrote %s", key)
+
+		// Orientation may have changed, so renditions made from the old file are stale
+		source := storage.URL(key)
+		if existing, err := repos.Renditions.ListBySource(ctx, source); err == nil && len(existing) > 0 {
+			renditions, err := marks.Render(ctx, source)
+			if err == nil {
+				err = repos.Renditions.Replace(ctx, source, imaging.Models(source, renditions))
+			}
+			if err != nil {
+				log.Printf("Failed to regenerate renditions for %s: %v", source, err)
+			}
+		}
+	}
+
+	// Record dimensions of image media items, which were never populated
+	var measured int
+	for page := 1; ; page++ {
+		items, _, err := repos.MediaItems.List(ctx, &repositories.MediaItemFilter{MediaType: "image"}, page, 100, "")
+		if err != nil {
+			log.Fatalf("Failed to list media items: %v", err)
+		}
+		for _, item := range items {
+			source := imaging.SourceURL(item.URL)
+			if source == "" {
+				continue
+			}
+			data, err := readObject(ctx, store, storage.Key(source))
+			if err != nil {
+				continue
+			}
+			meta, err := imaging.Inspect(data)
+			if err != nil || (meta.Width == item.Width && meta.Height == item.Height) {
+				continue
+			}
+			if *dryRun {
+				log.Printf("Would record %dx%d for media item %d", meta.Width, meta.Height, item.ID)
+				continue
+			}
+			if _, err := db.ExecContext(ctx, `UPDATE media_items SET width = ?, height = ? WHERE id = ?`,
+				meta.Width, meta.Height, item.ID); err != nil {
+				log.Printf("Failed to update media item %d: %v", item.ID, err)
+				continue
+			}
+			measured++
+		}
+		if len(items) < 100 {
+			break
+		}
+	}
+
+	// Probe videos, which never had their duration or size recorded
+	for page := 1; ; page++ {
+		items, _, err := repos.MediaItems.List(ctx, &repositories.MediaItemFilter{MediaType: "video"}, page, 100, "")
+		if err != nil {
+			log.Fatalf("Failed to list media items: %v", err)
+		}
+		for _, item := range items {
+			source := imaging.SourceURL(item.URL)
+			if source == "" {
+				continue
+			}
+			info, err := probeObject(ctx, store, storage.Key(source))
+			if err != nil {
+				log.Printf("Failed to probe media item %d: %v", item.ID, err)
+				continue
+			}
+			if info.Seconds() == item.Duration && info.Width == item.Width && info.Height == item.Height && info.Codec == item.Codec {
+				continue
+			}
+			if *dryRun {
+				log.Printf("Would record %dx%d, %ds, %s for media item %d", info.Width, info.Height, info.Seconds(), info.Codec, item.ID)
+				continue
+			}
+			if _, err := db.ExecContext(ctx, `UPDATE media_items SET duration = ?, codec = ?, width = ?, height = ? WHERE id = ?`,
+				info.Seconds(), info.Codec, info.Width, info.Height, item.ID); err != nil {
+				log.Printf("Failed to update media item %d: %v", item.ID, err)
+				continue
+			}
+			measured++
+		}
+		if len(items) < 100 {
+			break
+		}
+	}
+
+	log.Printf("Done: %d rewritten, %d already clean, %d failed, %d media items measured", rewritten, clean, failed, measured)
+}
+
+func readObject(ctx context.Context, store storage.Storage, key string) ([]byte, error) {
+	obj, _, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return io.ReadAll(obj)
+}
+
+func probeObject(ctx context.Context, store storage.Storage, key string) (*video.Info, error) {
+	obj, info, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return video.Probe(storage.ReaderAt(obj), info.Size)
+}
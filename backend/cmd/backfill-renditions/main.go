@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/thieugt95/portal-365/backend/internal/config"
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/imaging"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+	"github.com/thieugt95/portal-365/backend/internal/watermark"
+)
+
+// Generates renditions for images uploaded before the rendition pipeline existed:
+// image media items, article uploads and article featured images. Images in
+// the watermark selection are watermarked. Run it from the backend directory
+// so a local ./storage resolves like it does for the server.
+func main() {
+	force := flag.Bool("force", false, "regenerate renditions that already exist")
+	dryRun := flag.Bool("dry-run", false, "only list the images that would be processed")
+	watermarks := flag.Bool("watermarks", false, "also redraw renditions whose watermark is out of date")
+	flag.Parse()
+
+	// Load configuration
+	cfg := config.Load()
+
+	// Initialize database
+	db, err := database.Initialize(cfg.DatabaseDSN)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+
+	repos := database.NewRepositories(db)
+	marks := watermark.New(repos, store, imaging.NewRenderer(cfg, store))
+	ctx := context.Background()
+
+	sources := make(map[string]bool)
+	var ordered []string
+	add := func(imageURL string) {
+		if source := imaging.SourceURL(imageURL); source != "" && !sources[source] {
+			sources[source] = true
+			ordered = append(ordered, source)
+		}
+	}
+
+	// Image media items
+	for page := 1; ; page++ {
+		items, _, err := repos.MediaItems.List(ctx, &repositories.MediaItemFilter{MediaType: "image"}, page, 100, "")
+		if err != nil {
+			log.Fatalf("Failed to list media items: %v", err)
+		}
+		for _, item := range items {
+			add(item.URL)
+		}
+		if len(items) < 100 {
+			break
+		}
+	}
+
+	// Featured images, which may point anywhere under uploads
+	rows, err := db.QueryContext(ctx, `SELECT DISTINCT featured_image FROM articles WHERE featured_image LIKE '%/static/uploads/%'`)
+	if err != nil {
+		log.Fatalf("Failed to list featured images: %v", err)
+	}
+	for rows.Next() {
+		var featured string
+		if err := rows.Scan(&featured); err != nil {
+			log.Fatalf("Failed to read featured image: %v", err)
+		}
+		add(featured)
+	}
+	rows.Close()
+
+	// Files uploaded through the article editor
+	err = store.List(ctx, "uploads/articles/", func(obj *storage.ObjectInfo) error {
+		add(storage.URL(obj.Key))
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to list article uploads: %v", err)
+	}
+
+	var rendered, skipped, failed int
+	for _, source := range ordered {
+		if !*force {
+			existing, err := repos.Renditions.ListBySource(ctx, source)
+			if err == nil && len(existing) > 0 {
+				skipped++
+				continue
+			}
+		}
+		if *dryRun {
+			log.Printf("Would render %s", source)
+			continue
+		}
+
+		renditions, err := marks.Render(ctx, source)
+		if err != nil {
+			log.Printf("Failed to render %s: %v", source, err)
+			failed++
+			continue
+		}
+		if err := repos.Renditions.Replace(ctx, source, imaging.Models(source, renditions)); err != nil {
+			log.Printf("Failed to store renditions for %s: %v", source, err)
+			failed++
+			continue
+		}
+		log.Printf("Rendered %s (%d files)", source, len(renditions)-1)
+		rendered++
+	}
+
+	// Point media thumbnails that still use the original at the smallest rendition
+	if !*dryRun {
+		result, err := db.ExecContext(ctx,
+			`UPDATE media_items SET thumbnail_url = (
+				SELECT r.url FROM image_renditions r 
+				WHERE r.source_url = media_items.url AND r.name != 'original' AND r.format != 'webp' 
+				ORDER BY r.width LIMIT 1) 
+			 WHERE media_type = 'image' AND (thumbnail_url = url OR thumbnail_url = '') 
+			 AND EXISTS (SELECT 1 FROM image_renditions r WHERE r.source_url = media_items.url AND r.name != 'original' AND r.format != 'webp')`)
+		if err != nil {
+			log.Printf("Failed to update media thumbnails: %v", err)
+		} else if n, _ := result.RowsAffected(); n > 0 {
+			log.Printf("Updated %d media thumbnails", n)
+		}
+	}
+
+	log.Printf("Done: %d rendered, %d already had renditions, %d failed", rendered, skipped, failed)
+
+	if *watermarks && !*dryRun {
+		var redrawn, redrawFailed int
+		err := marks.Sync(ctx, false, func(source string, err error) {
+			if err != nil {
+				redrawFailed++
+				return
+			}
+			redrawn++
+			log.Printf("Redrew %s", source)
+		}, nil)
+		if err != nil {
+			log.Fatalf("Failed to redraw watermarks: %v", err)
+		}
+		log.Printf("Watermarks: %d redrawn, %d failed", redrawn, redrawFailed)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/thieugt95/portal-365/backend/internal/config"
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/docindex"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+)
+
+// Extracts the text of documents uploaded before document search covered
+// file contents, along with any still waiting from the server. Run it from
+// the backend directory so a local ./storage resolves like it does for the
+// server.
+func main() {
+	retryFailed := flag.Bool("failed", false, "also retry documents whose extraction failed")
+	all := flag.Bool("all", false, "re-extract every document, for example after improving the extractor")
+	dryRun := flag.Bool("dry-run", false, "only count the documents that would be processed")
+	flag.Parse()
+
+	// Load configuration
+	cfg := config.Load()
+
+	// Initialize database
+	db, err := database.Initialize(cfg.DatabaseDSN)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	// The text tables may be new to this database
+	if err := database.Migrate(db); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+
+	repos := database.NewRepositories(db)
+	ctx := context.Background()
+
+	if *dryRun {
+		query := `SELECT COUNT(*) FROM documents d LEFT JOIN document_texts t ON t.document_id = d.id
+		          WHERE t.document_id IS NULL OR t.status = 'pending'`
+		switch {
+		case *all:
+			query = `SELECT COUNT(*) FROM documents`
+		case *retryFailed:
+			query += ` OR t.status = 'failed'`
+		}
+		var count int
+		if err := db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+			log.Fatalf("Failed to count documents: %v", err)
+		}
+		log.Printf("Would extract the text of %d documents", count)
+		return
+	}
+
+	queued, err := repos.DocTexts.QueueMissing(ctx)
+	if err != nil {
+		log.Fatalf("Failed to queue documents: %v", err)
+	}
+	var requeued int64
+	switch {
+	case *all:
+		requeued, err = repos.DocTexts.Requeue(ctx)
+	case *retryFailed:
+		requeued, err = repos.DocTexts.Requeue(ctx, repositories.TextFailed)
+	}
+	if err != nil {
+		log.Fatalf("Failed to queue documents: %v", err)
+	}
+	log.Printf("Queued %d documents never extracted and %d to extract again", queued, requeued)
+
+	var done, failed, unsupported int
+	extractor := docindex.New(repos, store)
+	_, err = extractor.ExtractPending(ctx, func(text *models.DocumentText) {
+		switch text.Status {
+		case repositories.TextDone:
+			done++
+			log.Printf("Extracted document %d (%d bytes of text)", text.DocumentID, len(text.Content))
+		case repositories.TextFailed:
+			failed++
+			log.Printf("Failed to extract document %d: %s", text.DocumentID, text.Error)
+		default:
+			unsupported++
+		}
+	})
+	if err != nil {
+		log.Fatalf("Failed to save extracted text: %v", err)
+	}
+
+	log.Printf("Done: %d extracted, %d failed, %d of unsupported types", done, failed, unsupported)
+}
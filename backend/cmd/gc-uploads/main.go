@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/config"
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/imaging"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+	"github.com/thieugt95/portal-365/backend/internal/usage"
+)
+
+// Removes stored files under uploads/ that nothing refers to. It first
+// rebuilds the usage records of articles, pages and banners from their
+// content, then keeps every file referenced from there, from media items,
+// documents and their earlier versions, avatars, settings and article
+// revisions, plus the renditions of kept images. Files with a reference count
+// are never removed on the scan alone: they stay while counted, and once
+// released are purged under their row so that an upload of the same content
+// can't lose its file. Recent files are left alone: article editor uploads are
+// only referenced once the article is saved. Last, crops in the image cache
+// that haven't been served for cache-max-age are removed. Run it from the
+// backend directory so a local ./storage and ./cache resolve like they do for
+// the server.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only list the files that would be removed")
+	minAge := flag.Duration("min-age", 24*time.Hour, "keep files modified more recently than this")
+	cacheMaxAge := flag.Duration("cache-max-age", 30*24*time.Hour, "remove cached crops not served for this long")
+	flag.Parse()
+
+	// Load configuration
+	cfg := config.Load()
+
+	// Initialize database
+	db, err := database.Initialize(cfg.DatabaseDSN)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+
+	repos := database.NewRepositories(db)
+	ctx := context.Background()
+
+	tracked := rebuildUsage(ctx, db, repos.FileRefs)
+	log.Printf("Recorded %d file references from articles, pages and banners", tracked)
+
+	kept := make(map[string]bool)
+	keep := func(value string) {
+		if u := imaging.SourceURL(value); u != "" {
+			kept[u] = true
+		}
+		for _, u := range usage.ContentURLs(value) {
+			kept[u] = true
+		}
+	}
+	for _, query := range []string{
+		`SELECT url FROM file_references`,
+		`SELECT url FROM media_items`,
+		`SELECT thumbnail_url FROM media_items`,
+		`SELECT file_path FROM media`,
+		`SELECT file_path FROM documents`,
+		`SELECT file_path FROM document_versions`,
+		`SELECT image_url FROM banners`,
+		`SELECT avatar FROM users`,
+		`SELECT value FROM settings`,
+		`SELECT json_extract(value, '$.logo_url') FROM settings WHERE key = 'watermark' AND json_valid(value)`,
+		`SELECT content FROM article_revisions`,
+	} {
+		if err := scanStrings(ctx, db, query, keep); err != nil {
+			log.Fatalf("Failed to collect references (%s): %v", query, err)
+		}
+	}
+
+	// Renditions live and die with their source: a kept rendition keeps its
+	// source, and a kept source keeps all its renditions
+	sources := make(map[string][]string)
+	rows, err := db.QueryContext(ctx, `SELECT source_url, url FROM image_renditions`)
+	if err != nil {
+		log.Fatalf("Failed to list renditions: %v", err)
+	}
+	renditionSource := make(map[string]string)
+	for rows.Next() {
+		var source, url string
+		if err := rows.Scan(&source, &url); err != nil {
+			log.Fatalf("Failed to read rendition: %v", err)
+		}
+		sources[source] = append(sources[source], url)
+		renditionSource[url] = source
+	}
+	rows.Close()
+	for url := range kept {
+		if source, ok := renditionSource[url]; ok {
+			kept[source] = true
+		}
+	}
+	for source, urls := range sources {
+		if kept[source] {
+			for _, url := range urls {
+				kept[url] = true
+			}
+		}
+	}
+
+	// Counted files go by their reference count: one the scan above misses
+	// still has its references, and a released one is purged under its row
+	counts := make(map[string]int64)
+	rows, err = db.QueryContext(ctx, `SELECT url, ref_count FROM stored_blobs`)
+	if err != nil {
+		log.Fatalf("Failed to list stored blobs: %v", err)
+	}
+	for rows.Next() {
+		var url string
+		var count int64
+		if err := rows.Scan(&url, &count); err != nil {
+			log.Fatalf("Failed to read stored blob: %v", err)
+		}
+		counts[url] = count
+	}
+	rows.Close()
+	for source, urls := range sources {
+		if counts[source] > 0 {
+			for _, url := range urls {
+				kept[url] = true
+			}
+		}
+	}
+
+	cutoff := time.Now().Add(-*minAge)
+	var unreferenced []*storage.ObjectInfo
+	var recent, counted int
+	err = store.List(ctx, "uploads/", func(obj *storage.ObjectInfo) error {
+		url := storage.URL(obj.Key)
+		if kept[url] {
+			return nil
+		}
+		if count, ok := counts[url]; ok {
+			if count > 0 {
+				log.Printf("Keeping %s: no reference found, but %d counted", url, count)
+				counted++
+			}
+			return nil
+		}
+		if obj.ModTime.After(cutoff) {
+			recent++
+			return nil
+		}
+		unreferenced = append(unreferenced, obj)
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to list uploads: %v", err)
+	}
+
+	var removed int
+	var reclaimed int64
+	for _, obj := range unreferenced {
+		url := storage.URL(obj.Key)
+		if *dryRun {
+			log.Printf("Would remove %s (%d bytes)", url, obj.Size)
+		} else {
+			if err := store.Delete(ctx, obj.Key); err != nil {
+				log.Printf("Failed to remove %s: %v", url, err)
+				continue
+			}
+			// Forget the rendition rows of the removed file
+			if _, err := db.ExecContext(ctx, `DELETE FROM image_renditions WHERE source_url = ?`, url); err != nil {
+				log.Printf("Failed to delete renditions of %s: %v", url, err)
+			}
+			log.Printf("Removed %s", url)
+		}
+		removed++
+		reclaimed += obj.Size
+	}
+
+	// Released files whose purge failed when their last reference went
+	released, err := repos.Blobs.ListReleased(ctx)
+	if err != nil {
+		log.Fatalf("Failed to list released files: %v", err)
+	}
+	for _, blob := range released {
+		if kept[blob.URL] {
+			log.Printf("Keeping %s: released, but still referenced", blob.URL)
+			continue
+		}
+		if *dryRun {
+			log.Printf("Would remove %s (%d bytes, released)", blob.URL, blob.Size)
+		} else {
+			purged, err := repos.Blobs.Purge(ctx, blob.URL, func() error {
+				if err := store.Delete(ctx, storage.Key(blob.URL)); err != nil && !errors.Is(err, storage.ErrNotFound) {
+					return err
+				}
+				return imaging.RemoveRenditions(ctx, store, blob.URL)
+			})
+			if err != nil {
+				log.Printf("Failed to remove %s: %v", blob.URL, err)
+				continue
+			}
+			if !purged {
+				continue
+			}
+			if err := repos.Renditions.DeleteBySource(ctx, blob.URL); err != nil {
+				log.Printf("Failed to delete renditions of %s: %v", blob.URL, err)
+			}
+			log.Printf("Removed %s", blob.URL)
+		}
+		removed++
+		reclaimed += blob.Size
+	}
+
+	verb := "removed"
+	if *dryRun {
+		verb = "would be removed"
+	}
+	log.Printf("Done: %d unreferenced files (%d bytes) %s, %d recent files skipped, %d files referenced, %d kept by their reference count",
+		removed, reclaimed, verb, recent, len(kept), counted)
+
+	crops, cropBytes, err := imaging.NewCropper(cfg, store).Prune(time.Now().Add(-*cacheMaxAge), *dryRun)
+	if err != nil {
+		log.Fatalf("Failed to prune the image cache %s: %v", cfg.ImageCacheDir, err)
+	}
+	log.Printf("Image cache: %d crops (%d bytes) unused for %s %s", crops, cropBytes, *cacheMaxAge, verb)
+}
+
+// rebuildUsage records the files used by every article, page and banner and
+// drops the records of deleted ones. It returns the number of references.
+func rebuildUsage(ctx context.Context, db *sql.DB, refs repositories.FileReferenceRepository) int {
+	total := 0
+	record := func(ownerType string, ownerID int64, found []*models.FileReference) {
+		if err := refs.Replace(ctx, ownerType, ownerID, found); err != nil {
+			log.Fatalf("Failed to record files used by %s %d: %v", ownerType, ownerID, err)
+		}
+		total += len(found)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT id, COALESCE(featured_image, ''), COALESCE(content, '') FROM articles`)
+	if err != nil {
+		log.Fatalf("Failed to list articles: %v", err)
+	}
+	var articles []*models.Article
+	for rows.Next() {
+		article := &models.Article{}
+		if err := rows.Scan(&article.ID, &article.FeaturedImage, &article.Content); err != nil {
+			log.Fatalf("Failed to read article: %v", err)
+		}
+		articles = append(articles, article)
+	}
+	rows.Close()
+	for _, article := range articles {
+		record(usage.OwnerArticle, article.ID, usage.Article(article))
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT id, hero_image_url, COALESCE(content, '') FROM pages`)
+	if err != nil {
+		log.Fatalf("Failed to list pages: %v", err)
+	}
+	var pages []*models.Page
+	for rows.Next() {
+		page := &models.Page{}
+		if err := rows.Scan(&page.ID, &page.HeroImageURL, &page.Content); err != nil {
+			log.Fatalf("Failed to read page: %v", err)
+		}
+		pages = append(pages, page)
+	}
+	rows.Close()
+	for _, page := range pages {
+		record(usage.OwnerPage, page.ID, usage.Page(page))
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT id, image_url FROM banners`)
+	if err != nil {
+		log.Fatalf("Failed to list banners: %v", err)
+	}
+	var banners []*models.Banner
+	for rows.Next() {
+		banner := &models.Banner{}
+		if err := rows.Scan(&banner.ID, &banner.ImageURL); err != nil {
+			log.Fatalf("Failed to read banner: %v", err)
+		}
+		banners = append(banners, banner)
+	}
+	rows.Close()
+	for _, banner := range banners {
+		record(usage.OwnerBanner, banner.ID, usage.Banner(banner))
+	}
+
+	if _, err := db.ExecContext(ctx,
+		`DELETE FROM file_references WHERE
+		 (owner_type = 'article' AND owner_id NOT IN (SELECT id FROM articles)) OR
+		 (owner_type = 'page' AND owner_id NOT IN (SELECT id FROM pages)) OR
+		 (owner_type = 'banner' AND owner_id NOT IN (SELECT id FROM banners))`); err != nil {
+		log.Fatalf("Failed to drop stale file references: %v", err)
+	}
+	return total
+}
+
+// scanStrings calls fn with every non-empty value of a single-column query
+func scanStrings(ctx context.Context, db *sql.DB, query string, fn func(string)) error {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value sql.NullString
+		if err := rows.Scan(&value); err != nil {
+			return err
+		}
+		if strings.TrimSpace(value.String) != "" {
+			fn(value.String)
+		}
+	}
+	return rows.Err()
+}
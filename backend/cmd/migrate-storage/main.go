@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"mime"
+	"path"
+
+	"github.com/thieugt95/portal-365/backend/internal/config"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+)
+
+// Copies stored files from one storage backend to another, e.g. from the
+// local ./storage directory to an S3 bucket before switching STORAGE_DRIVER.
+// Both backends are configured from the usual STORAGE_* and S3_* settings.
+// Files already present in the target with the same size are skipped unless
+// -overwrite is given; nothing is removed from the source. The files of
+// restricted documents live apart from the uploads: copy them with a second
+// run using -prefix private/. Run it from the backend directory so a local
+// ./storage resolves like it does for the server.
+func main() {
+	from := flag.String("from", storage.DriverLocal, "backend to copy from (local or s3)")
+	to := flag.String("to", storage.DriverS3, "backend to copy to (local or s3)")
+	prefix := flag.String("prefix", "uploads/", "only copy keys starting with this prefix")
+	overwrite := flag.Bool("overwrite", false, "copy files that already exist in the target")
+	dryRun := flag.Bool("dry-run", false, "only list the files that would be copied")
+	flag.Parse()
+
+	if *from == *to {
+		log.Fatalf("Source and target are both %q", *from)
+	}
+
+	// Load configuration
+	cfg := config.Load()
+
+	src, err := storage.Open(*from, cfg)
+	if err != nil {
+		log.Fatalf("Failed to open %s storage: %v", *from, err)
+	}
+	dst, err := storage.Open(*to, cfg)
+	if err != nil {
+		log.Fatalf("Failed to open %s storage: %v", *to, err)
+	}
+	ctx := context.Background()
+
+	var objects []*storage.ObjectInfo
+	if err := src.List(ctx, *prefix, func(obj *storage.ObjectInfo) error {
+		objects = append(objects, obj)
+		return nil
+	}); err != nil {
+		log.Fatalf("Failed to list %s storage: %v", *from, err)
+	}
+
+	var copied, skipped, failed int
+	var bytes int64
+	for _, obj := range objects {
+		if !*overwrite {
+			if existing, err := dst.Stat(ctx, obj.Key); err == nil && existing.Size == obj.Size {
+				skipped++
+				continue
+			}
+		}
+		if *dryRun {
+			log.Printf("Would copy %s (%d bytes)", obj.Key, obj.Size)
+			continue
+		}
+
+		if err := copyObject(ctx, src, dst, obj.Key); err != nil {
+			log.Printf("Failed to copy %s: %v", obj.Key, err)
+			failed++
+			continue
+		}
+		copied++
+		bytes += obj.Size
+	}
+
+	log.Printf("Done: %d files (%d bytes) copied from %s to %s, %d already there, %d failed",
+		copied, bytes, *from, *to, skipped, failed)
+}
+
+func copyObject(ctx context.Context, src, dst storage.Storage, key string) error {
+	obj, info, err := src.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	return dst.Put(ctx, key, obj, info.Size, contentType)
+}
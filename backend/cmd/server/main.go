@@ -1,8 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -15,6 +22,7 @@ import (
 	"github.com/thieugt95/portal-365/backend/internal/database"
 	"github.com/thieugt95/portal-365/backend/internal/middleware"
 	"github.com/thieugt95/portal-365/backend/internal/routes"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
 )
 
 // @title Portal 365 API
@@ -77,9 +85,12 @@ func main() {
 		corsConfig.AllowOrigins = cfg.CORSAllowedOrigins
 	}
 
-	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"}
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"}
-	corsConfig.ExposeHeaders = []string{"Content-Length", "Content-Type"}
+	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH", "HEAD"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With",
+		"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata"}
+	corsConfig.ExposeHeaders = []string{"Content-Length", "Content-Type",
+		"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+		"Upload-Length", "Upload-Offset", "Upload-Expires", "Media-Item-ID"}
 	corsConfig.AllowCredentials = false // Set to false when using Authorization header
 	r.Use(cors.New(corsConfig))
 
@@ -94,8 +105,14 @@ func main() {
 	// Initialize repositories
 	repos := database.NewRepositories(db)
 
+	// Open file storage
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+
 	// Setup API routes
-	routes.Setup(r, cfg, repos)
+	workers := routes.Setup(r, cfg, repos, store)
 
 	// Serve static files from dist folder
 	r.Static("/assets", "./dist/assets")
@@ -122,10 +139,26 @@ func main() {
 		c.File("./dist/index.html")
 	})
 
+	// Background jobs run until the server is asked to stop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	workers.Start(ctx)
+
 	// Start server
 	addr := fmt.Sprintf(":%s", cfg.Port)
-	log.Printf("Server starting on %s", addr)
-	if err := r.Run(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{Addr: addr, Handler: r}
+	go func() {
+		log.Printf("Server starting on %s", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to shut down cleanly: %v", err)
 	}
 }
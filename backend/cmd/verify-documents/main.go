@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/thieugt95/portal-365/backend/internal/config"
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+)
+
+// version is a document version whose file is to be checked
+type version struct {
+	id         int64
+	documentID int64
+	number     int
+	filePath   string
+	sha256     string
+}
+
+// Verifies the files of every document version against their stored SHA-256
+// checksums, reporting files that are missing or have changed, and records
+// the checksum of versions uploaded before checksums were kept. It exits
+// with status 1 when a file fails verification. Run it from the backend
+// directory so a local ./storage resolves like it does for the server.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "do not record missing checksums")
+	flag.Parse()
+
+	// Load configuration
+	cfg := config.Load()
+
+	// Initialize database
+	db, err := database.Initialize(cfg.DatabaseDSN)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	// The versions table may be new to this database
+	if err := database.Migrate(db); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+
+	ctx := context.Background()
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, document_id, version, file_path, sha256 FROM document_versions ORDER BY document_id, version`)
+	if err != nil {
+		log.Fatalf("Failed to list document versions: %v", err)
+	}
+	var versions []version
+	for rows.Next() {
+		var v version
+		if err := rows.Scan(&v.id, &v.documentID, &v.number, &v.filePath, &v.sha256); err != nil {
+			log.Fatalf("Failed to list document versions: %v", err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("Failed to list document versions: %v", err)
+	}
+	rows.Close()
+
+	var verified, recorded, bad int
+	for _, v := range versions {
+		sum, err := fileSHA256(ctx, store, v.filePath)
+		if err != nil {
+			log.Printf("Document %d version %d: cannot read %s: %v", v.documentID, v.number, v.filePath, err)
+			bad++
+			continue
+		}
+
+		switch {
+		case v.sha256 == sum:
+			verified++
+		case v.sha256 != "":
+			log.Printf("Document %d version %d: %s does not match its checksum (stored %s, file %s)",
+				v.documentID, v.number, v.filePath, v.sha256, sum)
+			bad++
+		case *dryRun:
+			log.Printf("Document %d version %d: would record checksum %s", v.documentID, v.number, sum)
+			recorded++
+		default:
+			if _, err := db.ExecContext(ctx, `UPDATE document_versions SET sha256 = ? WHERE id = ?`, sum, v.id); err != nil {
+				log.Fatalf("Failed to record checksum of document %d version %d: %v", v.documentID, v.number, err)
+			}
+			recorded++
+		}
+	}
+
+	log.Printf("Done: %d verified, %d checksums recorded, %d failed", verified, recorded, bad)
+	if bad > 0 {
+		os.Exit(1)
+	}
+}
+
+func fileSHA256(ctx context.Context, store storage.Storage, url string) (string, error) {
+	obj, _, err := store.Get(ctx, storage.Key(url))
+	if err != nil {
+		return "", err
+	}
+	defer obj.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, obj); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -14,6 +15,60 @@ type Config struct {
 	AccessTokenTTL     time.Duration
 	RefreshTokenTTL    time.Duration
 	CORSAllowedOrigins []string
+	ImageRenditions    []ImageRendition
+	ImageWebP          bool
+	ImageJPEGQuality   int
+	ImageKeepCapture   bool
+	ImagePresets       map[string]ImageSize
+	ImageSizes         []ImageSize
+	ImageCacheDir      string
+	UploadTempDir      string
+	UploadSessionTTL   time.Duration
+	StorageDriver      string
+	StorageDir         string
+	StorageRedirect    bool
+	StoragePresignTTL  time.Duration
+	S3Endpoint         string
+	S3Region           string
+	S3Bucket           string
+	S3AccessKey        string
+	S3SecretKey        string
+	S3PathStyle        bool
+	ClamdAddress       string
+	ClamdTimeout       time.Duration
+	QuarantineDir      string
+}
+
+// ImageRendition is a named width uploaded images are scaled down to
+type ImageRendition struct {
+	Name  string
+	Width int
+}
+
+// ImageSize is an output size of the on-demand image endpoint. With both
+// sides set images are cropped to fill it; a zero side follows the aspect
+// ratio of the source.
+type ImageSize struct {
+	Width  int
+	Height int
+}
+
+func (s ImageSize) String() string {
+	return strconv.Itoa(s.Width) + "x" + strconv.Itoa(s.Height)
+}
+
+// ParseImageSize reads "WxH", where one side may be 0
+func ParseImageSize(value string) (ImageSize, bool) {
+	w, h, ok := strings.Cut(strings.TrimSpace(value), "x")
+	if !ok {
+		return ImageSize{}, false
+	}
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if errW != nil || errH != nil || width < 0 || height < 0 || width+height == 0 {
+		return ImageSize{}, false
+	}
+	return ImageSize{Width: width, Height: height}, true
 }
 
 func Load() *Config {
@@ -25,6 +80,28 @@ func Load() *Config {
 		AccessTokenTTL:     parseDuration(getEnv("ACCESS_TOKEN_TTL", "15m"), 15*time.Minute),
 		RefreshTokenTTL:    parseDuration(getEnv("REFRESH_TOKEN_TTL", "720h"), 720*time.Hour),
 		CORSAllowedOrigins: parseOrigins(getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:5173")),
+		ImageRenditions:    parseRenditions(getEnv("IMAGE_RENDITIONS", "thumb:320,small:640,medium:1024,large:1600")),
+		ImageWebP:          getEnv("IMAGE_WEBP", "true") == "true",
+		ImageJPEGQuality:   parseInt(getEnv("IMAGE_JPEG_QUALITY", "82"), 82),
+		ImageKeepCapture:   getEnv("IMAGE_KEEP_CAPTURE_INFO", "false") == "true",
+		ImagePresets:       parseImagePresets(getEnv("IMAGE_PRESETS", "thumb:320x320,card:640x360,wide:1280x720,hero:1600x600")),
+		ImageSizes:         parseImageSizes(getEnv("IMAGE_SIZES", "160x0,320x0,480x0,640x0,960x0,1280x0,1600x0,0x320,320x320,480x270,640x360,1280x720")),
+		ImageCacheDir:      getEnv("IMAGE_CACHE_DIR", "./cache/img"),
+		UploadTempDir:      getEnv("UPLOAD_TEMP_DIR", "./tmp/uploads"),
+		UploadSessionTTL:   parseDuration(getEnv("UPLOAD_SESSION_TTL", "24h"), 24*time.Hour),
+		StorageDriver:      getEnv("STORAGE_DRIVER", "local"),
+		StorageDir:         getEnv("STORAGE_DIR", "./storage"),
+		StorageRedirect:    getEnv("STORAGE_REDIRECT", "false") == "true",
+		StoragePresignTTL:  parseDuration(getEnv("STORAGE_PRESIGN_TTL", "1h"), time.Hour),
+		S3Endpoint:         getEnv("S3_ENDPOINT", ""),
+		S3Region:           getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:           getEnv("S3_BUCKET", ""),
+		S3AccessKey:        getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:        getEnv("S3_SECRET_KEY", ""),
+		S3PathStyle:        getEnv("S3_PATH_STYLE", "true") == "true",
+		ClamdAddress:       getEnv("CLAMD_ADDRESS", ""),
+		ClamdTimeout:       parseDuration(getEnv("CLAMD_TIMEOUT", "60s"), time.Minute),
+		QuarantineDir:      getEnv("QUARANTINE_DIR", "./quarantine"),
 	}
 }
 
@@ -49,3 +126,51 @@ func parseOrigins(value string) []string {
 	}
 	return origins
 }
+
+func parseInt(value string, defaultValue int) int {
+	if n, err := strconv.Atoi(value); err == nil {
+		return n
+	}
+	return defaultValue
+}
+
+// parseRenditions reads "name:width" pairs separated by commas, skipping malformed entries
+func parseRenditions(value string) []ImageRendition {
+	renditions := make([]ImageRendition, 0)
+	for _, entry := range strings.Split(value, ",") {
+		name, width, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || name == "" {
+			continue
+		}
+		if w, err := strconv.Atoi(width); err == nil && w > 0 {
+			renditions = append(renditions, ImageRendition{Name: name, Width: w})
+		}
+	}
+	return renditions
+}
+
+// parseImagePresets reads "name:WxH" pairs separated by commas, skipping malformed entries
+func parseImagePresets(value string) map[string]ImageSize {
+	presets := make(map[string]ImageSize)
+	for _, entry := range strings.Split(value, ",") {
+		name, size, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || name == "" {
+			continue
+		}
+		if s, ok := ParseImageSize(size); ok {
+			presets[name] = s
+		}
+	}
+	return presets
+}
+
+// parseImageSizes reads "WxH" sizes separated by commas, skipping malformed entries
+func parseImageSizes(value string) []ImageSize {
+	sizes := make([]ImageSize, 0)
+	for _, entry := range strings.Split(value, ",") {
+		if s, ok := ParseImageSize(entry); ok {
+			sizes = append(sizes, s)
+		}
+	}
+	return sizes
+}
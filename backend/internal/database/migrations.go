@@ -48,6 +48,21 @@ func Migrate(db *sql.DB) error {
 		createViewLogsTable,
 		createDocumentsTable,
 		createMediaItemsTable,
+		createSlugRedirectsTable,
+		createImageRenditionsTable,
+		createUploadSessionsTable,
+		createStoredBlobsTable,
+		createFileReferencesTable,
+		createAlbumsTable,
+		createMediaFoldersTable,
+		createCropPresetsTable,
+		createQuarantinedFilesTable,
+		createDocumentTextsTable,
+		createDocumentDownloadsTable,
+		createDocumentVersionsTable,
+		createDocumentTermsTable,
+		createDocumentRelationsTable,
+		createDocumentRolesTable,
 	}
 
 	for _, migration := range migrations {
@@ -56,6 +71,61 @@ func Migrate(db *sql.DB) error {
 		}
 	}
 
+	if err := addMissingColumns(db); err != nil {
+		return err
+	}
+
+	// Indexes on added columns can only be created once the columns exist
+	if _, err := db.Exec(createAddedColumnIndexes); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+	return nil
+}
+
+// addedColumns are columns introduced after their table was first released.
+// SQLite has no ADD COLUMN IF NOT EXISTS, so they are added when missing.
+var addedColumns = []struct {
+	table, column, definition string
+}{
+	{"media_items", "taken_at", "DATETIME"},
+	{"media_items", "camera", "TEXT NOT NULL DEFAULT ''"},
+	{"media_items", "codec", "TEXT NOT NULL DEFAULT ''"},
+	{"media_items", "folder_id", "INTEGER REFERENCES media_folders(id) ON DELETE SET NULL"},
+	{"media_items", "no_watermark", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"image_renditions", "watermark", "TEXT NOT NULL DEFAULT ''"},
+	{"documents", "security_flags", "TEXT NOT NULL DEFAULT ''"},
+	{"documents", "version", "INTEGER NOT NULL DEFAULT 1"},
+	{"documents", "type_id", "INTEGER REFERENCES document_terms(id) ON DELETE SET NULL"},
+	{"documents", "authority_id", "INTEGER REFERENCES document_terms(id) ON DELETE SET NULL"},
+	{"documents", "signer_id", "INTEGER REFERENCES document_terms(id) ON DELETE SET NULL"},
+	{"documents", "effective_date", "DATE"},
+	{"documents", "expiry_date", "DATE"},
+	{"documents", "repealed", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"documents", "visibility", "TEXT NOT NULL DEFAULT 'public'"},
+}
+
+const createAddedColumnIndexes = `
+CREATE INDEX IF NOT EXISTS idx_media_items_folder_id ON media_items(folder_id);
+CREATE INDEX IF NOT EXISTS idx_media_items_uploaded_by ON media_items(uploaded_by);
+CREATE INDEX IF NOT EXISTS idx_documents_type_id ON documents(type_id);
+CREATE INDEX IF NOT EXISTS idx_documents_authority_id ON documents(authority_id);
+CREATE INDEX IF NOT EXISTS idx_documents_signer_id ON documents(signer_id);
+`
+
+func addMissingColumns(db *sql.DB) error {
+	for _, added := range addedColumns {
+		var count int
+		err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, added.table, added.column).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+		if count > 0 {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", added.table, added.column, added.definition)); err != nil {
+			return fmt.Errorf("migration failed: adding %s.%s: %w", added.table, added.column, err)
+		}
+	}
 	return nil
 }
 
@@ -415,3 +485,298 @@ CREATE INDEX IF NOT EXISTS idx_media_items_media_type ON media_items(media_type)
 CREATE INDEX IF NOT EXISTS idx_media_items_status ON media_items(status);
 CREATE INDEX IF NOT EXISTS idx_media_items_published_at ON media_items(published_at);
 `
+
+const createSlugRedirectsTable = `
+CREATE TABLE IF NOT EXISTS slug_redirects (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	entity TEXT NOT NULL,
+	old_slug TEXT NOT NULL,
+	target_id INTEGER NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_slug_redirects_entity_slug ON slug_redirects(entity, old_slug);
+CREATE INDEX IF NOT EXISTS idx_slug_redirects_target ON slug_redirects(entity, target_id);
+`
+
+const createImageRenditionsTable = `
+CREATE TABLE IF NOT EXISTS image_renditions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	source_url TEXT NOT NULL,
+	name TEXT NOT NULL,
+	format TEXT NOT NULL,
+	url TEXT NOT NULL,
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	file_size INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_image_renditions_source_name ON image_renditions(source_url, name, format);
+`
+
+const createUploadSessionsTable = `
+CREATE TABLE IF NOT EXISTS upload_sessions (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	filename TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	title TEXT NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT '',
+	category_id INTEGER NOT NULL DEFAULT 0,
+	upload_length INTEGER NOT NULL,
+	upload_offset INTEGER NOT NULL DEFAULT 0,
+	media_item_id INTEGER,
+	expires_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_expires_at ON upload_sessions(expires_at);
+`
+
+const createStoredBlobsTable = `
+CREATE TABLE IF NOT EXISTS stored_blobs (
+	sha256 TEXT PRIMARY KEY,
+	url TEXT NOT NULL UNIQUE,
+	size INTEGER NOT NULL,
+	mime_type TEXT NOT NULL DEFAULT '',
+	ref_count INTEGER NOT NULL DEFAULT 1,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+const createFileReferencesTable = `
+CREATE TABLE IF NOT EXISTS file_references (
+	url TEXT NOT NULL,
+	owner_type TEXT NOT NULL CHECK(owner_type IN ('article', 'page', 'banner')),
+	owner_id INTEGER NOT NULL,
+	field TEXT NOT NULL,
+	PRIMARY KEY (owner_type, owner_id, field, url)
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_references_url ON file_references(url);
+`
+
+const createAlbumsTable = `
+CREATE TABLE IF NOT EXISTS albums (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	slug TEXT NOT NULL UNIQUE,
+	description TEXT NOT NULL DEFAULT '',
+	cover_media_id INTEGER,
+	created_by INTEGER NOT NULL,
+	status TEXT NOT NULL DEFAULT 'draft',
+	published_at DATETIME,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (cover_media_id) REFERENCES media_items(id) ON DELETE SET NULL,
+	FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE RESTRICT
+);
+
+CREATE INDEX IF NOT EXISTS idx_albums_status ON albums(status);
+CREATE INDEX IF NOT EXISTS idx_albums_published_at ON albums(published_at);
+
+CREATE TABLE IF NOT EXISTS album_items (
+	album_id INTEGER NOT NULL,
+	media_item_id INTEGER NOT NULL,
+	position INTEGER NOT NULL DEFAULT 0,
+	caption TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (album_id, media_item_id),
+	FOREIGN KEY (album_id) REFERENCES albums(id) ON DELETE CASCADE,
+	FOREIGN KEY (media_item_id) REFERENCES media_items(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_album_items_position ON album_items(album_id, position);
+CREATE INDEX IF NOT EXISTS idx_album_items_media_item_id ON album_items(media_item_id);
+`
+
+const createMediaFoldersTable = `
+CREATE TABLE IF NOT EXISTS media_folders (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	parent_id INTEGER,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (parent_id) REFERENCES media_folders(id) ON DELETE RESTRICT
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_folders_parent_id ON media_folders(parent_id);
+
+CREATE TABLE IF NOT EXISTS media_tags (
+	media_item_id INTEGER NOT NULL,
+	tag TEXT NOT NULL COLLATE NOCASE,
+	PRIMARY KEY (media_item_id, tag),
+	FOREIGN KEY (media_item_id) REFERENCES media_items(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_tags_tag ON media_tags(tag);
+`
+
+const createCropPresetsTable = `
+CREATE TABLE IF NOT EXISTS crop_presets (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	description TEXT NOT NULL DEFAULT '',
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT OR IGNORE INTO crop_presets (name, description, width, height) VALUES
+	('banner-1', 'Banner 1 (left)', 760, 190),
+	('banner-2', 'Banner 2 (right)', 760, 190),
+	('banner', 'Other banner placements', 1200, 200),
+	('article-hero', 'Article hero image', 1600, 600),
+	('card', 'Card thumbnail', 640, 360),
+	('social', 'Social share image', 1200, 630);
+
+CREATE TABLE IF NOT EXISTS image_focal_points (
+	source_url TEXT PRIMARY KEY,
+	x REAL NOT NULL,
+	y REAL NOT NULL,
+	updated_by INTEGER,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+const createQuarantinedFilesTable = `
+CREATE TABLE IF NOT EXISTS quarantined_files (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	filename TEXT NOT NULL,
+	path TEXT NOT NULL,
+	sha256 TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	mime_type TEXT NOT NULL DEFAULT '',
+	source TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	detail TEXT NOT NULL DEFAULT '',
+	uploaded_by INTEGER,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_quarantined_files_created_at ON quarantined_files(created_at);
+`
+
+// documents_fts indexes each document's title, description, number and
+// extracted text under the document's id. Diacritics are folded so that
+// "quy che" finds "Quy chế". The repositories keep it in step; the INSERT
+// indexes documents created before the table existed.
+const createDocumentTextsTable = `
+CREATE TABLE IF NOT EXISTS document_texts (
+	document_id INTEGER PRIMARY KEY,
+	status TEXT NOT NULL DEFAULT 'pending',
+	content TEXT NOT NULL DEFAULT '',
+	error TEXT NOT NULL DEFAULT '',
+	extracted_at DATETIME,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_texts_status ON document_texts(status);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS documents_fts USING fts5(
+	title, description, document_no, content,
+	tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO documents_fts (rowid, title, description, document_no, content)
+SELECT d.id, d.title, COALESCE(d.description, ''), COALESCE(d.document_no, ''), COALESCE(t.content, '')
+FROM documents d LEFT JOIN document_texts t ON t.document_id = d.id
+WHERE d.id NOT IN (SELECT rowid FROM documents_fts);
+`
+
+// document_downloads remembers recent downloads so that a client fetching a
+// file again, or in ranges, is counted once per window. Rows older than the
+// window are pruned as downloads are recorded.
+const createDocumentDownloadsTable = `
+CREATE TABLE IF NOT EXISTS document_downloads (
+	document_id INTEGER NOT NULL,
+	ip_address TEXT NOT NULL,
+	user_agent TEXT NOT NULL,
+	downloaded_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_downloads_recent ON document_downloads(document_id, ip_address, downloaded_at);
+`
+
+// document_versions keeps every file a document has had. The document row
+// carries the current file and its version number; earlier files stay
+// downloadable. Documents that predate versions get their file as version 1,
+// with the checksum known from stored_blobs when there is one.
+const createDocumentVersionsTable = `
+CREATE TABLE IF NOT EXISTS document_versions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	document_id INTEGER NOT NULL,
+	version INTEGER NOT NULL,
+	file_path TEXT NOT NULL,
+	file_size INTEGER NOT NULL DEFAULT 0,
+	mime_type TEXT NOT NULL,
+	sha256 TEXT NOT NULL DEFAULT '',
+	change_note TEXT NOT NULL DEFAULT '',
+	uploaded_by INTEGER NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (document_id, version),
+	FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE,
+	FOREIGN KEY (uploaded_by) REFERENCES users(id) ON DELETE RESTRICT
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_versions_file_path ON document_versions(file_path);
+
+INSERT INTO document_versions (document_id, version, file_path, file_size, mime_type, sha256, uploaded_by, created_at)
+SELECT d.id, 1, d.file_path, d.file_size, d.mime_type, COALESCE(b.sha256, ''), d.uploaded_by, d.created_at
+FROM documents d LEFT JOIN stored_blobs b ON b.url = d.file_path
+WHERE d.id NOT IN (SELECT document_id FROM document_versions);
+`
+
+// document_terms are the managed vocabularies of document metadata: kind is
+// "type" (Quyết định, Công văn...), "authority" (the issuing body) or
+// "signer". Documents refer to them by type_id, authority_id and signer_id.
+const createDocumentTermsTable = `
+CREATE TABLE IF NOT EXISTS document_terms (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	kind TEXT NOT NULL,
+	name TEXT NOT NULL,
+	sort_order INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (kind, name)
+);
+
+-- The common document types, until types are managed; seeding only then
+-- lets a removed type stay removed
+INSERT INTO document_terms (kind, name, sort_order)
+SELECT 'type', column1, column2 FROM (VALUES ('Quyết định', 1), ('Chỉ thị', 2), ('Công văn', 3), ('Hướng dẫn', 4))
+WHERE NOT EXISTS (SELECT 1 FROM document_terms WHERE kind = 'type');
+`
+
+const createDocumentRelationsTable = `
+CREATE TABLE IF NOT EXISTS document_relations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	related_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	type TEXT NOT NULL,
+	created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (document_id, related_id, type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_relations_related ON document_relations(related_id);
+`
+
+// document_roles lists the roles that may see a document whose visibility
+// is "roles"
+const createDocumentRolesTable = `
+CREATE TABLE IF NOT EXISTS document_roles (
+	document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+	PRIMARY KEY (document_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_roles_role_id ON document_roles(role_id);
+`
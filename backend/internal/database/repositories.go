@@ -14,6 +14,9 @@ type Repositories struct {
 	Articles   repositories.ArticleRepository
 	Media      repositories.MediaRepository
 	Documents  repositories.DocumentRepository
+	DocTexts   repositories.DocumentTextRepository
+	DocTerms   repositories.DocumentTermRepository
+	DocLinks   repositories.DocumentRelationRepository
 	MediaItems repositories.MediaItemRepository
 	Comments   repositories.CommentRepository
 	Menus      repositories.MenuRepository
@@ -21,6 +24,17 @@ type Repositories struct {
 	Banners    repositories.BannerRepository
 	Settings   repositories.SettingRepository
 	AuditLogs  repositories.AuditLogRepository
+	Redirects  repositories.SlugRedirectRepository
+	Renditions repositories.ImageRenditionRepository
+	Uploads    repositories.UploadSessionRepository
+	Blobs      repositories.StoredBlobRepository
+	FileRefs   repositories.FileReferenceRepository
+	Albums     repositories.AlbumRepository
+	Folders    repositories.MediaFolderRepository
+	Crops      repositories.CropPresetRepository
+	Focal      repositories.FocalPointRepository
+	Watermarks repositories.WatermarkRepository
+	Quarantine repositories.QuarantineRepository
 }
 
 func NewRepositories(db *sql.DB) *Repositories {
@@ -32,6 +46,9 @@ func NewRepositories(db *sql.DB) *Repositories {
 		Articles:   repositories.NewArticleRepository(db),
 		Media:      repositories.NewMediaRepository(db),
 		Documents:  repositories.NewDocumentRepository(db),
+		DocTexts:   repositories.NewDocumentTextRepository(db),
+		DocTerms:   repositories.NewDocumentTermRepository(db),
+		DocLinks:   repositories.NewDocumentRelationRepository(db),
 		MediaItems: repositories.NewMediaItemRepository(db),
 		Comments:   repositories.NewCommentRepository(db),
 		Menus:      repositories.NewMenuRepository(db),
@@ -39,5 +56,16 @@ func NewRepositories(db *sql.DB) *Repositories {
 		Banners:    repositories.NewBannerRepository(db),
 		Settings:   repositories.NewSettingRepository(db),
 		AuditLogs:  repositories.NewAuditLogRepository(db),
+		Redirects:  repositories.NewSlugRedirectRepository(db),
+		Renditions: repositories.NewImageRenditionRepository(db),
+		Uploads:    repositories.NewUploadSessionRepository(db),
+		Blobs:      repositories.NewStoredBlobRepository(db),
+		FileRefs:   repositories.NewFileReferenceRepository(db),
+		Albums:     repositories.NewAlbumRepository(db),
+		Folders:    repositories.NewMediaFolderRepository(db),
+		Crops:      repositories.NewCropPresetRepository(db),
+		Focal:      repositories.NewFocalPointRepository(db),
+		Watermarks: repositories.NewWatermarkRepository(db),
+		Quarantine: repositories.NewQuarantineRepository(db),
 	}
 }
@@ -0,0 +1,151 @@
+// Package docindex extracts the text of uploaded documents in the background
+// and stores it, so that document search finds phrases inside the files.
+package docindex
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/doctext"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+)
+
+// batchSize caps the pending documents fetched at a time
+const batchSize = 50
+
+// Service extracts document text, one document at a time
+type Service struct {
+	repos *database.Repositories
+	store storage.Storage
+
+	mu      sync.Mutex
+	ctx     context.Context // background runs stop when it is cancelled
+	running bool
+	pending bool // more documents were queued while a run was going
+}
+
+func New(repos *database.Repositories, store storage.Storage) *Service {
+	return &Service{repos: repos, store: store, ctx: context.Background()}
+}
+
+// Bind runs background extraction under ctx from now on, so cancelling ctx
+// stops it
+func (s *Service) Bind(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ctx = ctx
+}
+
+// Queue marks a document for extraction and starts the background run
+func (s *Service) Queue(ctx context.Context, documentID int64) error {
+	if err := s.repos.DocTexts.MarkPending(ctx, documentID); err != nil {
+		return err
+	}
+	s.Schedule()
+	return nil
+}
+
+// Schedule works through the documents waiting for extraction in the
+// background. A call made during a run starts another one when that run
+// ends, so documents queued meanwhile are not missed.
+func (s *Service) Schedule() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		s.pending = true
+		return
+	}
+	s.running = true
+	go s.run(s.ctx)
+}
+
+func (s *Service) run(ctx context.Context) {
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.running = false
+		if s.pending {
+			s.pending = false
+			s.running = true
+			go s.run(s.ctx)
+		}
+	}()
+
+	if _, err := s.ExtractPending(ctx, nil); err != nil {
+		log.Printf("Document text extraction stopped: %v", err)
+	}
+}
+
+// ExtractPending extracts every document waiting for extraction, calling
+// done, if given, after each one. It returns how many were processed.
+func (s *Service) ExtractPending(ctx context.Context, done func(*models.DocumentText)) (int, error) {
+	count := 0
+	for {
+		ids, err := s.repos.DocTexts.ListPending(ctx, batchSize)
+		if err != nil {
+			return count, err
+		}
+		if len(ids) == 0 {
+			return count, nil
+		}
+		for _, id := range ids {
+			text, err := s.Extract(ctx, id)
+			if err != nil {
+				// The status could not be saved, so the document would
+				// come back as pending forever
+				return count, err
+			}
+			count++
+			if done != nil {
+				done(text)
+			}
+		}
+	}
+}
+
+// Extract extracts the text of a document's file and saves it. Files that
+// cannot be read are saved as failed, with the reason; the error is only
+// set when the outcome could not be saved.
+func (s *Service) Extract(ctx context.Context, documentID int64) (*models.DocumentText, error) {
+	text := &models.DocumentText{DocumentID: documentID}
+
+	doc, err := s.repos.Documents.GetByID(ctx, documentID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		text.Status, text.Error = repositories.TextFailed, "document not found"
+	case err != nil:
+		return nil, err
+	case !doctext.Supported(doc.MimeType):
+		text.Status = repositories.TextUnsupported
+	default:
+		content, err := s.extractFile(ctx, doc)
+		if err != nil {
+			text.Status, text.Error = repositories.TextFailed, err.Error()
+		} else {
+			text.Status, text.Content = repositories.TextDone, content
+		}
+	}
+
+	now := time.Now()
+	text.ExtractedAt = &now
+	if err := s.repos.DocTexts.Save(ctx, text); err != nil {
+		return nil, err
+	}
+	return text, nil
+}
+
+func (s *Service) extractFile(ctx context.Context, doc *models.Document) (string, error) {
+	obj, info, err := s.store.Get(ctx, storage.Key(doc.FilePath))
+	if err != nil {
+		return "", err
+	}
+	defer obj.Close()
+	return doctext.Extract(storage.ReaderAt(obj), info.Size, doc.MimeType)
+}
@@ -0,0 +1,116 @@
+// Package doctext extracts the plain text of uploaded PDF, DOCX and XLSX
+// documents so that their content can be searched. Extraction is best effort:
+// text set in fonts without a Unicode mapping, scanned pages and the like
+// come out empty.
+package doctext
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/thieugt95/portal-365/backend/internal/scan"
+)
+
+// ErrUnsupported is returned for document types text cannot be extracted from
+var ErrUnsupported = errors.New("unsupported document type")
+
+// MaxTextSize caps the extracted text of a single document, in bytes
+const MaxTextSize = 4 << 20
+
+// maxPDFSize caps the PDFs read into memory for extraction
+const maxPDFSize = 256 << 20
+
+// Extract returns the plain text of a document of the given MIME type, in
+// Unicode normalization form C
+func Extract(r io.ReaderAt, size int64, mimeType string) (string, error) {
+	var text string
+	var err error
+	switch mimeType {
+	case scan.MIMEPDF:
+		if size > maxPDFSize {
+			return "", fmt.Errorf("PDF too large for extraction: %d bytes", size)
+		}
+		data := make([]byte, size)
+		if _, err := r.ReadAt(data, 0); err != nil && err != io.EOF {
+			return "", err
+		}
+		text, err = extractPDF(data)
+	case scan.MIMEDOCX:
+		text, err = extractDOCX(r, size)
+	case scan.MIMEXLSX:
+		text, err = extractXLSX(r, size)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupported, mimeType)
+	}
+	if err != nil {
+		return "", err
+	}
+	return norm.NFC.String(text), nil
+}
+
+// Supported reports whether Extract handles the MIME type
+func Supported(mimeType string) bool {
+	switch mimeType {
+	case scan.MIMEPDF, scan.MIMEDOCX, scan.MIMEXLSX:
+		return true
+	}
+	return false
+}
+
+// textWriter collects extracted text, collapsing runs of whitespace into a
+// single space, line break or paragraph break and stopping at MaxTextSize
+type textWriter struct {
+	b     strings.Builder
+	pend  int // pending separator: 0 none, 1 space, 2 line break, 3 paragraph break
+	start bool
+}
+
+// WriteString appends text, turning its whitespace into separators
+func (w *textWriter) WriteString(s string) {
+	for _, r := range s {
+		switch {
+		case r == '\n' || r == '\r' || r == '\u2028':
+			w.separate(2)
+		case r == '\u2029':
+			w.separate(3)
+		case unicode.IsSpace(r):
+			w.separate(1)
+		case unicode.IsControl(r) || r == unicode.ReplacementChar || r == '\uFEFF':
+			// dropped: control characters and glyphs without a mapping
+		default:
+			if w.full() {
+				return
+			}
+			if w.start {
+				w.b.WriteString([]string{"", " ", "\n", "\n\n"}[w.pend])
+			}
+			w.pend = 0
+			w.start = true
+			w.b.WriteRune(r)
+		}
+	}
+}
+
+func (w *textWriter) separate(level int) {
+	if level > w.pend {
+		w.pend = level
+	}
+}
+
+func (w *textWriter) space()     { w.separate(1) }
+func (w *textWriter) newline()   { w.separate(2) }
+func (w *textWriter) paragraph() { w.separate(3) }
+
+// full reports whether the text has reached MaxTextSize
+func (w *textWriter) full() bool {
+	return w.b.Len() >= MaxTextSize
+}
+
+func (w *textWriter) String() string {
+	return w.b.String()
+}
@@ -0,0 +1,221 @@
+package doctext
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/thieugt95/portal-365/backend/internal/scan"
+)
+
+// pdfDocument lays out a one-page PDF showing content with a Helvetica font.
+// Streams given as compressed are Flate-encoded.
+func pdfDocument(t *testing.T, content string, compressed bool) []byte {
+	t.Helper()
+	stream, filter := []byte(content), ""
+	if compressed {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write(stream)
+		w.Close()
+		stream, filter = buf.Bytes(), " /Filter /FlateDecode"
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d%s >>\nstream\n%s\nendstream", len(stream), filter, stream),
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	buf.WriteString("trailer\n<< /Root 1 0 R /Size 6 >>\n%%EOF\n")
+	return buf.Bytes()
+}
+
+// ooxmlDocument zips the given parts into a package
+func ooxmlDocument(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range parts {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func wordDocument(body string) map[string]string {
+	return map[string]string{
+		"word/document.xml": `<?xml version="1.0"?><w:document xmlns:w="` + wordNamespace + `"><w:body>` + body + `</w:body></w:document>`,
+	}
+}
+
+func worksheet(rows string) string {
+	return `<?xml version="1.0"?><worksheet xmlns="` + excelNamespace + `"><sheetData>` + rows + `</sheetData></worksheet>`
+}
+
+func TestExtractPDF(t *testing.T) {
+	simple := pdfDocument(t, "BT /F1 12 Tf 72 720 Td (Hello world) Tj 0 -14 Td (Second line) Tj ET", false)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		{"simple", simple, "Hello world\nSecond line", false},
+		{"compressed content", pdfDocument(t, "BT /F1 12 Tf 72 720 Td (Compressed) Tj ET", true), "Compressed", false},
+		{"kerned words", pdfDocument(t, "BT /F1 12 Tf [(Quy) -20 (et) -400 (dinh)] TJ ET", false), "Quyet dinh", false},
+		{"escaped string", pdfDocument(t, `BT /F1 12 Tf (a \(b\) \\ c) Tj ET`, false), `a (b) \ c`, false},
+		{"no text", pdfDocument(t, "0 0 m 100 100 l S", false), "", false},
+		{"truncated", simple[:len(simple)/2], "", false},
+		{"not a pdf", []byte("<html>Hello</html>"), "", true},
+		{"empty", []byte{}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Extract(bytes.NewReader(tt.data), int64(len(tt.data)), scan.MIMEPDF)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractEncryptedPDF(t *testing.T) {
+	data := []byte("%PDF-1.4\n1 0 obj\n<< /Filter /Custom /V 1 >>\nendobj\ntrailer\n<< /Encrypt 1 0 R >>\n%%EOF")
+	if _, err := Extract(bytes.NewReader(data), int64(len(data)), scan.MIMEPDF); !errors.Is(err, ErrEncrypted) {
+		t.Fatalf("err = %v, want %v", err, ErrEncrypted)
+	}
+}
+
+func TestExtractDOCX(t *testing.T) {
+	valid := ooxmlDocument(t, wordDocument(`<w:p><w:r><w:t>Điều 1.</w:t></w:r><w:r><w:tab/><w:t>Phạm vi</w:t></w:r></w:p><w:p><w:r><w:t>Second</w:t></w:r></w:p>`))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		{"paragraphs", valid, "Điều 1. Phạm vi\nSecond", false},
+		{"deleted revision", ooxmlDocument(t, wordDocument(`<w:p><w:del><w:r><w:delText>old</w:delText></w:r></w:del><w:r><w:t>new</w:t></w:r></w:p>`)), "new", false},
+		{"field code", ooxmlDocument(t, wordDocument(`<w:p><w:r><w:instrText>PAGE</w:instrText></w:r><w:r><w:t>3</w:t></w:r></w:p>`)), "3", false},
+		{"decomposed to NFC", ooxmlDocument(t, wordDocument("<w:p><w:r><w:t>e\u0301</w:t></w:r></w:p>")), "\u00e9", false},
+		{"no body", ooxmlDocument(t, map[string]string{"[Content_Types].xml": "<Types/>"}), "", false},
+		{"malformed xml", ooxmlDocument(t, wordDocument(`<w:p><w:t>open`)), "", true},
+		{"truncated", valid[:len(valid)/2], "", true},
+		{"not a zip", []byte("not a zip at all"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Extract(bytes.NewReader(tt.data), int64(len(tt.data)), scan.MIMEDOCX)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractXLSX(t *testing.T) {
+	shared := `<?xml version="1.0"?><sst xmlns="` + excelNamespace + `">` +
+		`<si><t>Name</t></si><si><r><t>Rich </t></r><r><t>text</t></r></si><si><t>漢字</t><rPh><t>かんじ</t></rPh></si></sst>`
+	workbook := map[string]string{
+		"xl/sharedStrings.xml":      shared,
+		"xl/worksheets/sheet1.xml":  worksheet(`<row><c t="s"><v>0</v></c><c><v>42</v></c></row><row><c t="s"><v>1</v></c><c t="b"><v>1</v></c></row>`),
+		"xl/worksheets/sheet2.xml":  worksheet(`<row><c t="inlineStr"><is><t>Inline</t></is></c><c t="s"><v>2</v></c></row>`),
+		"xl/worksheets/sheet10.xml": worksheet(`<row><c t="s"><v>99</v></c><c t="e"><v>#REF!</v></c><c><v>last</v></c></row>`),
+	}
+	valid := ooxmlDocument(t, workbook)
+
+	broken := map[string]string{"xl/worksheets/sheet1.xml": worksheet(`<row><c><v>1</v>`)}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		{"sheets in order", valid, "Name 42\nRich text\n\nInline 漢字\n\nlast", false},
+		{"no shared strings", ooxmlDocument(t, map[string]string{"xl/worksheets/sheet1.xml": worksheet(`<row><c t="s"><v>0</v></c><c><v>7</v></c></row>`)}), "7", false},
+		{"malformed sheet", ooxmlDocument(t, broken), "", true},
+		{"truncated", valid[:len(valid)/3], "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Extract(bytes.NewReader(tt.data), int64(len(tt.data)), scan.MIMEXLSX)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractUnsupported(t *testing.T) {
+	if _, err := Extract(bytes.NewReader(nil), 0, scan.MIMEDOC); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("err = %v, want %v", err, ErrUnsupported)
+	}
+	if Supported(scan.MIMEDOC) || !Supported(scan.MIMEXLSX) {
+		t.Error("Supported disagrees with Extract")
+	}
+}
+
+func TestTextWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"collapses spaces", []string{"a  \t b"}, "a b"},
+		{"strongest separator wins", []string{"a \n \r\n b"}, "a\nb"},
+		{"paragraph separator", []string{"a\u2029\nb"}, "a\n\nb"},
+		{"trims leading and trailing", []string{"\n  a", "b  \n"}, "ab"},
+		{"drops control and replacement characters", []string{"a\x00\uFFFD\uFEFFb"}, "ab"},
+		{"across writes", []string{"a ", " b"}, "a b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &textWriter{}
+			for _, s := range tt.writes {
+				w.WriteString(s)
+			}
+			if got := w.String(); got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextWriterLimit(t *testing.T) {
+	w := &textWriter{}
+	chunk := strings.Repeat("x", 1<<20)
+	for i := 0; i < 6; i++ {
+		w.WriteString(chunk)
+	}
+	if !w.full() || w.b.Len() > MaxTextSize+1<<20 {
+		t.Fatalf("wrote %d bytes, want about %d", w.b.Len(), MaxTextSize)
+	}
+}
@@ -0,0 +1,237 @@
+package doctext
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxPartSize caps a single XML part read from a package
+const maxPartSize = 64 << 20
+
+const (
+	wordNamespace  = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	excelNamespace = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+)
+
+// ooxmlParts indexes the entries of an OOXML package by lower-cased name
+func ooxmlParts(r io.ReaderAt, size int64) (map[string]*zip.File, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	parts := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		parts[strings.ToLower(f.Name)] = f
+	}
+	return parts, nil
+}
+
+// readPart walks the XML tokens of a part. A missing part is not an error.
+func readPart(parts map[string]*zip.File, name string, visit func(xml.Token)) error {
+	f, ok := parts[name]
+	if !ok {
+		return nil
+	}
+	if f.UncompressedSize64 > maxPartSize {
+		return fmt.Errorf("%s is larger than %d MB", name, maxPartSize>>20)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	decoder := xml.NewDecoder(io.LimitReader(rc, maxPartSize))
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		visit(tok)
+	}
+}
+
+// extractDOCX returns the text of a Word document's body, one paragraph per
+// line. Deleted revisions and field codes are left out.
+func extractDOCX(r io.ReaderAt, size int64) (string, error) {
+	parts, err := ooxmlParts(r, size)
+	if err != nil {
+		return "", err
+	}
+	out := &textWriter{}
+	inText := false
+	err = readPart(parts, "word/document.xml", func(tok xml.Token) {
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space != wordNamespace {
+				return
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				out.space()
+			case "br", "cr":
+				out.newline()
+			}
+		case xml.EndElement:
+			if t.Name.Space != wordNamespace {
+				return
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				out.newline()
+			case "tc":
+				out.space()
+			}
+		case xml.CharData:
+			if inText && !out.full() {
+				out.WriteString(string(t))
+			}
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// extractXLSX returns the text of a workbook's cells, one row per line and
+// one sheet per paragraph
+func extractXLSX(r io.ReaderAt, size int64) (string, error) {
+	parts, err := ooxmlParts(r, size)
+	if err != nil {
+		return "", err
+	}
+
+	shared, err := sharedStrings(parts)
+	if err != nil {
+		return "", err
+	}
+
+	var sheets []string
+	for name := range parts {
+		if path.Dir(name) == "xl/worksheets" && strings.HasPrefix(path.Base(name), "sheet") && path.Ext(name) == ".xml" {
+			sheets = append(sheets, name)
+		}
+	}
+	// sheet2.xml before sheet10.xml
+	sort.Slice(sheets, func(i, j int) bool {
+		if len(sheets[i]) != len(sheets[j]) {
+			return len(sheets[i]) < len(sheets[j])
+		}
+		return sheets[i] < sheets[j]
+	})
+
+	out := &textWriter{}
+	for _, sheet := range sheets {
+		var cellType string
+		var value strings.Builder
+		inValue := false
+		err := readPart(parts, sheet, func(tok xml.Token) {
+			switch t := tok.(type) {
+			case xml.StartElement:
+				if t.Name.Space != excelNamespace {
+					return
+				}
+				switch t.Name.Local {
+				case "c":
+					cellType = ""
+					for _, attr := range t.Attr {
+						if attr.Name.Local == "t" {
+							cellType = attr.Value
+						}
+					}
+					value.Reset()
+				case "v", "t":
+					inValue = true
+				}
+			case xml.EndElement:
+				if t.Name.Space != excelNamespace {
+					return
+				}
+				switch t.Name.Local {
+				case "v", "t":
+					inValue = false
+				case "c":
+					text := value.String()
+					switch cellType {
+					case "s":
+						if i, err := strconv.Atoi(strings.TrimSpace(text)); err == nil && i >= 0 && i < len(shared) {
+							text = shared[i]
+						} else {
+							text = ""
+						}
+					case "b", "e":
+						// booleans and error values say nothing about the document
+						text = ""
+					}
+					if text != "" {
+						out.WriteString(text)
+						out.space()
+					}
+				case "row":
+					out.newline()
+				}
+			case xml.CharData:
+				if inValue && !out.full() {
+					value.Write(t)
+				}
+			}
+		})
+		if err != nil {
+			return "", err
+		}
+		out.paragraph()
+		if out.full() {
+			break
+		}
+	}
+	return out.String(), nil
+}
+
+// sharedStrings reads the shared string table of a workbook, leaving out
+// phonetic runs
+func sharedStrings(parts map[string]*zip.File) ([]string, error) {
+	var table []string
+	var item strings.Builder
+	inText, inPhonetic := false, false
+	err := readPart(parts, "xl/sharedstrings.xml", func(tok xml.Token) {
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				item.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				inPhonetic = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				table = append(table, item.String())
+			case "t":
+				inText = false
+			case "rPh":
+				inPhonetic = false
+			}
+		case xml.CharData:
+			if inText && !inPhonetic && item.Len() < MaxTextSize {
+				item.Write(t)
+			}
+		}
+	})
+	return table, err
+}
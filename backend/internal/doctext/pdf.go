@@ -0,0 +1,533 @@
+package doctext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// PDF objects. Numbers are float64, booleans bool and null nil.
+type (
+	pdfName   string
+	pdfString []byte
+	pdfArray  []interface{}
+	pdfDict   map[string]interface{}
+	pdfOp     string // a content stream operator or other bare keyword
+	pdfRef    struct{ num, gen int }
+	pdfStream struct {
+		dict pdfDict
+		raw  []byte
+		ref  pdfRef // the object holding the stream, for decryption
+	}
+)
+
+// maxStreamSize caps a decoded stream
+const maxStreamSize = 64 << 20
+
+var objHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// pdfFile holds the objects of a PDF, found by scanning the file rather than
+// trusting its cross-reference table, so damaged files still yield text
+type pdfFile struct {
+	data    []byte
+	objects map[int]interface{}
+	trailer pdfDict
+	crypt   *pdfCrypt
+}
+
+func openPDF(data []byte) (*pdfFile, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return nil, fmt.Errorf("not a PDF document")
+	}
+	f := &pdfFile{data: data, objects: make(map[int]interface{}), trailer: pdfDict{}}
+
+	// Later definitions win, as incremental updates append to the file
+	for _, m := range objHeader.FindAllSubmatchIndex(data, -1) {
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		gen, _ := strconv.Atoi(string(data[m[4]:m[5]]))
+		lex := &pdfLexer{data: data, pos: m[1]}
+		obj, err := lex.object()
+		if err != nil {
+			continue
+		}
+		if dict, ok := obj.(pdfDict); ok {
+			if raw, ok := lex.streamData(dict); ok {
+				obj = &pdfStream{dict: dict, raw: raw, ref: pdfRef{num, gen}}
+			}
+		}
+		f.objects[num] = obj
+	}
+
+	// Trailer dictionaries, and cross-reference streams that stand in for them
+	for _, i := range indexAll(data, []byte("trailer")) {
+		lex := &pdfLexer{data: data, pos: i + len("trailer")}
+		if dict, err := lex.object(); err == nil {
+			if d, ok := dict.(pdfDict); ok {
+				for k, v := range d {
+					f.trailer[k] = v
+				}
+			}
+		}
+	}
+	for _, obj := range f.objects {
+		if s, ok := obj.(*pdfStream); ok && s.dict["Type"] == pdfName("XRef") {
+			for _, key := range []string{"Root", "Encrypt", "ID"} {
+				if v, ok := s.dict[key]; ok {
+					if _, set := f.trailer[key]; !set {
+						f.trailer[key] = v
+					}
+				}
+			}
+		}
+	}
+
+	if enc, ok := f.resolve(f.trailer["Encrypt"]).(pdfDict); ok {
+		crypt, err := newPDFCrypt(enc, f.trailer["ID"])
+		if err != nil {
+			return nil, err
+		}
+		f.crypt = crypt
+	}
+
+	f.loadObjectStreams()
+	return f, nil
+}
+
+// loadObjectStreams adds the objects packed in object streams, without
+// replacing objects defined directly in the file
+func (f *pdfFile) loadObjectStreams() {
+	var streams []*pdfStream
+	for _, obj := range f.objects {
+		if s, ok := obj.(*pdfStream); ok && s.dict["Type"] == pdfName("ObjStm") {
+			streams = append(streams, s)
+		}
+	}
+	for _, s := range streams {
+		data, err := f.decode(s)
+		if err != nil {
+			continue
+		}
+		n, _ := f.resolve(s.dict["N"]).(float64)
+		first, _ := f.resolve(s.dict["First"]).(float64)
+		lex := &pdfLexer{data: data}
+		type entry struct{ num, off int }
+		entries := make([]entry, 0, int(n))
+		for i := 0; i < int(n); i++ {
+			num, err1 := lex.object()
+			off, err2 := lex.object()
+			numF, ok1 := num.(float64)
+			offF, ok2 := off.(float64)
+			if err1 != nil || err2 != nil || !ok1 || !ok2 {
+				break
+			}
+			entries = append(entries, entry{int(numF), int(offF)})
+		}
+		for _, e := range entries {
+			if _, exists := f.objects[e.num]; exists {
+				continue
+			}
+			pos := int(first) + e.off
+			if pos < 0 || pos >= len(data) {
+				continue
+			}
+			obj, err := (&pdfLexer{data: data, pos: pos}).object()
+			if err == nil {
+				f.objects[e.num] = obj
+			}
+		}
+	}
+}
+
+// resolve follows references to the object they point at
+func (f *pdfFile) resolve(obj interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = f.objects[ref.num]
+	}
+	return nil
+}
+
+// dict resolves obj as a dictionary, taking a stream's dictionary
+func (f *pdfFile) dict(obj interface{}) pdfDict {
+	switch v := f.resolve(obj).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+// decode decrypts a stream and undoes its filters
+func (f *pdfFile) decode(s *pdfStream) ([]byte, error) {
+	data := s.raw
+	if f.crypt != nil && s.dict["Type"] != pdfName("XRef") {
+		var err error
+		if data, err = f.crypt.decrypt(s.ref, data); err != nil {
+			return nil, err
+		}
+	}
+
+	var filters []interface{}
+	switch v := f.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []interface{}{v}
+	case pdfArray:
+		filters = v
+	}
+	for _, filter := range filters {
+		name, _ := f.resolve(filter).(pdfName)
+		var err error
+		switch name {
+		case "FlateDecode", "Fl":
+			data, err = inflate(data)
+		case "ASCIIHexDecode", "AHx":
+			data, err = asciiHexDecode(data)
+		case "ASCII85Decode", "A85":
+			data, err = ascii85Decode(data)
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// inflate decompresses zlib data, keeping what was read before any damage
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, maxStreamSize))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	digits := make([]byte, 0, len(data))
+	for _, b := range data {
+		if b == '>' {
+			break
+		}
+		if !isPDFSpace(b) {
+			digits = append(digits, b)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	_, err := hex.Decode(out, digits)
+	return out, err
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	out := make([]byte, 4*len(data)/5+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+func indexAll(data, sep []byte) []int {
+	var result []int
+	for off := 0; ; {
+		i := bytes.Index(data[off:], sep)
+		if i < 0 {
+			return result
+		}
+		result = append(result, off+i)
+		off += i + len(sep)
+	}
+}
+
+// pdfLexer reads PDF objects and content stream tokens
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(b byte) bool {
+	switch b {
+	case ' ', '\t', '\r', '\n', '\f', 0:
+		return true
+	}
+	return false
+}
+
+func isPDFDelimiter(b byte) bool {
+	switch b {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return isPDFSpace(b)
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch b := l.data[l.pos]; {
+		case isPDFSpace(b):
+			l.pos++
+		case b == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// errEnd is returned at the end of the data or of the enclosing object
+var errEnd = fmt.Errorf("end of PDF data")
+
+// token reads the next token: an object, or a delimiter such as "]" or ">>"
+// returned as a pdfOp
+func (l *pdfLexer) token() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errEnd
+	}
+	b := l.data[l.pos]
+	switch {
+	case b == '/':
+		start := l.pos + 1
+		l.pos++
+		for l.pos < len(l.data) && !isPDFDelimiter(l.data[l.pos]) {
+			l.pos++
+		}
+		return pdfName(decodeName(l.data[start:l.pos])), nil
+	case b == '(':
+		return l.literalString(), nil
+	case b == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		return pdfOp("<<"), nil
+	case b == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+		l.pos += 2
+		return pdfOp(">>"), nil
+	case b == '<':
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			l.pos = len(l.data)
+			return nil, errEnd
+		}
+		s, _ := asciiHexDecode(l.data[l.pos+1 : l.pos+end])
+		l.pos += end + 1
+		return pdfString(s), nil
+	case b == '[', b == ']', b == '{', b == '}':
+		l.pos++
+		return pdfOp(string(b)), nil
+	case b == ')' || b == '>':
+		l.pos++
+		return l.token()
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if n, err := strconv.ParseFloat(word, 64); err == nil {
+		return n, nil
+	}
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return pdfOp(word), nil
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++ // (
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		l.pos++
+		switch b {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				b = '\n'
+			case 'r':
+				b = '\r'
+			case 't':
+				b = '\t'
+			case 'b':
+				b = '\b'
+			case 'f':
+				b = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					b = byte(v)
+				} else {
+					b = e
+				}
+			}
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// object reads a complete object, combining "n g R" into a reference
+func (l *pdfLexer) object() (interface{}, error) {
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case pdfOp("<<"):
+		dict := pdfDict{}
+		for {
+			key, err := l.token()
+			if err != nil {
+				return dict, err
+			}
+			if key == pdfOp(">>") {
+				return dict, nil
+			}
+			name, ok := key.(pdfName)
+			if !ok {
+				continue
+			}
+			value, err := l.object()
+			if err != nil {
+				return dict, err
+			}
+			dict[string(name)] = value
+		}
+	case pdfOp("["):
+		arr := pdfArray{}
+		for {
+			save := l.pos
+			tok, err := l.token()
+			if err != nil {
+				return arr, err
+			}
+			if tok == pdfOp("]") {
+				return arr, nil
+			}
+			l.pos = save
+			value, err := l.object()
+			if err != nil {
+				return arr, err
+			}
+			arr = append(arr, value)
+		}
+	}
+
+	if num, ok := tok.(float64); ok {
+		save := l.pos
+		if gen, err := l.token(); err == nil {
+			if g, ok := gen.(float64); ok {
+				if r, err := l.token(); err == nil && r == pdfOp("R") {
+					return pdfRef{int(num), int(g)}, nil
+				}
+			}
+		}
+		l.pos = save
+	}
+	return tok, nil
+}
+
+// streamData returns the data of the stream following dict, if there is one
+func (l *pdfLexer) streamData(dict pdfDict) ([]byte, bool) {
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		return nil, false
+	}
+	start := l.pos + len("stream")
+	if start < len(l.data) && l.data[start] == '\r' {
+		start++
+	}
+	if start < len(l.data) && l.data[start] == '\n' {
+		start++
+	}
+
+	// Trust a direct /Length that lands on endstream, otherwise search for it
+	if n, ok := dict["Length"].(float64); ok && n >= 0 {
+		end := start + int(n)
+		if end <= len(l.data) {
+			rest := l.data[end:min(len(l.data), end+32)]
+			if bytes.Contains(rest, []byte("endstream")) {
+				return l.data[start:end], true
+			}
+		}
+	}
+	i := bytes.Index(l.data[start:], []byte("endstream"))
+	if i < 0 {
+		return nil, false
+	}
+	end := start + i
+	if end > start && l.data[end-1] == '\n' {
+		end--
+	}
+	if end > start && l.data[end-1] == '\r' {
+		end--
+	}
+	return l.data[start:end], true
+}
+
+// decodeName resolves the #xx escapes of a name
+func decodeName(raw []byte) string {
+	if bytes.IndexByte(raw, '#') < 0 {
+		return string(raw)
+	}
+	name := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if b, err := strconv.ParseUint(string(raw[i+1:i+3]), 16, 8); err == nil {
+				name = append(name, byte(b))
+				i += 2
+				continue
+			}
+		}
+		name = append(name, raw[i])
+	}
+	return string(name)
+}
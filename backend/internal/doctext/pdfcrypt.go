@@ -0,0 +1,155 @@
+package doctext
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrEncrypted is returned for PDFs that cannot be opened without a password
+var ErrEncrypted = errors.New("document is encrypted")
+
+// passwordPadding pads passwords in the standard security handler
+var passwordPadding = []byte{
+	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+// pdfCrypt decrypts the streams of a PDF protected by the standard security
+// handler with an empty user password, as is common for documents that only
+// restrict printing or copying. Revisions 2 to 4 (RC4 and AES-128) are
+// supported.
+type pdfCrypt struct {
+	key []byte
+	aes bool
+}
+
+func newPDFCrypt(enc pdfDict, ids interface{}) (*pdfCrypt, error) {
+	if enc["Filter"] != pdfName("Standard") {
+		return nil, ErrEncrypted
+	}
+	revision, _ := enc["R"].(float64)
+	if revision < 2 || revision > 4 {
+		return nil, ErrEncrypted
+	}
+	owner, _ := enc["O"].(pdfString)
+	user, _ := enc["U"].(pdfString)
+	perms, _ := enc["P"].(float64)
+	if len(owner) < 32 || len(user) < 16 {
+		return nil, ErrEncrypted
+	}
+
+	keyLength := 5
+	if revision >= 3 {
+		if bits, ok := enc["Length"].(float64); ok && int(bits)%8 == 0 && bits >= 40 && bits <= 128 {
+			keyLength = int(bits) / 8
+		} else {
+			keyLength = 16
+		}
+	}
+	useAES := false
+	if revision == 4 {
+		keyLength = 16
+		if cf, ok := enc["CF"].(pdfDict); ok {
+			if stdCF, ok := cf["StdCF"].(pdfDict); ok {
+				switch stdCF["CFM"] {
+				case pdfName("AESV2"):
+					useAES = true
+				case pdfName("AESV3"):
+					return nil, ErrEncrypted
+				}
+			}
+		}
+	}
+
+	var firstID []byte
+	if arr, ok := ids.(pdfArray); ok && len(arr) > 0 {
+		firstID, _ = arr[0].(pdfString)
+	}
+
+	// Algorithm 2 of the PDF specification with an empty password
+	hash := md5.New()
+	hash.Write(passwordPadding)
+	hash.Write(owner[:32])
+	p := make([]byte, 4)
+	binary.LittleEndian.PutUint32(p, uint32(int32(perms)))
+	hash.Write(p)
+	hash.Write(firstID)
+	if revision >= 4 {
+		if meta, ok := enc["EncryptMetadata"].(bool); ok && !meta {
+			hash.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+		}
+	}
+	key := hash.Sum(nil)
+	if revision >= 3 {
+		for i := 0; i < 50; i++ {
+			sum := md5.Sum(key[:keyLength])
+			key = sum[:]
+		}
+	}
+	key = key[:keyLength]
+
+	if !checkUserPassword(key, user, int(revision), firstID) {
+		return nil, ErrEncrypted
+	}
+	return &pdfCrypt{key: key, aes: useAES}, nil
+}
+
+// checkUserPassword confirms that the empty password opens the document
+// (algorithms 4 and 5)
+func checkUserPassword(key, user []byte, revision int, firstID []byte) bool {
+	if revision == 2 {
+		c, _ := rc4.NewCipher(key)
+		out := make([]byte, 32)
+		c.XORKeyStream(out, passwordPadding)
+		return string(out) == string(user[:32])
+	}
+	hash := md5.New()
+	hash.Write(passwordPadding)
+	hash.Write(firstID)
+	out := hash.Sum(nil)
+	for i := 0; i < 20; i++ {
+		k := make([]byte, len(key))
+		for j := range key {
+			k[j] = key[j] ^ byte(i)
+		}
+		c, _ := rc4.NewCipher(k)
+		c.XORKeyStream(out, out)
+	}
+	return string(out[:16]) == string(user[:16])
+}
+
+// decrypt decrypts the data of the given object
+func (c *pdfCrypt) decrypt(ref pdfRef, data []byte) ([]byte, error) {
+	hash := md5.New()
+	hash.Write(c.key)
+	hash.Write([]byte{byte(ref.num), byte(ref.num >> 8), byte(ref.num >> 16), byte(ref.gen), byte(ref.gen >> 8)})
+	if c.aes {
+		hash.Write([]byte("sAlT"))
+	}
+	key := hash.Sum(nil)[:min(len(c.key)+5, 16)]
+
+	if !c.aes {
+		rc, _ := rc4.NewCipher(key)
+		out := make([]byte, len(data))
+		rc.XORKeyStream(out, data)
+		return out, nil
+	}
+
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("malformed AES stream")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(out, data[aes.BlockSize:])
+	if pad := int(out[len(out)-1]); pad >= 1 && pad <= aes.BlockSize {
+		out = out[:len(out)-pad]
+	}
+	return out, nil
+}
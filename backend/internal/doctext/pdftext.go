@@ -0,0 +1,627 @@
+package doctext
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxFormDepth bounds form XObjects drawn inside one another
+const maxFormDepth = 8
+
+// extractPDF returns the text of a PDF, page by page
+func extractPDF(data []byte) (string, error) {
+	f, err := openPDF(data)
+	if err != nil {
+		return "", err
+	}
+	out := &textWriter{}
+	fonts := make(map[pdfRef]*pdfFont)
+	for _, page := range f.pages() {
+		x := &pdfText{file: f, out: out, fonts: fonts}
+		x.draw(page.contents, page.resources, 0)
+		out.paragraph()
+		if out.full() {
+			break
+		}
+	}
+	return out.String(), nil
+}
+
+type pdfPage struct {
+	contents  [][]byte
+	resources pdfDict
+}
+
+// pages lists the pages in document order through the page tree, falling
+// back to every page object for files whose tree is damaged
+func (f *pdfFile) pages() []pdfPage {
+	var pages []pdfPage
+	seen := make(map[int]bool)
+	var walk func(ref interface{}, inherited pdfDict, depth int)
+	walk = func(ref interface{}, inherited pdfDict, depth int) {
+		if r, ok := ref.(pdfRef); ok {
+			if seen[r.num] {
+				return
+			}
+			seen[r.num] = true
+		}
+		node := f.dict(ref)
+		if node == nil || depth > 64 {
+			return
+		}
+		resources := inherited
+		if res := f.dict(node["Resources"]); res != nil {
+			resources = res
+		}
+		if kids, ok := f.resolve(node["Kids"]).(pdfArray); ok {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+			return
+		}
+		pages = append(pages, pdfPage{contents: f.contents(node["Contents"]), resources: resources})
+	}
+
+	if root := f.dict(f.trailer["Root"]); root != nil {
+		walk(root["Pages"], nil, 0)
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	nums := make([]int, 0)
+	for num, obj := range f.objects {
+		if d, ok := obj.(pdfDict); ok && d["Type"] == pdfName("Page") {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		page := f.objects[num].(pdfDict)
+		pages = append(pages, pdfPage{contents: f.contents(page["Contents"]), resources: f.dict(page["Resources"])})
+	}
+	return pages
+}
+
+// contents decodes a page's content streams
+func (f *pdfFile) contents(obj interface{}) [][]byte {
+	var refs []interface{}
+	switch v := f.resolve(obj).(type) {
+	case *pdfStream:
+		refs = []interface{}{v}
+	case pdfArray:
+		refs = v
+	}
+	var result [][]byte
+	for _, ref := range refs {
+		if s, ok := f.resolve(ref).(*pdfStream); ok {
+			if data, err := f.decode(s); err == nil {
+				result = append(result, data)
+			}
+		}
+	}
+	return result
+}
+
+// pdfText interprets content streams, writing the text they show. Glyph
+// positions are tracked from the font widths to tell word gaps, and lines,
+// from glyphs that are merely placed one by one.
+type pdfText struct {
+	file  *pdfFile
+	out   *textWriter
+	fonts map[pdfRef]*pdfFont
+
+	font     *pdfFont
+	fontSize float64
+	scale    float64 // of the text matrix, from text space to user space
+	lineX    float64 // start of the current line
+	lineY    float64
+	x        float64 // end of the last glyph shown
+}
+
+// wordGap is the gap, in ems, above which glyphs belong to different words
+const wordGap = 0.15
+
+func (x *pdfText) draw(contents [][]byte, resources pdfDict, depth int) {
+	fonts := x.file.dict(resources["Font"])
+	xobjects := x.file.dict(resources["XObject"])
+
+	for _, content := range contents {
+		lex := &pdfLexer{data: content}
+		var operands []interface{}
+		num := func(i int) float64 {
+			if i < len(operands) {
+				n, _ := operands[i].(float64)
+				return n
+			}
+			return 0
+		}
+		for {
+			obj, err := lex.object()
+			if err != nil {
+				break
+			}
+			op, isOp := obj.(pdfOp)
+			if !isOp {
+				operands = append(operands, obj)
+				continue
+			}
+			switch op {
+			case "BI":
+				lex.skipInlineImage()
+			case "BT":
+				x.scale, x.lineX, x.lineY, x.x = 1, 0, 0, 0
+			case "Tf":
+				if len(operands) >= 2 {
+					if name, ok := operands[0].(pdfName); ok {
+						x.font = x.loadFont(fonts[string(name)])
+					}
+					x.fontSize = num(1)
+				}
+			case "Td", "TD":
+				if len(operands) >= 2 {
+					x.moveTo(x.lineX+num(0)*x.scale, x.lineY+num(1)*x.scale)
+				}
+			case "Tm":
+				if len(operands) >= 6 {
+					if scale := math.Hypot(num(0), num(1)); scale > 0 {
+						x.scale = scale
+					}
+					x.moveTo(num(4), num(5))
+				}
+			case "T*":
+				x.out.newline()
+				x.x = x.lineX
+			case "Tj":
+				if len(operands) >= 1 {
+					x.show(operands[0])
+				}
+			case "'", "\"":
+				x.out.newline()
+				x.x = x.lineX
+				if len(operands) >= 1 {
+					x.show(operands[len(operands)-1])
+				}
+			case "TJ":
+				if len(operands) >= 1 {
+					if arr, ok := operands[0].(pdfArray); ok {
+						for _, item := range arr {
+							if n, ok := item.(float64); ok {
+								x.advance(-n / 1000)
+								continue
+							}
+							x.show(item)
+						}
+					}
+				}
+			case "Do":
+				if depth < maxFormDepth && len(operands) >= 1 {
+					if name, ok := operands[0].(pdfName); ok {
+						x.drawForm(xobjects[string(name)], resources, depth)
+					}
+				}
+			}
+			operands = operands[:0]
+			if x.out.full() {
+				return
+			}
+		}
+	}
+}
+
+// moveTo starts a line at (lineX, lineY), breaking the text when it moves
+// to another line and separating words when it leaves a gap
+func (x *pdfText) moveTo(lineX, lineY float64) {
+	em := x.fontSize * x.scale
+	if em <= 0 {
+		em = 1
+	}
+	if math.Abs(lineY-x.lineY) > em/2 {
+		x.out.newline()
+	} else if gap := lineX - x.x; gap > wordGap*em || gap < -em {
+		x.out.space()
+	}
+	x.lineX, x.lineY, x.x = lineX, lineY, lineX
+}
+
+// advance moves the glyph position by ems of the current font, separating
+// words when a TJ adjustment opens a gap
+func (x *pdfText) advance(ems float64) {
+	if ems > wordGap {
+		x.out.space()
+	}
+	x.x += ems * x.fontSize * x.scale
+}
+
+// drawForm draws a form XObject with its own resources, if it has any
+func (x *pdfText) drawForm(obj interface{}, resources pdfDict, depth int) {
+	form, ok := x.file.resolve(obj).(*pdfStream)
+	if !ok || form.dict["Subtype"] != pdfName("Form") {
+		return
+	}
+	data, err := x.file.decode(form)
+	if err != nil {
+		return
+	}
+	if own := x.file.dict(form.dict["Resources"]); own != nil {
+		resources = own
+	}
+	font := x.font
+	x.draw([][]byte{data}, resources, depth+1)
+	x.font = font
+}
+
+func (x *pdfText) show(obj interface{}) {
+	str, ok := obj.(pdfString)
+	if !ok || x.font == nil {
+		return
+	}
+	text, width := x.font.decode(str)
+	x.out.WriteString(text)
+	x.x += width * x.fontSize * x.scale
+}
+
+func (lex *pdfLexer) skipInlineImage() {
+	i := bytes.Index(lex.data[lex.pos:], []byte("ID"))
+	if i < 0 {
+		lex.pos = len(lex.data)
+		return
+	}
+	lex.pos += i + 3
+	for lex.pos < len(lex.data) {
+		j := bytes.Index(lex.data[lex.pos:], []byte("EI"))
+		if j < 0 {
+			lex.pos = len(lex.data)
+			return
+		}
+		end := lex.pos + j
+		lex.pos = end + 2
+		if end > 0 && isPDFSpace(lex.data[end-1]) && (lex.pos >= len(lex.data) || isPDFDelimiter(lex.data[lex.pos])) {
+			return
+		}
+	}
+}
+
+// pdfFont maps the character codes of a font to text and glyph widths
+type pdfFont struct {
+	codeLength   int               // bytes per code, for fonts without a ToUnicode map
+	toUnicode    map[string]string // code bytes to text
+	codeSizes    []int             // code lengths used by the ToUnicode map, longest first
+	simple       [256]rune         // single byte encoding of simple fonts
+	mapped       bool              // whether text can be read from the font at all
+	widths       map[uint32]float64
+	defaultWidth float64 // in ems
+}
+
+// loadFont reads a font resource, once per document for shared fonts
+func (x *pdfText) loadFont(obj interface{}) *pdfFont {
+	ref, isRef := obj.(pdfRef)
+	if cached, ok := x.fonts[ref]; isRef && ok {
+		return cached
+	}
+	dict := x.file.dict(obj)
+	if dict == nil {
+		return nil
+	}
+	font := &pdfFont{codeLength: 1, mapped: true, widths: make(map[uint32]float64), defaultWidth: 0.5}
+	if isRef {
+		x.fonts[ref] = font
+	}
+
+	subtype, _ := x.file.resolve(dict["Subtype"]).(pdfName)
+	if subtype == "Type0" {
+		font.codeLength = 2
+		font.defaultWidth = 1
+		x.cidWidths(font, dict)
+	} else {
+		x.simpleWidths(font, dict)
+	}
+
+	if s, ok := x.file.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := x.file.decode(s); err == nil {
+			font.parseCMap(data)
+		}
+		if len(font.toUnicode) > 0 {
+			return font
+		}
+	}
+
+	if subtype == "Type0" {
+		// CIDs without a ToUnicode map only name glyphs
+		font.mapped = false
+		return font
+	}
+	font.simple = winAnsi
+	switch enc := x.file.resolve(dict["Encoding"]).(type) {
+	case pdfName:
+		if enc == "MacRomanEncoding" {
+			font.simple = macRoman
+		}
+	case pdfDict:
+		if base, ok := x.file.resolve(enc["BaseEncoding"]).(pdfName); ok && base == "MacRomanEncoding" {
+			font.simple = macRoman
+		}
+		if diffs, ok := x.file.resolve(enc["Differences"]).(pdfArray); ok {
+			code := 0
+			for _, item := range diffs {
+				switch v := x.file.resolve(item).(type) {
+				case float64:
+					code = int(v)
+				case pdfName:
+					if code >= 0 && code < 256 {
+						if r := glyphRune(string(v)); r != 0 {
+							font.simple[code] = r
+						}
+					}
+					code++
+				}
+			}
+		}
+	}
+	return font
+}
+
+// simpleWidths reads the Widths of a single byte font
+func (x *pdfText) simpleWidths(font *pdfFont, dict pdfDict) {
+	first, _ := x.file.resolve(dict["FirstChar"]).(float64)
+	widths, _ := x.file.resolve(dict["Widths"]).(pdfArray)
+	for i, w := range widths {
+		if n, ok := x.file.resolve(w).(float64); ok {
+			font.widths[uint32(int(first)+i)] = n / 1000
+		}
+	}
+}
+
+// cidWidths reads the W array of a composite font's descendant, in which
+// "c [w1 w2 ...]" gives widths from c on and "c1 c2 w" one width for a range
+func (x *pdfText) cidWidths(font *pdfFont, dict pdfDict) {
+	descendants, _ := x.file.resolve(dict["DescendantFonts"]).(pdfArray)
+	if len(descendants) == 0 {
+		return
+	}
+	cid := x.file.dict(descendants[0])
+	if cid == nil {
+		return
+	}
+	if dw, ok := x.file.resolve(cid["DW"]).(float64); ok {
+		font.defaultWidth = dw / 1000
+	}
+	w, _ := x.file.resolve(cid["W"]).(pdfArray)
+	for i := 0; i < len(w); {
+		first, ok := x.file.resolve(w[i]).(float64)
+		if !ok || i+1 >= len(w) {
+			return
+		}
+		if list, ok := x.file.resolve(w[i+1]).(pdfArray); ok {
+			for j, item := range list {
+				if n, ok := x.file.resolve(item).(float64); ok {
+					font.widths[uint32(int(first)+j)] = n / 1000
+				}
+			}
+			i += 2
+			continue
+		}
+		last, ok1 := x.file.resolve(w[i+1]).(float64)
+		if i+2 >= len(w) || !ok1 || last < first || last-first > 0xFFFF {
+			return
+		}
+		if n, ok := x.file.resolve(w[i+2]).(float64); ok {
+			for c := int(first); c <= int(last); c++ {
+				font.widths[uint32(c)] = n / 1000
+			}
+		}
+		i += 3
+	}
+}
+
+func (font *pdfFont) width(code uint32) float64 {
+	if w, ok := font.widths[code]; ok {
+		return w
+	}
+	return font.defaultWidth
+}
+
+// decode returns the text of a string shown in the font and its width in ems
+func (font *pdfFont) decode(s []byte) (string, float64) {
+	var b strings.Builder
+	var width float64
+	if len(font.toUnicode) > 0 || !font.mapped {
+		for i := 0; i < len(s); {
+			n := font.codeLength
+			for _, size := range font.codeSizes {
+				if i+size <= len(s) {
+					if text, ok := font.toUnicode[string(s[i:i+size])]; ok {
+						b.WriteString(text)
+						n = size
+						break
+					}
+				}
+			}
+			if i+n > len(s) {
+				n = len(s) - i
+			}
+			width += font.width(codeValue(s[i : i+n]))
+			i += n
+		}
+		return b.String(), width
+	}
+	for _, c := range s {
+		if r := font.simple[c]; r != 0 {
+			b.WriteRune(r)
+		}
+		width += font.width(uint32(c))
+	}
+	return b.String(), width
+}
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap
+func (font *pdfFont) parseCMap(data []byte) {
+	font.toUnicode = make(map[string]string)
+	sizes := make(map[int]bool)
+	lex := &pdfLexer{data: data}
+	var operands []interface{}
+	for {
+		obj, err := lex.object()
+		if err != nil {
+			break
+		}
+		op, isOp := obj.(pdfOp)
+		if !isOp {
+			operands = append(operands, obj)
+			continue
+		}
+		switch op {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				if lo, ok := operands[i].(pdfString); ok {
+					sizes[len(lo)] = true
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					font.toUnicode[string(src)] = utf16BE(dst)
+					sizes[len(src)] = true
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				sizes[len(lo)] = true
+				start, end := codeValue(lo), codeValue(hi)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					base := []byte(dst)
+					for code := start; code <= end; code++ {
+						font.toUnicode[codeBytes(code, len(lo))] = utf16BE(offsetLast(base, int(code-start)))
+					}
+				case pdfArray:
+					for j, item := range dst {
+						if s, ok := item.(pdfString); ok && start+uint32(j) <= end {
+							font.toUnicode[codeBytes(start+uint32(j), len(lo))] = utf16BE(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	for n := range sizes {
+		font.codeSizes = append(font.codeSizes, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(font.codeSizes)))
+	if len(font.codeSizes) > 0 {
+		font.codeLength = font.codeSizes[len(font.codeSizes)-1]
+	}
+}
+
+func codeValue(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func codeBytes(v uint32, n int) string {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return string(b)
+}
+
+// offsetLast adds n to the last UTF-16 unit of a bfrange destination
+func offsetLast(base []byte, n int) []byte {
+	out := append([]byte(nil), base...)
+	if len(out) >= 2 {
+		last := binary.BigEndian.Uint16(out[len(out)-2:]) + uint16(n)
+		binary.BigEndian.PutUint16(out[len(out)-2:], last)
+	}
+	return out
+}
+
+func utf16BE(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, binary.BigEndian.Uint16(b[i:]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// glyphRune maps the glyph names used in encoding differences to characters
+func glyphRune(name string) rune {
+	if r, ok := glyphNames[name]; ok {
+		return r
+	}
+	if len(name) == 1 {
+		return rune(name[0])
+	}
+	for _, prefix := range []string{"uni", "u"} {
+		if strings.HasPrefix(name, prefix) && len(name) >= len(prefix)+4 {
+			if v, err := strconv.ParseUint(name[len(prefix):len(prefix)+4], 16, 32); err == nil {
+				return rune(v)
+			}
+		}
+	}
+	return 0
+}
+
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$', "percent": '%',
+	"ampersand": '&', "quotesingle": '\'', "quoteright": '’', "quoteleft": '‘', "parenleft": '(',
+	"parenright": ')', "asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-', "period": '.',
+	"slash": '/', "zero": '0', "one": '1', "two": '2', "three": '3', "four": '4', "five": '5',
+	"six": '6', "seven": '7', "eight": '8', "nine": '9', "colon": ':', "semicolon": ';',
+	"less": '<', "equal": '=', "greater": '>', "question": '?', "at": '@', "bracketleft": '[',
+	"backslash": '\\', "bracketright": ']', "underscore": '_', "braceleft": '{', "bar": '|',
+	"braceright": '}', "endash": '–', "emdash": '—', "quotedblleft": '“', "quotedblright": '”',
+	"bullet": '•', "ellipsis": '…', "degree": '°', "section": '§', "nbspace": ' ',
+	"dcroat": 'đ', "Dcroat": 'Đ',
+}
+
+// winAnsi is WinAnsiEncoding, close enough to StandardEncoding for search
+var winAnsi = func() [256]rune {
+	var t [256]rune
+	for i := 32; i < 256; i++ {
+		t[i] = rune(i)
+	}
+	t['\t'], t['\n'], t['\r'] = ' ', ' ', ' '
+	extra := map[int]rune{
+		0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡', 0x88: 'ˆ',
+		0x89: '‰', 0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ', 0x8E: 'Ž', 0x91: '‘', 0x92: '’', 0x93: '“',
+		0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x98: '˜', 0x99: '™', 0x9A: 'š', 0x9B: '›',
+		0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ', 0xA0: ' ',
+	}
+	for i := 0x80; i < 0xA0; i++ {
+		t[i] = 0
+	}
+	for code, r := range extra {
+		t[code] = r
+	}
+	return t
+}()
+
+// macRoman keeps ASCII and drops the rest, which Vietnamese text never uses
+var macRoman = func() [256]rune {
+	var t [256]rune
+	for i := 32; i < 127; i++ {
+		t[i] = rune(i)
+	}
+	return t
+}()
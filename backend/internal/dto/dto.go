@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"strings"
 	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/models"
 )
 
 // FlexibleTime handles multiple datetime formats from frontend
@@ -151,12 +153,35 @@ type UpdateCategoryRequest struct {
 	IsActive    bool   `json:"is_active"`
 }
 
+// MergeCategoryRequest moves everything from the category in the path into TargetID
+type MergeCategoryRequest struct {
+	TargetID int64 `json:"target_id" binding:"required"`
+}
+
 // Tag
 type CreateTagRequest struct {
 	Name string `json:"name" binding:"required"`
 	Slug string `json:"slug" binding:"required"`
 }
 
+type UpdateTagRequest struct {
+	Name string `json:"name" binding:"required"`
+	Slug string `json:"slug"` // Auto-generated from name if empty
+}
+
+type MergeTagRequest struct {
+	TargetID int64 `json:"target_id" binding:"required"`
+}
+
+// TagCloudItem is a tag with its published article count and a display weight from 1 (rare) to 5 (popular)
+type TagCloudItem struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Slug         string `json:"slug"`
+	ArticleCount int    `json:"article_count"`
+	Weight       int    `json:"weight"`
+}
+
 // Article
 type CreateArticleRequest struct {
 	Title         string        `json:"title" binding:"required"`
@@ -166,6 +191,7 @@ type CreateArticleRequest struct {
 	FeaturedImage string        `json:"featured_image"`
 	CategoryID    int64         `json:"category_id" binding:"required"`
 	TagIDs        []int64       `json:"tag_ids"`
+	TagNames      []string      `json:"tag_names"` // Created on the fly if no tag matches
 	IsFeatured    bool          `json:"is_featured"`
 	ScheduledAt   *FlexibleTime `json:"scheduled_at"`
 }
@@ -178,30 +204,186 @@ type UpdateArticleRequest struct {
 	FeaturedImage string        `json:"featured_image"`
 	CategoryID    int64         `json:"category_id" binding:"required"`
 	TagIDs        []int64       `json:"tag_ids"`
+	TagNames      []string      `json:"tag_names"` // Created on the fly if no tag matches
 	IsFeatured    bool          `json:"is_featured"`
 	ScheduledAt   *FlexibleTime `json:"scheduled_at"`
 }
 
+type SuggestMetadataRequest struct {
+	Title   string `json:"title" binding:"required"`
+	Content string `json:"content"`
+	Limit   int    `json:"limit"` // Maximum tag suggestions, default 10
+}
+
+// TagSuggestion is either an existing tag (TagID set) or a new keyword found in the text
+type TagSuggestion struct {
+	TagID    *int64  `json:"tag_id,omitempty"`
+	Name     string  `json:"name"`
+	Slug     string  `json:"slug"`
+	Score    float64 `json:"score"` // Relative to the best suggestion of the same kind, 0..1
+	Existing bool    `json:"existing"`
+}
+
+type CategorySuggestion struct {
+	ID          int64   `json:"id"`
+	Name        string  `json:"name"`
+	Slug        string  `json:"slug"`
+	Probability float64 `json:"probability"`
+}
+
+type SuggestMetadataResponse struct {
+	Tags                  []TagSuggestion      `json:"tags"`
+	Category              *CategorySuggestion  `json:"category"`
+	AlternativeCategories []CategorySuggestion `json:"alternative_categories"`
+}
+
 type ArticleResponse struct {
-	ID            int64             `json:"id"`
-	Title         string            `json:"title"`
-	Slug          string            `json:"slug"`
-	Summary       string            `json:"summary"`
-	Content       string            `json:"content"`
-	FeaturedImage string            `json:"featured_image"`
-	AuthorID      int64             `json:"author_id"`
-	AuthorName    string            `json:"author_name,omitempty"`
-	CategoryID    int64             `json:"category_id"`
-	CategoryName  string            `json:"category_name,omitempty"`
-	Category      *CategoryResponse `json:"category,omitempty"` // Full category object with parent info
-	Status        string            `json:"status"`
-	ViewCount     int64             `json:"view_count"`
-	IsFeatured    bool              `json:"is_featured"`
-	Tags          []TagResponse     `json:"tags,omitempty"` // Full tag objects
-	PublishedAt   *time.Time        `json:"published_at"`
-	ScheduledAt   *time.Time        `json:"scheduled_at"`
-	CreatedAt     time.Time         `json:"created_at"`
-	UpdatedAt     time.Time         `json:"updated_at"`
+	ID               int64              `json:"id"`
+	Title            string             `json:"title"`
+	Slug             string             `json:"slug"`
+	Summary          string             `json:"summary"`
+	Content          string             `json:"content"`
+	FeaturedImage    string             `json:"featured_image"`
+	FeaturedImageSet *ResponsiveImage   `json:"featured_image_set,omitempty"`
+	FeaturedCrops    map[string]string  `json:"featured_crops,omitempty"` // Featured image cropped around its focal point, by crop preset name
+	ContentImages    []*ResponsiveImage `json:"content_images,omitempty"` // Renditions of images in the content, matched by src
+	Albums           []*AlbumResponse   `json:"albums,omitempty"`         // Published albums embedded in the content with data-album="slug"
+	AuthorID         int64              `json:"author_id"`
+	AuthorName       string             `json:"author_name,omitempty"`
+	CategoryID       int64              `json:"category_id"`
+	CategoryName     string             `json:"category_name,omitempty"`
+	Category         *CategoryResponse  `json:"category,omitempty"` // Full category object with parent info
+	Status           string             `json:"status"`
+	ViewCount        int64              `json:"view_count"`
+	IsFeatured       bool               `json:"is_featured"`
+	Tags             []TagResponse      `json:"tags,omitempty"` // Full tag objects
+	Breadcrumbs      []Breadcrumb       `json:"breadcrumbs,omitempty"`
+	PublishedAt      *time.Time         `json:"published_at"`
+	ScheduledAt      *time.Time         `json:"scheduled_at"`
+	CreatedAt        time.Time          `json:"created_at"`
+	UpdatedAt        time.Time          `json:"updated_at"`
+}
+
+// Breadcrumb is one step of the navigation path to a piece of content, root first.
+// Type is category, group, article, document, media or page; groups have no ID.
+type Breadcrumb struct {
+	Type string `json:"type"`
+	ID   int64  `json:"id,omitempty"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// CategoryDetailResponse is a category with its navigation path
+type CategoryDetailResponse struct {
+	*models.Category
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs"`
+}
+
+// DocumentUploadResponse is an uploaded document. Duplicate marks an upload
+// answered with the existing document holding the same content.
+type DocumentUploadResponse struct {
+	*models.Document
+	Duplicate bool `json:"duplicate,omitempty"`
+}
+
+// DocumentListResponse is a page of documents with the facet counts of the
+// documents matching the filters
+type DocumentListResponse struct {
+	Data       []models.Document      `json:"data"`
+	Pagination *PaginationResponse    `json:"pagination"`
+	Facets     *models.DocumentFacets `json:"facets"`
+}
+
+// DocumentTermRequest creates or renames an entry of a document vocabulary.
+// Kind is ignored on update.
+type DocumentTermRequest struct {
+	Kind      string `json:"kind" binding:"omitempty,oneof=type authority signer"`
+	Name      string `json:"name" binding:"required,max=200"`
+	SortOrder int    `json:"sort_order"`
+}
+
+// DocumentRelationRequest relates a document to another: the document
+// amends, replaces, guides or references the related one
+type DocumentRelationRequest struct {
+	RelatedID int64  `json:"related_id" binding:"required"`
+	Type      string `json:"type" binding:"required,oneof=amends replaces guides references"`
+}
+
+// DocumentDetailResponse is a document with its navigation path, its
+// version history, newest first, the documents it is related to and the
+// graph of documents reachable through relations
+type DocumentDetailResponse struct {
+	*models.Document
+	Versions    []models.DocumentVersion `json:"versions"`
+	Related     []models.RelatedDocument `json:"related"`
+	Graph       *models.DocumentGraph    `json:"graph"`
+	Breadcrumbs []Breadcrumb             `json:"breadcrumbs"`
+}
+
+// DocumentVersionUploadResponse is a document after a new version of its
+// file was uploaded, along with that version
+type DocumentVersionUploadResponse struct {
+	Document *models.Document        `json:"document"`
+	Version  *models.DocumentVersion `json:"version"`
+}
+
+// MediaItemResponse is a media item with its image renditions and, on detail
+// responses, its navigation path or (for admins) where its file is used.
+// DuplicateOf is set on an upload answered with the existing item that
+// already holds the same content.
+type MediaItemResponse struct {
+	*models.MediaItem
+	Image       *ResponsiveImage        `json:"image,omitempty"`
+	Breadcrumbs []Breadcrumb            `json:"breadcrumbs,omitempty"`
+	UsedIn      []*models.FileReference `json:"used_in,omitempty"`
+	DuplicateOf *MediaItemRef           `json:"duplicate_of,omitempty"`
+}
+
+// MediaItemRef identifies a media item
+type MediaItemRef struct {
+	ID   int64  `json:"id"`
+	Slug string `json:"slug"`
+}
+
+// AlbumResponse is an album with its cover image and, on detail responses,
+// its items in order
+type AlbumResponse struct {
+	*models.Album
+	CoverImage *ResponsiveImage     `json:"cover_image,omitempty"`
+	Items      []*AlbumItemResponse `json:"items,omitempty"`
+}
+
+// AlbumItemResponse is an album item with the renditions of its image
+type AlbumItemResponse struct {
+	*models.AlbumItem
+	Image *ResponsiveImage `json:"image,omitempty"`
+}
+
+// ImageRenditionResponse is one candidate of a responsive image
+type ImageRenditionResponse struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"` // MIME type, for <source type="...">
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// ResponsiveImage lists the renditions of an uploaded image. Srcset holds the
+// JPEG/PNG renditions and the original; WebPSrcset is meant for a <picture>
+// <source type="image/webp"> and falls back per width where no WebP exists.
+type ResponsiveImage struct {
+	Src        string                   `json:"src"`
+	Width      int                      `json:"width"`
+	Height     int                      `json:"height"`
+	Srcset     string                   `json:"srcset"`
+	WebPSrcset string                   `json:"webp_srcset,omitempty"`
+	Renditions []ImageRenditionResponse `json:"renditions"`
+}
+
+// PageDetailResponse is a page with its navigation path
+type PageDetailResponse struct {
+	*models.Page
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs"`
 }
 
 type CategoryResponse struct {
@@ -265,6 +447,44 @@ type UpdateIntroPageRequest struct {
 	SeoDescription *string `json:"seo_description"`
 }
 
+// Album
+type CreateAlbumRequest struct {
+	Title       string `json:"title" binding:"required"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
+	Status      string `json:"status" binding:"omitempty,oneof=draft published"`
+}
+
+// UpdateAlbumRequest changes the given fields. The cover must be an item of
+// the album; 0 clears it so the first item is shown.
+type UpdateAlbumRequest struct {
+	Title        *string `json:"title"`
+	Slug         *string `json:"slug"`
+	Description  *string `json:"description"`
+	Status       *string `json:"status" binding:"omitempty,oneof=draft published"`
+	CoverMediaID *int64  `json:"cover_media_id"`
+}
+
+type AlbumItemInput struct {
+	MediaItemID int64  `json:"media_item_id" binding:"required"`
+	Caption     string `json:"caption"`
+}
+
+// AddAlbumItemsRequest appends media items to an album: listed items first,
+// then the items created by a batch of resumable uploads, in the given order
+type AddAlbumItemsRequest struct {
+	Items     []AlbumItemInput `json:"items" binding:"dive"`
+	UploadIDs []string         `json:"upload_ids"`
+}
+
+type UpdateAlbumItemRequest struct {
+	Caption string `json:"caption"`
+}
+
+type ReorderAlbumRequest struct {
+	MediaItemIDs []int64 `json:"media_item_ids" binding:"required"`
+}
+
 // Menu
 type CreateMenuRequest struct {
 	Name      string `json:"name" binding:"required"`
@@ -318,3 +538,60 @@ type StatsResponse struct {
 	TotalCategories   int64 `json:"total_categories"`
 	TotalComments     int64 `json:"total_comments"`
 }
+
+// MoveMediaRequest files media items in a folder; a null or 0 folder_id
+// takes them out of any folder
+type MoveMediaRequest struct {
+	MediaItemIDs []int64 `json:"media_item_ids" binding:"required,min=1"`
+	FolderID     *int64  `json:"folder_id"`
+}
+
+type MoveMediaResponse struct {
+	Moved    int64  `json:"moved"`
+	FolderID *int64 `json:"folder_id"`
+}
+
+type CreateMediaFolderRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+// UpdateMediaFolderRequest renames or moves a folder. Omitted fields are kept;
+// parent_id 0 moves the folder to the top level.
+type UpdateMediaFolderRequest struct {
+	Name     *string `json:"name" binding:"omitempty,max=100"`
+	ParentID *int64  `json:"parent_id"`
+}
+
+type CropPresetRequest struct {
+	Name        string `json:"name" binding:"required,max=50"`
+	Description string `json:"description"`
+	Width       int    `json:"width" binding:"required,min=1,max=4000"`
+	Height      int    `json:"height" binding:"required,min=1,max=4000"`
+}
+
+// FocalPointRequest sets the focal point of the uploaded image at url, as
+// fractions of its width and height from the top left corner
+type FocalPointRequest struct {
+	URL string   `json:"url" binding:"required"`
+	X   *float64 `json:"x" binding:"required,min=0,max=1"`
+	Y   *float64 `json:"y" binding:"required,min=0,max=1"`
+}
+
+// WatermarkRequest replaces the watermark settings. The logo is required
+// while the watermark is enabled.
+type WatermarkRequest struct {
+	Enabled     bool    `json:"enabled"`
+	LogoURL     string  `json:"logo_url"`
+	Position    string  `json:"position" binding:"required,oneof=top-left top-right bottom-left bottom-right center"`
+	Opacity     float64 `json:"opacity" binding:"required,gt=0,max=1"`
+	Scale       float64 `json:"scale" binding:"required,gt=0,max=1"`
+	CategoryIDs []int64 `json:"category_ids"`
+	AlbumIDs    []int64 `json:"album_ids"`
+}
+
+// WatermarkResponse is the watermark settings with the latest re-render
+type WatermarkResponse struct {
+	Settings *models.WatermarkSettings `json:"settings"`
+	Job      models.WatermarkJob       `json:"job"`
+}
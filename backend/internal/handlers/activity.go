@@ -11,14 +11,17 @@ import (
 	"github.com/thieugt95/portal-365/backend/internal/middleware"
 	"github.com/thieugt95/portal-365/backend/internal/models"
 	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/usage"
+	"github.com/thieugt95/portal-365/backend/internal/watermark"
 )
 
 type ActivityHandler struct {
 	repos *database.Repositories
+	marks *watermark.Service
 }
 
-func NewActivityHandler(repos *database.Repositories) *ActivityHandler {
-	return &ActivityHandler{repos: repos}
+func NewActivityHandler(repos *database.Repositories, marks *watermark.Service) *ActivityHandler {
+	return &ActivityHandler{repos: repos, marks: marks}
 }
 
 // ListActivities godoc
@@ -82,22 +85,26 @@ func (h *ActivityHandler) GetBySlug(c *gin.Context) {
 	}
 
 	response := dto.ArticleResponse{
-		ID:            article.ID,
-		Title:         article.Title,
-		Slug:          article.Slug,
-		Summary:       article.Summary,
-		Content:       article.Content,
-		FeaturedImage: article.FeaturedImage,
-		AuthorID:      article.AuthorID,
-		CategoryID:    article.CategoryID,
-		Status:        string(article.Status),
-		ViewCount:     article.ViewCount,
-		IsFeatured:    article.IsFeatured,
-		Tags:          tagResponses,
-		PublishedAt:   article.PublishedAt,
-		ScheduledAt:   article.ScheduledAt,
-		CreatedAt:     article.CreatedAt,
-		UpdatedAt:     article.UpdatedAt,
+		ID:               article.ID,
+		Title:            article.Title,
+		Slug:             article.Slug,
+		Summary:          article.Summary,
+		Content:          article.Content,
+		FeaturedImage:    article.FeaturedImage,
+		FeaturedImageSet: responsiveImage(c.Request.Context(), h.repos.Renditions, article.FeaturedImage),
+		ContentImages:    contentImages(c.Request.Context(), h.repos.Renditions, article.Content),
+		AuthorID:         article.AuthorID,
+		CategoryID:       article.CategoryID,
+		Status:           string(article.Status),
+		ViewCount:        article.ViewCount,
+		IsFeatured:       article.IsFeatured,
+		Tags:             tagResponses,
+		PublishedAt:      article.PublishedAt,
+		ScheduledAt:      article.ScheduledAt,
+		CreatedAt:        article.CreatedAt,
+		UpdatedAt:        article.UpdatedAt,
+		Breadcrumbs: contentBreadcrumbs(c.Request.Context(), h.repos.Categories, article.CategoryID,
+			dto.Breadcrumb{Type: "article", ID: article.ID, Name: article.Title, Slug: article.Slug}),
 	}
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{Data: response})
@@ -147,6 +154,8 @@ func (h *ActivityHandler) Create(c *gin.Context) {
 		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to create activity")
 		return
 	}
+	recordUsage(c.Request.Context(), h.repos.FileRefs, usage.OwnerArticle, article.ID, usage.Article(article))
+	h.marks.Recheck(articleImages(nil, article)...)
 
 	// Add tags
 	for _, tagID := range req.TagIDs {
@@ -184,6 +193,7 @@ func (h *ActivityHandler) Update(c *gin.Context) {
 		middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Activity not found")
 		return
 	}
+	before := *article
 
 	// Convert FlexibleTime to *time.Time
 	var scheduledAt *time.Time
@@ -204,6 +214,8 @@ func (h *ActivityHandler) Update(c *gin.Context) {
 		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to update activity")
 		return
 	}
+	recordUsage(c.Request.Context(), h.repos.FileRefs, usage.OwnerArticle, article.ID, usage.Article(article))
+	h.marks.Recheck(articleImages(&before, article)...)
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{Data: article})
 }
@@ -222,10 +234,16 @@ func (h *ActivityHandler) Update(c *gin.Context) {
 func (h *ActivityHandler) Delete(c *gin.Context) {
 	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
 
+	// Looked up first for the images whose watermark the activity decided
+	article, _ := h.repos.Articles.GetByID(c.Request.Context(), id)
 	if err := h.repos.Articles.Delete(c.Request.Context(), id); err != nil {
 		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to delete activity")
 		return
 	}
+	recordUsage(c.Request.Context(), h.repos.FileRefs, usage.OwnerArticle, id, nil)
+	if article != nil {
+		h.marks.Recheck(articleImages(article, nil)...)
+	}
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{Data: gin.H{"message": "Activity deleted successfully"}})
 }
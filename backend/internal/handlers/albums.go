@@ -0,0 +1,661 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/middleware"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/watermark"
+)
+
+// albumEmbedPattern finds albums placed in article content, e.g.
+// <div data-album="le-ky-niem-2025"></div>
+var albumEmbedPattern = regexp.MustCompile(`(?i)\bdata-album\s*=\s*["']([a-z0-9-]+)["']`)
+
+type AlbumHandler struct {
+	albums     repositories.AlbumRepository
+	media      repositories.MediaItemRepository
+	uploads    repositories.UploadSessionRepository
+	renditions repositories.ImageRenditionRepository
+	marks      *watermark.Service
+}
+
+func NewAlbumHandler(repos *database.Repositories, marks *watermark.Service) *AlbumHandler {
+	return &AlbumHandler{
+		albums:     repos.Albums,
+		media:      repos.MediaItems,
+		uploads:    repos.Uploads,
+		renditions: repos.Renditions,
+		marks:      marks,
+	}
+}
+
+// albumResponses attaches cover images to a page of albums
+func albumResponses(ctx context.Context, renditions repositories.ImageRenditionRepository, albums []models.Album) []*dto.AlbumResponse {
+	urls := make([]string, 0, len(albums))
+	for _, album := range albums {
+		if album.CoverURL != "" {
+			urls = append(urls, album.CoverURL)
+		}
+	}
+	images := responsiveImages(ctx, renditions, urls)
+
+	responses := make([]*dto.AlbumResponse, len(albums))
+	for i := range albums {
+		responses[i] = &dto.AlbumResponse{Album: &albums[i], CoverImage: images[albums[i].CoverURL]}
+	}
+	return responses
+}
+
+// albumDetail builds an album response with its items in order
+func albumDetail(ctx context.Context, albums repositories.AlbumRepository, renditions repositories.ImageRenditionRepository, album *models.Album) (*dto.AlbumResponse, error) {
+	items, err := albums.ListItems(ctx, album.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]string, 0, len(items)+1)
+	for _, item := range items {
+		if item.Media.MediaType == "image" {
+			urls = append(urls, item.Media.URL)
+		}
+	}
+	if album.CoverURL != "" {
+		urls = append(urls, album.CoverURL)
+	}
+	images := responsiveImages(ctx, renditions, urls)
+
+	response := &dto.AlbumResponse{
+		Album:      album,
+		CoverImage: images[album.CoverURL],
+		Items:      make([]*dto.AlbumItemResponse, len(items)),
+	}
+	for i, item := range items {
+		response.Items[i] = &dto.AlbumItemResponse{AlbumItem: item, Image: images[item.Media.URL]}
+	}
+	return response, nil
+}
+
+// contentAlbums resolves the published albums embedded in HTML content, in
+// the order they appear. Unknown and unpublished albums are left out.
+func contentAlbums(ctx context.Context, albums repositories.AlbumRepository, renditions repositories.ImageRenditionRepository, content string) []*dto.AlbumResponse {
+	seen := make(map[string]bool)
+	var responses []*dto.AlbumResponse
+	for _, match := range albumEmbedPattern.FindAllStringSubmatch(content, -1) {
+		slug := match[1]
+		if seen[slug] {
+			continue
+		}
+		seen[slug] = true
+
+		album, err := albums.GetBySlug(ctx, slug)
+		if err != nil || album.Status != "published" {
+			continue
+		}
+		response, err := albumDetail(ctx, albums, renditions, album)
+		if err != nil {
+			log.Printf("Failed to load embedded album %s: %v", slug, err)
+			continue
+		}
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+// uniqueAlbumSlug appends -2, -3, ... to a generated slug until it is free
+func (h *AlbumHandler) uniqueAlbumSlug(ctx context.Context, base string) (string, error) {
+	slug := base
+	for n := 2; ; n++ {
+		_, err := h.albums.GetBySlug(ctx, slug)
+		if errors.Is(err, sql.ErrNoRows) {
+			return slug, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+func (h *AlbumHandler) albumID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_ID", "Invalid album ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// loadAlbum fetches the album named by the :id parameter, writing the error response if it cannot
+func (h *AlbumHandler) loadAlbum(c *gin.Context) (*models.Album, bool) {
+	id, ok := h.albumID(c)
+	if !ok {
+		return nil, false
+	}
+	album, err := h.albums.GetByID(c.Request.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		middleware.AbortWithError(c, http.StatusNotFound, "NOT_FOUND", "Album not found")
+		return nil, false
+	}
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch album")
+		return nil, false
+	}
+	return album, true
+}
+
+// writeDetail answers with the album and its items, re-read after a change
+func (h *AlbumHandler) writeDetail(c *gin.Context, status int, id int64) {
+	ctx := c.Request.Context()
+	album, err := h.albums.GetByID(ctx, id)
+	if err == nil {
+		var response *dto.AlbumResponse
+		if response, err = albumDetail(ctx, h.albums, h.renditions, album); err == nil {
+			c.JSON(status, dto.SuccessResponse{Data: response})
+			return
+		}
+	}
+	middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch album")
+}
+
+func albumPage(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
+
+// ListPublic godoc
+// @Summary List albums
+// @Description Get published albums, newest first, with their cover and item count
+// @Tags Albums
+// @Produce json
+// @Param page query int false "Page number (default: 1)"
+// @Param page_size query int false "Page size (default: 20, max: 100)"
+// @Success 200 {object} dto.SuccessResponse{data=[]dto.AlbumResponse}
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /albums [get]
+func (h *AlbumHandler) ListPublic(c *gin.Context) {
+	page, pageSize := albumPage(c)
+
+	albums, total, err := h.albums.List(c.Request.Context(), "published", page, pageSize)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch albums")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Data:       albumResponses(c.Request.Context(), h.renditions, albums),
+		Pagination: getPagination(page, pageSize, total),
+	})
+}
+
+// GetBySlug godoc
+// @Summary Get album by slug
+// @Description Get a published album with its items in order, their captions and image renditions
+// @Tags Albums
+// @Produce json
+// @Param slug path string true "Album slug"
+// @Success 200 {object} dto.SuccessResponse{data=dto.AlbumResponse}
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /albums/{slug} [get]
+func (h *AlbumHandler) GetBySlug(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	album, err := h.albums.GetBySlug(ctx, c.Param("slug"))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && album.Status != "published") {
+		middleware.AbortWithError(c, http.StatusNotFound, "NOT_FOUND", "Album not found")
+		return
+	}
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch album")
+		return
+	}
+
+	response, err := albumDetail(ctx, h.albums, h.renditions, album)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch album items")
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: response})
+}
+
+// List godoc
+// @Summary List albums (Admin)
+// @Description Get all albums with their cover and item count
+// @Tags Albums
+// @Security BearerAuth
+// @Produce json
+// @Param status query string false "Status filter (draft, published)"
+// @Param page query int false "Page number (default: 1)"
+// @Param page_size query int false "Page size (default: 20, max: 100)"
+// @Success 200 {object} dto.SuccessResponse{data=[]dto.AlbumResponse}
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/albums [get]
+func (h *AlbumHandler) List(c *gin.Context) {
+	page, pageSize := albumPage(c)
+
+	albums, total, err := h.albums.List(c.Request.Context(), c.Query("status"), page, pageSize)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch albums")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Data:       albumResponses(c.Request.Context(), h.renditions, albums),
+		Pagination: getPagination(page, pageSize, total),
+	})
+}
+
+// GetByID godoc
+// @Summary Get album (Admin)
+// @Description Get an album in any status with its items in order
+// @Tags Albums
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Album ID"
+// @Success 200 {object} dto.SuccessResponse{data=dto.AlbumResponse}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/albums/{id} [get]
+func (h *AlbumHandler) GetByID(c *gin.Context) {
+	album, ok := h.loadAlbum(c)
+	if !ok {
+		return
+	}
+	response, err := albumDetail(c.Request.Context(), h.albums, h.renditions, album)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch album items")
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: response})
+}
+
+// Create godoc
+// @Summary Create album (Admin)
+// @Description Create an empty album. Without a slug one is made from the title. Status defaults to draft.
+// @Tags Albums
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param album body dto.CreateAlbumRequest true "Album data"
+// @Success 201 {object} dto.SuccessResponse{data=dto.AlbumResponse}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/albums [post]
+func (h *AlbumHandler) Create(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req dto.CreateAlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	album := &models.Album{
+		Title:       req.Title,
+		Description: req.Description,
+		CreatedBy:   c.GetInt64("user_id"),
+		Status:      "draft",
+	}
+	if req.Status != "" {
+		album.Status = req.Status
+	}
+	if album.Status == "published" {
+		now := time.Now()
+		album.PublishedAt = &now
+	}
+
+	if req.Slug != "" {
+		album.Slug = generateSlug(req.Slug)
+		if _, err := h.albums.GetBySlug(ctx, album.Slug); err == nil {
+			middleware.AbortWithError(c, http.StatusConflict, "SLUG_EXISTS", "Another album already uses this slug")
+			return
+		}
+	} else {
+		slug, err := h.uniqueAlbumSlug(ctx, generateSlug(req.Title))
+		if err != nil {
+			middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create album")
+			return
+		}
+		album.Slug = slug
+	}
+	if album.Slug == "" {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", "Album slug cannot be empty")
+		return
+	}
+
+	if err := h.albums.Create(ctx, album); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create album")
+		return
+	}
+	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: &dto.AlbumResponse{Album: album}})
+}
+
+// Update godoc
+// @Summary Update album (Admin)
+// @Description Change the title, slug, description, status or cover of an album. The cover must be one of its items; cover_media_id 0 goes back to showing the first item.
+// @Tags Albums
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Album ID"
+// @Param album body dto.UpdateAlbumRequest true "Fields to change"
+// @Success 200 {object} dto.SuccessResponse{data=dto.AlbumResponse}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/albums/{id} [put]
+func (h *AlbumHandler) Update(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req dto.UpdateAlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+	album, ok := h.loadAlbum(c)
+	if !ok {
+		return
+	}
+
+	if req.Title != nil {
+		album.Title = *req.Title
+	}
+	if req.Description != nil {
+		album.Description = *req.Description
+	}
+	if req.Slug != nil {
+		slug := generateSlug(*req.Slug)
+		if slug == "" {
+			middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", "Album slug cannot be empty")
+			return
+		}
+		if other, err := h.albums.GetBySlug(ctx, slug); err == nil && other.ID != album.ID {
+			middleware.AbortWithError(c, http.StatusConflict, "SLUG_EXISTS", "Another album already uses this slug")
+			return
+		}
+		album.Slug = slug
+	}
+	if req.Status != nil {
+		album.Status = *req.Status
+		if album.Status == "published" && album.PublishedAt == nil {
+			now := time.Now()
+			album.PublishedAt = &now
+		}
+	}
+	if req.CoverMediaID != nil {
+		if *req.CoverMediaID == 0 {
+			album.CoverMediaID = nil
+		} else {
+			member, err := h.albums.HasItem(ctx, album.ID, *req.CoverMediaID)
+			if err != nil {
+				middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update album")
+				return
+			}
+			if !member {
+				middleware.AbortWithError(c, http.StatusBadRequest, "COVER_NOT_IN_ALBUM", "The cover must be an item of the album")
+				return
+			}
+			album.CoverMediaID = req.CoverMediaID
+		}
+	}
+
+	if err := h.albums.Update(ctx, album); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update album")
+		return
+	}
+	h.writeDetail(c, http.StatusOK, album.ID)
+}
+
+// Delete godoc
+// @Summary Delete album (Admin)
+// @Description Delete an album. Its media items stay in the library.
+// @Tags Albums
+// @Security BearerAuth
+// @Param id path int true "Album ID"
+// @Success 204
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/albums/{id} [delete]
+func (h *AlbumHandler) Delete(c *gin.Context) {
+	id, ok := h.albumID(c)
+	if !ok {
+		return
+	}
+	// Listed first for the images whose watermark the album decided
+	items, err := h.albums.ListItems(c.Request.Context(), id)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch album items")
+		return
+	}
+	err = h.albums.Delete(c.Request.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		middleware.AbortWithError(c, http.StatusNotFound, "NOT_FOUND", "Album not found")
+		return
+	}
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete album")
+		return
+	}
+	for _, item := range items {
+		if item.Media != nil {
+			h.marks.Recheck(item.Media.URL)
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// AddItems godoc
+// @Summary Add items to album (Admin)
+// @Description Append media items to the end of an album, in the given order: the listed items with their captions, then the items created by a batch of resumable uploads (upload_ids). Items already in the album keep their place.
+// @Tags Albums
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Album ID"
+// @Param items body dto.AddAlbumItemsRequest true "Items to add"
+// @Success 200 {object} dto.SuccessResponse{data=dto.AlbumResponse}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/albums/{id}/items [post]
+func (h *AlbumHandler) AddItems(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req dto.AddAlbumItemsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+	if len(req.Items) == 0 && len(req.UploadIDs) == 0 {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", "No items or uploads given")
+		return
+	}
+	album, ok := h.loadAlbum(c)
+	if !ok {
+		return
+	}
+
+	items := make([]*models.AlbumItem, 0, len(req.Items)+len(req.UploadIDs))
+	for _, input := range req.Items {
+		items = append(items, &models.AlbumItem{MediaItemID: input.MediaItemID, Caption: input.Caption})
+	}
+	for _, uploadID := range req.UploadIDs {
+		session, err := h.uploads.GetByID(ctx, uploadID)
+		if errors.Is(err, sql.ErrNoRows) {
+			middleware.AbortWithError(c, http.StatusNotFound, "UPLOAD_NOT_FOUND", fmt.Sprintf("Upload %s not found", uploadID))
+			return
+		}
+		if err != nil {
+			middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch upload")
+			return
+		}
+		if session.MediaItemID == nil {
+			middleware.AbortWithError(c, http.StatusBadRequest, "UPLOAD_NOT_FINISHED", fmt.Sprintf("Upload %s has not finished", uploadID))
+			return
+		}
+		items = append(items, &models.AlbumItem{MediaItemID: *session.MediaItemID})
+	}
+
+	urls := make([]string, 0, len(items))
+	for _, item := range items {
+		media, err := h.media.GetByID(ctx, item.MediaItemID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				middleware.AbortWithError(c, http.StatusNotFound, "MEDIA_NOT_FOUND", fmt.Sprintf("Media item %d not found", item.MediaItemID))
+				return
+			}
+			middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch media item")
+			return
+		}
+		urls = append(urls, media.URL)
+	}
+
+	if _, err := h.albums.AddItems(ctx, album.ID, items); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to add album items")
+		return
+	}
+	h.marks.Recheck(urls...)
+	h.writeDetail(c, http.StatusOK, album.ID)
+}
+
+// UpdateItem godoc
+// @Summary Update album item caption (Admin)
+// @Tags Albums
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Album ID"
+// @Param media_id path int true "Media item ID"
+// @Param item body dto.UpdateAlbumItemRequest true "Caption"
+// @Success 200 {object} dto.SuccessResponse{data=dto.AlbumResponse}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/albums/{id}/items/{media_id} [put]
+func (h *AlbumHandler) UpdateItem(c *gin.Context) {
+	id, ok := h.albumID(c)
+	if !ok {
+		return
+	}
+	mediaID, err := strconv.ParseInt(c.Param("media_id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_ID", "Invalid media item ID")
+		return
+	}
+	var req dto.UpdateAlbumItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	err = h.albums.UpdateItemCaption(c.Request.Context(), id, mediaID, req.Caption)
+	if errors.Is(err, sql.ErrNoRows) {
+		middleware.AbortWithError(c, http.StatusNotFound, "NOT_FOUND", "Item not found in album")
+		return
+	}
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update album item")
+		return
+	}
+	h.writeDetail(c, http.StatusOK, id)
+}
+
+// RemoveItem godoc
+// @Summary Remove item from album (Admin)
+// @Description Take a media item out of an album. The media item stays in the library; if it was the cover, the first item becomes the cover.
+// @Tags Albums
+// @Security BearerAuth
+// @Param id path int true "Album ID"
+// @Param media_id path int true "Media item ID"
+// @Success 204
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/albums/{id}/items/{media_id} [delete]
+func (h *AlbumHandler) RemoveItem(c *gin.Context) {
+	id, ok := h.albumID(c)
+	if !ok {
+		return
+	}
+	mediaID, err := strconv.ParseInt(c.Param("media_id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_ID", "Invalid media item ID")
+		return
+	}
+
+	err = h.albums.RemoveItem(c.Request.Context(), id, mediaID)
+	if errors.Is(err, sql.ErrNoRows) {
+		middleware.AbortWithError(c, http.StatusNotFound, "NOT_FOUND", "Item not found in album")
+		return
+	}
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to remove album item")
+		return
+	}
+	if media, err := h.media.GetByID(c.Request.Context(), mediaID); err == nil {
+		h.marks.Recheck(media.URL)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Reorder godoc
+// @Summary Reorder album items (Admin)
+// @Description Set the order of an album. media_item_ids must list every item of the album exactly once.
+// @Tags Albums
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Album ID"
+// @Param order body dto.ReorderAlbumRequest true "Media item IDs in their new order"
+// @Success 200 {object} dto.SuccessResponse{data=dto.AlbumResponse}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/albums/{id}/order [put]
+func (h *AlbumHandler) Reorder(c *gin.Context) {
+	var req dto.ReorderAlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+	album, ok := h.loadAlbum(c)
+	if !ok {
+		return
+	}
+
+	err := h.albums.Reorder(c.Request.Context(), album.ID, req.MediaItemIDs)
+	if errors.Is(err, repositories.ErrAlbumOrderMismatch) {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_ORDER", err.Error())
+		return
+	}
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to reorder album")
+		return
+	}
+	h.writeDetail(c, http.StatusOK, album.ID)
+}
@@ -1,34 +1,28 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
 	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
+	"io"
+	"log"
+	"math"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/imaging"
 	"github.com/thieugt95/portal-365/backend/internal/models"
-	"golang.org/x/image/draw"
-	"golang.org/x/image/webp"
+	"github.com/thieugt95/portal-365/backend/internal/usage"
 )
 
-const (
-	BannerMaxUploadSize = 100 * 1024 * 1024 // 100MB
-	// Banner dimensions based on placement
-	Banner1Width        = 760 // Banner 1 (left)
-	Banner1Height       = 190 // Banner 1 height
-	Banner2Width        = 760 // Banner 2 (right)
-	Banner2Height       = 190 // Banner 2 height
-	DefaultBannerWidth  = 1200
-	DefaultBannerHeight = 200
-)
+const BannerMaxUploadSize = 100 * 1024 * 1024 // 100MB
+
+// bannerExtensions are the file extensions banner images are stored with
+var bannerExtensions = map[string]string{"jpeg": ".jpg", "png": ".png", "webp": ".webp"}
 
 var AllowedBannerMIME = map[string]bool{
 	"image/jpeg": true,
@@ -38,7 +32,7 @@ var AllowedBannerMIME = map[string]bool{
 
 // CreateWithUpload godoc
 // @Summary Create banner with image upload (Admin)
-// @Description Create a new banner with image file upload. Image will be auto-resized based on placement: banner-1 (760x190), banner-2 (760x190), others (1200x200)
+// @Description Create a new banner with image file upload. The image is stored whole, rotated upright per EXIF and without metadata. crop_url serves it cropped to the placement's crop preset (the "banner" preset when the placement has none) around the optional focal point.
 // @Tags Banners
 // @Security BearerAuth
 // @Accept multipart/form-data
@@ -49,6 +43,8 @@ var AllowedBannerMIME = map[string]bool{
 // @Param link_url formData string false "Link URL"
 // @Param sort_order formData int false "Sort order (default: 0)"
 // @Param is_active formData bool false "Is active (default: true)"
+// @Param focal_x formData number false "Focal point across the image, 0 (left) to 1 (right)"
+// @Param focal_y formData number false "Focal point down the image, 0 (top) to 1 (bottom)"
 // @Success 201 {object} dto.SuccessResponse{data=models.Banner}
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 401 {object} dto.ErrorResponse
@@ -91,30 +87,27 @@ func (h *BannerHandlerImpl) CreateWithUpload(c *gin.Context) {
 		return
 	}
 
-	// 4. Decode image
-	var img image.Image
-	switch contentType {
-	case "image/jpeg":
-		img, err = jpeg.Decode(file)
-	case "image/png":
-		img, err = png.Decode(file)
-	case "image/webp":
-		img, err = webp.Decode(file)
-	default:
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+	// 4. Rotate the image upright per EXIF and drop EXIF/XMP/GPS metadata
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: dto.ErrorDetail{
-				Code:    "INVALID_FILE_TYPE",
-				Message: "Unsupported image format",
+				Code:    "FILE_READ_ERROR",
+				Message: "Failed to read file",
 			},
 		})
 		return
 	}
-
-	if err != nil {
+	sanitized, err := imaging.Sanitize(data)
+	if err != nil || bannerExtensions[sanitized.Format] == "" {
+		message := "Only JPEG, PNG, WebP images are allowed"
+		if err != nil {
+			message = "Failed to decode image: " + err.Error()
+		}
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 			Error: dto.ErrorDetail{
 				Code:    "INVALID_IMAGE",
-				Message: "Failed to decode image: " + err.Error(),
+				Message: message,
 			},
 		})
 		return
@@ -146,47 +139,22 @@ func (h *BannerHandlerImpl) CreateWithUpload(c *gin.Context) {
 		return
 	}
 
-	// 6. Resize image based on placement type
-	targetWidth, targetHeight := getBannerDimensions(placement)
-	resizedImg := resizeImage(img, targetWidth, targetHeight)
-
-	// 7. Create directory structure: storage/uploads/banners/YYYY/MM
-	now := time.Now()
-	yearMonth := now.Format("2006/01")
-	uploadPath := filepath.Join("./storage/uploads/banners", yearMonth)
-	if err := os.MkdirAll(uploadPath, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error: dto.ErrorDetail{
-				Code:    "STORAGE_ERROR",
-				Message: "Failed to create upload directory",
-			},
-		})
-		return
-	}
-
-	// 7. Generate unique filename
-	ext := strings.ToLower(filepath.Ext(header.Filename))
-	if ext == "" {
-		ext = ".jpg" // Default to JPEG
-	}
-	uniqueFilename := fmt.Sprintf("%s%s", uuid.New().String(), ext)
-	fullPath := filepath.Join(uploadPath, uniqueFilename)
-
-	// 8. Save resized image
-	outFile, err := os.Create(fullPath)
+	focus, err := bannerFocus(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 			Error: dto.ErrorDetail{
-				Code:    "STORAGE_ERROR",
-				Message: "Failed to create file",
+				Code:    "INVALID_INPUT",
+				Message: err.Error(),
 			},
 		})
 		return
 	}
-	defer outFile.Close()
 
-	// Save as JPEG with high quality
-	err = jpeg.Encode(outFile, resizedImg, &jpeg.Options{Quality: 90})
+	// 6. Save under storage/uploads/banners/YYYY/MM, sharing the stored copy
+	// of an identical image. The image is kept whole; placements crop it
+	// through the crop_url.
+	ctx := c.Request.Context()
+	imageURL, err := h.storeImage(ctx, sanitized)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: dto.ErrorDetail{
@@ -197,10 +165,7 @@ func (h *BannerHandlerImpl) CreateWithUpload(c *gin.Context) {
 		return
 	}
 
-	// 9. Build URL path
-	imageURL := fmt.Sprintf("/static/uploads/banners/%s/%s", yearMonth, uniqueFilename)
-
-	// 10. Create banner record
+	// 7. Create banner record
 	banner := &models.Banner{
 		Title:     title,
 		ImageURL:  imageURL,
@@ -210,10 +175,10 @@ func (h *BannerHandlerImpl) CreateWithUpload(c *gin.Context) {
 		IsActive:  isActive,
 	}
 
-	err = h.repos.Banners.Create(c.Request.Context(), banner)
+	err = h.repos.Banners.Create(ctx, banner)
 	if err != nil {
-		// Clean up uploaded file if DB insert fails
-		os.Remove(fullPath)
+		// Give back the file reference if DB insert fails
+		releaseFile(ctx, h.store, h.repos.Blobs, nil, imageURL)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: dto.ErrorDetail{
 				Code:    "INTERNAL_ERROR",
@@ -222,13 +187,18 @@ func (h *BannerHandlerImpl) CreateWithUpload(c *gin.Context) {
 		})
 		return
 	}
+	recordUsage(ctx, h.repos.FileRefs, usage.OwnerBanner, banner.ID, usage.Banner(banner))
+	if focus != nil {
+		h.setFocus(c, imageURL, focus)
+	}
+	h.warmCrop(ctx, banner)
 
 	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: banner})
 }
 
 // UpdateWithUpload godoc
 // @Summary Update banner with new image (Admin)
-// @Description Update banner and optionally upload new image (auto-resized based on placement)
+// @Description Update banner and optionally upload new image (stored whole and cropped per placement through crop_url)
 // @Tags Banners
 // @Security BearerAuth
 // @Accept multipart/form-data
@@ -239,6 +209,8 @@ func (h *BannerHandlerImpl) CreateWithUpload(c *gin.Context) {
 // @Param placement formData string false "Placement (banner-1, banner-2, etc.)"
 // @Param link_url formData string false "Link URL"
 // @Param is_active formData bool false "Is active"
+// @Param focal_x formData number false "Focal point of the new image across, 0 to 1"
+// @Param focal_y formData number false "Focal point of the new image down, 0 to 1"
 // @Success 200 {object} dto.SuccessResponse{data=models.Banner}
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 401 {object} dto.ErrorResponse
@@ -246,12 +218,48 @@ func (h *BannerHandlerImpl) CreateWithUpload(c *gin.Context) {
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /admin/banners/{id}/upload [put]
 func (h *BannerHandlerImpl) UpdateWithUpload(c *gin.Context) {
-	// Get banner ID
-	id := c.Param("id")
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INVALID_ID",
+				Message: "Invalid banner ID",
+			},
+		})
+		return
+	}
 
-	// Get existing banner
-	var existingBanner models.Banner
-	// TODO: Fetch from DB - simplified for now
+	ctx := c.Request.Context()
+	banner, err := h.repos.Banners.GetByID(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{
+				Error: dto.ErrorDetail{
+					Code:    "NOT_FOUND",
+					Message: "Banner not found",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INTERNAL_ERROR",
+				Message: "Failed to fetch banner",
+			},
+		})
+		return
+	}
+
+	focus, err := bannerFocus(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INVALID_INPUT",
+				Message: err.Error(),
+			},
+		})
+		return
+	}
 
 	// Check if new file uploaded
 	file, header, err := c.Request.FormFile("file")
@@ -260,6 +268,16 @@ func (h *BannerHandlerImpl) UpdateWithUpload(c *gin.Context) {
 	if err == nil && file != nil {
 		defer file.Close()
 
+		if header.Size > BannerMaxUploadSize {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error: dto.ErrorDetail{
+					Code:    "FILE_TOO_LARGE",
+					Message: fmt.Sprintf("File size exceeds maximum of %d bytes", BannerMaxUploadSize),
+				},
+			})
+			return
+		}
+
 		// Process image upload (similar to Create)
 		contentType := header.Header.Get("Content-Type")
 		if !AllowedBannerMIME[contentType] {
@@ -272,18 +290,19 @@ func (h *BannerHandlerImpl) UpdateWithUpload(c *gin.Context) {
 			return
 		}
 
-		// Decode and resize
-		var img image.Image
-		switch contentType {
-		case "image/jpeg":
-			img, err = jpeg.Decode(file)
-		case "image/png":
-			img, err = png.Decode(file)
-		case "image/webp":
-			img, err = webp.Decode(file)
-		}
-
+		// Store upright and without metadata
+		data, err := io.ReadAll(file)
 		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error: dto.ErrorDetail{
+					Code:    "FILE_READ_ERROR",
+					Message: "Failed to read file",
+				},
+			})
+			return
+		}
+		sanitized, err := imaging.Sanitize(data)
+		if err != nil || bannerExtensions[sanitized.Format] == "" {
 			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 				Error: dto.ErrorDetail{
 					Code:    "INVALID_IMAGE",
@@ -293,28 +312,8 @@ func (h *BannerHandlerImpl) UpdateWithUpload(c *gin.Context) {
 			return
 		}
 
-		// Get placement to determine resize dimensions
-		placement := c.PostForm("placement")
-		if placement == "" {
-			placement = existingBanner.Placement // Use existing placement if not provided
-		}
-		targetWidth, targetHeight := getBannerDimensions(placement)
-		resizedImg := resizeImage(img, targetWidth, targetHeight)
-
 		// Save new image
-		now := time.Now()
-		yearMonth := now.Format("2006/01")
-		uploadPath := filepath.Join("./storage/uploads/banners", yearMonth)
-		os.MkdirAll(uploadPath, 0755)
-
-		ext := strings.ToLower(filepath.Ext(header.Filename))
-		if ext == "" {
-			ext = ".jpg"
-		}
-		uniqueFilename := fmt.Sprintf("%s%s", uuid.New().String(), ext)
-		fullPath := filepath.Join(uploadPath, uniqueFilename)
-
-		outFile, err := os.Create(fullPath)
+		newImageURL, err = h.storeImage(ctx, sanitized)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 				Error: dto.ErrorDetail{
@@ -324,81 +323,87 @@ func (h *BannerHandlerImpl) UpdateWithUpload(c *gin.Context) {
 			})
 			return
 		}
-		defer outFile.Close()
-
-		jpeg.Encode(outFile, resizedImg, &jpeg.Options{Quality: 90})
-		newImageURL = fmt.Sprintf("/static/uploads/banners/%s/%s", yearMonth, uniqueFilename)
-
-		// Delete old image if exists
-		if existingBanner.ImageURL != "" {
-			oldPath := strings.TrimPrefix(existingBanner.ImageURL, "/static/uploads/banners/")
-			os.Remove(filepath.Join("./storage/uploads/banners", oldPath))
-		}
 	}
 
 	// Update banner fields
+	oldImageURL := banner.ImageURL
 	if title := c.PostForm("title"); title != "" {
-		existingBanner.Title = title
+		banner.Title = title
 	}
 	if placement := c.PostForm("placement"); placement != "" {
-		existingBanner.Placement = placement
+		banner.Placement = placement
 	}
 	if newImageURL != "" {
-		existingBanner.ImageURL = newImageURL
+		banner.ImageURL = newImageURL
+	}
+	if linkURL, ok := c.GetPostForm("link_url"); ok {
+		banner.LinkURL = linkURL
+	}
+	if isActive, ok := c.GetPostForm("is_active"); ok {
+		banner.IsActive = isActive != "false"
 	}
-	existingBanner.LinkURL = c.PostForm("link_url")
-	existingBanner.IsActive = c.PostForm("is_active") != "false"
-
-	c.JSON(http.StatusOK, dto.SuccessResponse{Data: map[string]interface{}{
-		"id":      id,
-		"message": "Banner updated (simplified implementation)",
-	}})
-}
 
-// getBannerDimensions returns width and height based on placement type
-func getBannerDimensions(placement string) (width, height int) {
-	switch placement {
-	case "banner-1":
-		return Banner1Width, Banner1Height
-	case "banner-2":
-		return Banner2Width, Banner2Height
-	default:
-		return DefaultBannerWidth, DefaultBannerHeight
+	if err := h.repos.Banners.Update(ctx, banner); err != nil {
+		// Give back the new file reference; the banner keeps its old image
+		if newImageURL != "" {
+			releaseFile(ctx, h.store, h.repos.Blobs, nil, newImageURL)
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INTERNAL_ERROR",
+				Message: "Failed to update banner",
+			},
+		})
+		return
 	}
-}
+	recordUsage(ctx, h.repos.FileRefs, usage.OwnerBanner, banner.ID, usage.Banner(banner))
 
-// resizeImage resizes an image to fit within the specified dimensions while maintaining aspect ratio
-// If the image is smaller, it will be scaled up. If larger, it will be scaled down.
-func resizeImage(src image.Image, width, height int) image.Image {
-	srcBounds := src.Bounds()
-	srcWidth := srcBounds.Dx()
-	srcHeight := srcBounds.Dy()
-
-	// Calculate aspect ratios
-	srcAspect := float64(srcWidth) / float64(srcHeight)
-	dstAspect := float64(width) / float64(height)
-
-	var newWidth, newHeight int
-
-	if srcAspect > dstAspect {
-		// Source is wider - fit to width
-		newWidth = width
-		newHeight = int(float64(width) / srcAspect)
-	} else {
-		// Source is taller - fit to height
-		newHeight = height
-		newWidth = int(float64(height) * srcAspect)
+	// Release the old image only once the banner no longer points at it
+	if newImageURL != "" && oldImageURL != "" {
+		releaseFile(ctx, h.store, h.repos.Blobs, nil, oldImageURL)
+	}
+	if focus != nil {
+		h.setFocus(c, banner.ImageURL, focus)
 	}
+	h.warmCrop(ctx, banner)
 
-	// Create destination image with target size
-	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: banner})
+}
 
-	// Calculate centering offset
-	offsetX := (width - newWidth) / 2
-	offsetY := (height - newHeight) / 2
+// storeImage saves a sanitized banner image under uploads/banners/YYYY/MM
+func (h *BannerHandlerImpl) storeImage(ctx context.Context, sanitized *imaging.Sanitized) (string, error) {
+	staged, err := stageFile(bytes.NewReader(sanitized.Data), "/static/uploads/banners/"+time.Now().Format("2006/01"), bannerExtensions[sanitized.Format])
+	if err != nil {
+		return "", err
+	}
+	imageURL, _, err := staged.commit(ctx, h.store, h.repos.Blobs, renditionMIME[sanitized.Format])
+	return imageURL, err
+}
 
-	// Draw resized image centered
-	draw.BiLinear.Scale(dst, image.Rect(offsetX, offsetY, offsetX+newWidth, offsetY+newHeight), src, srcBounds, draw.Over, nil)
+// bannerFocus reads the optional focal_x/focal_y form fields
+func bannerFocus(c *gin.Context) (*imaging.FocalPoint, error) {
+	x, y := c.PostForm("focal_x"), c.PostForm("focal_y")
+	if x == "" && y == "" {
+		return nil, nil
+	}
+	fx, errX := strconv.ParseFloat(x, 64)
+	fy, errY := strconv.ParseFloat(y, 64)
+	if errX != nil || errY != nil || fx < 0 || fx > 1 || fy < 0 || fy > 1 {
+		return nil, fmt.Errorf("focal_x and focal_y must both be between 0 and 1")
+	}
+	return &imaging.FocalPoint{X: math.Round(fx*10000) / 10000, Y: math.Round(fy*10000) / 10000}, nil
+}
 
-	return dst
+// setFocus records the focal point of an uploaded banner image. The banner
+// is still saved if it fails; it is then cropped around the centre.
+func (h *BannerHandlerImpl) setFocus(c *gin.Context, imageURL string, focus *imaging.FocalPoint) {
+	point := &models.FocalPoint{
+		SourceURL: imaging.SourceURL(imageURL),
+		X:         focus.X,
+		Y:         focus.Y,
+		UpdatedBy: c.GetInt64("user_id"),
+	}
+	if err := h.repos.Focal.Set(c.Request.Context(), point); err != nil {
+		log.Printf("Failed to save focal point of %s: %v", imageURL, err)
+	}
 }
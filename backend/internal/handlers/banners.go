@@ -1,23 +1,32 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/thieugt95/portal-365/backend/internal/config"
 	"github.com/thieugt95/portal-365/backend/internal/database"
 	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/imaging"
 	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+	"github.com/thieugt95/portal-365/backend/internal/usage"
+	"github.com/thieugt95/portal-365/backend/internal/watermark"
 )
 
 type BannerHandlerImpl struct {
-	repos *database.Repositories
+	repos   *database.Repositories
+	store   storage.Storage
+	cropper *imaging.Cropper
+	marks   *watermark.Service
 }
 
-func NewBannerHandlerImpl(repos *database.Repositories) *BannerHandlerImpl {
-	return &BannerHandlerImpl{repos: repos}
+func NewBannerHandlerImpl(cfg *config.Config, repos *database.Repositories, store storage.Storage, marks *watermark.Service) *BannerHandlerImpl {
+	return &BannerHandlerImpl{repos: repos, store: store, cropper: imaging.NewCropper(cfg, store), marks: marks}
 }
 
 // GetByPlacement godoc
@@ -54,7 +63,7 @@ func (h *BannerHandlerImpl) GetByPlacement(c *gin.Context) {
 
 	// Filter by time window and active status
 	now := time.Now()
-	var filtered []models.Banner
+	var filtered []*models.Banner
 	for _, banner := range banners {
 		if !banner.IsActive {
 			continue
@@ -65,8 +74,9 @@ func (h *BannerHandlerImpl) GetByPlacement(c *gin.Context) {
 		if banner.EndDate != nil && banner.EndDate.Before(now) {
 			continue
 		}
-		filtered = append(filtered, *banner)
+		filtered = append(filtered, banner)
 	}
+	withBannerCrops(c.Request.Context(), h.repos, filtered...)
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{Data: filtered})
 }
@@ -143,6 +153,7 @@ func (h *BannerHandlerImpl) List(c *gin.Context) {
 	}
 
 	paginated := filtered[start:end]
+	withBannerCrops(c.Request.Context(), h.repos, paginated...)
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{
 		Data:       paginated,
@@ -208,6 +219,7 @@ func (h *BannerHandlerImpl) GetByID(c *gin.Context) {
 		})
 		return
 	}
+	withBannerCrops(c.Request.Context(), h.repos, banner)
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{Data: banner})
 }
@@ -259,6 +271,8 @@ func (h *BannerHandlerImpl) Create(c *gin.Context) {
 		})
 		return
 	}
+	recordUsage(c.Request.Context(), h.repos.FileRefs, usage.OwnerBanner, banner.ID, usage.Banner(&banner))
+	h.warmCrop(c.Request.Context(), &banner)
 
 	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: banner})
 }
@@ -334,10 +348,21 @@ func (h *BannerHandlerImpl) Update(c *gin.Context) {
 		})
 		return
 	}
+	recordUsage(c.Request.Context(), h.repos.FileRefs, usage.OwnerBanner, banner.ID, usage.Banner(&banner))
+	h.warmCrop(c.Request.Context(), &banner)
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{Data: banner})
 }
 
+// warmCrop sets the banner's crop_url and renders the crop in the background
+// so the first visitor after a save doesn't wait for it
+func (h *BannerHandlerImpl) warmCrop(ctx context.Context, banner *models.Banner) {
+	withBannerCrops(ctx, h.repos, banner)
+	if preset, err := bannerPreset(ctx, h.repos.Crops, banner.Placement); err == nil {
+		warmCrops(h.cropper, h.marks, banner.ImageURL, focalPoint(ctx, h.repos.Focal, banner.ImageURL), preset)
+	}
+}
+
 // Delete godoc
 // @Summary Delete banner (Admin)
 // @Description Delete a banner (admin only)
@@ -363,7 +388,11 @@ func (h *BannerHandlerImpl) Delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.repos.Banners.Delete(c.Request.Context(), id); err != nil {
+	banner, err := h.repos.Banners.GetByID(c.Request.Context(), id)
+	if err == nil {
+		err = h.repos.Banners.Delete(c.Request.Context(), id)
+	}
+	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, dto.ErrorResponse{
 				Error: dto.ErrorDetail{
@@ -382,5 +411,7 @@ func (h *BannerHandlerImpl) Delete(c *gin.Context) {
 		return
 	}
 
+	recordUsage(c.Request.Context(), h.repos.FileRefs, usage.OwnerBanner, id, nil)
+	releaseFile(c.Request.Context(), h.store, h.repos.Blobs, nil, banner.ImageURL)
 	c.Status(http.StatusNoContent)
 }
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+
+	"github.com/thieugt95/portal-365/backend/internal/imaging"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/quarantine"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/scan"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+)
+
+// stagedFile is an upload written to a temporary file and hashed, before it
+// is known whether the same content is already stored
+type stagedFile struct {
+	tmpPath string
+	urlDir  string
+	ext     string
+	SHA256  string
+	Size    int64
+}
+
+// stageFile streams r into a local temporary file, computing its SHA-256 on
+// the way. urlDir is the /static/uploads/... directory it will be stored in.
+func stageFile(r io.Reader, urlDir, ext string) (*stagedFile, error) {
+	tmp, err := os.CreateTemp("", "portal-upload-*")
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	return &stagedFile{
+		tmpPath: tmp.Name(),
+		urlDir:  urlDir,
+		ext:     ext,
+		SHA256:  hex.EncodeToString(hash.Sum(nil)),
+		Size:    size,
+	}, nil
+}
+
+// discard removes the temporary file
+func (f *stagedFile) discard() {
+	if err := os.Remove(f.tmpPath); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove staged upload %s: %v", f.tmpPath, err)
+	}
+}
+
+// scan passes the staged content through the malware scanner
+func (f *stagedFile) scan(ctx context.Context, guard *quarantine.Service) (*scan.Result, error) {
+	return guard.Scan(ctx, f.tmpPath)
+}
+
+// quarantine moves the staged content into quarantine instead of storage.
+// record describes the upload and the reason it was refused.
+func (f *stagedFile) quarantine(ctx context.Context, guard *quarantine.Service, record *models.QuarantinedFile) {
+	defer f.discard()
+	record.SHA256 = f.SHA256
+	if err := guard.Hold(ctx, f.tmpPath, record); err != nil {
+		log.Printf("Failed to quarantine upload %s: %v", record.Filename, err)
+	}
+}
+
+// commit takes a reference on the stored copy of the staged content. New
+// content is stored at <urlDir>/<sha256><ext>; content stored before is
+// dropped in favour of the existing object. It returns the URL serving the
+// file and whether that file was already stored.
+func (f *stagedFile) commit(ctx context.Context, store storage.Storage, blobs repositories.StoredBlobRepository, mimeType string) (string, bool, error) {
+	defer f.discard()
+
+	blob := &models.StoredBlob{
+		SHA256:   f.SHA256,
+		URL:      f.urlDir + "/" + f.SHA256 + f.ext,
+		Size:     f.Size,
+		MimeType: mimeType,
+	}
+	if err := blobs.Acquire(ctx, blob); err != nil {
+		return "", false, err
+	}
+	existing := blob.RefCount > 1
+	key := storage.Key(blob.URL)
+
+	if existing {
+		if _, err := store.Stat(ctx, key); err == nil {
+			return blob.URL, true, nil
+		}
+		// The stored copy has gone missing; this upload takes its place
+	}
+
+	file, err := os.Open(f.tmpPath)
+	if err == nil {
+		err = store.Put(ctx, key, file, f.Size, mimeType)
+		file.Close()
+	}
+	if err != nil {
+		_, _ = blobs.Release(ctx, blob.URL)
+		return "", false, err
+	}
+	return blob.URL, existing, nil
+}
+
+// commitPrivate stores the staged content as a private file at url, outside
+// the shared uploads and their reference counts
+func (f *stagedFile) commitPrivate(ctx context.Context, store storage.Storage, url, mimeType string) error {
+	defer f.discard()
+
+	file, err := os.Open(f.tmpPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return store.Put(ctx, storage.Key(url), file, f.Size, mimeType)
+}
+
+// releaseFile drops one reference to a stored upload. With the last one the
+// file goes, together with its image renditions when renditions is set.
+// Files uploaded before content addressing are not counted and stay.
+func releaseFile(ctx context.Context, store storage.Storage, blobs repositories.StoredBlobRepository, renditions repositories.ImageRenditionRepository, url string) {
+	remaining, err := blobs.Release(ctx, url)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to release stored file %s: %v", url, err)
+		return
+	}
+	if remaining > 0 {
+		return
+	}
+	if err := purgeFile(ctx, store, blobs, renditions, url); err != nil {
+		log.Printf("Failed to remove stored file %s: %v", url, err)
+	}
+}
+
+// purgeFile deletes a released upload and its image renditions. The object
+// is deleted while the release is being committed, so an upload of the same
+// content meanwhile either keeps the file or stores it again afterwards.
+// A failed purge leaves the file released for gc-uploads to retry.
+func purgeFile(ctx context.Context, store storage.Storage, blobs repositories.StoredBlobRepository, renditions repositories.ImageRenditionRepository, url string) error {
+	purged, err := blobs.Purge(ctx, url, func() error {
+		if err := store.Delete(ctx, storage.Key(url)); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		if renditions != nil {
+			return imaging.RemoveRenditions(ctx, store, url)
+		}
+		return nil
+	})
+	if err != nil || !purged || renditions == nil {
+		return err
+	}
+	return renditions.DeleteBySource(ctx, url)
+}
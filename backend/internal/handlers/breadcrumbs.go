@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/middleware"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+)
+
+// pageGroupNames are the display names of page groups in breadcrumbs
+var pageGroupNames = map[string]string{
+	"introduction": "Giới thiệu",
+}
+
+var errUnknownBreadcrumbType = errors.New("type must be one of category, article, document, media, page")
+
+// categoryBreadcrumbs returns the path from the root category down to categoryID
+func categoryBreadcrumbs(ctx context.Context, categories repositories.CategoryRepository, categoryID int64) ([]dto.Breadcrumb, error) {
+	ancestors, err := categories.GetAncestors(ctx, categoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	crumbs := make([]dto.Breadcrumb, 0, len(ancestors)+1)
+	for _, category := range ancestors {
+		crumbs = append(crumbs, dto.Breadcrumb{Type: "category", ID: category.ID, Name: category.Name, Slug: category.Slug})
+	}
+	return crumbs, nil
+}
+
+// contentBreadcrumbs appends an item to its category's path. A missing
+// category only loses the prefix; the item itself is still returned.
+func contentBreadcrumbs(ctx context.Context, categories repositories.CategoryRepository, categoryID int64, item dto.Breadcrumb) []dto.Breadcrumb {
+	crumbs, err := categoryBreadcrumbs(ctx, categories, categoryID)
+	if err != nil {
+		crumbs = make([]dto.Breadcrumb, 0, 1)
+	}
+	return append(crumbs, item)
+}
+
+func pageBreadcrumbs(page *models.Page) []dto.Breadcrumb {
+	crumbs := make([]dto.Breadcrumb, 0, 2)
+	if page.Group != "" {
+		name, ok := pageGroupNames[page.Group]
+		if !ok {
+			name = page.Group
+		}
+		crumbs = append(crumbs, dto.Breadcrumb{Type: "group", Name: name, Slug: page.Group})
+	}
+	return append(crumbs, dto.Breadcrumb{Type: "page", ID: page.ID, Name: page.Title, Slug: page.Slug})
+}
+
+// resolveBreadcrumbs finds publicly visible content by type and slug and
+// returns its path. It returns sql.ErrNoRows when nothing visible matches.
+func resolveBreadcrumbs(ctx context.Context, repos *database.Repositories, entityType, slug string) ([]dto.Breadcrumb, error) {
+	switch entityType {
+	case "category":
+		category, err := repos.Categories.GetBySlug(ctx, slug)
+		if err != nil {
+			return nil, err
+		}
+		if !category.IsActive {
+			return nil, sql.ErrNoRows
+		}
+		return categoryBreadcrumbs(ctx, repos.Categories, category.ID)
+
+	case "article":
+		article, err := repos.Articles.GetBySlug(ctx, slug)
+		if err != nil {
+			return nil, err
+		}
+		if article.Status != models.StatusPublished {
+			return nil, sql.ErrNoRows
+		}
+		return contentBreadcrumbs(ctx, repos.Categories, article.CategoryID,
+			dto.Breadcrumb{Type: "article", ID: article.ID, Name: article.Title, Slug: article.Slug}), nil
+
+	case "document":
+		document, err := repos.Documents.GetBySlug(ctx, slug)
+		if err != nil {
+			return nil, err
+		}
+		// Restricted documents come with their breadcrumbs to those who may
+		// see them
+		if document.Status != "published" || !isPublic(document) {
+			return nil, sql.ErrNoRows
+		}
+		return contentBreadcrumbs(ctx, repos.Categories, document.CategoryID,
+			dto.Breadcrumb{Type: "document", ID: document.ID, Name: document.Title, Slug: document.Slug}), nil
+
+	case "media":
+		media, err := repos.MediaItems.GetBySlug(ctx, slug)
+		if err != nil {
+			return nil, err
+		}
+		if media.Status != "published" {
+			return nil, sql.ErrNoRows
+		}
+		return contentBreadcrumbs(ctx, repos.Categories, media.CategoryID,
+			dto.Breadcrumb{Type: "media", ID: media.ID, Name: media.Title, Slug: media.Slug}), nil
+
+	case "page":
+		page, err := repos.Pages.GetBySlug(ctx, slug)
+		if err != nil {
+			return nil, err
+		}
+		if page.Status != models.PageStatusPublished || !page.IsActive {
+			return nil, sql.ErrNoRows
+		}
+		return pageBreadcrumbs(page), nil
+	}
+
+	return nil, errUnknownBreadcrumbType
+}
+
+// Breadcrumb Handler
+type BreadcrumbHandler struct {
+	repos *database.Repositories
+}
+
+func NewBreadcrumbHandler(repos *database.Repositories) *BreadcrumbHandler {
+	return &BreadcrumbHandler{repos: repos}
+}
+
+// @Summary Get breadcrumbs
+// @Description Get the navigation path, root first, for a published category, article, document, media item or page
+// @Tags Navigation
+// @Produce json
+// @Param type query string true "Content type: category, article, document, media or page"
+// @Param slug query string true "Content slug"
+// @Success 200 {object} dto.SuccessResponse{data=[]dto.Breadcrumb}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/breadcrumbs [get]
+func (h *BreadcrumbHandler) Get(c *gin.Context) {
+	slug := c.Query("slug")
+	if slug == "" {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_request", "slug is required")
+		return
+	}
+
+	crumbs, err := resolveBreadcrumbs(c.Request.Context(), h.repos, c.Query("type"), slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnknownBreadcrumbType):
+			middleware.AbortWithError(c, http.StatusBadRequest, "invalid_type", err.Error())
+		case errors.Is(err, sql.ErrNoRows):
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Content not found")
+		default:
+			middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to resolve breadcrumbs")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: crumbs})
+}
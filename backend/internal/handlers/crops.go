@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thieugt95/portal-365/backend/internal/config"
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/imaging"
+	"github.com/thieugt95/portal-365/backend/internal/middleware"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+	"github.com/thieugt95/portal-365/backend/internal/usage"
+	"github.com/thieugt95/portal-365/backend/internal/watermark"
+)
+
+// Crop presets with a fixed role. Banners use the preset named after their
+// placement and fall back to DefaultBannerPreset.
+const (
+	DefaultBannerPreset = "banner"
+	ArticleHeroPreset   = "article-hero"
+	CardPreset          = "card"
+	SocialPreset        = "social"
+)
+
+// articleCropPresets are the crops made of article featured images and page hero images
+var articleCropPresets = []string{ArticleHeroPreset, CardPreset, SocialPreset}
+
+// presetNamePattern keeps preset names usable as a path segment of /img URLs
+var presetNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// focalPoint returns the focal point set on an image, or nil
+func focalPoint(ctx context.Context, focal repositories.FocalPointRepository, imageURL string) *imaging.FocalPoint {
+	source := imaging.SourceURL(imageURL)
+	if source == "" {
+		return nil
+	}
+	point, err := focal.Get(ctx, source)
+	if err != nil {
+		return nil
+	}
+	return &imaging.FocalPoint{X: point.X, Y: point.Y}
+}
+
+// bannerPreset returns the preset a banner placement is cropped to
+func bannerPreset(ctx context.Context, presets repositories.CropPresetRepository, placement string) (*models.CropPreset, error) {
+	preset, err := presets.GetByName(ctx, placement)
+	if errors.Is(err, sql.ErrNoRows) {
+		preset, err = presets.GetByName(ctx, DefaultBannerPreset)
+	}
+	return preset, err
+}
+
+// withBannerCrops points each banner's crop_url at its image cropped to the
+// placement's preset around the image's focal point
+func withBannerCrops(ctx context.Context, repos *database.Repositories, banners ...*models.Banner) {
+	presets := make(map[string]*models.CropPreset)
+	for _, banner := range banners {
+		preset, ok := presets[banner.Placement]
+		if !ok {
+			preset, _ = bannerPreset(ctx, repos.Crops, banner.Placement)
+			presets[banner.Placement] = preset
+		}
+		if preset != nil {
+			banner.CropURL = imaging.CropURL(preset.Name, banner.ImageURL, focalPoint(ctx, repos.Focal, banner.ImageURL))
+		}
+	}
+}
+
+// presetCrops returns the crop URLs of an image for the named presets that exist
+func presetCrops(ctx context.Context, repos *database.Repositories, imageURL string, names []string) map[string]string {
+	if imaging.SourceURL(imageURL) == "" {
+		return nil
+	}
+	focus := focalPoint(ctx, repos.Focal, imageURL)
+	crops := make(map[string]string)
+	for _, name := range names {
+		if _, err := repos.Crops.GetByName(ctx, name); err == nil {
+			crops[name] = imaging.CropURL(name, imageURL, focus)
+		}
+	}
+	return crops
+}
+
+// warmCrops renders the crops of an image for presets in the background, so
+// the first visitor does not wait for them
+func warmCrops(cropper *imaging.Cropper, marks *watermark.Service, imageURL string, focus *imaging.FocalPoint, presets ...*models.CropPreset) {
+	source := imaging.SourceURL(imageURL)
+	if source == "" || len(presets) == 0 {
+		return
+	}
+	if focus == nil {
+		focus = &imaging.Center
+	}
+	go func() {
+		ctx := context.Background()
+		src, err := cropper.Source(ctx, storage.Key(source))
+		if err != nil {
+			return
+		}
+		wm, err := marks.Due(ctx, source)
+		if err != nil {
+			log.Printf("Failed to look up the watermark for %s: %v", source, err)
+			return
+		}
+		for _, preset := range presets {
+			size := config.ImageSize{Width: preset.Width, Height: preset.Height}
+			if _, err := cropper.Crop(ctx, src, size, *focus, wm); err != nil {
+				log.Printf("Failed to crop %s to %s: %v", source, preset.Name, err)
+			}
+		}
+	}()
+}
+
+// CropHandler manages crop presets and the focal points of images
+type CropHandler struct {
+	repos   *database.Repositories
+	cropper *imaging.Cropper
+	marks   *watermark.Service
+}
+
+func NewCropHandler(cfg *config.Config, repos *database.Repositories, store storage.Storage, marks *watermark.Service) *CropHandler {
+	return &CropHandler{repos: repos, cropper: imaging.NewCropper(cfg, store), marks: marks}
+}
+
+// ListPresets godoc
+// @Summary List crop presets (Admin)
+// @Description Get the named sizes images are cropped to. Each can be requested as /img/{name}/{path}.
+// @Tags Crops
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} dto.SuccessResponse{data=[]models.CropPreset}
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/crop-presets [get]
+func (h *CropHandler) ListPresets(c *gin.Context) {
+	presets, err := h.repos.Crops.List(c.Request.Context())
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch crop presets")
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: presets})
+}
+
+// CreatePreset godoc
+// @Summary Create crop preset (Admin)
+// @Description Add a named crop size. Name a preset after a banner placement to crop that placement's banners to it.
+// @Tags Crops
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param preset body dto.CropPresetRequest true "Preset"
+// @Success 201 {object} dto.SuccessResponse{data=models.CropPreset}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/crop-presets [post]
+func (h *CropHandler) CreatePreset(c *gin.Context) {
+	var req dto.CropPresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+	if !presetNamePattern.MatchString(req.Name) {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", "Preset names use lowercase letters, digits, - and _")
+		return
+	}
+	if _, err := h.repos.Crops.GetByName(c.Request.Context(), req.Name); err == nil {
+		middleware.AbortWithError(c, http.StatusConflict, "PRESET_EXISTS", "A crop preset with this name already exists")
+		return
+	}
+
+	preset := &models.CropPreset{Name: req.Name, Description: req.Description, Width: req.Width, Height: req.Height}
+	if err := h.repos.Crops.Create(c.Request.Context(), preset); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create crop preset")
+		return
+	}
+	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: preset})
+}
+
+// UpdatePreset godoc
+// @Summary Update crop preset (Admin)
+// @Description Change the name, description or size of a crop preset. Crops already made for the old size stay in the image cache until gc-uploads prunes them.
+// @Tags Crops
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Preset ID"
+// @Param preset body dto.CropPresetRequest true "Preset"
+// @Success 200 {object} dto.SuccessResponse{data=models.CropPreset}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/crop-presets/{id} [put]
+func (h *CropHandler) UpdatePreset(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_ID", "Invalid preset ID")
+		return
+	}
+	var req dto.CropPresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+	if !presetNamePattern.MatchString(req.Name) {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", "Preset names use lowercase letters, digits, - and _")
+		return
+	}
+	if other, err := h.repos.Crops.GetByName(c.Request.Context(), req.Name); err == nil && other.ID != id {
+		middleware.AbortWithError(c, http.StatusConflict, "PRESET_EXISTS", "A crop preset with this name already exists")
+		return
+	}
+
+	preset := &models.CropPreset{ID: id, Name: req.Name, Description: req.Description, Width: req.Width, Height: req.Height}
+	err = h.repos.Crops.Update(c.Request.Context(), preset)
+	if errors.Is(err, sql.ErrNoRows) {
+		middleware.AbortWithError(c, http.StatusNotFound, "NOT_FOUND", "Crop preset not found")
+		return
+	}
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update crop preset")
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: preset})
+}
+
+// DeletePreset godoc
+// @Summary Delete crop preset (Admin)
+// @Description Delete a crop preset. The banner preset cannot be deleted, since placements without their own preset use it.
+// @Tags Crops
+// @Security BearerAuth
+// @Param id path int true "Preset ID"
+// @Success 204
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/crop-presets/{id} [delete]
+func (h *CropHandler) DeletePreset(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_ID", "Invalid preset ID")
+		return
+	}
+	ctx := c.Request.Context()
+
+	preset, err := h.repos.Crops.GetByID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		middleware.AbortWithError(c, http.StatusNotFound, "NOT_FOUND", "Crop preset not found")
+		return
+	}
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete crop preset")
+		return
+	}
+	if preset.Name == DefaultBannerPreset {
+		middleware.AbortWithError(c, http.StatusBadRequest, "PRESET_REQUIRED", "The banner preset is used by placements without their own preset")
+		return
+	}
+
+	if err := h.repos.Crops.Delete(ctx, id); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete crop preset")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// imageSource resolves the url parameter to an uploaded image, writing the
+// error response and returning "" when it is not one
+func (h *CropHandler) imageSource(c *gin.Context, imageURL string) string {
+	source := imaging.SourceURL(imageURL)
+	if source == "" {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_URL", "Focal points can only be set on uploaded images")
+		return ""
+	}
+	if _, err := h.cropper.Source(c.Request.Context(), storage.Key(source)); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			middleware.AbortWithError(c, http.StatusNotFound, "NOT_FOUND", "Image not found")
+		} else if errors.Is(err, imaging.ErrNotCroppable) {
+			middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_URL", "Focal points can only be set on uploaded images")
+		} else {
+			middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to read image")
+		}
+		return ""
+	}
+	return source
+}
+
+// usedPresets returns the presets an image is cropped to where it is used: the
+// placement presets of banners showing it, and the article presets when it is
+// an article featured image or page hero image
+func (h *CropHandler) usedPresets(ctx context.Context, source string) []*models.CropPreset {
+	refs, err := h.repos.FileRefs.ListByURLs(ctx, []string{source})
+	if err != nil {
+		return nil
+	}
+
+	names := make(map[string]bool)
+	for _, ref := range refs {
+		switch {
+		case ref.OwnerType == usage.OwnerBanner:
+			if banner, err := h.repos.Banners.GetByID(ctx, ref.OwnerID); err == nil {
+				if preset, err := bannerPreset(ctx, h.repos.Crops, banner.Placement); err == nil {
+					names[preset.Name] = true
+				}
+			}
+		case ref.Field == usage.FieldFeaturedImage || ref.Field == usage.FieldHeroImage:
+			for _, name := range articleCropPresets {
+				names[name] = true
+			}
+		}
+	}
+
+	var presets []*models.CropPreset
+	for name := range names {
+		if preset, err := h.repos.Crops.GetByName(ctx, name); err == nil {
+			presets = append(presets, preset)
+		}
+	}
+	return presets
+}
+
+// GetFocalPoint godoc
+// @Summary Get image focal point (Admin)
+// @Description Get the focal point of an uploaded image. Images without one are cropped around their centre.
+// @Tags Crops
+// @Security BearerAuth
+// @Produce json
+// @Param url query string true "Image URL under /static/uploads/"
+// @Success 200 {object} dto.SuccessResponse{data=models.FocalPoint}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /admin/images/focal-point [get]
+func (h *CropHandler) GetFocalPoint(c *gin.Context) {
+	source := imaging.SourceURL(c.Query("url"))
+	if source == "" {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_URL", "Focal points can only be set on uploaded images")
+		return
+	}
+	point, err := h.repos.Focal.Get(c.Request.Context(), source)
+	if errors.Is(err, sql.ErrNoRows) {
+		middleware.AbortWithError(c, http.StatusNotFound, "NOT_FOUND", "No focal point set on this image")
+		return
+	}
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch focal point")
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: point})
+}
+
+// SetFocalPoint godoc
+// @Summary Set image focal point (Admin)
+// @Description Set the point of an uploaded image that crops keep in view, as fractions (0-1) of its width and height from the top left. The crops for the presets the image is used with are regenerated in the background.
+// @Tags Crops
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param focal body dto.FocalPointRequest true "Image URL and focal point"
+// @Success 200 {object} dto.SuccessResponse{data=models.FocalPoint}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/images/focal-point [put]
+func (h *CropHandler) SetFocalPoint(c *gin.Context) {
+	var req dto.FocalPointRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+	source := h.imageSource(c, req.URL)
+	if source == "" {
+		return
+	}
+
+	point := &models.FocalPoint{
+		SourceURL: source,
+		X:         math.Round(*req.X*10000) / 10000,
+		Y:         math.Round(*req.Y*10000) / 10000,
+		UpdatedBy: c.GetInt64("user_id"),
+	}
+	if err := h.repos.Focal.Set(c.Request.Context(), point); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to save focal point")
+		return
+	}
+
+	warmCrops(h.cropper, h.marks, source, &imaging.FocalPoint{X: point.X, Y: point.Y}, h.usedPresets(c.Request.Context(), source)...)
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: point})
+}
+
+// DeleteFocalPoint godoc
+// @Summary Clear image focal point (Admin)
+// @Description Go back to cropping an image around its centre
+// @Tags Crops
+// @Security BearerAuth
+// @Param url query string true "Image URL under /static/uploads/"
+// @Success 204
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/images/focal-point [delete]
+func (h *CropHandler) DeleteFocalPoint(c *gin.Context) {
+	source := imaging.SourceURL(c.Query("url"))
+	if source == "" {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_URL", "Focal points can only be set on uploaded images")
+		return
+	}
+	if err := h.repos.Focal.Delete(c.Request.Context(), source); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to clear focal point")
+		return
+	}
+	warmCrops(h.cropper, h.marks, source, nil, h.usedPresets(c.Request.Context(), source)...)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/middleware"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+)
+
+// documentTokenTTL is how long the download and preview links of a
+// restricted document work once handed out
+const documentTokenTTL = 15 * time.Minute
+
+// documentViewer describes the user of a request to the public document
+// routes. Administrators and editors see every document.
+func documentViewer(c *gin.Context) *repositories.DocumentViewer {
+	viewer := &repositories.DocumentViewer{UserID: c.GetInt64("user_id"), Roles: c.GetStringSlice("user_roles")}
+	for _, role := range viewer.Roles {
+		if role == "Admin" || role == "Editor" {
+			viewer.All = true
+		}
+	}
+	return viewer
+}
+
+// authorize checks that the user may see a restricted document. Links to its
+// files carry an access token standing in for the user, since browsers open
+// them without the Authorization header. Refusals of signed-in users are
+// audited. On refusal the response is written and false returned.
+func (h *DocumentsHandler) authorize(c *gin.Context, document *models.Document) bool {
+	if isPublic(document) {
+		return true
+	}
+	if token := c.Query("access"); token != "" {
+		claims, err := middleware.ParseDocumentToken(h.cfg, token)
+		if err != nil || claims.DocumentID != document.ID {
+			middleware.AbortWithError(c, http.StatusUnauthorized, "invalid_access_token", "The link has expired; open the document again")
+			return false
+		}
+		c.Set("user_id", claims.UserID)
+		c.Set("user_roles", claims.Roles)
+	}
+
+	viewer := documentViewer(c)
+	if viewer.CanView(document) {
+		return true
+	}
+	if viewer.UserID == 0 {
+		middleware.AbortWithError(c, http.StatusUnauthorized, "login_required", "Sign in to see this document")
+		return false
+	}
+	h.auditAccess(c, document, "access_denied", 0)
+	middleware.AbortWithError(c, http.StatusForbidden, "forbidden", "You are not allowed to see this document")
+	return false
+}
+
+// auditAccess records who saw or fetched a restricted document, and from
+// where. version is that of the file fetched, or 0.
+func (h *DocumentsHandler) auditAccess(c *gin.Context, document *models.Document, action string, version int) {
+	if isPublic(document) {
+		return
+	}
+	details := gin.H{"visibility": document.Visibility, "user_agent": c.GetHeader("User-Agent")}
+	if version > 0 {
+		details["version"] = version
+	}
+	recordAudit(c, h.repos, action, "document", document.ID, details)
+}
+
+func isPublic(document *models.Document) bool {
+	return document.Visibility == "" || document.Visibility == repositories.VisibilityPublic
+}
+
+// withAccessTokens adds an access token for the user to the file links of a
+// restricted document and its versions
+func (h *DocumentsHandler) withAccessTokens(c *gin.Context, document *models.Document, versions []models.DocumentVersion) {
+	if isPublic(document) || document.DownloadURL == "" {
+		return
+	}
+	token, err := middleware.GenerateDocumentToken(h.cfg, c.GetInt64("user_id"), c.GetStringSlice("user_roles"), document.ID, documentTokenTTL)
+	if err != nil {
+		log.Printf("Failed to sign access token for document %d: %v", document.ID, err)
+		return
+	}
+	query := "?access=" + token
+	document.DownloadURL += query
+	document.PreviewURL += query
+	for i := range versions {
+		if versions[i].DownloadURL != "" {
+			versions[i].DownloadURL += query
+		}
+	}
+}
+
+// checkVisibility checks the visibility of a document and the roles it is
+// restricted to. An empty visibility means public. On invalid input the
+// response is written and false returned.
+func (h *DocumentsHandler) checkVisibility(c *gin.Context, document *models.Document) bool {
+	switch document.Visibility {
+	case "":
+		document.Visibility = repositories.VisibilityPublic
+	case repositories.VisibilityPublic, repositories.VisibilityAuthenticated, repositories.VisibilityRoles:
+	default:
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_visibility", "Visibility must be public, authenticated or roles")
+		return false
+	}
+
+	if document.Visibility != repositories.VisibilityRoles {
+		document.RoleIDs = nil
+		return true
+	}
+	if len(document.RoleIDs) == 0 {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_visibility", "Choose the roles that may see the document")
+		return false
+	}
+	for _, id := range document.RoleIDs {
+		if _, err := h.repos.Roles.GetByID(c.Request.Context(), id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				middleware.AbortWithError(c, http.StatusBadRequest, "invalid_visibility", fmt.Sprintf("Role %d does not exist", id))
+				return false
+			}
+			middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch roles")
+			return false
+		}
+	}
+	return true
+}
+
+// privateDocumentURL names a new private file for a restricted document.
+// Private files are not shared between documents, so they are named at
+// random rather than by content.
+func privateDocumentURL(ext string) (string, error) {
+	name := make([]byte, 16)
+	if _, err := rand.Read(name); err != nil {
+		return "", err
+	}
+	return DocumentPrivatePrefix + "/" + time.Now().Format("2006/01") + "/" + hex.EncodeToString(name) + ext, nil
+}
+
+// releaseDocumentFile drops the file of a document version: private files
+// belong to that version alone, uploads are shared and counted
+func (h *DocumentsHandler) releaseDocumentFile(ctx context.Context, url string) {
+	if !storage.IsPrivate(storage.Key(url)) {
+		releaseFile(ctx, h.store, h.blobs, nil, url)
+		return
+	}
+	if err := h.store.Delete(ctx, storage.Key(url)); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("Failed to remove stored file %s: %v", url, err)
+	}
+}
+
+// moveFiles moves the files of every version of a document into private
+// storage, or back to the public uploads, as its visibility changes. Each
+// version row holds one reference to a public file.
+func (h *DocumentsHandler) moveFiles(ctx context.Context, id int64, private bool) error {
+	versions, err := h.repo.ListVersions(ctx, id)
+	if err != nil {
+		return err
+	}
+	refs := map[string]int{}
+	var urls []string
+	for _, version := range versions {
+		key := storage.Key(version.FilePath)
+		if key == "" || storage.IsPrivate(key) == private {
+			continue
+		}
+		if refs[version.FilePath] == 0 {
+			urls = append(urls, version.FilePath)
+		}
+		refs[version.FilePath]++
+	}
+
+	for _, url := range urls {
+		var err error
+		if private {
+			err = h.hideFile(ctx, id, url, refs[url])
+		} else {
+			err = h.publishFile(ctx, id, url, refs[url])
+		}
+		if errors.Is(err, storage.ErrNotFound) {
+			log.Printf("File %s of document %d is missing; left in place", url, id)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hideFile copies a public file of a document to private storage and drops
+// the document's refs references to the public copy. Copies from before
+// content addressing are not counted, and are removed outright.
+func (h *DocumentsHandler) hideFile(ctx context.Context, id int64, url string, refs int) error {
+	obj, info, err := h.store.Get(ctx, storage.Key(url))
+	if err != nil {
+		return err
+	}
+	privateURL, err := privateDocumentURL(path.Ext(url))
+	if err == nil {
+		err = h.store.Put(ctx, storage.Key(privateURL), obj, info.Size, info.ContentType)
+	}
+	obj.Close()
+	if err != nil {
+		return err
+	}
+	if err := h.repo.MoveFile(ctx, id, url, privateURL); err != nil {
+		h.releaseDocumentFile(ctx, privateURL)
+		return err
+	}
+
+	for i := 0; i < refs; i++ {
+		remaining, err := h.blobs.Release(ctx, url)
+		if errors.Is(err, sql.ErrNoRows) {
+			if err := h.store.Delete(ctx, storage.Key(url)); err != nil {
+				log.Printf("Failed to remove stored file %s: %v", url, err)
+			}
+			return nil
+		}
+		if err != nil {
+			log.Printf("Failed to release stored file %s: %v", url, err)
+			return nil
+		}
+		if remaining == 0 {
+			if err := purgeFile(ctx, h.store, h.blobs, nil, url); err != nil {
+				log.Printf("Failed to remove stored file %s: %v", url, err)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// publishFile stores a private file of a document with the public uploads,
+// taking refs references to it, and removes the private copy
+func (h *DocumentsHandler) publishFile(ctx context.Context, id int64, url string, refs int) error {
+	obj, info, err := h.store.Get(ctx, storage.Key(url))
+	if err != nil {
+		return err
+	}
+	staged, err := stageFile(obj, DocumentStaticPrefix+"/"+time.Now().Format("2006/01"), path.Ext(url))
+	obj.Close()
+	if err != nil {
+		return err
+	}
+	publicURL, _, err := staged.commit(ctx, h.store, h.blobs, info.ContentType)
+	if err != nil {
+		return err
+	}
+	taken := 1
+	for taken < refs {
+		blob := &models.StoredBlob{SHA256: staged.SHA256, URL: publicURL, Size: staged.Size, MimeType: info.ContentType}
+		if err = h.blobs.Acquire(ctx, blob); err != nil {
+			break
+		}
+		taken++
+	}
+	if err == nil {
+		err = h.repo.MoveFile(ctx, id, url, publicURL)
+	}
+	if err != nil {
+		for ; taken > 0; taken-- {
+			releaseFile(ctx, h.store, h.blobs, nil, publicURL)
+		}
+		return err
+	}
+
+	h.releaseDocumentFile(ctx, url)
+	return nil
+}
+
+// @Summary Document access log (Admin)
+// @Description Get the audited accesses to a document, newest first: views (view), file downloads (download) and previews (preview) of a restricted document, and refusals of signed-in users without access (access_denied), each with the user, IP address and details (visibility, version, user_agent). Public documents are not audited.
+// @Tags documents
+// @Security Bearer
+// @Produce json
+// @Param id path int true "Document ID"
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} dto.SuccessResponse{data=[]models.AuditLog}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/documents/{id}/access-log [get]
+func (h *DocumentsHandler) AccessLog(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_id", "Invalid document ID")
+		return
+	}
+	if _, err := h.repo.GetByID(c.Request.Context(), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Document not found")
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document")
+		return
+	}
+
+	page := getPage(c)
+	pageSize := getPageSize(c)
+	logs, total, err := h.repos.AuditLogs.ListByEntity(c.Request.Context(), "document", id, page, pageSize)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch access log")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Data:       logs,
+		Pagination: getPagination(page, pageSize, total),
+	})
+}
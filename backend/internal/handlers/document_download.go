@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/thieugt95/portal-365/backend/internal/middleware"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+)
+
+// downloadWindow is how long repeated downloads by one client count once
+const downloadWindow = time.Hour
+
+// @Summary Download a document (Public)
+// @Description Stream the file of a published document as an attachment named after its title. Range and conditional (ETag) requests are supported. A download is counted once per client per hour; ranges after the first byte, HEAD requests and 304 responses are not counted. Restricted documents need a signed-in user or the access token of their links, and each download of them is audited with the user and IP address.
+// @Tags documents
+// @Produce octet-stream
+// @Param slug path string true "Document slug"
+// @Param access query string false "Access token from the file link of a restricted document"
+// @Param Range header string false "Byte range, e.g. bytes=0-1023"
+// @Param If-None-Match header string false "ETag from an earlier response"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Success 304 "Not modified"
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 416 "Range not satisfiable"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/documents/{slug}/download [get]
+func (h *DocumentsHandler) Download(c *gin.Context) {
+	if document := h.publishedDocument(c); document != nil {
+		h.serveFile(c, document, currentVersion(document), "attachment")
+	}
+}
+
+// @Summary Preview a document (Public)
+// @Description Stream the file of a published document for display in the browser. Range and conditional (ETag) requests are supported. Previews are not counted as downloads; previews of restricted documents are audited like downloads.
+// @Tags documents
+// @Produce octet-stream
+// @Param slug path string true "Document slug"
+// @Param access query string false "Access token from the file link of a restricted document"
+// @Param Range header string false "Byte range, e.g. bytes=0-1023"
+// @Param If-None-Match header string false "ETag from an earlier response"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Success 304 "Not modified"
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 416 "Range not satisfiable"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/documents/{slug}/preview [get]
+func (h *DocumentsHandler) Preview(c *gin.Context) {
+	if document := h.publishedDocument(c); document != nil {
+		h.serveFile(c, document, currentVersion(document), "inline")
+	}
+}
+
+// @Summary Download a document version (Public)
+// @Description Stream a given version of a published document's file, current or earlier, as an attachment. Earlier versions are named after the title with the version number. Like the current file, downloads are counted, and the ETag and Repr-Digest headers carry the version's SHA-256 checksum when it is known.
+// @Tags documents
+// @Produce octet-stream
+// @Param slug path string true "Document slug"
+// @Param version path int true "Version number"
+// @Param access query string false "Access token from the file link of a restricted document"
+// @Param Range header string false "Byte range, e.g. bytes=0-1023"
+// @Param If-None-Match header string false "ETag from an earlier response"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Success 304 "Not modified"
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 416 "Range not satisfiable"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/documents/{slug}/versions/{version}/download [get]
+func (h *DocumentsHandler) DownloadVersion(c *gin.Context) {
+	document := h.publishedDocument(c)
+	if document == nil {
+		return
+	}
+
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusNotFound, "version_not_found", "Document version not found")
+		return
+	}
+	version, err := h.repo.GetVersion(c.Request.Context(), document.ID, number)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middleware.AbortWithError(c, http.StatusNotFound, "version_not_found", "Document version not found")
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document version")
+		return
+	}
+
+	h.serveFile(c, document, version, "attachment")
+}
+
+// publishedDocument looks up the document named by the slug parameter.
+// Unpublished documents are answered as if they did not exist, and the user
+// must be allowed to see restricted ones. On failure the response is written
+// and nil returned.
+func (h *DocumentsHandler) publishedDocument(c *gin.Context) *models.Document {
+	document, err := h.repo.GetBySlug(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Document not found")
+			return nil
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document")
+		return nil
+	}
+	if document.Status != "published" {
+		middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Document not found")
+		return nil
+	}
+	if !h.authorize(c, document) {
+		return nil
+	}
+	return document
+}
+
+// currentVersion describes the current file of a document as a version
+func currentVersion(document *models.Document) *models.DocumentVersion {
+	return &models.DocumentVersion{
+		DocumentID: document.ID,
+		Version:    document.Version,
+		FilePath:   document.FilePath,
+		FileSize:   document.FileSize,
+		MimeType:   document.MimeType,
+		SHA256:     document.SHA256,
+		Current:    true,
+	}
+}
+
+func (h *DocumentsHandler) serveFile(c *gin.Context, document *models.Document, version *models.DocumentVersion, disposition string) {
+	ctx := c.Request.Context()
+
+	obj, info, err := h.store.Get(ctx, storage.Key(version.FilePath))
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		middleware.AbortWithError(c, http.StatusNotFound, "file_not_found", "Document file not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to open file of document %d: %v", document.ID, err)
+		middleware.AbortWithError(c, http.StatusInternalServerError, "storage_error", "Failed to read document file")
+		return
+	}
+	defer obj.Close()
+
+	contentType := version.MimeType
+	if contentType == "" {
+		contentType = info.ContentType
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", contentDisposition(disposition, documentFilename(document, version)))
+	if digest, err := hex.DecodeString(version.SHA256); err == nil && len(digest) == sha256.Size {
+		// The checksum identifies the content exactly, and lets clients
+		// verify what they received (RFC 9530)
+		c.Header("ETag", `"`+version.SHA256+`"`)
+		c.Header("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(digest)+":")
+	} else {
+		c.Header("ETag", fileETag(info))
+	}
+	c.Header("Accept-Ranges", "bytes")
+	// Revalidated on every use, so downloads keep reaching the counter.
+	// Restricted documents are kept out of shared caches.
+	if isPublic(document) {
+		c.Header("Cache-Control", "no-cache")
+	} else {
+		c.Header("Cache-Control", "private, no-cache")
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime, obj)
+
+	if !countsAsDownload(c) {
+		return
+	}
+	action := "preview"
+	if disposition == "attachment" {
+		action = "download"
+	}
+	h.auditAccess(c, document, action, version.Version)
+	if disposition == "attachment" {
+		// Counted once the file is sent, even if the client has gone by now
+		_, err := h.repo.RecordDownload(context.WithoutCancel(ctx), document.ID, c.ClientIP(), c.GetHeader("User-Agent"), downloadWindow)
+		if err != nil {
+			log.Printf("Failed to record download of document %d: %v", document.ID, err)
+		}
+	}
+}
+
+// countsAsDownload reports whether a served request fetched the file, rather
+// than a later part of it, its headers or a cache revalidation. Such fetches
+// of restricted documents are audited, and downloads counted.
+func countsAsDownload(c *gin.Context) bool {
+	if c.Request.Method != http.MethodGet {
+		return false
+	}
+	switch c.Writer.Status() {
+	case http.StatusOK:
+		return true
+	case http.StatusPartialContent:
+		return strings.HasPrefix(strings.TrimSpace(c.GetHeader("Range")), "bytes=0-")
+	}
+	return false
+}
+
+// fileETag is the stored object's ETag, or one made from its size and
+// modification time for backends that have none
+func fileETag(info *storage.ObjectInfo) string {
+	if info.ETag != "" {
+		return info.ETag
+	}
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime.UnixNano(), info.Size)
+}
+
+// documentFilename names a version of a document's file after its title,
+// keeping the extension of the stored file. Earlier versions get their
+// number appended, so they do not overwrite the current one when saved.
+func documentFilename(document *models.Document, version *models.DocumentVersion) string {
+	ext := path.Ext(version.FilePath)
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '/' || r == '\\' {
+			return ' '
+		}
+		return r
+	}, document.Title)
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return path.Base(version.FilePath)
+	}
+	if strings.EqualFold(path.Ext(name), ext) {
+		name = name[:len(name)-len(ext)]
+	}
+	if !version.Current {
+		name += fmt.Sprintf(" (v%d)", version.Version)
+	}
+	return name + ext
+}
+
+// contentDisposition builds a Content-Disposition header carrying the
+// filename twice: folded to ASCII for old clients, and in full as UTF-8
+// through the RFC 5987 filename* parameter, which clients prefer
+func contentDisposition(disposition, filename string) string {
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, asciiFilename(filename), encodeRFC5987(filename))
+}
+
+// asciiFilename strips Vietnamese diacritics and replaces whatever is left
+// outside printable ASCII, along with quotes and backslashes
+func asciiFilename(name string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	name, _, _ = transform.String(t, name)
+	name = strings.NewReplacer("đ", "d", "Đ", "D").Replace(name)
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// encodeRFC5987 percent-encodes the UTF-8 bytes of s outside the attr-char
+// set of RFC 5987
+func encodeRFC5987(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' ||
+			strings.IndexByte("!#$&+-.^_`|~", ch) >= 0 {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+	return b.String()
+}
+
+// withDocumentURLs fills in the download and preview links of a published
+// document
+func withDocumentURLs(document *models.Document) {
+	if document.Status != "published" {
+		return
+	}
+	document.DownloadURL = "/api/v1/documents/" + document.Slug + "/download"
+	document.PreviewURL = "/api/v1/documents/" + document.Slug + "/preview"
+}
+
+// withVersionURLs fills in the download links of the versions of a
+// published document
+func withVersionURLs(document *models.Document, versions []models.DocumentVersion) {
+	if document.Status != "published" {
+		return
+	}
+	for i := range versions {
+		versions[i].DownloadURL = fmt.Sprintf("/api/v1/documents/%s/versions/%d/download", document.Slug, versions[i].Version)
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/middleware"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+)
+
+// Bounds of the relation graph of a document, so that a large network of
+// references stays a readable response
+const (
+	relationGraphDepth = 3
+	relationGraphNodes = 50
+)
+
+// repealReplaced marks the documents a published document replaces as no
+// longer in force. A failure leaves them in force until the document is
+// saved again, so it is logged.
+func (h *DocumentsHandler) repealReplaced(ctx context.Context, id int64) {
+	repealed, err := h.relations.RepealReplaced(ctx, id)
+	if err != nil {
+		log.Printf("Failed to repeal the documents replaced by document %d: %v", id, err)
+		return
+	}
+	if repealed > 0 {
+		log.Printf("Document %d replaced %d documents, now marked repealed", id, repealed)
+	}
+}
+
+// @Summary List related documents (Admin)
+// @Description Get the documents a document is related to, whatever their status. relation reads from the document: amends, replaces, guides and references when it is the source, amended_by, replaced_by, guided_by and referenced_by when the other document is.
+// @Tags documents
+// @Security Bearer
+// @Produce json
+// @Param id path int true "Document ID"
+// @Success 200 {object} dto.SuccessResponse{data=[]models.RelatedDocument}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/documents/{id}/relations [get]
+func (h *DocumentsHandler) ListRelations(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_id", "Invalid document ID")
+		return
+	}
+
+	if _, err := h.repo.GetByID(c.Request.Context(), id); err != nil {
+		if err == sql.ErrNoRows {
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Document not found")
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document")
+		return
+	}
+
+	related, err := h.relations.ListRelated(c.Request.Context(), id, nil)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch related documents")
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: related})
+}
+
+// @Summary Relate documents (Admin)
+// @Description Record that a document amends, replaces, guides (implements) or references another. When the document replaces another and is published, or once it is published, the replaced document is marked repealed and so no longer in force; removing the relation later does not restore it.
+// @Tags documents
+// @Security Bearer
+// @Accept json
+// @Produce json
+// @Param id path int true "Document ID"
+// @Param relation body dto.DocumentRelationRequest true "Relation"
+// @Success 201 {object} dto.SuccessResponse{data=models.DocumentRelation}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/documents/{id}/relations [post]
+func (h *DocumentsHandler) CreateRelation(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_id", "Invalid document ID")
+		return
+	}
+	var req dto.DocumentRelationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_input", err.Error())
+		return
+	}
+	if req.RelatedID == id {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_relation", "A document cannot be related to itself")
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := h.repo.GetByID(ctx, id); err != nil {
+		if err == sql.ErrNoRows {
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Document not found")
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document")
+		return
+	}
+	if _, err := h.repo.GetByID(ctx, req.RelatedID); err != nil {
+		if err == sql.ErrNoRows {
+			middleware.AbortWithError(c, http.StatusBadRequest, "invalid_relation", "The related document does not exist")
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document")
+		return
+	}
+
+	if _, err := h.relations.Find(ctx, id, req.RelatedID, req.Type); err == nil {
+		middleware.AbortWithError(c, http.StatusConflict, "relation_exists", "The documents are already related this way")
+		return
+	}
+	// Two documents cannot amend or replace each other
+	cyclic := req.Type == repositories.RelationAmends || req.Type == repositories.RelationReplaces
+	if _, err := h.relations.Find(ctx, req.RelatedID, id, req.Type); cyclic && err == nil {
+		middleware.AbortWithError(c, http.StatusConflict, "relation_cycle",
+			"The related document already "+req.Type+" this document")
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	createdBy := userID.(int64)
+	relation := &models.DocumentRelation{DocumentID: id, RelatedID: req.RelatedID, Type: req.Type, CreatedBy: &createdBy}
+	if err := h.relations.Create(ctx, relation); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to relate documents")
+		return
+	}
+	if relation.Type == repositories.RelationReplaces {
+		h.repealReplaced(ctx, id)
+	}
+
+	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: relation})
+}
+
+// @Summary Remove a document relation (Admin)
+// @Description Remove a relation of a document, from either of its ends. A document repealed because of a replacement stays repealed until it is updated.
+// @Tags documents
+// @Security Bearer
+// @Produce json
+// @Param id path int true "Document ID"
+// @Param relationId path int true "Relation ID"
+// @Success 200 {object} dto.SuccessResponse{data=string}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/documents/{id}/relations/{relationId} [delete]
+func (h *DocumentsHandler) DeleteRelation(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_id", "Invalid document ID")
+		return
+	}
+	relationID, err := strconv.ParseInt(c.Param("relationId"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_id", "Invalid relation ID")
+		return
+	}
+
+	ctx := c.Request.Context()
+	relation, err := h.relations.GetByID(ctx, relationID)
+	if err == nil && relation.DocumentID != id && relation.RelatedID != id {
+		err = sql.ErrNoRows
+	}
+	if err == nil {
+		err = h.relations.Delete(ctx, relationID)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Relation not found")
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to remove relation")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: "Relation removed successfully"})
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/middleware"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+)
+
+// DocumentTermsHandler manages the vocabularies of document metadata:
+// document types, issuing authorities and signers
+type DocumentTermsHandler struct {
+	terms repositories.DocumentTermRepository
+}
+
+func NewDocumentTermsHandler(repos *database.Repositories) *DocumentTermsHandler {
+	return &DocumentTermsHandler{terms: repos.DocTerms}
+}
+
+// @Summary List document terms
+// @Description Get the entries of the document vocabularies in their sort order: document types (type), issuing authorities (authority) and signers (signer)
+// @Tags documents
+// @Produce json
+// @Param kind query string false "Only terms of this kind" Enums(type, authority, signer)
+// @Success 200 {object} dto.SuccessResponse{data=[]models.DocumentTerm}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/document-terms [get]
+func (h *DocumentTermsHandler) List(c *gin.Context) {
+	kind := c.Query("kind")
+	if _, ok := repositories.TermKinds[kind]; kind != "" && !ok {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_kind", "Kind must be type, authority or signer")
+		return
+	}
+
+	terms, err := h.terms.List(c.Request.Context(), kind)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document terms")
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: terms})
+}
+
+// @Summary Create document term (Admin)
+// @Description Add a document type, issuing authority or signer to its vocabulary
+// @Tags documents
+// @Security Bearer
+// @Accept json
+// @Produce json
+// @Param term body dto.DocumentTermRequest true "Term"
+// @Success 201 {object} dto.SuccessResponse{data=models.DocumentTerm}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/document-terms [post]
+func (h *DocumentTermsHandler) Create(c *gin.Context) {
+	var req dto.DocumentTermRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_input", err.Error())
+		return
+	}
+	if req.Kind == "" {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_kind", "Kind must be type, authority or signer")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_input", "Name is required")
+		return
+	}
+	if _, err := h.terms.GetByName(c.Request.Context(), req.Kind, name); err == nil {
+		middleware.AbortWithError(c, http.StatusConflict, "term_exists", "This term already exists")
+		return
+	}
+
+	term := &models.DocumentTerm{Kind: req.Kind, Name: name, SortOrder: req.SortOrder}
+	if err := h.terms.Create(c.Request.Context(), term); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to create document term")
+		return
+	}
+	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: term})
+}
+
+// @Summary Update document term (Admin)
+// @Description Rename or reorder a document vocabulary entry. Documents using it show the new name.
+// @Tags documents
+// @Security Bearer
+// @Accept json
+// @Produce json
+// @Param id path int true "Term ID"
+// @Param term body dto.DocumentTermRequest true "Term"
+// @Success 200 {object} dto.SuccessResponse{data=models.DocumentTerm}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/document-terms/{id} [put]
+func (h *DocumentTermsHandler) Update(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_id", "Invalid term ID")
+		return
+	}
+	var req dto.DocumentTermRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_input", err.Error())
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_input", "Name is required")
+		return
+	}
+
+	ctx := c.Request.Context()
+	term, err := h.terms.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Document term not found")
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document term")
+		return
+	}
+	if other, err := h.terms.GetByName(ctx, term.Kind, name); err == nil && other.ID != id {
+		middleware.AbortWithError(c, http.StatusConflict, "term_exists", "This term already exists")
+		return
+	}
+
+	term.Name, term.SortOrder = name, req.SortOrder
+	if err := h.terms.Update(ctx, term); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to update document term")
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: term})
+}
+
+// @Summary Delete document term (Admin)
+// @Description Delete a document vocabulary entry. Terms still used by documents cannot be deleted.
+// @Tags documents
+// @Security Bearer
+// @Produce json
+// @Param id path int true "Term ID"
+// @Success 200 {object} dto.SuccessResponse{data=string}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/document-terms/{id} [delete]
+func (h *DocumentTermsHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_id", "Invalid term ID")
+		return
+	}
+
+	ctx := c.Request.Context()
+	term, err := h.terms.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Document term not found")
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document term")
+		return
+	}
+	count, err := h.terms.CountDocuments(ctx, term)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to delete document term")
+		return
+	}
+	if count > 0 {
+		middleware.AbortWithError(c, http.StatusConflict, "term_in_use",
+			fmt.Sprintf("The term is used by %d documents", count))
+		return
+	}
+
+	if err := h.terms.Delete(ctx, id); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to delete document term")
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: "Document term deleted successfully"})
+}
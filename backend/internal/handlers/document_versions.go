@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/middleware"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+)
+
+// maxChangeNoteLength caps the change note of a version, in characters
+const maxChangeNoteLength = 1000
+
+// @Summary Upload a new document version (Admin)
+// @Description Replace the file of a document with a corrected one, keeping its slug, counters and metadata. The new file becomes the next version and earlier files stay downloadable by version number. The file is checked like an upload; a PDF with JavaScript or embedded files takes the document back to draft with security_flags set. A file identical to the current version is refused with 409. The SHA-256 checksum of the file is stored with the version. The file of a document not visible to everyone is stored privately.
+// @Tags documents
+// @Security Bearer
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "Document ID"
+// @Param file formData file true "Document file (max 10MB)"
+// @Param change_note formData string true "What changed in this version"
+// @Success 201 {object} dto.SuccessResponse{data=dto.DocumentVersionUploadResponse}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Failure 503 {object} dto.ErrorResponse
+// @Router /api/v1/admin/documents/{id}/versions [post]
+func (h *DocumentsHandler) UploadVersion(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_id", "Invalid document ID")
+		return
+	}
+
+	changeNote := strings.TrimSpace(c.PostForm("change_note"))
+	if changeNote == "" {
+		middleware.AbortWithError(c, http.StatusBadRequest, "change_note_required", "A change note is required")
+		return
+	}
+	if len([]rune(changeNote)) > maxChangeNoteLength {
+		middleware.AbortWithError(c, http.StatusBadRequest, "change_note_too_long", "The change note is too long")
+		return
+	}
+
+	ctx := c.Request.Context()
+	document, err := h.repo.GetByID(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Document not found")
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document")
+		return
+	}
+
+	upload := h.receiveFile(c)
+	if upload == nil {
+		return
+	}
+	staged := upload.staged
+	if staged.SHA256 == document.SHA256 {
+		staged.discard()
+		middleware.AbortWithError(c, http.StatusConflict, "unchanged_file", "The file is identical to the current version")
+		return
+	}
+
+	filePathURL, err := h.commitFile(ctx, staged, upload.contentType, isPublic(document))
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "storage_error", "Failed to save file")
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	version := &models.DocumentVersion{
+		DocumentID: id,
+		FilePath:   filePathURL,
+		FileSize:   staged.Size,
+		MimeType:   upload.contentType,
+		SHA256:     staged.SHA256,
+		ChangeNote: changeNote,
+		UploadedBy: userID.(int64),
+	}
+	if err := h.repo.AddVersion(ctx, version, strings.Join(upload.flags, ",")); err != nil {
+		h.releaseDocumentFile(ctx, filePathURL)
+		if err == sql.ErrNoRows {
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Document not found")
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "database_error", "Failed to save document version")
+		return
+	}
+	h.queueText(ctx, id)
+
+	document, err = h.repo.GetByID(ctx, id)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document")
+		return
+	}
+	withDocumentURLs(document)
+	versions := []models.DocumentVersion{*version}
+	withVersionURLs(document, versions)
+
+	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: dto.DocumentVersionUploadResponse{Document: document, Version: &versions[0]}})
+}
+
+// @Summary List document versions (Admin)
+// @Description Get the version history of a document, newest first, with the change note, uploader and SHA-256 checksum of each file
+// @Tags documents
+// @Security Bearer
+// @Produce json
+// @Param id path int true "Document ID"
+// @Success 200 {object} dto.SuccessResponse{data=[]models.DocumentVersion}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/documents/{id}/versions [get]
+func (h *DocumentsHandler) ListVersions(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_id", "Invalid document ID")
+		return
+	}
+
+	document, err := h.repo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Document not found")
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document")
+		return
+	}
+
+	versions, err := h.repo.ListVersions(c.Request.Context(), id)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document versions")
+		return
+	}
+	withDocumentURLs(document)
+	withVersionURLs(document, versions)
+	h.withAccessTokens(c, document, versions)
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: versions})
+}
@@ -1,137 +1,200 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/thieugt95/portal-365/backend/internal/config"
 	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/docindex"
 	"github.com/thieugt95/portal-365/backend/internal/dto"
 	"github.com/thieugt95/portal-365/backend/internal/middleware"
 	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/quarantine"
 	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/scan"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
 )
 
 type DocumentsHandler struct {
-	repo repositories.DocumentRepository
+	cfg        *config.Config
+	repos      *database.Repositories
+	repo       repositories.DocumentRepository
+	categories repositories.CategoryRepository
+	blobs      repositories.StoredBlobRepository
+	texts      repositories.DocumentTextRepository
+	terms      repositories.DocumentTermRepository
+	relations  repositories.DocumentRelationRepository
+	store      storage.Storage
+	guard      *quarantine.Service
+	extractor  *docindex.Service
 }
 
-func NewDocumentsHandler(repos *database.Repositories) *DocumentsHandler {
-	return &DocumentsHandler{repo: repos.Documents}
+func NewDocumentsHandler(cfg *config.Config, repos *database.Repositories, store storage.Storage, guard *quarantine.Service, extractor *docindex.Service) *DocumentsHandler {
+	return &DocumentsHandler{cfg: cfg, repos: repos, repo: repos.Documents, categories: repos.Categories, blobs: repos.Blobs, texts: repos.DocTexts,
+		terms: repos.DocTerms, relations: repos.DocLinks, store: store, guard: guard, extractor: extractor}
 }
 
 // @Summary List documents (Public)
-// @Description Get published documents with pagination and filtering
+// @Description Get the published documents the user may see with pagination, filtering and facet counts. Anonymous visitors see public documents; signed-in users also see those for authenticated users and those restricted to one of their roles, whose file links carry a short-lived access token. With q, documents are searched by title, description, number and the text of the file, ignoring diacritics; every word must appear and "quoted phrases" must appear as written. Search results come best match first with a snippet, matches wrapped in <mark>. document_no finds documents by their exact number. Facets count the matching documents by type, issuing authority, signer, validity and year of issue; each facet ignores its own filter.
 // @Tags documents
 // @Accept json
 // @Produce json
+// @Param q query string false "Search query"
+// @Param document_no query string false "Exact document number"
 // @Param category_id query int false "Category ID"
+// @Param include_descendants query bool false "Also match documents in child categories"
+// @Param type_id query int false "Document type (term ID)"
+// @Param authority_id query int false "Issuing authority (term ID)"
+// @Param signer_id query int false "Signer (term ID)"
+// @Param validity query string false "Validity status" Enums(in_force, expired, not_yet_effective)
+// @Param year query int false "Year of issue"
+// @Param issued_from query string false "Issued on or after (YYYY-MM-DD)"
+// @Param issued_to query string false "Issued on or before (YYYY-MM-DD)"
+// @Param effective_from query string false "Effective on or after (YYYY-MM-DD)"
+// @Param effective_to query string false "Effective on or before (YYYY-MM-DD)"
+// @Param expiry_from query string false "Expiring on or after (YYYY-MM-DD)"
+// @Param expiry_to query string false "Expiring on or before (YYYY-MM-DD)"
 // @Param page query int false "Page number" default(1)
 // @Param page_size query int false "Page size" default(20)
-// @Success 200 {object} dto.SuccessResponse{data=[]models.Document}
+// @Success 200 {object} dto.DocumentListResponse
+// @Failure 400 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/documents [get]
 func (h *DocumentsHandler) ListPublic(c *gin.Context) {
 	page := getPage(c)
 	pageSize := getPageSize(c)
-	categoryID := c.Query("category_id")
 
-	var catID *int64
-	if categoryID != "" {
-		id, err := strconv.ParseInt(categoryID, 10, 64)
-		if err == nil {
-			catID = &id
-		}
+	filter, ok := documentFilter(c)
+	if !ok {
+		return
 	}
-
-	documents, total, err := h.repo.ListPublished(c.Request.Context(), catID, page, pageSize)
+	filter.Viewer = documentViewer(c)
+	documents, total, err := h.repo.ListPublished(c.Request.Context(), filter, page, pageSize)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch documents")
+		return
+	}
+	facets, err := h.repo.PublishedFacets(c.Request.Context(), filter)
 	if err != nil {
 		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch documents")
 		return
 	}
+	for i := range documents {
+		withDocumentURLs(&documents[i])
+		h.withAccessTokens(c, &documents[i], nil)
+	}
 
-	c.JSON(http.StatusOK, dto.SuccessResponse{
+	c.JSON(http.StatusOK, dto.DocumentListResponse{
 		Data:       documents,
 		Pagination: getPagination(page, pageSize, total),
+		Facets:     facets,
 	})
 }
 
 // @Summary Get document by slug (Public)
-// @Description Get a published document by slug and increment view count
+// @Description Get a published document by slug and increment its view count. Documents not visible to everyone answer 401 to anonymous visitors and 403 to users without access; views of them are audited with the user and IP address, and their file links carry a short-lived access token. The document comes with its version history, the published documents it is related to (amends, replaces, guides, references, or amended_by, replaced_by, guided_by, referenced_by when the other document is the source), and a graph of the published documents reachable through relations, up to 3 relations away and 50 documents, for following chains of amendments and replacements.
 // @Tags documents
 // @Accept json
 // @Produce json
 // @Param slug path string true "Document slug"
-// @Success 200 {object} dto.SuccessResponse{data=models.Document}
+// @Success 200 {object} dto.SuccessResponse{data=dto.DocumentDetailResponse}
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/documents/{slug} [get]
 func (h *DocumentsHandler) GetBySlug(c *gin.Context) {
-	slug := c.Param("slug")
+	document := h.publishedDocument(c)
+	if document == nil {
+		return
+	}
+	viewer := documentViewer(c)
 
-	document, err := h.repo.GetBySlug(c.Request.Context(), slug)
+	versions, err := h.repo.ListVersions(c.Request.Context(), document.ID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Document not found")
-			return
-		}
-		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document")
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document versions")
 		return
 	}
 
-	// Only show published documents to public
-	if document.Status != "published" {
-		middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Document not found")
+	related, err := h.relations.ListRelated(c.Request.Context(), document.ID, viewer)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch related documents")
+		return
+	}
+	graph, err := h.relations.Graph(c.Request.Context(), document.ID, relationGraphDepth, relationGraphNodes, viewer)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch related documents")
 		return
 	}
 
 	// Increment view count
 	_ = h.repo.IncrementViewCount(c.Request.Context(), document.ID)
-
-	c.JSON(http.StatusOK, dto.SuccessResponse{Data: document})
+	h.auditAccess(c, document, "view", 0)
+	withDocumentURLs(document)
+	withVersionURLs(document, versions)
+	h.withAccessTokens(c, document, versions)
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: dto.DocumentDetailResponse{
+		Document: document,
+		Versions: versions,
+		Related:  related,
+		Graph:    graph,
+		Breadcrumbs: contentBreadcrumbs(c.Request.Context(), h.categories, document.CategoryID,
+			dto.Breadcrumb{Type: "document", ID: document.ID, Name: document.Title, Slug: document.Slug}),
+	}})
 }
 
 // @Summary List all documents (Admin)
-// @Description Get all documents with pagination
+// @Description Get all documents with pagination, each with the extraction status of its text and who may see it. q and the metadata filters work like the public listing.
 // @Tags documents
 // @Security Bearer
 // @Accept json
 // @Produce json
 // @Param page query int false "Page number" default(1)
 // @Param page_size query int false "Page size" default(20)
+// @Param q query string false "Search query"
+// @Param document_no query string false "Exact document number"
 // @Param status query string false "Filter by status"
 // @Param category_id query int false "Filter by category"
+// @Param include_descendants query bool false "Also match documents in child categories"
+// @Param type_id query int false "Document type (term ID)"
+// @Param authority_id query int false "Issuing authority (term ID)"
+// @Param signer_id query int false "Signer (term ID)"
+// @Param validity query string false "Validity status" Enums(in_force, expired, not_yet_effective)
+// @Param year query int false "Year of issue"
 // @Success 200 {object} dto.SuccessResponse{data=[]models.Document}
+// @Failure 400 {object} dto.ErrorResponse
 // @Failure 401 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/admin/documents [get]
 func (h *DocumentsHandler) List(c *gin.Context) {
 	page := getPage(c)
 	pageSize := getPageSize(c)
-	status := c.Query("status")
-	categoryID := c.Query("category_id")
-
-	var catID *int64
-	if categoryID != "" {
-		id, err := strconv.ParseInt(categoryID, 10, 64)
-		if err == nil {
-			catID = &id
-		}
-	}
 
-	documents, total, err := h.repo.List(c.Request.Context(), status, catID, page, pageSize)
+	filter, ok := documentFilter(c)
+	if !ok {
+		return
+	}
+	filter.Status = c.Query("status")
+	documents, total, err := h.repo.List(c.Request.Context(), filter, page, pageSize)
 	if err != nil {
 		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch documents")
 		return
 	}
+	for i := range documents {
+		withDocumentURLs(&documents[i])
+		h.withAccessTokens(c, &documents[i], nil)
+	}
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{
 		Data:       documents,
@@ -139,8 +202,117 @@ func (h *DocumentsHandler) List(c *gin.Context) {
 	})
 }
 
+// documentFilter reads the filters of a document listing from the query
+// string. On invalid input the response is written and false returned.
+func documentFilter(c *gin.Context) (*repositories.DocumentFilter, bool) {
+	filter := &repositories.DocumentFilter{
+		IncludeDescendants: c.Query("include_descendants") == "true",
+		Query:              c.Query("q"),
+		DocumentNo:         c.Query("document_no"),
+		Validity:           c.Query("validity"),
+	}
+
+	for name, id := range map[string]**int64{
+		"category_id":  &filter.CategoryID,
+		"type_id":      &filter.TypeID,
+		"authority_id": &filter.AuthorityID,
+		"signer_id":    &filter.SignerID,
+	} {
+		if value := c.Query(name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				middleware.AbortWithError(c, http.StatusBadRequest, "invalid_filter", "Invalid "+name)
+				return nil, false
+			}
+			*id = &parsed
+		}
+	}
+
+	switch filter.Validity {
+	case "", repositories.ValidityInForce, repositories.ValidityExpired, repositories.ValidityNotYetEffective:
+	default:
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_filter", "Validity must be in_force, expired or not_yet_effective")
+		return nil, false
+	}
+
+	if value := c.Query("year"); value != "" {
+		year, err := strconv.Atoi(value)
+		if err != nil || year < 1 || year > 9999 {
+			middleware.AbortWithError(c, http.StatusBadRequest, "invalid_filter", "Invalid year")
+			return nil, false
+		}
+		filter.Year = year
+	}
+
+	for name, date := range map[string]**time.Time{
+		"issued_from":    &filter.Issued.From,
+		"issued_to":      &filter.Issued.To,
+		"effective_from": &filter.Effective.From,
+		"effective_to":   &filter.Effective.To,
+		"expiry_from":    &filter.Expiry.From,
+		"expiry_to":      &filter.Expiry.To,
+	} {
+		parsed, err := parseDate(c.Query(name))
+		if err != nil {
+			middleware.AbortWithError(c, http.StatusBadRequest, "invalid_filter", "Invalid "+name+"; use YYYY-MM-DD")
+			return nil, false
+		}
+		*date = parsed
+	}
+	return filter, true
+}
+
+// parseDate reads a YYYY-MM-DD date or an RFC 3339 time. Empty input is nil.
+func parseDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		parsed, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// checkMetadata checks that the terms a document refers to exist in the
+// right vocabulary, that it does not expire before taking effect and who may
+// see it. On invalid metadata the response is written and false returned.
+func (h *DocumentsHandler) checkMetadata(c *gin.Context, document *models.Document) bool {
+	for _, ref := range []struct {
+		id         *int64
+		kind, name string
+	}{
+		{document.TypeID, repositories.TermType, "type_id"},
+		{document.AuthorityID, repositories.TermAuthority, "authority_id"},
+		{document.SignerID, repositories.TermSigner, "signer_id"},
+	} {
+		if ref.id == nil {
+			continue
+		}
+		term, err := h.terms.GetByID(c.Request.Context(), *ref.id)
+		if err != nil && err != sql.ErrNoRows {
+			middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document terms")
+			return false
+		}
+		if err != nil || term.Kind != ref.kind {
+			middleware.AbortWithError(c, http.StatusBadRequest, "invalid_term",
+				fmt.Sprintf("%s does not refer to a %s term", ref.name, ref.kind))
+			return false
+		}
+	}
+
+	if document.EffectiveDate != nil && document.ExpiryDate != nil && document.ExpiryDate.Before(*document.EffectiveDate) {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_dates", "The expiry date is before the effective date")
+		return false
+	}
+	return h.checkVisibility(c, document)
+}
+
 // @Summary Create document (Admin)
-// @Description Create a new document
+// @Description Create a new document. visibility is public (the default), authenticated (signed-in users) or roles (users with one of role_ids); the file of a restricted document is moved out of the public uploads.
 // @Tags documents
 // @Security Bearer
 // @Accept json
@@ -158,6 +330,10 @@ func (h *DocumentsHandler) Create(c *gin.Context) {
 		return
 	}
 
+	if !h.checkMetadata(c, &document) {
+		return
+	}
+
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
 	document.UploadedBy = userID.(int64)
@@ -166,12 +342,25 @@ func (h *DocumentsHandler) Create(c *gin.Context) {
 		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to create document")
 		return
 	}
+	if !isPublic(&document) {
+		if err := h.moveFiles(c.Request.Context(), document.ID, true); err != nil {
+			log.Printf("Failed to move the file of document %d to private storage: %v", document.ID, err)
+		}
+	}
+	h.queueText(c.Request.Context(), document.ID)
+	h.repealReplaced(c.Request.Context(), document.ID)
+
+	// Reloaded for the term names and validity status
+	if created, err := h.repo.GetByID(c.Request.Context(), document.ID); err == nil {
+		document = *created
+	}
+	withDocumentURLs(&document)
 
 	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: document})
 }
 
 // @Summary Update document (Admin)
-// @Description Update an existing document
+// @Description Update the metadata of a document. File fields are ignored; a new file is uploaded as a version. Publishing a document marks the documents it replaces as repealed. Without visibility, the document keeps its visibility and roles; restricting a document moves its files out of the public uploads, and making it public moves them back.
 // @Tags documents
 // @Security Bearer
 // @Accept json
@@ -197,8 +386,9 @@ func (h *DocumentsHandler) Update(c *gin.Context) {
 		return
 	}
 
-	document.ID = id
-	if err := h.repo.Update(c.Request.Context(), &document); err != nil {
+	ctx := c.Request.Context()
+	current, err := h.repo.GetByID(ctx, id)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Document not found")
 			return
@@ -206,8 +396,45 @@ func (h *DocumentsHandler) Update(c *gin.Context) {
 		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to update document")
 		return
 	}
+	if document.Visibility == "" {
+		document.Visibility, document.RoleIDs = current.Visibility, current.RoleIDs
+	}
+	if !h.checkMetadata(c, &document) {
+		return
+	}
+
+	// Files leave the public uploads before the document is restricted, and
+	// return only once it is public
+	document.ID = id
+	if !isPublic(&document) && isPublic(current) {
+		if err := h.moveFiles(ctx, id, true); err != nil {
+			log.Printf("Failed to move the files of document %d to private storage: %v", id, err)
+			middleware.AbortWithError(c, http.StatusInternalServerError, "storage_error", "Failed to move the document files")
+			return
+		}
+	}
+	if err := h.repo.Update(ctx, &document); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to update document")
+		return
+	}
+	if isPublic(&document) && !isPublic(current) {
+		if err := h.moveFiles(ctx, id, false); err != nil {
+			// Still served through the download routes, only not under /static
+			log.Printf("Failed to move the files of document %d to public storage: %v", id, err)
+		}
+	}
+
+	h.repealReplaced(ctx, id)
+
+	// The file fields of the request were not saved
+	updated, err := h.repo.GetByID(c.Request.Context(), id)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document")
+		return
+	}
+	withDocumentURLs(updated)
 
-	c.JSON(http.StatusOK, dto.SuccessResponse{Data: document})
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: updated})
 }
 
 // @Summary Delete document (Admin)
@@ -228,7 +455,15 @@ func (h *DocumentsHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.repo.Delete(c.Request.Context(), id); err != nil {
+	_, err = h.repo.GetByID(c.Request.Context(), id)
+	var versions []models.DocumentVersion
+	if err == nil {
+		versions, err = h.repo.ListVersions(c.Request.Context(), id)
+	}
+	if err == nil {
+		err = h.repo.Delete(c.Request.Context(), id)
+	}
+	if err != nil {
 		if err == sql.ErrNoRows {
 			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Document not found")
 			return
@@ -236,6 +471,10 @@ func (h *DocumentsHandler) Delete(c *gin.Context) {
 		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to delete document")
 		return
 	}
+	// Each version holds its own reference to its file
+	for _, version := range versions {
+		h.releaseDocumentFile(c.Request.Context(), version.FilePath)
+	}
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{Data: "Document deleted successfully"})
 }
@@ -244,18 +483,20 @@ const (
 	MaxDocumentSize      = 10 * 1024 * 1024 // 10MB
 	DocumentUploadDir    = "./storage/uploads/documents"
 	DocumentStaticPrefix = "/static/uploads/documents"
+	// Files of documents not visible to everyone, never served under /static
+	DocumentPrivatePrefix = "/private/documents"
 )
 
 var AllowedDocumentMIME = map[string]string{
-	"application/pdf":    ".pdf",
-	"application/msword": ".doc",
-	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": ".docx",
-	"application/vnd.ms-excel": ".xls",
-	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": ".xlsx",
+	scan.MIMEPDF:  ".pdf",
+	scan.MIMEDOC:  ".doc",
+	scan.MIMEDOCX: ".docx",
+	scan.MIMEXLS:  ".xls",
+	scan.MIMEXLSX: ".xlsx",
 }
 
 // @Summary Upload document file
-// @Description Upload a document file (PDF, DOC, DOCX, XLS, XLSX)
+// @Description Upload a document file (PDF, DOC, DOCX, XLS, XLSX). The text of PDF, DOCX and XLSX files is extracted for search in the background. The content must be a well-formed file of the declared type. Office documents with macros, and files the malware scanner reports, are quarantined and refused with 422. PDFs with JavaScript or embedded files are saved as drafts with security_flags set, for review before publishing. A file that is already a document returns that document with duplicate=true and status 200. Files of documents not visible to everyone are stored privately, outside /static.
 // @Tags documents
 // @Security Bearer
 // @Accept multipart/form-data
@@ -265,139 +506,327 @@ var AllowedDocumentMIME = map[string]string{
 // @Param description formData string false "Document description"
 // @Param category_id formData int true "Category ID"
 // @Param document_no formData string false "Document number"
-// @Param issued_date formData string false "Issued date (RFC3339)"
-// @Success 201 {object} dto.SuccessResponse{data=models.Document}
+// @Param issued_date formData string false "Issued date (YYYY-MM-DD or RFC3339)"
+// @Param type_id formData int false "Document type (term ID)"
+// @Param authority_id formData int false "Issuing authority (term ID)"
+// @Param signer_id formData int false "Signer (term ID)"
+// @Param effective_date formData string false "Effective date (YYYY-MM-DD)"
+// @Param expiry_date formData string false "Expiry date (YYYY-MM-DD)"
+// @Param visibility formData string false "Who may see the document" Enums(public, authenticated, roles) default(public)
+// @Param role_ids formData []int false "Roles that may see the document when visibility is roles" collectionFormat(multi)
+// @Success 200 {object} dto.SuccessResponse{data=dto.DocumentUploadResponse}
+// @Success 201 {object} dto.SuccessResponse{data=dto.DocumentUploadResponse}
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 401 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
+// @Failure 503 {object} dto.ErrorResponse
 // @Router /api/v1/admin/documents/upload [post]
 func (h *DocumentsHandler) Upload(c *gin.Context) {
-	// 1. Get file from multipart form
+	// 1. Get form data
+	description := c.PostForm("description")
+	categoryIDStr := c.PostForm("category_id")
+	documentNo := c.PostForm("document_no")
+
+	categoryID, err := strconv.ParseInt(categoryIDStr, 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_category", "Category ID is required")
+		return
+	}
+
+	metadata := &models.Document{Visibility: c.PostForm("visibility")}
+	for _, value := range c.PostFormArray("role_ids") {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			middleware.AbortWithError(c, http.StatusBadRequest, "invalid_visibility", "Invalid role_ids")
+			return
+		}
+		metadata.RoleIDs = append(metadata.RoleIDs, id)
+	}
+	for name, id := range map[string]**int64{
+		"type_id":      &metadata.TypeID,
+		"authority_id": &metadata.AuthorityID,
+		"signer_id":    &metadata.SignerID,
+	} {
+		if value := c.PostForm(name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				middleware.AbortWithError(c, http.StatusBadRequest, "invalid_term", "Invalid "+name)
+				return
+			}
+			*id = &parsed
+		}
+	}
+	for name, date := range map[string]**time.Time{
+		"issued_date":    &metadata.IssuedDate,
+		"effective_date": &metadata.EffectiveDate,
+		"expiry_date":    &metadata.ExpiryDate,
+	} {
+		parsed, err := parseDate(c.PostForm(name))
+		if err != nil {
+			middleware.AbortWithError(c, http.StatusBadRequest, "invalid_date", "Invalid "+name+"; use YYYY-MM-DD or RFC 3339")
+			return
+		}
+		*date = parsed
+	}
+	if !h.checkMetadata(c, metadata) {
+		return
+	}
+
+	// 2. Receive, check and stage the file
+	upload := h.receiveFile(c)
+	if upload == nil {
+		return
+	}
+	ctx := c.Request.Context()
+	staged := upload.staged
+	userID, _ := c.Get("user_id")
+
+	title := c.PostForm("title")
+	if title == "" {
+		title = strings.TrimSuffix(upload.filename, filepath.Ext(upload.filename))
+	}
+
+	// 3. A file that is already a document returns that document
+	if blob, err := h.blobs.GetBySHA256(ctx, staged.SHA256); err == nil {
+		if existing, err := h.repo.GetByFilePath(ctx, blob.URL); err == nil {
+			staged.discard()
+			withDocumentURLs(existing)
+			c.JSON(http.StatusOK, dto.SuccessResponse{Data: dto.DocumentUploadResponse{Document: existing, Duplicate: true}})
+			return
+		}
+	}
+
+	// 4. Keep the file, sharing any stored copy of the same content, or
+	// privately for a restricted document
+	filePathURL, err := h.commitFile(ctx, staged, upload.contentType, isPublic(metadata))
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "storage_error", "Failed to save file")
+		return
+	}
+
+	// 5. Generate slug from title
+	slug := generateSlug(title)
+
+	// 6. Create document record. Documents with active content wait as
+	// drafts for someone to review them.
+	status := "published" // Auto-publish on upload
+	if len(upload.flags) > 0 {
+		status = "draft"
+	}
+
+	document := &models.Document{
+		Title:         title,
+		Slug:          slug,
+		Description:   description,
+		CategoryID:    categoryID,
+		FilePath:      filePathURL,
+		FileSize:      staged.Size,
+		MimeType:      upload.contentType,
+		DocumentNo:    documentNo,
+		IssuedDate:    metadata.IssuedDate,
+		TypeID:        metadata.TypeID,
+		AuthorityID:   metadata.AuthorityID,
+		SignerID:      metadata.SignerID,
+		EffectiveDate: metadata.EffectiveDate,
+		ExpiryDate:    metadata.ExpiryDate,
+		Visibility:    metadata.Visibility,
+		RoleIDs:       metadata.RoleIDs,
+		UploadedBy:    userID.(int64),
+		Status:        status,
+		SecurityFlags: strings.Join(upload.flags, ","),
+		SHA256:        staged.SHA256,
+	}
+
+	if err := h.repo.Create(ctx, document); err != nil {
+		h.releaseDocumentFile(ctx, filePathURL)
+		middleware.AbortWithError(c, http.StatusInternalServerError, "database_error", "Failed to save document record")
+		return
+	}
+	h.queueText(ctx, document.ID)
+
+	// Reloaded for the term names and validity status
+	if created, err := h.repo.GetByID(ctx, document.ID); err == nil {
+		document = created
+	}
+	withDocumentURLs(document)
+
+	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: dto.DocumentUploadResponse{Document: document}})
+}
+
+// documentFile is an uploaded document file that passed the checks and
+// the malware scan, staged for storing
+type documentFile struct {
+	staged      *stagedFile
+	filename    string
+	contentType string
+	flags       []string // active content found in a PDF
+}
+
+// receiveFile reads the "file" field of a document upload, checks its type
+// and content and stages it. Macro-enabled and infected files are
+// quarantined. On failure the response is written and nil returned.
+func (h *DocumentsHandler) receiveFile(c *gin.Context) *documentFile {
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
 		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_file", "File is required")
-		return
+		return nil
 	}
 	defer file.Close()
 
-	// 2. Validate file size
 	if header.Size > MaxDocumentSize {
 		middleware.AbortWithError(c, http.StatusBadRequest, "file_too_large",
 			fmt.Sprintf("File size exceeds maximum of %d MB", MaxDocumentSize/(1024*1024)))
-		return
+		return nil
 	}
 
-	// 3. Validate MIME type
 	contentType := header.Header.Get("Content-Type")
 	ext, allowed := AllowedDocumentMIME[contentType]
 	if !allowed {
 		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_file_type",
 			"Only PDF, DOC, DOCX, XLS, XLSX files are allowed")
-		return
+		return nil
 	}
 
-	// 4. Verify magic bytes
-	buffer := make([]byte, 512)
-	_, err = file.Read(buffer)
-	if err != nil && err != io.EOF {
-		middleware.AbortWithError(c, http.StatusInternalServerError, "file_read_error", "Failed to read file")
-		return
-	}
-	detectedType := http.DetectContentType(buffer)
-	if _, ok := AllowedDocumentMIME[detectedType]; !ok && !strings.HasPrefix(detectedType, "application/") {
+	// Check the content is a well-formed file of the declared type;
+	// macro-enabled Office documents are quarantined once staged
+	flags, err := scan.Inspect(file, header.Size, contentType)
+	macros := errors.Is(err, scan.ErrMacros)
+	if err != nil && !macros {
 		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_file_type",
-			"File content does not match allowed document types")
-		return
+			"File content does not match the declared document type: "+err.Error())
+		return nil
 	}
 
-	// Reset file pointer
-	if _, err := file.Seek(0, 0); err != nil {
-		middleware.AbortWithError(c, http.StatusInternalServerError, "file_read_error", "Failed to reset file pointer")
-		return
-	}
-
-	// 5. Create directory structure: YYYY/MM
-	now := time.Now()
-	yearMonth := now.Format("2006/01")
-	uploadPath := filepath.Join(DocumentUploadDir, yearMonth)
-	if err := os.MkdirAll(uploadPath, 0755); err != nil {
-		middleware.AbortWithError(c, http.StatusInternalServerError, "storage_error", "Failed to create upload directory")
-		return
-	}
-
-	// 6. Generate unique filename
+	// Stream the file to disk under YYYY/MM, hashing the content
 	if ext == "" {
 		ext = strings.ToLower(filepath.Ext(header.Filename))
 	}
-	filename := fmt.Sprintf("%s-%s%s", now.Format("20060102-150405"), uuid.New().String()[:8], ext)
-	filePath := filepath.Join(uploadPath, filename)
+	ctx := c.Request.Context()
+	staged, err := stageFile(file, DocumentStaticPrefix+"/"+time.Now().Format("2006/01"), ext)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "storage_error", "Failed to save file")
+		return nil
+	}
 
-	// 7. Save file
-	dst, err := os.Create(filePath)
+	// Macros and files the malware scanner reports are quarantined
+	userID, _ := c.Get("user_id")
+	suspect := &models.QuarantinedFile{
+		Filename:   header.Filename,
+		MimeType:   contentType,
+		Source:     "document",
+		UploadedBy: userID.(int64),
+	}
+	if macros {
+		suspect.Reason = quarantine.ReasonMacros
+		staged.quarantine(ctx, h.guard, suspect)
+		middleware.AbortWithError(c, http.StatusUnprocessableEntity, "macros_not_allowed",
+			"Documents containing macros are not accepted; the file has been quarantined")
+		return nil
+	}
+	result, err := staged.scan(ctx, h.guard)
 	if err != nil {
-		middleware.AbortWithError(c, http.StatusInternalServerError, "storage_error", "Failed to create file")
-		return
+		staged.discard()
+		middleware.AbortWithError(c, http.StatusServiceUnavailable, "scan_unavailable", "The file could not be scanned for malware")
+		return nil
+	}
+	if result.Infected {
+		suspect.Reason, suspect.Detail = quarantine.ReasonMalware, result.Signature
+		staged.quarantine(ctx, h.guard, suspect)
+		middleware.AbortWithError(c, http.StatusUnprocessableEntity, "file_quarantined",
+			"The file was reported as malware and has been quarantined")
+		return nil
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		os.Remove(filePath)
-		middleware.AbortWithError(c, http.StatusInternalServerError, "storage_error", "Failed to save file")
-		return
+	return &documentFile{staged: staged, filename: header.Filename, contentType: contentType, flags: flags}
+}
+
+// commitFile stores a staged document file: with the shared uploads for a
+// public document, privately otherwise. It returns the file's URL.
+func (h *DocumentsHandler) commitFile(ctx context.Context, staged *stagedFile, contentType string, public bool) (string, error) {
+	if public {
+		url, _, err := staged.commit(ctx, h.store, h.blobs, contentType)
+		return url, err
 	}
+	url, err := privateDocumentURL(staged.ext)
+	if err != nil {
+		staged.discard()
+		return "", err
+	}
+	return url, staged.commitPrivate(ctx, h.store, url, contentType)
+}
 
-	// 8. Get form data
-	title := c.PostForm("title")
-	if title == "" {
-		title = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+// queueText queues a document's text for extraction. A failure only delays
+// search until the document is re-extracted, so it is logged.
+func (h *DocumentsHandler) queueText(ctx context.Context, id int64) {
+	if err := h.extractor.Queue(ctx, id); err != nil {
+		log.Printf("Failed to queue text extraction for document %d: %v", id, err)
 	}
-	description := c.PostForm("description")
-	categoryIDStr := c.PostForm("category_id")
-	documentNo := c.PostForm("document_no")
-	issuedDateStr := c.PostForm("issued_date")
+}
 
-	categoryID, err := strconv.ParseInt(categoryIDStr, 10, 64)
+// @Summary Get extracted document text (Admin)
+// @Description Get the plain text extracted from a document's file for search, with the extraction status: pending, done, failed (with the error) or unsupported (DOC and XLS files)
+// @Tags documents
+// @Security Bearer
+// @Produce json
+// @Param id path int true "Document ID"
+// @Success 200 {object} dto.SuccessResponse{data=models.DocumentText}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/documents/{id}/text [get]
+func (h *DocumentsHandler) GetText(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		os.Remove(filePath)
-		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_category", "Category ID is required")
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_id", "Invalid document ID")
 		return
 	}
 
-	// Parse issued date if provided
-	var issuedDate *time.Time
-	if issuedDateStr != "" {
-		parsed, err := time.Parse(time.RFC3339, issuedDateStr)
-		if err == nil {
-			issuedDate = &parsed
+	text, err := h.texts.Get(c.Request.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "No text has been extracted from this document")
+			return
 		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document text")
+		return
 	}
 
-	// 9. Generate slug from title
-	slug := generateSlug(title)
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: text})
+}
 
-	// 10. Create document record
-	userID, _ := c.Get("user_id")
-	filePathURL := fmt.Sprintf("%s/%s/%s", DocumentStaticPrefix, yearMonth, filename)
+// @Summary Re-extract document text (Admin)
+// @Description Queue a document for text extraction, for example after improving the extractor or when an earlier attempt failed. The text already stored stays searchable until the new one is saved.
+// @Tags documents
+// @Security Bearer
+// @Produce json
+// @Param id path int true "Document ID"
+// @Success 202 {object} dto.SuccessResponse{data=string}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/documents/{id}/extract [post]
+func (h *DocumentsHandler) Extract(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_id", "Invalid document ID")
+		return
+	}
 
-	document := &models.Document{
-		Title:       title,
-		Slug:        slug,
-		Description: description,
-		CategoryID:  categoryID,
-		FilePath:    filePathURL,
-		FileSize:    header.Size,
-		MimeType:    contentType,
-		DocumentNo:  documentNo,
-		IssuedDate:  issuedDate,
-		UploadedBy:  userID.(int64),
-		Status:      "published", // Auto-publish on upload
-	}
-
-	if err := h.repo.Create(c.Request.Context(), document); err != nil {
-		os.Remove(filePath)
-		middleware.AbortWithError(c, http.StatusInternalServerError, "database_error", "Failed to save document record")
+	if _, err := h.repo.GetByID(c.Request.Context(), id); err != nil {
+		if err == sql.ErrNoRows {
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Document not found")
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch document")
+		return
+	}
+	if err := h.extractor.Queue(c.Request.Context(), id); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to queue text extraction")
 		return
 	}
 
-	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: document})
+	c.JSON(http.StatusAccepted, dto.SuccessResponse{Data: "Text extraction queued"})
 }
@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
 	"regexp"
 	"strconv"
@@ -21,6 +25,8 @@ import (
 	"github.com/thieugt95/portal-365/backend/internal/middleware"
 	"github.com/thieugt95/portal-365/backend/internal/models"
 	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/usage"
+	"github.com/thieugt95/portal-365/backend/internal/watermark"
 )
 
 // Helper functions
@@ -76,6 +82,24 @@ func getPagination(page, pageSize, total int) *dto.PaginationResponse {
 	}
 }
 
+// recordAudit writes an audit log entry for the authenticated user.
+// Failures are attached to the context and never block the request.
+func recordAudit(c *gin.Context, repos *database.Repositories, action, entity string, entityID int64, details interface{}) {
+	detailsJSON, _ := json.Marshal(details)
+	entry := &models.AuditLog{
+		UserID:    c.GetInt64("user_id"),
+		Action:    action,
+		Entity:    entity,
+		EntityID:  entityID,
+		Details:   string(detailsJSON),
+		IPAddress: c.ClientIP(),
+	}
+	// Recorded even when the client has gone, as after a download
+	if err := repos.AuditLogs.Create(context.WithoutCancel(c.Request.Context()), entry); err != nil {
+		c.Error(err)
+	}
+}
+
 // toArticleResponse converts Article model to ArticleResponse with category and tags populated
 func (h *ArticleHandler) toArticleResponse(c *gin.Context, article *models.Article) (*dto.ArticleResponse, error) {
 	response := &dto.ArticleResponse{
@@ -95,6 +119,7 @@ func (h *ArticleHandler) toArticleResponse(c *gin.Context, article *models.Artic
 		CreatedAt:     article.CreatedAt,
 		UpdatedAt:     article.UpdatedAt,
 	}
+	response.FeaturedCrops = presetCrops(c.Request.Context(), h.repos, article.FeaturedImage, articleCropPresets)
 
 	// Get category with parent info
 	category, err := h.repos.Categories.GetByID(c.Request.Context(), article.CategoryID)
@@ -120,6 +145,10 @@ func (h *ArticleHandler) toArticleResponse(c *gin.Context, article *models.Artic
 		response.Category = categoryResp
 	}
 
+	if article.FeaturedImage != "" {
+		response.FeaturedImageSet = responsiveImage(c.Request.Context(), h.repos.Renditions, article.FeaturedImage)
+	}
+
 	// Get tags
 	tags, err := h.repos.Articles.GetTags(c.Request.Context(), article.ID)
 	if err == nil && len(tags) > 0 {
@@ -137,6 +166,23 @@ func (h *ArticleHandler) toArticleResponse(c *gin.Context, article *models.Artic
 	return response, nil
 }
 
+// namedTags turns free-form tag names into tags with generated slugs,
+// dropping blanks and names that collapse to the same slug
+func namedTags(names []string) []*models.Tag {
+	tags := make([]*models.Tag, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.Join(strings.Fields(name), " ")
+		slug := generateSlug(name)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		tags = append(tags, &models.Tag{Name: name, Slug: slug})
+	}
+	return tags
+}
+
 // toArticleResponses batch converts multiple articles
 func (h *ArticleHandler) toArticleResponses(c *gin.Context, articles []*models.Article) ([]*dto.ArticleResponse, error) {
 	responses := make([]*dto.ArticleResponse, len(articles))
@@ -170,11 +216,13 @@ func (h *ArticleHandler) toArticleResponses(c *gin.Context, articles []*models.A
 
 // Article Handler
 type ArticleHandler struct {
-	repos *database.Repositories
+	repos       *database.Repositories
+	marks       *watermark.Service
+	suggestions suggestionCache
 }
 
-func NewArticleHandler(repos *database.Repositories) *ArticleHandler {
-	return &ArticleHandler{repos: repos}
+func NewArticleHandler(repos *database.Repositories, marks *watermark.Service) *ArticleHandler {
+	return &ArticleHandler{repos: repos, marks: marks}
 }
 
 // List godoc
@@ -188,6 +236,7 @@ func NewArticleHandler(repos *database.Repositories) *ArticleHandler {
 // @Param page_size query int false "Page size" default(20)
 // @Param category_id query int false "Filter by category ID"
 // @Param category_slug query string false "Filter by category slug"
+// @Param include_descendants query bool false "Also match articles in child categories"
 // @Param author_id query int false "Filter by author ID"
 // @Param status query string false "Filter by status (draft, under_review, published, hidden, rejected)"
 // @Param tag query string false "Filter by tag"
@@ -208,6 +257,7 @@ func (h *ArticleHandler) List(c *gin.Context) {
 	if categorySlug := c.Query("category_slug"); categorySlug != "" {
 		filter.CategorySlug = &categorySlug
 	}
+	filter.IncludeDescendants = c.Query("include_descendants") == "true"
 	if authorID := c.Query("author_id"); authorID != "" {
 		id, _ := strconv.ParseInt(authorID, 10, 64)
 		filter.AuthorID = &id
@@ -257,6 +307,7 @@ func (h *ArticleHandler) List(c *gin.Context) {
 // @Param page_size query int false "Page size" default(20)
 // @Param category_id query int false "Filter by category ID"
 // @Param category_slug query string false "Filter by category slug"
+// @Param include_descendants query bool false "Also match articles in child categories"
 // @Param tag query string false "Filter by tag"
 // @Param q query string false "Search query"
 // @Param sort query string false "Sort by field" default(-published_at)
@@ -280,6 +331,7 @@ func (h *ArticleHandler) ListPublic(c *gin.Context) {
 	if categorySlug := c.Query("category_slug"); categorySlug != "" {
 		filter.CategorySlug = &categorySlug
 	}
+	filter.IncludeDescendants = c.Query("include_descendants") == "true"
 	if tag := c.Query("tag"); tag != "" {
 		filter.Tag = &tag
 	}
@@ -374,19 +426,23 @@ func (h *ArticleHandler) GetBySlug(c *gin.Context) {
 		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to build article response")
 		return
 	}
+	response.Breadcrumbs = contentBreadcrumbs(c.Request.Context(), h.repos.Categories, article.CategoryID,
+		dto.Breadcrumb{Type: "article", ID: article.ID, Name: article.Title, Slug: article.Slug})
+	response.ContentImages = contentImages(c.Request.Context(), h.repos.Renditions, article.Content)
+	response.Albums = contentAlbums(c.Request.Context(), h.repos.Albums, h.repos.Renditions, article.Content)
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{Data: response})
 }
 
 // Create godoc
 // @Summary Create a new article
-// @Description Create a new article with title, content, category, and tags. Requires authentication.
+// @Description Create a new article with title, content, category, and tags. Tags can be given by ID or by name; unknown names are created. Requires authentication.
 // @Tags Articles (Admin)
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param article body dto.CreateArticleRequest true "Article data"
-// @Success 201 {object} dto.SuccessResponse{data=models.Article} "Article created successfully"
+// @Success 201 {object} dto.SuccessResponse{data=dto.ArticleResponse} "Article created successfully"
 // @Failure 400 {object} middleware.ErrorResponse "Invalid request body"
 // @Failure 401 {object} middleware.ErrorResponse "Unauthorized"
 // @Failure 500 {object} middleware.ErrorResponse "Internal server error"
@@ -425,29 +481,32 @@ func (h *ArticleHandler) Create(c *gin.Context) {
 		ScheduledAt:   scheduledAt,
 	}
 
-	if err := h.repos.Articles.Create(c.Request.Context(), article); err != nil {
+	tags := &repositories.ArticleTags{IDs: req.TagIDs, Named: namedTags(req.TagNames)}
+	if err := h.repos.Articles.SaveWithTags(c.Request.Context(), article, tags); err != nil {
 		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to create article")
 		return
 	}
+	recordUsage(c.Request.Context(), h.repos.FileRefs, usage.OwnerArticle, article.ID, usage.Article(article))
+	h.marks.Recheck(articleImages(nil, article)...)
 
-	// Add tags
-	for _, tagID := range req.TagIDs {
-		h.repos.Articles.AddTag(c.Request.Context(), article.ID, tagID)
+	response, err := h.toArticleResponse(c, article)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to build article response")
+		return
 	}
-
-	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: article})
+	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: response})
 }
 
 // Update godoc
 // @Summary Update an existing article
-// @Description Update article details including title, content, category, and featured image. Requires authentication.
+// @Description Update article details including title, content, category, featured image and tags. Sending tag_ids or tag_names replaces the tag set. Requires authentication.
 // @Tags Articles (Admin)
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "Article ID"
 // @Param article body dto.UpdateArticleRequest true "Updated article data"
-// @Success 200 {object} dto.SuccessResponse{data=models.Article} "Article updated successfully"
+// @Success 200 {object} dto.SuccessResponse{data=dto.ArticleResponse} "Article updated successfully"
 // @Failure 400 {object} middleware.ErrorResponse "Invalid request body"
 // @Failure 401 {object} middleware.ErrorResponse "Unauthorized"
 // @Failure 404 {object} middleware.ErrorResponse "Article not found"
@@ -467,6 +526,7 @@ func (h *ArticleHandler) Update(c *gin.Context) {
 		middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Article not found")
 		return
 	}
+	before := *article
 
 	// Convert FlexibleTime to *time.Time
 	var scheduledAt *time.Time
@@ -489,12 +549,25 @@ func (h *ArticleHandler) Update(c *gin.Context) {
 	article.IsFeatured = req.IsFeatured
 	article.ScheduledAt = scheduledAt
 
-	if err := h.repos.Articles.Update(c.Request.Context(), article); err != nil {
+	// Only touch tags when the request mentions them, so clients that don't
+	// send tag fields keep the existing set
+	var tags *repositories.ArticleTags
+	if req.TagIDs != nil || req.TagNames != nil {
+		tags = &repositories.ArticleTags{IDs: req.TagIDs, Named: namedTags(req.TagNames)}
+	}
+	if err := h.repos.Articles.SaveWithTags(c.Request.Context(), article, tags); err != nil {
 		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to update article")
 		return
 	}
+	recordUsage(c.Request.Context(), h.repos.FileRefs, usage.OwnerArticle, article.ID, usage.Article(article))
+	h.marks.Recheck(articleImages(&before, article)...)
 
-	c.JSON(http.StatusOK, dto.SuccessResponse{Data: article})
+	response, err := h.toArticleResponse(c, article)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to build article response")
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: response})
 }
 
 // Delete godoc
@@ -512,10 +585,16 @@ func (h *ArticleHandler) Update(c *gin.Context) {
 func (h *ArticleHandler) Delete(c *gin.Context) {
 	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
 
+	// Looked up first for the images whose watermark the article decided
+	article, _ := h.repos.Articles.GetByID(c.Request.Context(), id)
 	if err := h.repos.Articles.Delete(c.Request.Context(), id); err != nil {
 		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to delete article")
 		return
 	}
+	recordUsage(c.Request.Context(), h.repos.FileRefs, usage.OwnerArticle, id, nil)
+	if article != nil {
+		h.marks.Recheck(articleImages(article, nil)...)
+	}
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{Data: gin.H{"message": "Article deleted"}})
 }
@@ -727,6 +806,7 @@ type HomeResponse struct {
 // @Accept json
 // @Produce json
 // @Param sections query string false "Comma-separated category slugs" example("hoat-dong-cua-thu-truong,tin-quan-su")
+// @Param include_descendants query bool false "Include articles from child categories in each section" default(true)
 // @Success 200 {object} dto.SuccessResponse{data=HomeResponse}
 // @Failure 500 {object} middleware.ErrorResponse
 // @Router /api/v1/home [get]
@@ -743,6 +823,9 @@ func (h *HomeHandler) GetHomeData(c *gin.Context) {
 		slugs = strings.Split(sectionsParam, ",")
 	}
 
+	// Sections are usually parent categories, so include their children unless told otherwise
+	includeDescendants := c.DefaultQuery("include_descendants", "true") != "false"
+
 	result := HomeResponse{
 		ByCategory: make([]CategorySection, 0, len(slugs)),
 	}
@@ -792,8 +875,9 @@ func (h *HomeHandler) GetHomeData(c *gin.Context) {
 
 		// Get published articles for this category (max 6, sorted by -published_at)
 		filter := &repositories.ArticleFilter{
-			CategoryID: &category.ID,
-			Status:     &published,
+			CategoryID:         &category.ID,
+			IncludeDescendants: includeDescendants,
+			Status:             &published,
 		}
 
 		articles, _, err := h.repos.Articles.List(c.Request.Context(), filter, 1, 6, "-published_at")
@@ -871,7 +955,8 @@ func (h *CategoryHandler) GetMenuTree(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param slug path string true "Category slug"
-// @Success 200 {object} dto.SuccessResponse{data=models.Category}
+// @Success 200 {object} dto.SuccessResponse{data=dto.CategoryDetailResponse}
+// @Success 301 "Slug was merged into another category"
 // @Failure 404 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/categories/{slug} [get]
@@ -881,6 +966,13 @@ func (h *CategoryHandler) GetBySlug(c *gin.Context) {
 	category, err := h.repos.Categories.GetBySlug(c.Request.Context(), slug)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			// The slug may belong to a category that was merged away
+			if targetID, rerr := h.repos.Redirects.Resolve(c.Request.Context(), "category", slug); rerr == nil {
+				if target, terr := h.repos.Categories.GetByID(c.Request.Context(), targetID); terr == nil {
+					c.Redirect(http.StatusMovedPermanently, "/api/v1/categories/"+target.Slug)
+					return
+				}
+			}
 			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Category not found")
 			return
 		}
@@ -888,7 +980,13 @@ func (h *CategoryHandler) GetBySlug(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.SuccessResponse{Data: category})
+	crumbs, err := categoryBreadcrumbs(c.Request.Context(), h.repos.Categories, category.ID)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to resolve breadcrumbs")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: dto.CategoryDetailResponse{Category: category, Breadcrumbs: crumbs}})
 }
 
 // @Summary Create a new category
@@ -971,26 +1069,170 @@ func (h *CategoryHandler) Update(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.SuccessResponse{Data: category})
 }
 
+// @Summary Get category delete impact
+// @Description Count the articles, documents, media items and child categories that depend on a category
+// @Tags Categories
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "Category ID"
+// @Success 200 {object} dto.SuccessResponse{data=models.CategoryImpact}
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/categories/{id}/impact [get]
+func (h *CategoryHandler) GetImpact(c *gin.Context) {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	impact, err := h.repos.Categories.GetImpact(c.Request.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Category not found")
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to compute category impact")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: impact})
+}
+
 // @Summary Delete a category
-// @Description Delete a category by ID (admin only)
+// @Description Delete a category by ID (admin only). If the category still has content or child categories, target_id is required and everything is reassigned to it first.
 // @Tags Categories
 // @Accept json
 // @Produce json
 // @Security Bearer
 // @Param id path integer true "Category ID"
+// @Param target_id query integer false "Category that receives the content and children"
 // @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
 // @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse "Category in use and no target_id given; details hold the impact"
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/admin/categories/{id} [delete]
 func (h *CategoryHandler) Delete(c *gin.Context) {
 	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
 
-	if err := h.repos.Categories.Delete(c.Request.Context(), id); err != nil {
-		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to delete category")
+	impact, err := h.repos.Categories.GetImpact(c.Request.Context(), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Category not found")
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to compute category impact")
+		return
+	}
+
+	targetParam := c.Query("target_id")
+	if targetParam == "" {
+		if !impact.IsEmpty() {
+			middleware.AbortWithErrorDetails(c, http.StatusConflict, "category_in_use",
+				"Category still has content or child categories; choose a target_id to reassign them", impact)
+			return
+		}
+
+		if err := h.repos.Categories.Delete(c.Request.Context(), id); err != nil {
+			middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to delete category")
+			return
+		}
+
+		recordAudit(c, h.repos, "delete", "category", id, impact)
+		c.JSON(http.StatusOK, dto.SuccessResponse{Data: gin.H{"message": "Category deleted"}})
+		return
+	}
+
+	targetID, err := strconv.ParseInt(targetParam, 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_request", "Invalid target_id")
+		return
+	}
+
+	if !h.moveCategory(c, id, targetID, false) {
+		return
+	}
+
+	recordAudit(c, h.repos, "delete", "category", id, gin.H{"target_id": targetID, "reassigned": impact})
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: gin.H{
+		"message":    "Category deleted",
+		"target_id":  targetID,
+		"reassigned": impact,
+	}})
+}
+
+// @Summary Merge a category into another
+// @Description Move all articles, documents, media items and child categories into the target, redirect the old slug to it and delete the source (admin only)
+// @Tags Categories
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "Source category ID"
+// @Param request body dto.MergeCategoryRequest true "Target category"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/categories/{id}/merge [post]
+func (h *CategoryHandler) Merge(c *gin.Context) {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	var req dto.MergeCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	source, err := h.repos.Categories.GetByID(c.Request.Context(), id)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Category not found")
+		return
+	}
+
+	impact, err := h.repos.Categories.GetImpact(c.Request.Context(), id)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to compute category impact")
+		return
+	}
+
+	if !h.moveCategory(c, id, req.TargetID, true) {
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.SuccessResponse{Data: gin.H{"message": "Category deleted"}})
+	recordAudit(c, h.repos, "merge", "category", id, gin.H{
+		"source_slug": source.Slug,
+		"target_id":   req.TargetID,
+		"moved":       impact,
+	})
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: gin.H{
+		"message":   "Category merged",
+		"target_id": req.TargetID,
+		"moved":     impact,
+	}})
+}
+
+// moveCategory reassigns everything under id to targetID and deletes id,
+// writing the error response itself. It reports whether the move succeeded.
+func (h *CategoryHandler) moveCategory(c *gin.Context, id, targetID int64, merge bool) bool {
+	var err error
+	if merge {
+		err = h.repos.Categories.Merge(c.Request.Context(), id, targetID)
+	} else {
+		err = h.repos.Categories.DeleteAndReassign(c.Request.Context(), id, targetID)
+	}
+
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, repositories.ErrInvalidCategoryTarget):
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_target", err.Error())
+	case err == sql.ErrNoRows:
+		middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Category or target category not found")
+	default:
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to move category content")
+	}
+	return false
 }
 
 // Tag Handler
@@ -1003,15 +1245,16 @@ func NewTagHandler(repos *database.Repositories) *TagHandler {
 }
 
 // @Summary List all tags
-// @Description Get all tags (public access)
+// @Description Get all tags with their article counts (public access)
 // @Tags Tags
 // @Accept json
 // @Produce json
-// @Success 200 {object} dto.SuccessResponse{data=[]models.Tag}
+// @Param sort query string false "Sort order: name (default) or popular"
+// @Success 200 {object} dto.SuccessResponse{data=[]models.TagUsage}
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/tags [get]
 func (h *TagHandler) List(c *gin.Context) {
-	tags, err := h.repos.Tags.GetAll(c.Request.Context())
+	tags, err := h.repos.Tags.ListWithUsage(c.Request.Context(), false, c.Query("sort"), 0)
 	if err != nil {
 		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch tags")
 		return
@@ -1020,6 +1263,66 @@ func (h *TagHandler) List(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.SuccessResponse{Data: tags})
 }
 
+// @Summary Get tag cloud
+// @Description Get the most used tags on published articles with a display weight from 1 to 5 (public access)
+// @Tags Tags
+// @Accept json
+// @Produce json
+// @Param limit query int false "Maximum number of tags" default(50)
+// @Success 200 {object} dto.SuccessResponse{data=[]dto.TagCloudItem}
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/tags/cloud [get]
+func (h *TagHandler) Cloud(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	tags, err := h.repos.Tags.ListWithUsage(c.Request.Context(), true, "popular", limit)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch tag cloud")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: buildTagCloud(tags)})
+}
+
+// buildTagCloud assigns weights on a logarithmic scale so a few very popular
+// tags don't flatten everything else to the lowest weight
+func buildTagCloud(tags []*models.TagUsage) []dto.TagCloudItem {
+	items := make([]dto.TagCloudItem, 0, len(tags))
+	if len(tags) == 0 {
+		return items
+	}
+
+	minCount, maxCount := tags[0].ArticleCount, tags[0].ArticleCount
+	for _, tag := range tags {
+		if tag.ArticleCount < minCount {
+			minCount = tag.ArticleCount
+		}
+		if tag.ArticleCount > maxCount {
+			maxCount = tag.ArticleCount
+		}
+	}
+
+	spread := math.Log(float64(maxCount)) - math.Log(float64(minCount))
+	for _, tag := range tags {
+		weight := 3
+		if spread > 0 {
+			weight = 1 + int(math.Round(4*(math.Log(float64(tag.ArticleCount))-math.Log(float64(minCount)))/spread))
+		}
+		items = append(items, dto.TagCloudItem{
+			ID:           tag.ID,
+			Name:         tag.Name,
+			Slug:         tag.Slug,
+			ArticleCount: tag.ArticleCount,
+			Weight:       weight,
+		})
+	}
+
+	return items
+}
+
 // @Summary Get tag by slug
 // @Description Get a single tag by its slug (public access)
 // @Tags Tags
@@ -1036,6 +1339,13 @@ func (h *TagHandler) GetBySlug(c *gin.Context) {
 	tag, err := h.repos.Tags.GetBySlug(c.Request.Context(), slug)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			// The slug may belong to a tag that was renamed or merged away
+			if targetID, rerr := h.repos.Redirects.Resolve(c.Request.Context(), "tag", slug); rerr == nil {
+				if target, terr := h.repos.Tags.GetByID(c.Request.Context(), targetID); terr == nil {
+					c.Redirect(http.StatusMovedPermanently, "/api/v1/tags/"+target.Slug)
+					return
+				}
+			}
 			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Tag not found")
 			return
 		}
@@ -1078,6 +1388,142 @@ func (h *TagHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: tag})
 }
 
+// @Summary Rename a tag
+// @Description Update a tag's name and slug; the old slug keeps redirecting to the tag. A given slug is normalized like one generated from the name; a name or slug another tag has is refused with 409 (admin only)
+// @Tags Tags
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "Tag ID"
+// @Param tag body dto.UpdateTagRequest true "Tag details"
+// @Success 200 {object} dto.SuccessResponse{data=models.Tag}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/tags/{id} [put]
+func (h *TagHandler) Update(c *gin.Context) {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	var req dto.UpdateTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	tag, err := h.repos.Tags.GetByID(c.Request.Context(), id)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Tag not found")
+		return
+	}
+
+	oldSlug := tag.Slug
+	tag.Name = strings.TrimSpace(req.Name)
+	tag.Slug = generateSlug(req.Slug)
+	if tag.Slug == "" {
+		tag.Slug = generateSlug(tag.Name)
+	}
+	if tag.Name == "" || tag.Slug == "" {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_request", "Tag name must contain letters or digits")
+		return
+	}
+
+	if existing, err := h.repos.Tags.GetByName(c.Request.Context(), tag.Name); err == nil && existing.ID != id {
+		middleware.AbortWithError(c, http.StatusConflict, "name_exists", "Another tag already has this name; merge the tags instead")
+		return
+	}
+	if existing, err := h.repos.Tags.GetBySlug(c.Request.Context(), tag.Slug); err == nil && existing.ID != id {
+		middleware.AbortWithError(c, http.StatusConflict, "slug_exists", "Another tag already uses this slug; merge the tags instead")
+		return
+	}
+
+	if err := h.repos.Tags.Update(c.Request.Context(), tag); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to update tag")
+		return
+	}
+
+	if oldSlug != tag.Slug {
+		redirect := &models.SlugRedirect{Entity: "tag", OldSlug: oldSlug, TargetID: id}
+		if err := h.repos.Redirects.Create(c.Request.Context(), redirect); err != nil {
+			c.Error(err)
+		}
+	}
+
+	recordAudit(c, h.repos, "update", "tag", id, gin.H{"old_slug": oldSlug, "name": tag.Name, "slug": tag.Slug})
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: tag})
+}
+
+// @Summary Merge tags
+// @Description Move every article of a tag to the target tag and delete it; the old slug redirects to the target (admin only)
+// @Tags Tags
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path integer true "Source tag ID"
+// @Param request body dto.MergeTagRequest true "Target tag"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/tags/{id}/merge [post]
+func (h *TagHandler) Merge(c *gin.Context) {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	var req dto.MergeTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	source, err := h.repos.Tags.GetByID(c.Request.Context(), id)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Tag not found")
+		return
+	}
+
+	if err := h.repos.Tags.Merge(c.Request.Context(), id, req.TargetID); err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrInvalidTagTarget):
+			middleware.AbortWithError(c, http.StatusBadRequest, "invalid_target", err.Error())
+		case errors.Is(err, sql.ErrNoRows):
+			middleware.AbortWithError(c, http.StatusNotFound, "not_found", "Target tag not found")
+		default:
+			middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to merge tags")
+		}
+		return
+	}
+
+	recordAudit(c, h.repos, "merge", "tag", id, gin.H{"source_slug": source.Slug, "target_id": req.TargetID})
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: gin.H{
+		"message":   "Tag merged",
+		"target_id": req.TargetID,
+	}})
+}
+
+// @Summary Delete unused tags
+// @Description Delete every tag that is not attached to any article (admin only)
+// @Tags Tags
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/tags/cleanup [post]
+func (h *TagHandler) Cleanup(c *gin.Context) {
+	deleted, err := h.repos.Tags.DeleteUnused(c.Request.Context())
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to delete unused tags")
+		return
+	}
+
+	recordAudit(c, h.repos, "cleanup", "tag", 0, gin.H{"deleted": deleted})
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: gin.H{"deleted": deleted}})
+}
+
 // @Summary Delete a tag
 // @Description Delete a tag by ID (admin only)
 // @Tags Tags
@@ -1358,7 +1804,7 @@ func (h *PageHandler) List(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param slug path string true "Page slug (e.g. intro/history)"
-// @Success 200 {object} dto.SuccessResponse{data=models.Page}
+// @Success 200 {object} dto.SuccessResponse{data=dto.PageDetailResponse}
 // @Failure 404 {object} dto.ErrorResponse
 // @Router /api/v1/pages/{slug} [get]
 func (h *PageHandler) GetBySlug(c *gin.Context) {
@@ -1372,7 +1818,7 @@ func (h *PageHandler) GetBySlug(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.SuccessResponse{Data: page})
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: dto.PageDetailResponse{Page: page, Breadcrumbs: pageBreadcrumbs(page)}})
 }
 
 // GetByID godoc
@@ -1457,6 +1903,7 @@ func (h *PageHandler) Create(c *gin.Context) {
 		})
 		return
 	}
+	recordUsage(c.Request.Context(), h.repos.FileRefs, usage.OwnerPage, page.ID, usage.Page(page))
 
 	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: page})
 }
@@ -1521,6 +1968,7 @@ func (h *PageHandler) Update(c *gin.Context) {
 		})
 		return
 	}
+	recordUsage(c.Request.Context(), h.repos.FileRefs, usage.OwnerPage, existing.ID, usage.Page(existing))
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{Data: existing})
 }
@@ -1551,6 +1999,7 @@ func (h *PageHandler) Delete(c *gin.Context) {
 		})
 		return
 	}
+	recordUsage(c.Request.Context(), h.repos.FileRefs, usage.OwnerPage, id, nil)
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{Data: gin.H{"message": "Page deleted successfully"}})
 }
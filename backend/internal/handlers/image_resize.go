@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"image"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thieugt95/portal-365/backend/internal/config"
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/imaging"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+	"github.com/thieugt95/portal-365/backend/internal/watermark"
+)
+
+// ImageCacheControl is sent with resized images. The ETag changes with the
+// source, the focal point and the watermark, and crop URLs handed out carry the focal point,
+// so clients can keep them for a year.
+const ImageCacheControl = "public, max-age=31536000"
+
+// ImageHandler resizes and crops stored images on demand. Only crop presets,
+// the preset names and sizes listed in IMAGE_PRESETS and IMAGE_SIZES are
+// served, so the cache cannot be filled with arbitrary sizes. Crops are made
+// around the focal point set on the image and carry the watermark its
+// renditions have.
+type ImageHandler struct {
+	cropper *imaging.Cropper
+	marks   *watermark.Service
+	crops   repositories.CropPresetRepository
+	focal   repositories.FocalPointRepository
+	presets map[string]config.ImageSize
+	allowed map[config.ImageSize]bool
+}
+
+func NewImageHandler(cfg *config.Config, repos *database.Repositories, store storage.Storage, marks *watermark.Service) *ImageHandler {
+	allowed := make(map[config.ImageSize]bool)
+	for _, size := range cfg.ImageSizes {
+		allowed[size] = true
+	}
+	for _, size := range cfg.ImagePresets {
+		allowed[size] = true
+	}
+
+	return &ImageHandler{
+		cropper: imaging.NewCropper(cfg, store),
+		marks:   marks,
+		crops:   repos.Crops,
+		focal:   repos.Focal,
+		presets: cfg.ImagePresets,
+		allowed: allowed,
+	}
+}
+
+// size resolves a crop preset, a preset name from IMAGE_PRESETS or a
+// whitelisted WxH
+func (h *ImageHandler) size(ctx context.Context, spec string) (config.ImageSize, bool) {
+	if preset, err := h.crops.GetByName(ctx, spec); err == nil {
+		return config.ImageSize{Width: preset.Width, Height: preset.Height}, true
+	}
+	if size, ok := h.presets[spec]; ok {
+		return size, true
+	}
+	size, ok := config.ParseImageSize(spec)
+	return size, ok && h.allowed[size]
+}
+
+// Serve godoc
+// @Summary Resized image
+// @Description Resize and crop an uploaded image on demand. size is a crop preset, a preset name or a whitelisted WxH; with both sides set the image is cropped to fill around its focal point, a 0 side keeps the aspect ratio. Images are never scaled up. Images in the watermark selection are watermarked like their renditions. Query parameters are ignored.
+// @Tags Media
+// @Produce image/jpeg,image/png,image/webp
+// @Param size path string true "Preset name or WxH, e.g. card or 640x0"
+// @Param path path string true "Path under /static/, e.g. uploads/images/2025/01/a.jpg"
+// @Success 200 {file} binary
+// @Success 304 "Not modified"
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 "Image not found"
+// @Router /img/{size}/{path} [get]
+func (h *ImageHandler) Serve(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	size, ok := h.size(ctx, c.Param("size"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "SIZE_NOT_ALLOWED",
+				Message: "Unknown preset or size not allowed",
+			},
+		})
+		return
+	}
+
+	key := storage.Key(storage.URLPrefix + strings.TrimPrefix(c.Param("filepath"), "/"))
+	source, err := h.cropper.Source(ctx, key)
+	if errors.Is(err, imaging.ErrNotCroppable) || errors.Is(err, storage.ErrNotFound) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to stat %s: %v", key, err)
+		c.Status(http.StatusBadGateway)
+		return
+	}
+
+	focus := imaging.Center
+	if point, err := h.focal.Get(ctx, storage.URL(key)); err == nil {
+		focus = imaging.FocalPoint{X: point.X, Y: point.Y}
+	}
+
+	wm, err := h.marks.Due(ctx, storage.URL(key))
+	if err != nil {
+		log.Printf("Failed to look up the watermark for %s: %v", key, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	etag := `"` + h.cropper.Name(source, size, focus, wm)[:32] + `"`
+	c.Header("Cache-Control", ImageCacheControl)
+	c.Header("ETag", etag)
+	if match := c.GetHeader("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	cached, err := h.cropper.Crop(ctx, source, size, focus, wm)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, image.ErrFormat) || errors.Is(err, imaging.ErrCropTooLarge) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INVALID_IMAGE",
+				Message: err.Error(),
+			},
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to resize %s to %s: %v", key, size, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	file, err := os.Open(cached)
+	if err != nil {
+		log.Printf("Failed to open cached image %s: %v", cached, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Content-Type", renditionMIME[source.Format])
+	http.ServeContent(c.Writer, c.Request, "", stat.ModTime(), file)
+}
@@ -8,6 +8,7 @@ import (
 "github.com/thieugt95/portal-365/backend/internal/database"
 "github.com/thieugt95/portal-365/backend/internal/dto"
 "github.com/thieugt95/portal-365/backend/internal/models"
+"github.com/thieugt95/portal-365/backend/internal/usage"
 )
 
 type IntroductionHandler struct {
@@ -89,7 +90,7 @@ return
 }
 
 go h.repos.Pages.IncrementViewCount(c.Request.Context(), page.ID)
-c.JSON(http.StatusOK, dto.SuccessResponse{Data: page})
+c.JSON(http.StatusOK, dto.SuccessResponse{Data: dto.PageDetailResponse{Page: page, Breadcrumbs: pageBreadcrumbs(page)}})
 }
 
 func (h *IntroductionHandler) ListIntroductionPagesAdmin(c *gin.Context) {
@@ -188,6 +189,7 @@ Error: dto.ErrorDetail{Code: "INTERNAL_ERROR", Message: "Failed to retrieve upda
 })
 return
 }
+recordUsage(ctx, h.repos.FileRefs, usage.OwnerPage, updatedPage.ID, usage.Page(updatedPage))
 
 c.JSON(http.StatusOK, dto.SuccessResponse{Data: updatedPage})
 }
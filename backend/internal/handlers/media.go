@@ -1,11 +1,12 @@
 package handlers
 
 import (
+	"bytes"
 	"database/sql"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -13,18 +14,63 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/thieugt95/portal-365/backend/internal/config"
 	"github.com/thieugt95/portal-365/backend/internal/database"
 	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/imaging"
 	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/quarantine"
 	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+	"github.com/thieugt95/portal-365/backend/internal/video"
+	"github.com/thieugt95/portal-365/backend/internal/watermark"
 )
 
 type MediaItemHandler struct {
-	repo repositories.MediaItemRepository
+	repo        repositories.MediaItemRepository
+	categories  repositories.CategoryRepository
+	renditions  repositories.ImageRenditionRepository
+	blobs       repositories.StoredBlobRepository
+	fileRefs    repositories.FileReferenceRepository
+	albums      repositories.AlbumRepository
+	folders     repositories.MediaFolderRepository
+	store       storage.Storage
+	marks       *watermark.Service
+	guard       *quarantine.Service
+	keepCapture bool // store the EXIF capture date and camera of uploaded images
 }
 
-func NewMediaItemHandler(repos *database.Repositories) *MediaItemHandler {
-	return &MediaItemHandler{repo: repos.MediaItems}
+func NewMediaItemHandler(cfg *config.Config, repos *database.Repositories, store storage.Storage, marks *watermark.Service, guard *quarantine.Service) *MediaItemHandler {
+	return &MediaItemHandler{
+		repo:        repos.MediaItems,
+		categories:  repos.Categories,
+		renditions:  repos.Renditions,
+		blobs:       repos.Blobs,
+		fileRefs:    repos.FileRefs,
+		albums:      repos.Albums,
+		folders:     repos.Folders,
+		store:       store,
+		marks:       marks,
+		guard:       guard,
+		keepCapture: cfg.ImageKeepCapture,
+	}
+}
+
+// toResponses attaches the renditions of image items
+func (h *MediaItemHandler) toResponses(c *gin.Context, items []models.MediaItem) []dto.MediaItemResponse {
+	urls := make([]string, 0, len(items))
+	for _, item := range items {
+		if item.MediaType == "image" {
+			urls = append(urls, item.URL)
+		}
+	}
+	images := responsiveImages(c.Request.Context(), h.renditions, urls)
+
+	responses := make([]dto.MediaItemResponse, len(items))
+	for i := range items {
+		responses[i] = dto.MediaItemResponse{MediaItem: &items[i], Image: images[items[i].URL]}
+	}
+	return responses
 }
 
 const (
@@ -63,7 +109,7 @@ var AllowedMediaMIME = map[string]bool{
 
 // Upload godoc
 // @Summary Upload media file
-// @Description Upload an image or video file with validation. Images: JPEG, PNG, WebP (max 100MB). Videos: MP4, MPEG, MOV, AVI, WebM (max 100MB)
+// @Description Upload an image or video file with validation. Images: JPEG, PNG, WebP (max 100MB). Videos: MP4, MPEG, MOV, AVI, WebM (max 100MB). Images are rotated upright per EXIF and stored without EXIF/XMP/GPS metadata. Videos must match their declared container; duration, resolution and codec are read from it, and videos the malware scanner reports are quarantined and refused with 422. Content already in the library is not added again: the existing item is returned with status 200 and duplicate_of holding its ID and slug, and the title, tags and other fields given are not applied to it
 // @Tags Media
 // @Security BearerAuth
 // @Accept multipart/form-data
@@ -72,10 +118,15 @@ var AllowedMediaMIME = map[string]bool{
 // @Param title formData string false "Media title"
 // @Param alt formData string false "Alt text for image"
 // @Param category_id formData int false "Category ID"
-// @Success 201 {object} dto.SuccessResponse{data=models.MediaItem}
+// @Param folder_id formData int false "Library folder to file the new item in"
+// @Param tags formData string false "Comma-separated tags for the new item"
+// @Success 200 {object} dto.SuccessResponse{data=dto.MediaItemResponse}
+// @Success 201 {object} dto.SuccessResponse{data=dto.MediaItemResponse}
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 401 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
+// @Failure 503 {object} dto.ErrorResponse
 // @Router /admin/media/upload [post]
 func (h *MediaItemHandler) Upload(c *gin.Context) {
 	// 1. Get file from multipart form
@@ -91,19 +142,105 @@ func (h *MediaItemHandler) Upload(c *gin.Context) {
 	}
 	defer file.Close()
 
+	var categoryID int64
+	if catIDStr := c.PostForm("category_id"); catIDStr != "" {
+		catID, err := strconv.ParseInt(catIDStr, 10, 64)
+		if err == nil {
+			categoryID = catID
+		}
+	}
+
+	var folderID *int64
+	if folderIDStr := c.PostForm("folder_id"); folderIDStr != "" && folderIDStr != "0" {
+		id, err := strconv.ParseInt(folderIDStr, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error: dto.ErrorDetail{
+					Code:    "INVALID_FOLDER",
+					Message: "Invalid folder ID",
+				},
+			})
+			return
+		}
+		if !h.folderExists(c, id) {
+			return
+		}
+		folderID = &id
+	}
+
+	tags, err := normalizeMediaTags(strings.Split(c.PostForm("tags"), ","))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INVALID_INPUT",
+				Message: err.Error(),
+			},
+		})
+		return
+	}
+
+	response, ok := h.saveUpload(c, mediaUpload{
+		file:        file,
+		size:        header.Size,
+		filename:    header.Filename,
+		contentType: header.Header.Get("Content-Type"),
+		title:       c.PostForm("title"),
+		alt:         c.PostForm("alt"),
+		categoryID:  categoryID,
+		folderID:    folderID,
+		tags:        tags,
+	})
+	if !ok {
+		return
+	}
+
+	status := http.StatusCreated
+	if response.DuplicateOf != nil {
+		status = http.StatusOK
+	}
+	c.JSON(status, dto.SuccessResponse{Data: response})
+}
+
+// uploadedFile is implemented by multipart files and files on disk
+type uploadedFile interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+}
+
+// mediaUpload is a complete file on its way to becoming a MediaItem, received
+// as a multipart form or assembled by a resumable upload
+type mediaUpload struct {
+	file        uploadedFile
+	size        int64
+	filename    string
+	contentType string
+	title       string
+	alt         string
+	categoryID  int64
+	folderID    *int64
+	tags        []string
+}
+
+// saveUpload validates an upload, puts it in storage under uploads/ and
+// creates its MediaItem, or returns the item already holding the same
+// content. On failure it writes the error response and returns false.
+func (h *MediaItemHandler) saveUpload(c *gin.Context, upload mediaUpload) (*dto.MediaItemResponse, bool) {
+	file, contentType := upload.file, upload.contentType
+	var err error
+
 	// 2. Validate file size
-	if header.Size > MaxUploadSize {
+	if upload.size > MaxUploadSize {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 			Error: dto.ErrorDetail{
 				Code:    "FILE_TOO_LARGE",
 				Message: fmt.Sprintf("File size exceeds maximum of %d bytes", MaxUploadSize),
 			},
 		})
-		return
+		return nil, false
 	}
 
 	// 3. Validate MIME type from header
-	contentType := header.Header.Get("Content-Type")
 	if !AllowedMediaMIME[contentType] {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 			Error: dto.ErrorDetail{
@@ -111,7 +248,7 @@ func (h *MediaItemHandler) Upload(c *gin.Context) {
 				Message: "Only JPEG, PNG, WebP images and MP4, MPEG, MOV, AVI, WebM videos are allowed",
 			},
 		})
-		return
+		return nil, false
 	}
 
 	// 4. Verify magic bytes (first 512 bytes) - chỉ cho images
@@ -128,7 +265,7 @@ func (h *MediaItemHandler) Upload(c *gin.Context) {
 					Message: "Failed to read file",
 				},
 			})
-			return
+			return nil, false
 		}
 		detectedType := http.DetectContentType(buffer)
 		if !AllowedImageMIME[detectedType] {
@@ -138,7 +275,7 @@ func (h *MediaItemHandler) Upload(c *gin.Context) {
 					Message: "File content does not match allowed image types",
 				},
 			})
-			return
+			return nil, false
 		}
 
 		// Reset file pointer after reading magic bytes
@@ -149,22 +286,58 @@ func (h *MediaItemHandler) Upload(c *gin.Context) {
 					Message: "Failed to reset file pointer",
 				},
 			})
-			return
+			return nil, false
+		}
+	}
+
+	// Images are stored upright and re-encoded without EXIF/XMP/GPS metadata
+	var sanitized *imaging.Sanitized
+	if isImage {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error: dto.ErrorDetail{
+					Code:    "FILE_READ_ERROR",
+					Message: "Failed to read file",
+				},
+			})
+			return nil, false
+		}
+		if sanitized, err = imaging.Sanitize(data); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error: dto.ErrorDetail{
+					Code:    "INVALID_IMAGE",
+					Message: "Failed to process image: " + err.Error(),
+				},
+			})
+			return nil, false
+		}
+	}
+
+	// Videos must be the container their MIME type claims; their headers give
+	// duration, resolution and codec
+	var probed *video.Info
+	if isVideo {
+		if probed, err = video.ProbeMIME(file, upload.size, contentType); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error: dto.ErrorDetail{
+					Code:    "INVALID_VIDEO",
+					Message: "Invalid video file: " + err.Error(),
+				},
+			})
+			return nil, false
 		}
 	}
 
 	// 5. Determine media type and upload directory
 	var mediaType string
-	var baseUploadDir string
 	var staticPrefix string
 
 	if isImage {
 		mediaType = "image"
-		baseUploadDir = "./storage/uploads/images"
 		staticPrefix = "/static/uploads/images"
 	} else if isVideo {
 		mediaType = "video"
-		baseUploadDir = "./storage/uploads/videos"
 		staticPrefix = "/static/uploads/videos"
 	} else {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
@@ -173,27 +346,12 @@ func (h *MediaItemHandler) Upload(c *gin.Context) {
 				Message: "Unsupported media type",
 			},
 		})
-		return
+		return nil, false
 	}
 
-	// 6. Create directory structure: YYYY/MM
-	now := time.Now()
-	yearMonth := now.Format("2006/01")
-	uploadPath := filepath.Join(baseUploadDir, yearMonth)
-	if err := os.MkdirAll(uploadPath, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error: dto.ErrorDetail{
-				Code:    "STORAGE_ERROR",
-				Message: "Failed to create upload directory",
-			},
-		})
-		return
-	}
-
-	// 7. Generate unique filename with UUID
-	ext := strings.ToLower(filepath.Ext(header.Filename))
+	// 6. Generate extension, deriving it from the MIME type when missing
+	ext := strings.ToLower(filepath.Ext(upload.filename))
 	if ext == "" {
-		// Derive extension from MIME type
 		switch contentType {
 		case "image/jpeg":
 			ext = ".jpg"
@@ -213,45 +371,87 @@ func (h *MediaItemHandler) Upload(c *gin.Context) {
 			ext = ".webm"
 		}
 	}
-	filename := uuid.New().String() + ext
-	fullPath := filepath.Join(uploadPath, filename)
 
-	// 8. Save file to disk
-	dst, err := os.Create(fullPath)
+	// 7. Stream to disk under YYYY/MM, hashing the content
+	now := time.Now()
+	var src io.Reader = file
+	if sanitized != nil {
+		src = bytes.NewReader(sanitized.Data)
+	}
+	staged, err := stageFile(src, staticPrefix+"/"+now.Format("2006/01"), ext)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: dto.ErrorDetail{
 				Code:    "STORAGE_ERROR",
-				Message: "Failed to create file on disk",
+				Message: "Failed to save file",
 			},
 		})
-		return
+		return nil, false
+	}
+
+	// Videos are kept as uploaded, so they go through the malware scanner;
+	// images are re-encoded and keep nothing of the upload but its pixels
+	ctx := c.Request.Context()
+	if isVideo {
+		result, err := staged.scan(ctx, h.guard)
+		if err != nil {
+			staged.discard()
+			c.JSON(http.StatusServiceUnavailable, dto.ErrorResponse{
+				Error: dto.ErrorDetail{
+					Code:    "SCAN_UNAVAILABLE",
+					Message: "The file could not be scanned for malware",
+				},
+			})
+			return nil, false
+		}
+		if result.Infected {
+			staged.quarantine(ctx, h.guard, &models.QuarantinedFile{
+				Filename:   upload.filename,
+				MimeType:   contentType,
+				Source:     "media",
+				Reason:     quarantine.ReasonMalware,
+				Detail:     result.Signature,
+				UploadedBy: c.GetInt64("user_id"),
+			})
+			c.JSON(http.StatusUnprocessableEntity, dto.ErrorResponse{
+				Error: dto.ErrorDetail{
+					Code:    "FILE_QUARANTINED",
+					Message: "The file was reported as malware and has been quarantined",
+				},
+			})
+			return nil, false
+		}
+	}
+
+	// Identical content already in the library is answered with the item
+	// holding it rather than a second item
+	if blob, err := h.blobs.GetBySHA256(ctx, staged.SHA256); err == nil {
+		if existing, err := h.repo.GetByURL(ctx, blob.URL); err == nil {
+			staged.discard()
+			renditions, _ := h.renditions.ListBySource(ctx, existing.URL)
+			return &dto.MediaItemResponse{
+				MediaItem:   existing,
+				Image:       buildResponsiveImage(existing.URL, renditions),
+				DuplicateOf: &dto.MediaItemRef{ID: existing.ID, Slug: existing.Slug},
+			}, true
+		}
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
+	urlPath, stored, err := staged.commit(ctx, h.store, h.blobs, contentType)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: dto.ErrorDetail{
 				Code:    "STORAGE_ERROR",
 				Message: "Failed to save file",
 			},
 		})
-		return
+		return nil, false
 	}
 
-	// 8. Get form values
-	title := c.PostForm("title")
+	// 8. Default the title to the file name
+	title := upload.title
 	if title == "" {
-		title = strings.TrimSuffix(header.Filename, ext)
-	}
-	alt := c.PostForm("alt")
-
-	var categoryID int64
-	if catIDStr := c.PostForm("category_id"); catIDStr != "" {
-		catID, err := strconv.ParseInt(catIDStr, 10, 64)
-		if err == nil {
-			categoryID = catID
-		}
+		title = strings.TrimSuffix(upload.filename, filepath.Ext(upload.filename))
 	}
 
 	// 9. Get user ID from JWT context
@@ -262,8 +462,15 @@ func (h *MediaItemHandler) Upload(c *gin.Context) {
 		}
 	}
 
-	// 10. Create MediaItem record
-	urlPath := fmt.Sprintf("%s/%s/%s", staticPrefix, yearMonth, filename)
+	// 10. Create MediaItem record. A file shared with an article image
+	// already has its renditions; new ones are rendered once the item is
+	// saved and the thumbnail points at the smallest of them.
+	thumbnail := urlPath
+	var renditions []*models.ImageRendition
+	if isImage && stored {
+		renditions, _ = h.renditions.ListBySource(ctx, urlPath)
+		thumbnail = thumbnailURL(renditions, urlPath)
+	}
 
 	// Generate simple slug from title + timestamp for uniqueness
 	slug := strings.ToLower(strings.ReplaceAll(title, " ", "-")) + "-" + uuid.New().String()[:8]
@@ -271,32 +478,66 @@ func (h *MediaItemHandler) Upload(c *gin.Context) {
 	media := models.MediaItem{
 		Title:        title,
 		Slug:         slug,
-		Description:  alt,
-		CategoryID:   categoryID,
+		Description:  upload.alt,
+		CategoryID:   upload.categoryID,
+		FolderID:     upload.folderID,
 		MediaType:    mediaType, // "image" hoặc "video"
 		URL:          urlPath,
-		ThumbnailURL: urlPath, // TODO: Generate actual thumbnail
-		FileSize:     header.Size,
+		ThumbnailURL: thumbnail,
+		FileSize:     staged.Size,
 		UploadedBy:   uploadedBy,
 		Status:       "published",
 		CreatedAt:    now,
 		UpdatedAt:    now,
 	}
 
+	if probed != nil {
+		media.Duration, media.Codec = probed.Seconds(), probed.Codec
+		media.Width, media.Height = probed.Width, probed.Height
+	}
+	if sanitized != nil {
+		media.Width, media.Height = sanitized.Width, sanitized.Height
+		if h.keepCapture {
+			media.TakenAt, media.Camera = sanitized.TakenAt, sanitized.Camera
+		}
+	}
+
 	// 11. Save to database
-	if err := h.repo.Create(c.Request.Context(), &media); err != nil {
-		// Clean up file on database error
-		_ = os.Remove(fullPath)
+	if err := h.repo.Create(ctx, &media); err != nil {
+		// Give back the file reference on database error
+		releaseFile(ctx, h.store, h.blobs, h.renditions, urlPath)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: dto.ErrorDetail{
 				Code:    "DATABASE_ERROR",
 				Message: "Failed to save media record",
 			},
 		})
-		return
+		return nil, false
 	}
 
-	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: media})
+	if len(upload.tags) > 0 {
+		if err := h.repo.SetTags(ctx, media.ID, upload.tags); err != nil {
+			log.Printf("Failed to tag media item %d: %v", media.ID, err)
+		} else {
+			media.Tags = upload.tags
+		}
+	}
+
+	// Rendered now the item's category is on record, so it gets its watermark.
+	// Failures are only logged: the original stays usable without renditions.
+	if isImage {
+		if rows, err := h.marks.Renditions(ctx, urlPath); err != nil {
+			log.Printf("Failed to render renditions for %s: %v", urlPath, err)
+		} else {
+			renditions = rows
+			media.ThumbnailURL = thumbnailURL(rows, urlPath)
+		}
+	}
+
+	return &dto.MediaItemResponse{
+		MediaItem: &media,
+		Image:     buildResponsiveImage(urlPath, renditions),
+	}, true
 }
 
 // ListPublic godoc
@@ -306,9 +547,10 @@ func (h *MediaItemHandler) Upload(c *gin.Context) {
 // @Produce json
 // @Param media_type query string false "Media type filter (image, video)"
 // @Param category_id query int false "Category ID filter"
+// @Param include_descendants query bool false "Also match media in child categories"
 // @Param page query int false "Page number (default: 1)"
 // @Param page_size query int false "Page size (default: 20, max: 100)"
-// @Success 200 {object} dto.SuccessResponse{data=[]models.MediaItem}
+// @Success 200 {object} dto.SuccessResponse{data=[]dto.MediaItemResponse}
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /media [get]
 func (h *MediaItemHandler) ListPublic(c *gin.Context) {
@@ -321,6 +563,7 @@ func (h *MediaItemHandler) ListPublic(c *gin.Context) {
 			categoryID = &catID
 		}
 	}
+	includeDescendants := c.Query("include_descendants") == "true"
 
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
@@ -332,7 +575,8 @@ func (h *MediaItemHandler) ListPublic(c *gin.Context) {
 	}
 
 	// Show all images regardless of status
-	items, total, err := h.repo.List(c.Request.Context(), mediaType, "", categoryID, page, pageSize)
+	filter := &repositories.MediaItemFilter{MediaType: mediaType, CategoryID: categoryID, IncludeDescendants: includeDescendants}
+	items, total, err := h.repo.List(c.Request.Context(), filter, page, pageSize, "")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: dto.ErrorDetail{
@@ -344,7 +588,7 @@ func (h *MediaItemHandler) ListPublic(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{
-		Data:       items,
+		Data:       h.toResponses(c, items),
 		Pagination: getPagination(page, pageSize, total),
 	})
 }
@@ -355,7 +599,7 @@ func (h *MediaItemHandler) ListPublic(c *gin.Context) {
 // @Tags Media
 // @Produce json
 // @Param slug path string true "Media slug"
-// @Success 200 {object} dto.SuccessResponse{data=models.MediaItem}
+// @Success 200 {object} dto.SuccessResponse{data=dto.MediaItemResponse}
 // @Failure 404 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /media/{slug} [get]
@@ -395,17 +639,22 @@ func (h *MediaItemHandler) GetBySlug(c *gin.Context) {
 	// Increment view count
 	_ = h.repo.IncrementViewCount(c.Request.Context(), media.ID)
 
-	c.JSON(http.StatusOK, dto.SuccessResponse{Data: media})
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: dto.MediaItemResponse{
+		MediaItem: media,
+		Image:     responsiveImage(c.Request.Context(), h.renditions, media.URL),
+		Breadcrumbs: contentBreadcrumbs(c.Request.Context(), h.categories, media.CategoryID,
+			dto.Breadcrumb{Type: "media", ID: media.ID, Name: media.Title, Slug: media.Slug}),
+	}})
 }
 
 // GetByID godoc
 // @Summary Get media item by ID (Admin)
-// @Description Get single media item by ID (admin only)
+// @Description Get single media item by ID (admin only), with the articles, pages and banners using its file
 // @Tags Media
 // @Security BearerAuth
 // @Produce json
 // @Param id path int true "Media ID"
-// @Success 200 {object} dto.SuccessResponse{data=models.MediaItem}
+// @Success 200 {object} dto.SuccessResponse{data=dto.MediaItemResponse}
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 401 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
@@ -443,34 +692,66 @@ func (h *MediaItemHandler) GetByID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.SuccessResponse{Data: media})
+	usedIn, err := mediaUsage(c.Request.Context(), h.fileRefs, h.renditions, media)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INTERNAL_ERROR",
+				Message: "Failed to fetch media usage",
+			},
+		})
+		return
+	}
+
+	h.attachTags(c.Request.Context(), media)
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: dto.MediaItemResponse{
+		MediaItem: media,
+		Image:     responsiveImage(c.Request.Context(), h.renditions, media.URL),
+		UsedIn:    usedIn,
+	}})
 }
 
 // List godoc
 // @Summary List all media items (Admin)
-// @Description Get list of all media items with filters (admin only)
+// @Description Search and filter the media library (admin only). Dates are upload dates; a date-only "to" includes that whole day.
 // @Tags Media
 // @Security BearerAuth
 // @Produce json
+// @Param q query string false "Search in title and description"
 // @Param media_type query string false "Media type filter"
 // @Param status query string false "Status filter"
 // @Param category_id query int false "Category ID filter"
+// @Param include_descendants query bool false "Also match media in child categories"
+// @Param folder_id query string false "Folder ID filter, or none for media outside any folder"
+// @Param include_subfolders query bool false "Also match media in folders below folder_id"
+// @Param tags query string false "Comma-separated tags; items must carry all of them"
+// @Param uploaded_by query int false "Uploader user ID"
+// @Param from query string false "Uploaded on or after (YYYY-MM-DD or RFC 3339)"
+// @Param to query string false "Uploaded on or before (YYYY-MM-DD or RFC 3339)"
+// @Param min_width query int false "Minimum width in pixels"
+// @Param max_width query int false "Maximum width in pixels"
+// @Param min_height query int false "Minimum height in pixels"
+// @Param max_height query int false "Maximum height in pixels"
+// @Param orientation query string false "landscape, portrait or square"
+// @Param sort query string false "Sort fields, - for descending: created_at, updated_at, published_at, taken_at, title, file_size, width, height, view_count (default: -created_at)"
 // @Param page query int false "Page number (default: 1)"
 // @Param page_size query int false "Page size (default: 20, max: 100)"
-// @Success 200 {object} dto.SuccessResponse{data=[]models.MediaItem}
+// @Success 200 {object} dto.SuccessResponse{data=[]dto.MediaItemResponse}
+// @Failure 400 {object} dto.ErrorResponse
 // @Failure 401 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /admin/media [get]
 func (h *MediaItemHandler) List(c *gin.Context) {
-	mediaType := c.Query("media_type")
-	status := c.Query("status")
-
-	var categoryID *int64
-	if catIDStr := c.Query("category_id"); catIDStr != "" {
-		catID, err := strconv.ParseInt(catIDStr, 10, 64)
-		if err == nil {
-			categoryID = &catID
-		}
+	filter, err := mediaFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INVALID_INPUT",
+				Message: err.Error(),
+			},
+		})
+		return
 	}
 
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -482,7 +763,7 @@ func (h *MediaItemHandler) List(c *gin.Context) {
 		pageSize = 20
 	}
 
-	items, total, err := h.repo.List(c.Request.Context(), mediaType, status, categoryID, page, pageSize)
+	items, total, err := h.repo.List(c.Request.Context(), filter, page, pageSize, c.Query("sort"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: dto.ErrorDetail{
@@ -493,8 +774,15 @@ func (h *MediaItemHandler) List(c *gin.Context) {
 		return
 	}
 
+	responses := h.toResponses(c, items)
+	tagged := make([]*models.MediaItem, len(responses))
+	for i := range responses {
+		tagged[i] = responses[i].MediaItem
+	}
+	h.attachTags(c.Request.Context(), tagged...)
+
 	c.JSON(http.StatusOK, dto.SuccessResponse{
-		Data:       items,
+		Data:       responses,
 		Pagination: getPagination(page, pageSize, total),
 	})
 }
@@ -546,7 +834,7 @@ func (h *MediaItemHandler) Create(c *gin.Context) {
 
 // Update godoc
 // @Summary Update media item (Admin)
-// @Description Update an existing media item (admin only)
+// @Description Update an existing media item (admin only). When tags is present it replaces the item's tags. The folder is changed with the move endpoint.
 // @Tags Media
 // @Security BearerAuth
 // @Accept json
@@ -584,6 +872,22 @@ func (h *MediaItemHandler) Update(c *gin.Context) {
 
 	media.ID = id
 
+	// Tags are only replaced when the request includes them
+	if media.Tags != nil {
+		if media.Tags, err = normalizeMediaTags(media.Tags); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Error: dto.ErrorDetail{
+					Code:    "INVALID_INPUT",
+					Message: err.Error(),
+				},
+			})
+			return
+		}
+	}
+
+	// The stored item tells whether the save moves its image in or out of
+	// the watermark selection
+	before, _ := h.repo.GetByID(c.Request.Context(), id)
 	if err := h.repo.Update(c.Request.Context(), &media); err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, dto.ErrorResponse{
@@ -603,20 +907,41 @@ func (h *MediaItemHandler) Update(c *gin.Context) {
 		return
 	}
 
+	if media.Tags != nil {
+		if err := h.repo.SetTags(c.Request.Context(), id, media.Tags); err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Error: dto.ErrorDetail{
+					Code:    "INTERNAL_ERROR",
+					Message: "Failed to update media tags",
+				},
+			})
+			return
+		}
+	}
+	switch {
+	case before == nil:
+	case before.URL != media.URL:
+		h.marks.Recheck(before.URL, media.URL)
+	case before.CategoryID != media.CategoryID || before.NoWatermark != media.NoWatermark:
+		h.marks.Recheck(media.URL)
+	}
+
 	c.JSON(http.StatusOK, dto.SuccessResponse{Data: media})
 }
 
 // Delete godoc
 // @Summary Delete media item (Admin)
-// @Description Delete a media item (admin only)
+// @Description Delete a media item (admin only). Media used by articles, pages or banners is refused with 409 and the list of uses unless force=true.
 // @Tags Media
 // @Security BearerAuth
 // @Produce json
 // @Param id path int true "Media ID"
+// @Param force query bool false "Delete even if the file is in use"
 // @Success 204
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 401 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /admin/media/{id} [delete]
 func (h *MediaItemHandler) Delete(c *gin.Context) {
@@ -631,7 +956,9 @@ func (h *MediaItemHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.repo.Delete(c.Request.Context(), id); err != nil {
+	ctx := c.Request.Context()
+	media, err := h.repo.GetByID(ctx, id)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, dto.ErrorResponse{
 				Error: dto.ErrorDetail{
@@ -650,5 +977,47 @@ func (h *MediaItemHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	// Deleting media that published content still shows needs force=true
+	usedIn, err := mediaUsage(ctx, h.fileRefs, h.renditions, media)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INTERNAL_ERROR",
+				Message: "Failed to fetch media usage",
+			},
+		})
+		return
+	}
+	if len(usedIn) > 0 && c.Query("force") != "true" {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "MEDIA_IN_USE",
+				Message: fmt.Sprintf("Media item is used in %d places; pass force=true to delete it anyway", len(usedIn)),
+				Details: usedIn,
+			},
+		})
+		return
+	}
+
+	if err := h.repo.Delete(ctx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INTERNAL_ERROR",
+				Message: "Failed to delete media item",
+			},
+		})
+		return
+	}
+
+	if err := h.albums.RemoveMediaItem(ctx, id); err != nil {
+		log.Printf("Failed to remove media item %d from albums: %v", id, err)
+	}
+
+	// A file still in use stays on disk; gc-uploads removes it once nothing refers to it
+	if len(usedIn) == 0 {
+		releaseFile(ctx, h.store, h.blobs, h.renditions, media.URL)
+	}
+	// A file kept for other items or content may now be due another watermark
+	h.marks.Recheck(media.URL)
 	c.Status(http.StatusNoContent)
 }
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/middleware"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+)
+
+// MediaFolderHandler manages the folders of the admin media library
+type MediaFolderHandler struct {
+	folders repositories.MediaFolderRepository
+}
+
+func NewMediaFolderHandler(repos *database.Repositories) *MediaFolderHandler {
+	return &MediaFolderHandler{folders: repos.Folders}
+}
+
+// folderTree nests folders under their parents, keeping their order
+func folderTree(folders []*models.MediaFolder) []*models.MediaFolder {
+	byID := make(map[int64]*models.MediaFolder, len(folders))
+	for _, folder := range folders {
+		byID[folder.ID] = folder
+	}
+	roots := []*models.MediaFolder{}
+	for _, folder := range folders {
+		if folder.ParentID != nil {
+			if parent, ok := byID[*folder.ParentID]; ok {
+				parent.Children = append(parent.Children, folder)
+				continue
+			}
+		}
+		roots = append(roots, folder)
+	}
+	return roots
+}
+
+func (h *MediaFolderHandler) folderID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_ID", "Invalid folder ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// checkPlacement validates a folder name under a parent, writing the error
+// response and returning false when it cannot go there. id is 0 for new folders.
+func (h *MediaFolderHandler) checkPlacement(c *gin.Context, id int64, parentID *int64, name string) bool {
+	ctx := c.Request.Context()
+
+	if parentID != nil {
+		if _, err := h.folders.GetByID(ctx, *parentID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_PARENT", "Parent folder not found")
+				return false
+			}
+			middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch parent folder")
+			return false
+		}
+		if id != 0 {
+			cycle, err := h.folders.IsWithin(ctx, *parentID, id)
+			if err != nil {
+				middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to check folder tree")
+				return false
+			}
+			if cycle {
+				middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_PARENT", "A folder cannot be moved into itself or one of its subfolders")
+				return false
+			}
+		}
+	}
+
+	taken, err := h.folders.NameTaken(ctx, parentID, name, id)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to check folder name")
+		return false
+	}
+	if taken {
+		middleware.AbortWithError(c, http.StatusConflict, "FOLDER_EXISTS", "A folder with this name already exists here")
+		return false
+	}
+	return true
+}
+
+// List godoc
+// @Summary List media folders (Admin)
+// @Description Get the media library folder tree. item_count counts the items filed directly in each folder.
+// @Tags Media Folders
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} dto.SuccessResponse{data=[]models.MediaFolder}
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/media-folders [get]
+func (h *MediaFolderHandler) List(c *gin.Context) {
+	folders, err := h.folders.List(c.Request.Context())
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch folders")
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: folderTree(folders)})
+}
+
+// Create godoc
+// @Summary Create media folder (Admin)
+// @Description Create a folder at the top level or inside parent_id. Names are unique among siblings.
+// @Tags Media Folders
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param folder body dto.CreateMediaFolderRequest true "Folder data"
+// @Success 201 {object} dto.SuccessResponse{data=models.MediaFolder}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/media-folders [post]
+func (h *MediaFolderHandler) Create(c *gin.Context) {
+	var req dto.CreateMediaFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	folder := &models.MediaFolder{Name: strings.TrimSpace(req.Name), ParentID: req.ParentID}
+	if folder.ParentID != nil && *folder.ParentID == 0 {
+		folder.ParentID = nil
+	}
+	if folder.Name == "" {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", "Folder name cannot be empty")
+		return
+	}
+	if !h.checkPlacement(c, 0, folder.ParentID, folder.Name) {
+		return
+	}
+
+	if err := h.folders.Create(c.Request.Context(), folder); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create folder")
+		return
+	}
+	c.JSON(http.StatusCreated, dto.SuccessResponse{Data: folder})
+}
+
+// Update godoc
+// @Summary Update media folder (Admin)
+// @Description Rename a folder or move it under another parent (parent_id 0 for the top level). Items inside keep their URLs.
+// @Tags Media Folders
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Folder ID"
+// @Param folder body dto.UpdateMediaFolderRequest true "Fields to change"
+// @Success 200 {object} dto.SuccessResponse{data=models.MediaFolder}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/media-folders/{id} [put]
+func (h *MediaFolderHandler) Update(c *gin.Context) {
+	id, ok := h.folderID(c)
+	if !ok {
+		return
+	}
+	var req dto.UpdateMediaFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	folder, err := h.folders.GetByID(c.Request.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		middleware.AbortWithError(c, http.StatusNotFound, "NOT_FOUND", "Folder not found")
+		return
+	}
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch folder")
+		return
+	}
+
+	if req.Name != nil {
+		folder.Name = strings.TrimSpace(*req.Name)
+		if folder.Name == "" {
+			middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", "Folder name cannot be empty")
+			return
+		}
+	}
+	if req.ParentID != nil {
+		folder.ParentID = req.ParentID
+		if *req.ParentID == 0 {
+			folder.ParentID = nil
+		}
+	}
+	if !h.checkPlacement(c, folder.ID, folder.ParentID, folder.Name) {
+		return
+	}
+
+	if err := h.folders.Update(c.Request.Context(), folder); err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to update folder")
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: folder})
+}
+
+// Delete godoc
+// @Summary Delete media folder (Admin)
+// @Description Delete an empty folder. Folders still holding media items or subfolders are refused with 409.
+// @Tags Media Folders
+// @Security BearerAuth
+// @Param id path int true "Folder ID"
+// @Success 204
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/media-folders/{id} [delete]
+func (h *MediaFolderHandler) Delete(c *gin.Context) {
+	id, ok := h.folderID(c)
+	if !ok {
+		return
+	}
+
+	empty, err := h.folders.IsEmpty(c.Request.Context(), id)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete folder")
+		return
+	}
+	if !empty {
+		middleware.AbortWithError(c, http.StatusConflict, "FOLDER_NOT_EMPTY", "Move the media items and subfolders out of this folder first")
+		return
+	}
+
+	err = h.folders.Delete(c.Request.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		middleware.AbortWithError(c, http.StatusNotFound, "NOT_FOUND", "Folder not found")
+		return
+	}
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete folder")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
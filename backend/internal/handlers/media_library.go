@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+)
+
+const maxMediaTagLength = 50
+
+// normalizeMediaTags trims tags, collapses inner whitespace and drops empty
+// ones and repeats, compared without case
+func normalizeMediaTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(tag), " ")
+		if tag == "" {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxMediaTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, maxMediaTagLength)
+		}
+		key := strings.ToLower(tag)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized, nil
+}
+
+// parseDateParam reads a date (2006-01-02) or timestamp (RFC 3339) query
+// parameter. A date given as an upper bound covers that whole day.
+func parseDateParam(value string, upper bool) (*time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// mediaFilter builds the admin media library filter from the query string
+func mediaFilter(c *gin.Context) (*repositories.MediaItemFilter, error) {
+	filter := &repositories.MediaItemFilter{
+		MediaType:          c.Query("media_type"),
+		Status:             c.Query("status"),
+		IncludeDescendants: c.Query("include_descendants") == "true",
+		IncludeSubfolders:  c.Query("include_subfolders") == "true",
+		Query:              strings.TrimSpace(c.Query("q")),
+		Orientation:        c.Query("orientation"),
+	}
+
+	ids := map[string]**int64{"category_id": &filter.CategoryID, "uploaded_by": &filter.UploadedBy}
+	for param, target := range ids {
+		if value := c.Query(param); value != "" {
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s", param)
+			}
+			*target = &id
+		}
+	}
+
+	// folder_id=none lists the media not filed in any folder
+	if value := c.Query("folder_id"); value == "none" {
+		filter.Unfiled = true
+	} else if value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid folder_id")
+		}
+		filter.FolderID = &id
+	}
+
+	if value := c.Query("tags"); value != "" {
+		tags, err := normalizeMediaTags(strings.Split(value, ","))
+		if err != nil {
+			return nil, err
+		}
+		filter.Tags = tags
+	}
+
+	var err error
+	if value := c.Query("from"); value != "" {
+		if filter.FromDate, err = parseDateParam(value, false); err != nil {
+			return nil, errors.New("invalid from date, use YYYY-MM-DD")
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if filter.ToDate, err = parseDateParam(value, true); err != nil {
+			return nil, errors.New("invalid to date, use YYYY-MM-DD")
+		}
+	}
+
+	sizes := map[string]*int{
+		"min_width": &filter.MinWidth, "max_width": &filter.MaxWidth,
+		"min_height": &filter.MinHeight, "max_height": &filter.MaxHeight,
+	}
+	for param, target := range sizes {
+		if value := c.Query(param); value != "" {
+			if *target, err = strconv.Atoi(value); err != nil || *target < 0 {
+				return nil, fmt.Errorf("invalid %s", param)
+			}
+		}
+	}
+
+	switch filter.Orientation {
+	case "", repositories.OrientationLandscape, repositories.OrientationPortrait, repositories.OrientationSquare:
+	default:
+		return nil, errors.New("orientation must be landscape, portrait or square")
+	}
+	return filter, nil
+}
+
+// attachTags fills in the tags of media items for admin responses
+func (h *MediaItemHandler) attachTags(ctx context.Context, items ...*models.MediaItem) {
+	ids := make([]int64, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	tags, err := h.repo.GetTags(ctx, ids)
+	if err != nil {
+		log.Printf("Failed to load media tags: %v", err)
+		return
+	}
+	for _, item := range items {
+		item.Tags = tags[item.ID]
+	}
+}
+
+// folderExists writes a 400 response and returns false when folderID names no folder
+func (h *MediaItemHandler) folderExists(c *gin.Context, folderID int64) bool {
+	_, err := h.folders.GetByID(c.Request.Context(), folderID)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INVALID_FOLDER",
+				Message: "Folder not found",
+			},
+		})
+		return false
+	}
+	c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+		Error: dto.ErrorDetail{
+			Code:    "INTERNAL_ERROR",
+			Message: "Failed to fetch folder",
+		},
+	})
+	return false
+}
+
+// Move godoc
+// @Summary Move media items to a folder (Admin)
+// @Description File media items in a folder, or take them out of any folder with folder_id null or 0. Only the library organization changes; URLs of the files stay the same.
+// @Tags Media
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param move body dto.MoveMediaRequest true "Items and target folder"
+// @Success 200 {object} dto.SuccessResponse{data=dto.MoveMediaResponse}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/media-items/move [post]
+func (h *MediaItemHandler) Move(c *gin.Context) {
+	var req dto.MoveMediaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INVALID_INPUT",
+				Message: err.Error(),
+			},
+		})
+		return
+	}
+
+	folderID := req.FolderID
+	if folderID != nil && *folderID == 0 {
+		folderID = nil
+	}
+	if folderID != nil && !h.folderExists(c, *folderID) {
+		return
+	}
+
+	moved, err := h.repo.MoveToFolder(c.Request.Context(), req.MediaItemIDs, folderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INTERNAL_ERROR",
+				Message: "Failed to move media items",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: dto.MoveMediaResponse{Moved: moved, FolderID: folderID}})
+}
+
+// Tags godoc
+// @Summary List media tags (Admin)
+// @Description Get the tags used in the media library, most used first, for filters and autocomplete
+// @Tags Media
+// @Security BearerAuth
+// @Produce json
+// @Param q query string false "Only tags starting with this text"
+// @Param limit query int false "Maximum number of tags (default: 50, max: 500)"
+// @Success 200 {object} dto.SuccessResponse{data=[]models.MediaTagUsage}
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/media/tags [get]
+func (h *MediaItemHandler) Tags(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	tags, err := h.repo.ListTags(c.Request.Context(), strings.TrimSpace(c.Query("q")), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INTERNAL_ERROR",
+				Message: "Failed to fetch media tags",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: tags})
+}
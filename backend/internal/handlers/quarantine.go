@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/middleware"
+	"github.com/thieugt95/portal-365/backend/internal/quarantine"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+)
+
+// QuarantineHandler lists and clears uploads refused as suspicious
+type QuarantineHandler struct {
+	repo  repositories.QuarantineRepository
+	guard *quarantine.Service
+}
+
+func NewQuarantineHandler(repos *database.Repositories, guard *quarantine.Service) *QuarantineHandler {
+	return &QuarantineHandler{repo: repos.Quarantine, guard: guard}
+}
+
+// List godoc
+// @Summary List quarantined files (Admin)
+// @Description List uploads refused as suspicious, newest first: Office documents with macros and files the malware scanner reported. The files are kept outside public storage.
+// @Tags Quarantine
+// @Security BearerAuth
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Success 200 {object} dto.SuccessResponse{data=[]models.QuarantinedFile}
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/quarantine [get]
+func (h *QuarantineHandler) List(c *gin.Context) {
+	page := getPage(c)
+	pageSize := getPageSize(c)
+
+	files, total, err := h.repo.List(c.Request.Context(), page, pageSize)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch quarantined files")
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Data:       files,
+		Pagination: getPagination(page, pageSize, total),
+	})
+}
+
+// Delete godoc
+// @Summary Delete a quarantined file (Admin)
+// @Description Permanently delete a quarantined file and its record
+// @Tags Quarantine
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Quarantined file ID"
+// @Success 200 {object} dto.SuccessResponse{data=string}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/quarantine/{id} [delete]
+func (h *QuarantineHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_ID", "Invalid quarantined file ID")
+		return
+	}
+
+	if err := h.guard.Delete(c.Request.Context(), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			middleware.AbortWithError(c, http.StatusNotFound, "NOT_FOUND", "Quarantined file not found")
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to delete quarantined file")
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: "Quarantined file deleted successfully"})
+}
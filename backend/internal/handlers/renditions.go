@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/imaging"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+)
+
+var contentImagePattern = regexp.MustCompile(`(?i)<img[^>]+src\s*=\s*["']([^"']+)["']`)
+
+var renditionMIME = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"webp": "image/webp",
+	"gif":  "image/gif",
+}
+
+// thumbnailURL picks the smallest rendition, falling back to the original URL
+func thumbnailURL(renditions []*models.ImageRendition, fallback string) string {
+	for _, rendition := range renditions {
+		if rendition.Name != "original" && rendition.Format != "webp" {
+			return rendition.URL
+		}
+	}
+	return fallback
+}
+
+// buildResponsiveImage turns stored renditions into srcset lists. Rendition
+// URLs get the scheme and host of imageURL so absolute URLs stay absolute.
+func buildResponsiveImage(imageURL string, renditions []*models.ImageRendition) *dto.ResponsiveImage {
+	if len(renditions) == 0 {
+		return nil
+	}
+	renditions = append([]*models.ImageRendition{}, renditions...)
+	sort.SliceStable(renditions, func(i, j int) bool { return renditions[i].Width < renditions[j].Width })
+
+	origin := ""
+	if u, err := url.Parse(imageURL); err == nil && u.Host != "" {
+		origin = u.Scheme + "://" + u.Host
+	}
+
+	image := &dto.ResponsiveImage{
+		Src:        imageURL,
+		Renditions: make([]dto.ImageRenditionResponse, 0, len(renditions)),
+	}
+
+	var srcset, webpSrcset []string
+	hasWebP := false
+	webpWidths := make(map[int]bool)
+	for _, rendition := range renditions {
+		if rendition.Format == "webp" {
+			webpWidths[rendition.Width] = true
+		}
+	}
+
+	for _, rendition := range renditions {
+		u := origin + rendition.URL
+		image.Renditions = append(image.Renditions, dto.ImageRenditionResponse{
+			Name:   rendition.Name,
+			Type:   renditionMIME[rendition.Format],
+			URL:    u,
+			Width:  rendition.Width,
+			Height: rendition.Height,
+		})
+
+		candidate := u + " " + strconv.Itoa(rendition.Width) + "w"
+		if rendition.Name == "original" {
+			image.Width, image.Height = rendition.Width, rendition.Height
+		}
+		if rendition.Format == "webp" {
+			hasWebP = true
+			webpSrcset = append(webpSrcset, candidate)
+			continue
+		}
+		srcset = append(srcset, candidate)
+		if !webpWidths[rendition.Width] {
+			webpSrcset = append(webpSrcset, candidate)
+		}
+	}
+
+	image.Srcset = strings.Join(srcset, ", ")
+	if hasWebP {
+		image.WebPSrcset = strings.Join(webpSrcset, ", ")
+	}
+	return image
+}
+
+// responsiveImages looks up the renditions of several image URLs at once,
+// keyed by the URL as given. URLs without renditions are left out.
+func responsiveImages(ctx context.Context, repo repositories.ImageRenditionRepository, imageURLs []string) map[string]*dto.ResponsiveImage {
+	result := make(map[string]*dto.ResponsiveImage)
+
+	sources := make([]string, 0, len(imageURLs))
+	for _, imageURL := range imageURLs {
+		if source := imaging.SourceURL(imageURL); source != "" {
+			sources = append(sources, source)
+		}
+	}
+	if len(sources) == 0 {
+		return result
+	}
+
+	bySource, err := repo.ListBySources(ctx, sources)
+	if err != nil {
+		log.Printf("Failed to load image renditions: %v", err)
+		return result
+	}
+	for _, imageURL := range imageURLs {
+		if image := buildResponsiveImage(imageURL, bySource[imaging.SourceURL(imageURL)]); image != nil {
+			result[imageURL] = image
+		}
+	}
+	return result
+}
+
+func responsiveImage(ctx context.Context, repo repositories.ImageRenditionRepository, imageURL string) *dto.ResponsiveImage {
+	return responsiveImages(ctx, repo, []string{imageURL})[imageURL]
+}
+
+// contentImages returns the renditions of the images embedded in HTML content
+func contentImages(ctx context.Context, repo repositories.ImageRenditionRepository, content string) []*dto.ResponsiveImage {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, match := range contentImagePattern.FindAllStringSubmatch(content, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			urls = append(urls, match[1])
+		}
+	}
+
+	found := responsiveImages(ctx, repo, urls)
+	images := make([]*dto.ResponsiveImage, 0, len(found))
+	for _, u := range urls {
+		if image, ok := found[u]; ok {
+			images = append(images, image)
+		}
+	}
+	return images
+}
@@ -0,0 +1,540 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/thieugt95/portal-365/backend/internal/config"
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/quarantine"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+	"github.com/thieugt95/portal-365/backend/internal/watermark"
+)
+
+const (
+	TusVersion    = "1.0.0"
+	TusExtensions = "creation,expiration,termination"
+	tusChunkType  = "application/offset+octet-stream"
+)
+
+// ResumableUploadHandler accepts media uploads over the tus 1.0 protocol.
+// Chunks are appended to a file in the upload temp dir, outside the served
+// storage; the finished file goes through the same validation and MediaItem
+// creation as MediaItemHandler.Upload.
+type ResumableUploadHandler struct {
+	sessions repositories.UploadSessionRepository
+	media    *MediaItemHandler
+	dir      string
+	ttl      time.Duration
+	locks    sync.Map // session ID -> *sync.Mutex, so chunks of a session never interleave
+}
+
+func NewResumableUploadHandler(cfg *config.Config, repos *database.Repositories, store storage.Storage, marks *watermark.Service, guard *quarantine.Service) *ResumableUploadHandler {
+	return &ResumableUploadHandler{
+		sessions: repos.Uploads,
+		media:    NewMediaItemHandler(cfg, repos, store, marks, guard),
+		dir:      cfg.UploadTempDir,
+		ttl:      cfg.UploadSessionTTL,
+	}
+}
+
+func (h *ResumableUploadHandler) partPath(id string) string {
+	return filepath.Join(h.dir, id+".part")
+}
+
+// lock claims a session for one request; it fails while another holds it
+func (h *ResumableUploadHandler) lock(id string) (func(), bool) {
+	m, _ := h.locks.LoadOrStore(id, &sync.Mutex{})
+	mu := m.(*sync.Mutex)
+	if !mu.TryLock() {
+		return nil, false
+	}
+	return mu.Unlock, true
+}
+
+// discard removes a session with its partial file
+func (h *ResumableUploadHandler) discard(c *gin.Context, id string) {
+	if err := os.Remove(h.partPath(id)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove partial upload %s: %v", id, err)
+	}
+	if err := h.sessions.Delete(c.Request.Context(), id); err != nil {
+		log.Printf("Failed to delete upload session %s: %v", id, err)
+	}
+}
+
+// checkTusVersion rejects requests for protocol versions other than 1.0.0
+func checkTusVersion(c *gin.Context) bool {
+	c.Header("Tus-Resumable", TusVersion)
+	if c.GetHeader("Tus-Resumable") != TusVersion {
+		c.Header("Tus-Version", TusVersion)
+		c.JSON(http.StatusPreconditionFailed, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "UNSUPPORTED_VERSION",
+				Message: "Tus-Resumable must be " + TusVersion,
+			},
+		})
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata decodes the Upload-Metadata header: comma separated
+// "key base64(value)" pairs, where the value may be left out
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("metadata %q is not base64 encoded", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+func uploadUserID(c *gin.Context) int64 {
+	if userID, exists := c.Get("user_id"); exists {
+		if uid, ok := userID.(int64); ok {
+			return uid
+		}
+	}
+	return 0
+}
+
+// loadSession finds a live session of the current user, writing a 404 (or
+// 410 once expired) when there is none. HEAD responses carry no body.
+func (h *ResumableUploadHandler) loadSession(c *gin.Context) (*models.UploadSession, bool) {
+	session, err := h.sessions.GetByID(c.Request.Context(), c.Param("id"))
+	status, code, message := 0, "", ""
+	switch {
+	case errors.Is(err, sql.ErrNoRows) || (err == nil && session.UserID != uploadUserID(c)):
+		status, code, message = http.StatusNotFound, "NOT_FOUND", "Upload not found"
+	case err != nil:
+		status, code, message = http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load upload"
+	case session.ExpiresAt.Before(time.Now()):
+		status, code, message = http.StatusGone, "UPLOAD_EXPIRED", "Upload has expired"
+	}
+	if status == 0 {
+		return session, true
+	}
+
+	if c.Request.Method == http.MethodHead {
+		c.Status(status)
+	} else {
+		c.JSON(status, dto.ErrorResponse{Error: dto.ErrorDetail{Code: code, Message: message}})
+	}
+	return nil, false
+}
+
+// sessionHeaders describes the progress of a session to the client
+func sessionHeaders(c *gin.Context, session *models.UploadSession) {
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Header("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	if session.MediaItemID != nil {
+		c.Header("Media-Item-ID", strconv.FormatInt(*session.MediaItemID, 10))
+	}
+}
+
+// Options godoc
+// @Summary Resumable upload capabilities
+// @Description Report the supported tus protocol version, extensions and maximum upload size
+// @Tags Media
+// @Security BearerAuth
+// @Success 204
+// @Router /admin/media/uploads [options]
+func (h *ResumableUploadHandler) Options(c *gin.Context) {
+	c.Header("Tus-Resumable", TusVersion)
+	c.Header("Tus-Version", TusVersion)
+	c.Header("Tus-Extension", TusExtensions)
+	c.Header("Tus-Max-Size", strconv.Itoa(MaxUploadSize))
+	c.Status(http.StatusNoContent)
+}
+
+// Create godoc
+// @Summary Start a resumable upload
+// @Description Create a tus upload session. Upload-Metadata may carry base64 encoded filename, filetype, title, alt and category_id. The session URL is returned in Location.
+// @Tags Media
+// @Security BearerAuth
+// @Param Tus-Resumable header string true "Protocol version, 1.0.0"
+// @Param Upload-Length header int true "Total file size in bytes (max 100MB)"
+// @Param Upload-Metadata header string false "tus metadata: filename, filetype, title, alt, category_id"
+// @Success 201
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 412 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/media/uploads [post]
+func (h *ResumableUploadHandler) Create(c *gin.Context) {
+	if !checkTusVersion(c) {
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INVALID_LENGTH",
+				Message: "Upload-Length must be a positive number of bytes",
+			},
+		})
+		return
+	}
+	if length > MaxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "FILE_TOO_LARGE",
+				Message: fmt.Sprintf("File size exceeds maximum of %d bytes", MaxUploadSize),
+			},
+		})
+		return
+	}
+
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INVALID_METADATA",
+				Message: err.Error(),
+			},
+		})
+		return
+	}
+
+	// Reject unsupported types before any bytes are sent
+	contentType := metadata["filetype"]
+	if !AllowedMediaMIME[contentType] {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INVALID_FILE_TYPE",
+				Message: "Only JPEG, PNG, WebP images and MP4, MPEG, MOV, AVI, WebM videos are allowed",
+			},
+		})
+		return
+	}
+
+	session := &models.UploadSession{
+		ID:          uuid.New().String(),
+		UserID:      uploadUserID(c),
+		Filename:    filepath.Base(metadata["filename"]),
+		ContentType: contentType,
+		Title:       metadata["title"],
+		Description: metadata["alt"],
+		Length:      length,
+		ExpiresAt:   time.Now().Add(h.ttl),
+	}
+	if categoryID, err := strconv.ParseInt(metadata["category_id"], 10, 64); err == nil {
+		session.CategoryID = categoryID
+	}
+
+	if err := os.MkdirAll(h.dir, 0755); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "STORAGE_ERROR",
+				Message: "Failed to create upload directory",
+			},
+		})
+		return
+	}
+	part, err := os.OpenFile(h.partPath(session.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "STORAGE_ERROR",
+				Message: "Failed to create upload file",
+			},
+		})
+		return
+	}
+	part.Close()
+
+	if err := h.sessions.Create(c.Request.Context(), session); err != nil {
+		_ = os.Remove(h.partPath(session.ID))
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to create upload",
+			},
+		})
+		return
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+session.ID)
+	sessionHeaders(c, session)
+	c.Status(http.StatusCreated)
+}
+
+// Head godoc
+// @Summary Get resumable upload offset
+// @Description Return the number of bytes received in Upload-Offset, so an interrupted upload can resume. Completed uploads also return Media-Item-ID.
+// @Tags Media
+// @Security BearerAuth
+// @Param id path string true "Upload ID"
+// @Success 200
+// @Failure 404
+// @Failure 410
+// @Router /admin/media/uploads/{id} [head]
+func (h *ResumableUploadHandler) Head(c *gin.Context) {
+	c.Header("Tus-Resumable", TusVersion)
+	c.Header("Cache-Control", "no-store")
+	session, ok := h.loadSession(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Upload-Length", strconv.FormatInt(session.Length, 10))
+	sessionHeaders(c, session)
+	c.Status(http.StatusOK)
+}
+
+// Patch godoc
+// @Summary Upload a chunk
+// @Description Append the request body at Upload-Offset. When the last byte arrives the file is validated and becomes a media item, whose ID is returned in Media-Item-ID.
+// @Tags Media
+// @Security BearerAuth
+// @Accept application/offset+octet-stream
+// @Param id path string true "Upload ID"
+// @Param Tus-Resumable header string true "Protocol version, 1.0.0"
+// @Param Upload-Offset header int true "Offset the chunk starts at"
+// @Success 204
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 410 {object} dto.ErrorResponse
+// @Failure 415 {object} dto.ErrorResponse
+// @Failure 423 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/media/uploads/{id} [patch]
+func (h *ResumableUploadHandler) Patch(c *gin.Context) {
+	if !checkTusVersion(c) {
+		return
+	}
+	if c.ContentType() != tusChunkType {
+		c.JSON(http.StatusUnsupportedMediaType, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INVALID_CONTENT_TYPE",
+				Message: "Content-Type must be " + tusChunkType,
+			},
+		})
+		return
+	}
+
+	unlock, ok := h.lock(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusLocked, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "UPLOAD_LOCKED",
+				Message: "Another chunk of this upload is being received",
+			},
+		})
+		return
+	}
+	defer unlock()
+
+	session, ok := h.loadSession(c)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset != session.Offset || session.MediaItemID != nil {
+		sessionHeaders(c, session)
+		c.JSON(http.StatusConflict, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "OFFSET_MISMATCH",
+				Message: fmt.Sprintf("Upload-Offset must be %d", session.Offset),
+			},
+		})
+		return
+	}
+
+	part, err := os.OpenFile(h.partPath(session.ID), os.O_WRONLY, 0600)
+	if err == nil {
+		_, err = part.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		if part != nil {
+			part.Close()
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "STORAGE_ERROR",
+				Message: "Failed to open upload file",
+			},
+		})
+		return
+	}
+
+	// Whatever arrived before a dropped connection is kept, so the client
+	// resumes from there
+	written, copyErr := io.Copy(part, io.LimitReader(c.Request.Body, session.Length-offset))
+	if err := part.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	session.Offset = offset + written
+	session.ExpiresAt = time.Now().Add(h.ttl)
+	if err := h.sessions.UpdateOffset(c.Request.Context(), session.ID, session.Offset, session.ExpiresAt); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "DATABASE_ERROR",
+				Message: "Failed to record upload progress",
+			},
+		})
+		return
+	}
+	if copyErr != nil {
+		log.Printf("Upload %s interrupted at %d bytes: %v", session.ID, session.Offset, copyErr)
+		sessionHeaders(c, session)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "UPLOAD_INTERRUPTED",
+				Message: "Failed to receive chunk",
+			},
+		})
+		return
+	}
+
+	if session.Offset == session.Length && !h.finish(c, session) {
+		return
+	}
+
+	sessionHeaders(c, session)
+	c.Status(http.StatusNoContent)
+}
+
+// finish hands a complete upload to the regular media upload path. A file
+// that fails validation cannot be fixed by resuming, so its session is dropped.
+func (h *ResumableUploadHandler) finish(c *gin.Context, session *models.UploadSession) bool {
+	part, err := os.Open(h.partPath(session.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "STORAGE_ERROR",
+				Message: "Failed to open upload file",
+			},
+		})
+		return false
+	}
+
+	response, ok := h.media.saveUpload(c, mediaUpload{
+		file:        part,
+		size:        session.Length,
+		filename:    session.Filename,
+		contentType: session.ContentType,
+		title:       session.Title,
+		alt:         session.Description,
+		categoryID:  session.CategoryID,
+	})
+	part.Close()
+	if !ok {
+		h.discard(c, session.ID)
+		return false
+	}
+
+	if err := os.Remove(h.partPath(session.ID)); err != nil {
+		log.Printf("Failed to remove partial upload %s: %v", session.ID, err)
+	}
+	session.MediaItemID = &response.ID
+	if err := h.sessions.Complete(c.Request.Context(), session.ID, response.ID); err != nil {
+		log.Printf("Failed to mark upload %s complete: %v", session.ID, err)
+	}
+	return true
+}
+
+// Delete godoc
+// @Summary Cancel a resumable upload
+// @Description Terminate an upload session and discard the bytes received. A media item already created from it is kept.
+// @Tags Media
+// @Security BearerAuth
+// @Param id path string true "Upload ID"
+// @Param Tus-Resumable header string true "Protocol version, 1.0.0"
+// @Success 204
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 423 {object} dto.ErrorResponse
+// @Router /admin/media/uploads/{id} [delete]
+func (h *ResumableUploadHandler) Delete(c *gin.Context) {
+	if !checkTusVersion(c) {
+		return
+	}
+
+	unlock, ok := h.lock(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusLocked, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "UPLOAD_LOCKED",
+				Message: "A chunk of this upload is being received",
+			},
+		})
+		return
+	}
+	defer unlock()
+
+	session, ok := h.loadSession(c)
+	if !ok {
+		return
+	}
+
+	h.discard(c, session.ID)
+	h.locks.Delete(session.ID)
+	c.Status(http.StatusNoContent)
+}
+
+// ExpireSessions removes expired sessions and their partial files every
+// interval until ctx is cancelled
+func (h *ResumableUploadHandler) ExpireSessions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		h.expire(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *ResumableUploadHandler) expire(ctx context.Context) {
+	sessions, err := h.sessions.ListExpired(ctx, time.Now())
+	if err != nil {
+		log.Printf("Failed to list expired uploads: %v", err)
+		return
+	}
+	for _, session := range sessions {
+		unlock, ok := h.lock(session.ID)
+		if !ok {
+			continue // a chunk is arriving, which extends the expiry
+		}
+		if err := os.Remove(h.partPath(session.ID)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove partial upload %s: %v", session.ID, err)
+		}
+		if err := h.sessions.Delete(ctx, session.ID); err != nil {
+			log.Printf("Failed to delete upload session %s: %v", session.ID, err)
+		}
+		unlock()
+		h.locks.Delete(session.ID)
+	}
+}
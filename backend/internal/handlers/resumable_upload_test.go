@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thieugt95/portal-365/backend/internal/config"
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/imaging"
+	"github.com/thieugt95/portal-365/backend/internal/quarantine"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+	"github.com/thieugt95/portal-365/backend/internal/watermark"
+)
+
+// tusServer serves the resumable upload routes over a fresh database with
+// category 1, and users 1 and 2 signed in as the X-User header says
+type tusServer struct {
+	handler *ResumableUploadHandler
+	router  *gin.Engine
+}
+
+func newTusServer(t *testing.T) *tusServer {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := database.Initialize(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO users (id, email, password_hash, full_name) VALUES
+		(1, 'one@example.com', '', 'One'), (2, 'two@example.com', '', 'Two');
+		INSERT INTO categories (id, name, slug) VALUES (1, 'Photos', 'photos')`); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{UploadTempDir: filepath.Join(dir, "tmp"), UploadSessionTTL: time.Hour}
+	repos := database.NewRepositories(db)
+	store := storage.NewFilesystem(filepath.Join(dir, "storage"))
+	marks := watermark.New(repos, store, imaging.NewRenderer(cfg, store))
+	h := NewResumableUploadHandler(cfg, repos, store, marks, quarantine.New(repos, nil, filepath.Join(dir, "quarantine")))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if id, err := strconv.ParseInt(c.GetHeader("X-User"), 10, 64); err == nil {
+			c.Set("user_id", id)
+		}
+	})
+	router.POST("/uploads", h.Create)
+	router.HEAD("/uploads/:id", h.Head)
+	router.PATCH("/uploads/:id", h.Patch)
+	router.DELETE("/uploads/:id", h.Delete)
+	return &tusServer{handler: h, router: router}
+}
+
+func (s *tusServer) do(method, target, user string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("X-User", user)
+	req.Header.Set("Tus-Resumable", TusVersion)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// create starts an upload of length bytes for user 1, filed in category 1,
+// and returns its URL
+func (s *tusServer) create(t *testing.T, length int, filetype string) string {
+	t.Helper()
+	w := s.do(http.MethodPost, "/uploads", "1", nil, map[string]string{
+		"Upload-Length": strconv.Itoa(length),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("photo.png")) + ",filetype " + base64.StdEncoding.EncodeToString([]byte(filetype)) +
+			",category_id " + base64.StdEncoding.EncodeToString([]byte("1")),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, body %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Upload-Offset"); got != "0" {
+		t.Fatalf("create Upload-Offset = %q, want 0", got)
+	}
+	return w.Header().Get("Location")
+}
+
+func (s *tusServer) patch(location, user string, offset int, body io.Reader) *httptest.ResponseRecorder {
+	return s.do(http.MethodPatch, location, user, body, map[string]string{
+		"Content-Type":  tusChunkType,
+		"Upload-Offset": strconv.Itoa(offset),
+	})
+}
+
+func (s *tusServer) offset(t *testing.T, location string) string {
+	t.Helper()
+	w := s.do(http.MethodHead, location, "1", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("head status = %d", w.Code)
+	}
+	return w.Header().Get("Upload-Offset")
+}
+
+// failingReader yields data and then fails, as a dropped connection does
+type failingReader struct {
+	data []byte
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 48, 32))
+	for x := 0; x < 48; x++ {
+		for y := 0; y < 32; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 5), uint8(y * 8), 120, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestResumableUploadOffsets(t *testing.T) {
+	s := newTusServer(t)
+	location := s.create(t, 10, "video/mp4")
+
+	tests := []struct {
+		name       string
+		user       string
+		offset     int
+		body       io.Reader
+		wantStatus int
+		wantOffset string
+	}{
+		{"first chunk", "1", 0, bytes.NewReader([]byte("abcd")), http.StatusNoContent, "4"},
+		{"chunk sent again", "1", 0, bytes.NewReader([]byte("abcd")), http.StatusConflict, "4"},
+		{"offset past the end", "1", 6, bytes.NewReader([]byte("gh")), http.StatusConflict, "4"},
+		{"other user", "2", 4, bytes.NewReader([]byte("ef")), http.StatusNotFound, ""},
+		{"interrupted chunk keeps what arrived", "1", 4, &failingReader{data: []byte("ef")}, http.StatusInternalServerError, "6"},
+		{"resumed at the new offset", "1", 6, bytes.NewReader([]byte("gh")), http.StatusNoContent, "8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.patch(location, tt.user, tt.offset, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := w.Header().Get("Upload-Offset"); got != tt.wantOffset {
+				t.Errorf("Upload-Offset = %q, want %q", got, tt.wantOffset)
+			}
+		})
+	}
+
+	if got := s.offset(t, location); got != "8" {
+		t.Errorf("head Upload-Offset = %q, want 8", got)
+	}
+	part, err := os.ReadFile(s.handler.partPath(filepath.Base(location)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(part) != "abcdefgh" {
+		t.Errorf("partial file = %q, want %q", part, "abcdefgh")
+	}
+}
+
+func TestResumableUploadCompletes(t *testing.T) {
+	s := newTusServer(t)
+	data := testPNG(t)
+	location := s.create(t, len(data), "image/png")
+
+	half := len(data) / 2
+	if w := s.patch(location, "1", 0, bytes.NewReader(data[:half])); w.Code != http.StatusNoContent {
+		t.Fatalf("first half status = %d (%s)", w.Code, w.Body)
+	}
+	if got := s.offset(t, location); got != strconv.Itoa(half) {
+		t.Fatalf("Upload-Offset = %q, want %d", got, half)
+	}
+	w := s.patch(location, "1", half, bytes.NewReader(data[half:]))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("second half status = %d (%s)", w.Code, w.Body)
+	}
+	id := w.Header().Get("Media-Item-ID")
+	if id == "" {
+		t.Fatal("no Media-Item-ID after the last chunk")
+	}
+
+	head := s.do(http.MethodHead, location, "1", nil, nil)
+	if got := head.Header().Get("Media-Item-ID"); got != id {
+		t.Errorf("head Media-Item-ID = %q, want %q", got, id)
+	}
+	if w := s.patch(location, "1", len(data), bytes.NewReader([]byte("x"))); w.Code != http.StatusConflict {
+		t.Errorf("chunk after completion status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if _, err := os.Stat(s.handler.partPath(filepath.Base(location))); !os.IsNotExist(err) {
+		t.Errorf("partial file left after completion: %v", err)
+	}
+}
+
+func TestResumableUploadExpiry(t *testing.T) {
+	s := newTusServer(t)
+	expired := s.create(t, 10, "video/mp4")
+	live := s.create(t, 10, "video/mp4")
+	if w := s.patch(expired, "1", 0, bytes.NewReader([]byte("abc"))); w.Code != http.StatusNoContent {
+		t.Fatalf("patch status = %d", w.Code)
+	}
+
+	ctx := context.Background()
+	id := filepath.Base(expired)
+	if err := s.handler.sessions.UpdateOffset(ctx, id, 3, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := s.do(http.MethodHead, expired, "1", nil, nil); w.Code != http.StatusGone {
+		t.Errorf("head of expired upload status = %d, want %d", w.Code, http.StatusGone)
+	}
+	if w := s.patch(expired, "1", 3, bytes.NewReader([]byte("def"))); w.Code != http.StatusGone {
+		t.Errorf("patch of expired upload status = %d, want %d", w.Code, http.StatusGone)
+	}
+
+	s.handler.expire(ctx)
+	if w := s.do(http.MethodHead, expired, "1", nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("head after expiry status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if _, err := os.Stat(s.handler.partPath(id)); !os.IsNotExist(err) {
+		t.Errorf("partial file left after expiry: %v", err)
+	}
+	if got := s.offset(t, live); got != "0" {
+		t.Errorf("live upload Upload-Offset = %q, want 0", got)
+	}
+}
+
+func TestParseUploadMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"pairs", "filename cGhvdG8ucG5n, filetype aW1hZ2UvcG5n", map[string]string{"filename": "photo.png", "filetype": "image/png"}, false},
+		{"value left out", "title,alt YWx0", map[string]string{"title": "", "alt": "alt"}, false},
+		{"empty", "", map[string]string{}, false},
+		{"not base64", "filename photo.png", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUploadMetadata(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("metadata = %v, want %v", got, tt.want)
+			}
+			for key, value := range tt.want {
+				if got[key] != value {
+					t.Errorf("%s = %q, want %q", key, got[key], value)
+				}
+			}
+		})
+	}
+}
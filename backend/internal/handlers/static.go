@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thieugt95/portal-365/backend/internal/config"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+)
+
+// StaticHandler serves stored files under /static/. Range requests are
+// answered from any backend, which video previews depend on; with
+// STORAGE_REDIRECT set, backends that can presign URLs send the client to the
+// bucket instead.
+type StaticHandler struct {
+	store      storage.Storage
+	redirect   bool
+	presignTTL time.Duration
+}
+
+func NewStaticHandler(cfg *config.Config, store storage.Storage) *StaticHandler {
+	return &StaticHandler{store: store, redirect: cfg.StorageRedirect, presignTTL: cfg.StoragePresignTTL}
+}
+
+func (h *StaticHandler) Serve(c *gin.Context) {
+	ctx := c.Request.Context()
+	key := storage.Key(storage.URLPrefix + strings.TrimPrefix(c.Param("filepath"), "/"))
+	if key == "" {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if h.redirect {
+		if u, err := h.store.PresignedURL(ctx, key, h.presignTTL); err == nil {
+			c.Redirect(http.StatusFound, u)
+			return
+		}
+	}
+
+	obj, info, err := h.store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to open stored file %s: %v", key, err)
+		c.Status(http.StatusBadGateway)
+		return
+	}
+	defer obj.Close()
+
+	if info.ContentType != "" {
+		c.Header("Content-Type", info.ContentType)
+	}
+	if info.ETag != "" {
+		c.Header("ETag", info.ETag)
+	}
+	c.Header("Accept-Ranges", "bytes")
+	http.ServeContent(c.Writer, c.Request, path.Base(key), info.ModTime, obj)
+}
@@ -0,0 +1,604 @@
+package handlers
+
+import (
+	"context"
+	"html"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/middleware"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/singleflight"
+)
+
+const (
+	// Number of recent published articles the suggestion statistics are learned from
+	suggestSampleSize = 1000
+	// Characters of each sample's content taken into account
+	suggestSampleContent = 3000
+	// Occurrences in the title count this many times more than in the body
+	suggestTitleWeight = 3.0
+	// Longest keyword, in syllables
+	suggestMaxPhrase = 4
+	// Longest a trained model is used while articles don't change
+	suggestModelTTL = 10 * time.Minute
+)
+
+// vietnameseStopwords are function words that never start, end or sit inside a
+// keyword. Vietnamese writes one syllable per word, so keywords are runs of
+// syllables between punctuation and these words.
+var vietnameseStopwords = makeWordSet(`
+	và của các những là có được trong cho với đã đang sẽ này đó kia một thì
+	mà khi để từ theo tại về như cũng nhiều rất ra vào lên trên dưới sau trước
+	đến nhằm nhưng hoặc hay nên vì do bị bởi còn lại đây ấy nào gì ai ngày
+	tháng năm lúc giờ qua tới cùng luôn đều vẫn thêm hơn mỗi mọi cả chúng tôi
+	ta họ mình nó vậy rằng nếu nhau vừa
+`)
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+func makeWordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+// keywordCandidate is a phrase found in a text with its weighted count
+type keywordCandidate struct {
+	display string
+	size    int
+	count   float64
+	inBody  bool
+	proper  bool
+}
+
+// textAnalysis holds what the suggestion scoring needs to know about a text
+type textAnalysis struct {
+	phrases  map[string]*keywordCandidate // keyed by the lowercase phrase
+	features map[string]float64           // syllables and phrases for category classification
+	slugs    []weightedText               // slugged punctuation segments for tag matching
+	runs     []weightedRun                // lowercase syllable runs between stopwords
+}
+
+type weightedText struct {
+	text   string
+	weight float64
+}
+
+type weightedRun struct {
+	words  []string
+	weight float64
+}
+
+func analyzeText(title, summary, content string) *textAnalysis {
+	a := &textAnalysis{
+		phrases:  make(map[string]*keywordCandidate),
+		features: make(map[string]float64),
+	}
+	a.add(title, suggestTitleWeight, false)
+	a.add(summary, 1, true)
+	a.add(content, 1, true)
+	return a
+}
+
+func (a *textAnalysis) add(text string, weight float64, body bool) {
+	text = norm.NFC.String(html.UnescapeString(htmlTagPattern.ReplaceAllString(text, " ")))
+
+	for _, segment := range splitSegments(text) {
+		a.slugs = append(a.slugs, weightedText{text: "-" + generateSlug(strings.Join(segment, " ")) + "-", weight: weight})
+
+		// Break the segment into runs of content syllables
+		var run []string
+		for i := 0; i <= len(segment); i++ {
+			if i < len(segment) {
+				lower := strings.ToLower(segment[i])
+				if !vietnameseStopwords[lower] && !hasDigit(lower) {
+					a.features[lower] += weight
+					run = append(run, segment[i])
+					continue
+				}
+			}
+			a.addRun(run, weight, body)
+			run = nil
+		}
+	}
+}
+
+func (a *textAnalysis) addRun(run []string, weight float64, body bool) {
+	if len(run) == 0 {
+		return
+	}
+	lower := make([]string, len(run))
+	for i, word := range run {
+		lower[i] = strings.ToLower(word)
+	}
+	a.runs = append(a.runs, weightedRun{words: lower, weight: weight})
+
+	for i, word := range run {
+		if isAcronym(word) {
+			a.addPhrase(run[i:i+1], weight, body)
+		}
+		for n := 2; n <= suggestMaxPhrase && i+n <= len(run); n++ {
+			a.addPhrase(run[i:i+n], weight, body)
+		}
+	}
+}
+
+func (a *textAnalysis) addPhrase(words []string, weight float64, body bool) {
+	key := strings.ToLower(strings.Join(words, " "))
+	if len(words) == 2 {
+		a.features[key] += weight
+	}
+
+	candidate, ok := a.phrases[key]
+	if !ok {
+		candidate = &keywordCandidate{size: len(words)}
+		a.phrases[key] = candidate
+	}
+	// Titles are often capitalised for emphasis, so prefer how the body writes it
+	if candidate.display == "" || (body && !candidate.inBody) {
+		candidate.display, candidate.proper = displayPhrase(words)
+	}
+	candidate.inBody = candidate.inBody || body
+	candidate.count += weight
+}
+
+// splitSegments splits text into runs of words between punctuation marks
+func splitSegments(text string) [][]string {
+	var segments [][]string
+	var segment []string
+	var word strings.Builder
+
+	endWord := func() {
+		if word.Len() > 0 {
+			segment = append(segment, word.String())
+			word.Reset()
+		}
+	}
+	endSegment := func() {
+		endWord()
+		if len(segment) > 0 {
+			segments = append(segments, segment)
+			segment = nil
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r):
+			word.WriteRune(r)
+		case unicode.IsSpace(r):
+			endWord()
+		default:
+			endSegment()
+		}
+	}
+	endSegment()
+
+	return segments
+}
+
+// displayPhrase keeps proper nouns (every syllable capitalised) and acronyms
+// as written and lowercases everything else. It also reports whether the
+// phrase is a proper noun.
+func displayPhrase(words []string) (string, bool) {
+	properNoun := len(words) > 1
+	for _, word := range words {
+		first, _ := utf8.DecodeRuneInString(word)
+		if !unicode.IsUpper(first) {
+			properNoun = false
+		}
+	}
+
+	out := make([]string, len(words))
+	for i, word := range words {
+		if properNoun || isAcronym(word) {
+			out[i] = word
+		} else {
+			out[i] = strings.ToLower(word)
+		}
+	}
+	return strings.Join(out, " "), properNoun
+}
+
+func isAcronym(word string) bool {
+	if utf8.RuneCountInString(word) < 2 {
+		return false
+	}
+	for _, r := range word {
+		if !unicode.IsUpper(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasDigit(word string) bool {
+	return strings.IndexFunc(word, unicode.IsDigit) >= 0
+}
+
+// keywords returns the phrases worth suggesting, seen at least twice (a title
+// occurrence alone qualifies). Without a dictionary every pair of adjacent
+// syllables looks like a compound word, so each run is tiled greedily with its
+// most frequent non-overlapping pairs, which drops pairs that straddle two
+// words ("luyện chiến" in "huấn luyện chiến sĩ"). Longer phrases are only
+// kept for proper nouns such as "Nguyễn Văn An", and acronyms stand alone.
+func (a *textAnalysis) keywords() map[string]*keywordCandidate {
+	counts := make(map[string]float64)
+	for _, run := range a.runs {
+		for _, key := range a.tileRun(run.words) {
+			counts[key] += run.weight
+		}
+	}
+	for key, candidate := range a.phrases {
+		if candidate.size == 1 || (candidate.size > 2 && candidate.proper) {
+			counts[key] = candidate.count
+		}
+	}
+
+	result := make(map[string]*keywordCandidate)
+	for key, count := range counts {
+		if count >= 2 {
+			result[key] = &keywordCandidate{
+				display: a.phrases[key].display,
+				size:    a.phrases[key].size,
+				count:   count,
+				proper:  a.phrases[key].proper,
+			}
+		}
+	}
+
+	// A proper noun swallows the shorter phrases that only occur inside it
+	for key, candidate := range result {
+		if candidate.size < 3 {
+			continue
+		}
+		words := strings.Fields(key)
+		for _, sub := range []string{strings.Join(words[1:], " "), strings.Join(words[:len(words)-1], " ")} {
+			if _, ok := result[sub]; ok && a.phrases[sub].count <= a.phrases[key].count {
+				delete(result, sub)
+			}
+		}
+	}
+
+	return result
+}
+
+// tileRun picks non-overlapping syllable pairs from a run, most frequent first
+// and leftmost on ties
+func (a *textAnalysis) tileRun(words []string) []string {
+	if len(words) < 2 {
+		return nil
+	}
+
+	positions := make([]int, len(words)-1)
+	for i := range positions {
+		positions[i] = i
+	}
+	pair := func(i int) string { return words[i] + " " + words[i+1] }
+	sort.SliceStable(positions, func(i, j int) bool {
+		return a.phrases[pair(positions[i])].count > a.phrases[pair(positions[j])].count
+	})
+
+	used := make([]bool, len(words))
+	var keys []string
+	for _, i := range positions {
+		if used[i] || used[i+1] {
+			continue
+		}
+		used[i], used[i+1] = true, true
+		keys = append(keys, pair(i))
+	}
+	return keys
+}
+
+// countSlug counts weighted occurrences of a tag slug in the text
+func (a *textAnalysis) countSlug(slug string) float64 {
+	needle := "-" + slug + "-"
+	var hits float64
+	for _, segment := range a.slugs {
+		hits += float64(strings.Count(segment.text, needle)) * segment.weight
+	}
+	return hits
+}
+
+// suggestionModel holds statistics learned from published articles
+type suggestionModel struct {
+	documents    int
+	phraseDocs   map[string]int           // articles containing each phrase
+	phraseTagged map[string]int           // tagged articles containing each phrase
+	phraseTags   map[string]map[int64]int // phrase -> tag -> articles having both
+	categoryDocs map[int64]int
+	categoryFeat map[int64]map[string]float64
+	categorySum  map[int64]float64
+	vocabulary   map[string]bool
+}
+
+func trainSuggestionModel(samples []*models.ArticleSample) *suggestionModel {
+	m := &suggestionModel{
+		documents:    len(samples),
+		phraseDocs:   make(map[string]int),
+		phraseTagged: make(map[string]int),
+		phraseTags:   make(map[string]map[int64]int),
+		categoryDocs: make(map[int64]int),
+		categoryFeat: make(map[int64]map[string]float64),
+		categorySum:  make(map[int64]float64),
+		vocabulary:   make(map[string]bool),
+	}
+
+	for _, sample := range samples {
+		analysis := analyzeText(sample.Title, sample.Summary, sample.Content)
+
+		for key := range analysis.phrases {
+			m.phraseDocs[key]++
+			if len(sample.TagIDs) == 0 {
+				continue
+			}
+			m.phraseTagged[key]++
+			if m.phraseTags[key] == nil {
+				m.phraseTags[key] = make(map[int64]int)
+			}
+			for _, tagID := range sample.TagIDs {
+				m.phraseTags[key][tagID]++
+			}
+		}
+
+		m.categoryDocs[sample.CategoryID]++
+		if m.categoryFeat[sample.CategoryID] == nil {
+			m.categoryFeat[sample.CategoryID] = make(map[string]float64)
+		}
+		for feature, count := range analysis.features {
+			m.categoryFeat[sample.CategoryID][feature] += count
+			m.categorySum[sample.CategoryID] += count
+			m.vocabulary[feature] = true
+		}
+	}
+
+	return m
+}
+
+// idf down-weights phrases that appear in many articles, such as "cán bộ"
+func (m *suggestionModel) idf(key string) float64 {
+	return math.Log(float64(m.documents+1)/float64(m.phraseDocs[key]+1)) + 1
+}
+
+// tagAssociation scores tags that co-occur with the text's phrases in already
+// tagged articles, so tags are suggested even when their name isn't in the text
+func (m *suggestionModel) tagAssociation(a *textAnalysis) map[int64]float64 {
+	scores := make(map[int64]float64)
+	for key, candidate := range a.phrases {
+		tagged := m.phraseTagged[key]
+		if tagged < 2 {
+			continue
+		}
+		weight := math.Min(candidate.count, 3) * m.idf(key)
+		for tagID, together := range m.phraseTags[key] {
+			if p := float64(together) / float64(tagged); p >= 0.3 {
+				scores[tagID] += p * weight
+			}
+		}
+	}
+	return scores
+}
+
+// classify returns category probabilities using multinomial naive Bayes
+func (m *suggestionModel) classify(a *textAnalysis) map[int64]float64 {
+	if m.documents == 0 {
+		return nil
+	}
+
+	vocabulary := float64(len(m.vocabulary))
+	logScores := make(map[int64]float64)
+	best := math.Inf(-1)
+	for categoryID, docs := range m.categoryDocs {
+		score := math.Log(float64(docs) / float64(m.documents))
+		for feature, count := range a.features {
+			if !m.vocabulary[feature] {
+				continue
+			}
+			score += count * math.Log((m.categoryFeat[categoryID][feature]+1)/(m.categorySum[categoryID]+vocabulary))
+		}
+		logScores[categoryID] = score
+		best = math.Max(best, score)
+	}
+
+	var total float64
+	probabilities := make(map[int64]float64)
+	for categoryID, score := range logScores {
+		probabilities[categoryID] = math.Exp(score - best)
+		total += probabilities[categoryID]
+	}
+	for categoryID := range probabilities {
+		probabilities[categoryID] /= total
+	}
+	return probabilities
+}
+
+// suggestionCache keeps the trained suggestion model until the published
+// articles change, so requests don't reload and retrain on every keystroke
+type suggestionCache struct {
+	mu        sync.Mutex
+	model     *suggestionModel
+	version   string
+	trainedAt time.Time
+	flight    singleflight.Group
+}
+
+// get returns the model, training it again when articles changed since or it
+// is older than suggestModelTTL
+func (s *suggestionCache) get(ctx context.Context, articles repositories.ArticleRepository) (*suggestionModel, error) {
+	s.mu.Lock()
+	model, version, trainedAt := s.model, s.version, s.trainedAt
+	s.mu.Unlock()
+
+	current, err := articles.SamplesVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if model != nil && current == version && time.Since(trainedAt) < suggestModelTTL {
+		return model, nil
+	}
+
+	trained, err, _ := s.flight.Do(current, func() (interface{}, error) {
+		samples, err := articles.ListSamples(ctx, suggestSampleSize, suggestSampleContent)
+		if err != nil {
+			return nil, err
+		}
+		model := trainSuggestionModel(samples)
+		s.mu.Lock()
+		s.model, s.version, s.trainedAt = model, current, time.Now()
+		s.mu.Unlock()
+		return model, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return trained.(*suggestionModel), nil
+}
+
+// SuggestMetadata godoc
+// @Summary Suggest tags and category for an article
+// @Description Extract keywords from the title and content and rank existing tags first, then new keyword candidates, and predict the most likely category from already published articles. Everything is computed locally.
+// @Tags Articles (Admin)
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body dto.SuggestMetadataRequest true "Article text"
+// @Success 200 {object} dto.SuccessResponse{data=dto.SuggestMetadataResponse}
+// @Failure 400 {object} middleware.ErrorResponse "Invalid request body"
+// @Failure 401 {object} middleware.ErrorResponse "Unauthorized"
+// @Failure 500 {object} middleware.ErrorResponse "Internal server error"
+// @Router /api/v1/admin/articles/suggest-metadata [post]
+func (h *ArticleHandler) SuggestMetadata(c *gin.Context) {
+	var req dto.SuggestMetadataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if req.Limit < 1 || req.Limit > 50 {
+		req.Limit = 10
+	}
+
+	ctx := c.Request.Context()
+
+	model, err := h.suggestions.get(ctx, h.repos.Articles)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to load articles")
+		return
+	}
+	tags, err := h.repos.Tags.ListWithUsage(ctx, false, "", 0)
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "internal_error", "Failed to fetch tags")
+		return
+	}
+
+	analysis := analyzeText(req.Title, "", req.Content)
+
+	response := dto.SuggestMetadataResponse{
+		Tags:                  suggestTags(model, analysis, tags, req.Limit),
+		AlternativeCategories: make([]dto.CategorySuggestion, 0),
+	}
+
+	probabilities := model.classify(analysis)
+	categoryIDs := make([]int64, 0, len(probabilities))
+	for categoryID := range probabilities {
+		categoryIDs = append(categoryIDs, categoryID)
+	}
+	sort.Slice(categoryIDs, func(i, j int) bool {
+		return probabilities[categoryIDs[i]] > probabilities[categoryIDs[j]]
+	})
+	for _, categoryID := range categoryIDs {
+		if len(response.AlternativeCategories) == 3 {
+			break
+		}
+		category, err := h.repos.Categories.GetByID(ctx, categoryID)
+		if err != nil || !category.IsActive {
+			continue
+		}
+		suggestion := dto.CategorySuggestion{
+			ID:          category.ID,
+			Name:        category.Name,
+			Slug:        category.Slug,
+			Probability: math.Round(probabilities[categoryID]*1000) / 1000,
+		}
+		if response.Category == nil {
+			response.Category = &suggestion
+			continue
+		}
+		response.AlternativeCategories = append(response.AlternativeCategories, suggestion)
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: response})
+}
+
+// suggestTags ranks existing tags found in or associated with the text, then
+// fills the remaining slots with new keywords
+func suggestTags(model *suggestionModel, analysis *textAnalysis, tags []*models.TagUsage, limit int) []dto.TagSuggestion {
+	association := model.tagAssociation(analysis)
+	existingSlugs := make(map[string]bool, len(tags))
+
+	var existing []dto.TagSuggestion
+	for _, tag := range tags {
+		existingSlugs[tag.Slug] = true
+
+		literal := analysis.countSlug(tag.Slug)
+		if literal == 0 && association[tag.ID] < 1 {
+			continue
+		}
+		score := (2*literal + association[tag.ID]) * (1 + 0.1*math.Log1p(float64(tag.ArticleCount)))
+		id := tag.ID
+		existing = append(existing, dto.TagSuggestion{TagID: &id, Name: tag.Name, Slug: tag.Slug, Score: score, Existing: true})
+	}
+
+	var keywords []dto.TagSuggestion
+	for key, candidate := range analysis.keywords() {
+		slug := generateSlug(candidate.display)
+		if existingSlugs[slug] {
+			continue
+		}
+		score := candidate.count * model.idf(key) * (1 + 0.2*float64(candidate.size-2))
+		keywords = append(keywords, dto.TagSuggestion{Name: candidate.display, Slug: slug, Score: score})
+	}
+
+	result := make([]dto.TagSuggestion, 0, limit)
+	for _, group := range [][]dto.TagSuggestion{rankSuggestions(existing), rankSuggestions(keywords)} {
+		for _, suggestion := range group {
+			if len(result) == limit {
+				return result
+			}
+			result = append(result, suggestion)
+		}
+	}
+	return result
+}
+
+// rankSuggestions sorts by score and rescales scores relative to the best one
+func rankSuggestions(suggestions []dto.TagSuggestion) []dto.TagSuggestion {
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Slug < suggestions[j].Slug
+	})
+	if len(suggestions) > 0 && suggestions[0].Score > 0 {
+		top := suggestions[0].Score
+		for i := range suggestions {
+			suggestions[i].Score = math.Round(suggestions[i].Score/top*1000) / 1000
+		}
+	}
+	return suggestions
+}
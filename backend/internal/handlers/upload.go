@@ -1,23 +1,34 @@
 package handlers
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/thieugt95/portal-365/backend/internal/database"
 	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/imaging"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+	"github.com/thieugt95/portal-365/backend/internal/watermark"
 )
 
-type UploadHandler struct{}
+type UploadHandler struct {
+	renditions repositories.ImageRenditionRepository
+	blobs      repositories.StoredBlobRepository
+	store      storage.Storage
+	marks      *watermark.Service
+}
 
-func NewUploadHandler() *UploadHandler {
-	return &UploadHandler{}
+func NewUploadHandler(repos *database.Repositories, store storage.Storage, marks *watermark.Service) *UploadHandler {
+	return &UploadHandler{renditions: repos.Renditions, blobs: repos.Blobs, store: store, marks: marks}
 }
 
 const (
@@ -36,13 +47,13 @@ var AllowedMIME = map[string]bool{
 
 // UploadImage godoc
 // @Summary Upload image for article content or featured image
-// @Description Upload an image file (JPEG, PNG, WebP, GIF)
+// @Description Upload an image file (JPEG, PNG, WebP, GIF). The image is rotated upright per EXIF and stored without EXIF/XMP/GPS metadata. Scaled renditions are generated and returned as srcset lists. An image uploaded before is not stored twice: the existing URL is returned with duplicate=true.
 // @Tags Upload
 // @Security BearerAuth
 // @Accept multipart/form-data
 // @Produce json
 // @Param file formData file true "Image file (max 5MB)"
-// @Success 200 {object} dto.SuccessResponse{data=object{url=string}}
+// @Success 200 {object} dto.SuccessResponse{data=object{url=string,filename=string,width=int,height=int,image=dto.ResponsiveImage,duplicate=bool}}
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 401 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
@@ -89,19 +100,29 @@ func (h *UploadHandler) UploadImage(c *gin.Context) {
 		return
 	}
 
-	// Create upload directory if not exists
-	if err := os.MkdirAll(ArticleUploadDir, 0755); err != nil {
-		log.Printf("Failed to create directory: %v", err)
+	// Store the image upright and without EXIF/XMP/GPS metadata
+	data, err := io.ReadAll(file)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: dto.ErrorDetail{
 				Code:    "SERVER_ERROR",
-				Message: "Failed to create upload directory",
+				Message: "Failed to read file",
+			},
+		})
+		return
+	}
+	sanitized, err := imaging.Sanitize(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: dto.ErrorDetail{
+				Code:    "INVALID_IMAGE",
+				Message: "Failed to process image: " + err.Error(),
 			},
 		})
 		return
 	}
 
-	// Generate unique filename
+	// Generate extension
 	ext := filepath.Ext(header.Filename)
 	if ext == "" {
 		// Try to get extension from MIME type
@@ -117,15 +138,16 @@ func (h *UploadHandler) UploadImage(c *gin.Context) {
 		}
 	}
 
-	timestamp := time.Now().Format("20060102-150405")
-	filename := fmt.Sprintf("%s-%s%s", timestamp, uuid.New().String()[:8], ext)
-	filePath := filepath.Join(ArticleUploadDir, filename)
-
-	log.Printf("Saving file to: %s", filePath)
-
-	// Save file
-	dst, err := os.Create(filePath)
+	// Save file, sharing the stored copy when the same image was uploaded before
+	ctx := c.Request.Context()
+	staged, err := stageFile(bytes.NewReader(sanitized.Data), ArticleURLPrefix, ext)
+	var urlPath string
+	var duplicate bool
+	if err == nil {
+		urlPath, duplicate, err = staged.commit(ctx, h.store, h.blobs, contentType)
+	}
 	if err != nil {
+		log.Printf("Failed to save upload: %v", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: dto.ErrorDetail{
 				Code:    "SERVER_ERROR",
@@ -134,31 +156,36 @@ func (h *UploadHandler) UploadImage(c *gin.Context) {
 		})
 		return
 	}
-	defer dst.Close()
-
-	if _, err := io.Copy(dst, file); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error: dto.ErrorDetail{
-				Code:    "SERVER_ERROR",
-				Message: "Failed to write file",
-			},
-		})
-		return
-	}
+	filename := path.Base(urlPath)
 
 	// Build public URL
 	baseURL := os.Getenv("APP_BASE_URL")
 	if baseURL == "" {
 		baseURL = "http://localhost:8080"
 	}
-	url := fmt.Sprintf("%s%s/%s", baseURL, ArticleURLPrefix, filename)
+	url := baseURL + urlPath
 
 	log.Printf("Upload successful: %s", url)
 
+	// Failures are only logged: the original stays usable without renditions
+	var renditions []*models.ImageRendition
+	if duplicate {
+		renditions, _ = h.renditions.ListBySource(ctx, urlPath)
+	}
+	if len(renditions) == 0 {
+		if renditions, err = h.marks.Renditions(ctx, urlPath); err != nil {
+			log.Printf("Failed to render renditions for %s: %v", urlPath, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, dto.SuccessResponse{
 		Data: map[string]interface{}{
-			"url":      url,
-			"filename": filename,
+			"url":       url,
+			"filename":  filename,
+			"width":     sanitized.Width,
+			"height":    sanitized.Height,
+			"image":     buildResponsiveImage(url, renditions),
+			"duplicate": duplicate,
 		},
 	})
 }
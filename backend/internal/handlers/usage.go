@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"log"
+
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/usage"
+)
+
+// recordUsage replaces the files an article, page or banner refers to; nil
+// refs clear them. Failures are only logged: the gc-uploads command rebuilds
+// usage from the content.
+func recordUsage(ctx context.Context, repo repositories.FileReferenceRepository, ownerType string, ownerID int64, refs []*models.FileReference) {
+	if err := repo.Replace(ctx, ownerType, ownerID, refs); err != nil {
+		log.Printf("Failed to record files used by %s %d: %v", ownerType, ownerID, err)
+	}
+}
+
+// mediaUsage lists where the file of a media item is used, through its
+// original URL, thumbnail or any of its renditions
+func mediaUsage(ctx context.Context, refs repositories.FileReferenceRepository, renditions repositories.ImageRenditionRepository, media *models.MediaItem) ([]*models.FileReference, error) {
+	urls := []string{media.URL}
+	if media.ThumbnailURL != "" && media.ThumbnailURL != media.URL {
+		urls = append(urls, media.ThumbnailURL)
+	}
+	if media.MediaType == "image" {
+		sets, err := renditions.ListBySource(ctx, media.URL)
+		if err != nil {
+			return nil, err
+		}
+		for _, rendition := range sets {
+			if rendition.URL != media.URL {
+				urls = append(urls, rendition.URL)
+			}
+		}
+	}
+	return refs.ListByURLs(ctx, urls)
+}
+
+// articleImages lists the uploads whose watermark an article save may have
+// changed: every file of the article when it moved category, otherwise those
+// it started or stopped using. before is nil for a new article and after nil
+// for a deleted one.
+func articleImages(before, after *models.Article) []string {
+	files := make(map[string]int)
+	if before != nil {
+		for _, ref := range usage.Article(before) {
+			files[ref.URL]--
+		}
+	}
+	if after != nil {
+		for _, ref := range usage.Article(after) {
+			files[ref.URL]++
+		}
+	}
+	moved := before == nil || after == nil || before.CategoryID != after.CategoryID
+	var urls []string
+	for url, change := range files {
+		if moved || change != 0 {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
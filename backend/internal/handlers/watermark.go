@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/dto"
+	"github.com/thieugt95/portal-365/backend/internal/middleware"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/watermark"
+)
+
+// WatermarkHandler configures the watermark drawn over public renditions
+type WatermarkHandler struct {
+	repos *database.Repositories
+	marks *watermark.Service
+}
+
+func NewWatermarkHandler(repos *database.Repositories, marks *watermark.Service) *WatermarkHandler {
+	return &WatermarkHandler{repos: repos, marks: marks}
+}
+
+// Get godoc
+// @Summary Get watermark settings (Admin)
+// @Description Get the watermark settings and the progress of the latest re-render of watermarked renditions
+// @Tags Watermark
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} dto.SuccessResponse{data=dto.WatermarkResponse}
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/watermark [get]
+func (h *WatermarkHandler) Get(c *gin.Context) {
+	settings, err := h.marks.Settings(c.Request.Context())
+	if err != nil {
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch watermark settings")
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: dto.WatermarkResponse{Settings: settings, Job: h.marks.Status()}})
+}
+
+// Update godoc
+// @Summary Update watermark settings (Admin)
+// @Description Replace the watermark settings. The logo, an uploaded image, is drawn over the renditions of images in the selected categories (and their subcategories) and albums, including images used by articles in those categories; originals are never changed and media items marked no_watermark are skipped. Renditions already generated are redrawn in the background.
+// @Tags Watermark
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param watermark body dto.WatermarkRequest true "Watermark settings"
+// @Success 200 {object} dto.SuccessResponse{data=dto.WatermarkResponse}
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /admin/watermark [put]
+func (h *WatermarkHandler) Update(c *gin.Context) {
+	var req dto.WatermarkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	settings := &models.WatermarkSettings{
+		Enabled:     req.Enabled,
+		LogoURL:     req.LogoURL,
+		Position:    req.Position,
+		Opacity:     req.Opacity,
+		Scale:       req.Scale,
+		CategoryIDs: uniqueIDs(req.CategoryIDs),
+		AlbumIDs:    uniqueIDs(req.AlbumIDs),
+	}
+	for _, id := range settings.CategoryIDs {
+		if _, err := h.repos.Categories.GetByID(ctx, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				middleware.AbortWithError(c, http.StatusBadRequest, "CATEGORY_NOT_FOUND", fmt.Sprintf("Category %d not found", id))
+				return
+			}
+			middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch category")
+			return
+		}
+	}
+	for _, id := range settings.AlbumIDs {
+		if _, err := h.repos.Albums.GetByID(ctx, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				middleware.AbortWithError(c, http.StatusBadRequest, "ALBUM_NOT_FOUND", fmt.Sprintf("Album %d not found", id))
+				return
+			}
+			middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to fetch album")
+			return
+		}
+	}
+
+	if err := h.marks.Save(ctx, settings); err != nil {
+		if errors.Is(err, watermark.ErrInvalidLogo) {
+			middleware.AbortWithError(c, http.StatusBadRequest, "INVALID_LOGO", err.Error())
+			return
+		}
+		middleware.AbortWithError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to save watermark settings")
+		return
+	}
+	h.marks.Schedule()
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Data: dto.WatermarkResponse{Settings: settings, Job: h.marks.Status()}})
+}
+
+// Render godoc
+// @Summary Re-render watermarked renditions (Admin)
+// @Description Redraw, in the background, the renditions whose watermark is out of date, or all renditions with force=true. Poll GET /admin/watermark for progress.
+// @Tags Watermark
+// @Security BearerAuth
+// @Produce json
+// @Param force query bool false "Redraw every rendition set, not only out of date ones"
+// @Success 202 {object} dto.SuccessResponse{data=models.WatermarkJob}
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Router /admin/watermark/render [post]
+func (h *WatermarkHandler) Render(c *gin.Context) {
+	if err := h.marks.Start(c.Query("force") == "true"); err != nil {
+		middleware.AbortWithError(c, http.StatusConflict, "RENDER_RUNNING", "A re-render is already running")
+		return
+	}
+	c.JSON(http.StatusAccepted, dto.SuccessResponse{Data: h.marks.Status()})
+}
+
+// uniqueIDs drops repeated IDs, keeping the first of each
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool)
+	result := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
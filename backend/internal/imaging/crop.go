@@ -0,0 +1,223 @@
+package imaging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/config"
+	"github.com/thieugt95/portal-365/backend/internal/singleflight"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+)
+
+// CropURLPrefix is where resized and cropped images are served
+const CropURLPrefix = "/img/"
+
+// CropMaxPixels bounds the sources the cropper will decode
+const CropMaxPixels = 50_000_000
+
+// cropTouchInterval is how often a cache entry in use has its modification
+// time renewed, which is what Prune goes by
+const cropTouchInterval = 24 * time.Hour
+
+// cropFormats maps source extensions to the format crops are encoded in.
+// GIFs lose their animation and become PNG.
+var cropFormats = map[string]string{
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".jfif": "jpeg",
+	".png":  "png",
+	".webp": "webp",
+	".gif":  "png",
+}
+
+var cropExtensions = map[string]string{"jpeg": ".jpg", "png": ".png", "webp": ".webp"}
+
+var (
+	// ErrNotCroppable is returned for keys outside uploads/ or without an image extension
+	ErrNotCroppable = errors.New("not an uploaded image")
+	// ErrCropTooLarge is returned for sources with more than CropMaxPixels pixels
+	ErrCropTooLarge = errors.New("image is too large to resize")
+)
+
+// CropURL is the address of sourceURL resized to spec, a preset name or WxH.
+// A focal point is added as a query parameter the endpoint ignores, so moving
+// it gives the crop a new URL and cached copies are not reused.
+func CropURL(spec, sourceURL string, focus *FocalPoint) string {
+	source := SourceURL(sourceURL)
+	if source == "" {
+		return ""
+	}
+	u := CropURLPrefix + spec + "/" + strings.TrimPrefix(source, storage.URLPrefix)
+	if focus != nil {
+		u += "?focus=" + strconv.FormatFloat(focus.X, 'f', -1, 64) + "," + strconv.FormatFloat(focus.Y, 'f', -1, 64)
+	}
+	return u
+}
+
+// CropSource is a stored image crops are made from
+type CropSource struct {
+	Key    string
+	Format string // the format its crops are encoded in
+	Info   *storage.ObjectInfo
+}
+
+// Cropper resizes and crops stored images, keeping the results in a disk
+// cache. Concurrent requests for the same result render it once.
+type Cropper struct {
+	store    storage.Storage
+	cacheDir string
+	quality  int
+	flight   singleflight.Group
+}
+
+func NewCropper(cfg *config.Config, store storage.Storage) *Cropper {
+	quality := cfg.ImageJPEGQuality
+	if quality < 1 || quality > 100 {
+		quality = 82
+	}
+	return &Cropper{store: store, cacheDir: cfg.ImageCacheDir, quality: quality}
+}
+
+// Source looks up the upload at key
+func (c *Cropper) Source(ctx context.Context, key string) (*CropSource, error) {
+	format := cropFormats[strings.ToLower(path.Ext(key))]
+	if !strings.HasPrefix(key, "uploads/") || format == "" {
+		return nil, ErrNotCroppable
+	}
+	info, err := c.store.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &CropSource{Key: key, Format: format, Info: info}, nil
+}
+
+// Name identifies a crop by everything it depends on, so a replaced source, a
+// moved focal point or a changed watermark gets a new cache entry
+func (c *Cropper) Name(src *CropSource, size config.ImageSize, focus FocalPoint, wm *Watermark) string {
+	var watermark string
+	if wm != nil {
+		watermark = wm.Fingerprint
+	}
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s\n%s\n%d\n%d\n%s\n%d\n%.4f,%.4f\n%s",
+		src.Key, size, src.Info.Size, src.Info.ModTime.UnixNano(), src.Info.ETag, c.quality, focus.X, focus.Y, watermark)))
+	return hex.EncodeToString(hash[:])
+}
+
+// Crop returns the cache file holding src resized to size around focus with
+// wm drawn over it, rendering it on first use. A nil wm crops without one.
+func (c *Cropper) Crop(ctx context.Context, src *CropSource, size config.ImageSize, focus FocalPoint, wm *Watermark) (string, error) {
+	name := c.Name(src, size, focus, wm)
+	cached := filepath.Join(c.cacheDir, name[:2], name+cropExtensions[src.Format])
+	if stat, err := os.Stat(cached); err == nil {
+		if now := time.Now(); now.Sub(stat.ModTime()) > cropTouchInterval {
+			_ = os.Chtimes(cached, now, now)
+		}
+		return cached, nil
+	}
+
+	_, err, _ := c.flight.Do(name, func() (interface{}, error) {
+		// Waiters share the result, so one caller going away must not cancel it
+		return nil, c.render(context.WithoutCancel(ctx), src, size, focus, wm, cached)
+	})
+	return cached, err
+}
+
+// render resizes the source into the cache file, which appears atomically
+func (c *Cropper) render(ctx context.Context, src *CropSource, size config.ImageSize, focus FocalPoint, wm *Watermark, cached string) error {
+	if _, err := os.Stat(cached); err == nil {
+		return nil // finished by a call that ended just before this one started
+	}
+
+	obj, _, err := c.store.Get(ctx, src.Key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	cfg, _, err := image.DecodeConfig(obj)
+	if err != nil {
+		return err
+	}
+	if cfg.Width*cfg.Height > CropMaxPixels {
+		return ErrCropTooLarge
+	}
+	if _, err := obj.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	img, _, err := image.Decode(obj)
+	if err != nil {
+		return err
+	}
+
+	out := ResizeAround(img, size, focus)
+	if wm != nil {
+		out = wm.Apply(out)
+	}
+	data, err := Encode(out, src.Format, c.quality)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cached), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cached), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), cached)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Prune removes the cache entries not used since before, including those of
+// replaced sources, moved focal points and changed preset sizes, which are
+// never asked for again. Entries still in use are rendered again on demand.
+// With dryRun it only counts them. It returns the number of files and bytes.
+func (c *Cropper) Prune(before time.Time, dryRun bool) (int, int64, error) {
+	var files int
+	var size int64
+	err := filepath.WalkDir(c.cacheDir, func(path string, entry os.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil || !info.ModTime().Before(before) {
+			return err
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		files++
+		size += info.Size()
+		return nil
+	})
+	return files, size, err
+}
@@ -0,0 +1,87 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/thieugt95/portal-365/backend/internal/config"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+)
+
+func TestCropWatermark(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewFilesystem(t.TempDir())
+	cropper := NewCropper(&config.Config{ImageCacheDir: t.TempDir()}, store)
+
+	encode := func(img image.Image) []byte {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	white := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	for i := range white.Pix {
+		white.Pix[i] = 0xFF
+	}
+	black := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := 3; i < len(black.Pix); i += 4 {
+		black.Pix[i] = 0xFF
+	}
+
+	const key = "uploads/media/2026/10/white.png"
+	data := encode(white)
+	if err := store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	src, err := cropper.Source(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logo, err := NewWatermark(encode(black), WatermarkCenter, 1, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := config.ImageSize{Width: 20, Height: 20}
+	if cropper.Name(src, size, Center, nil) == cropper.Name(src, size, Center, logo) {
+		t.Fatal("clean and watermarked crops share a cache entry")
+	}
+
+	tests := []struct {
+		name string
+		wm   *Watermark
+		want color.NRGBA // centre pixel
+	}{
+		{"clean", nil, color.NRGBA{0xFF, 0xFF, 0xFF, 0xFF}},
+		{"watermarked", logo, color.NRGBA{0, 0, 0, 0xFF}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cached, err := cropper.Crop(ctx, src, size, Center, tt.wm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file, err := os.Open(cached)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			img, err := png.Decode(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := img.Bounds(); b.Dx() != 20 || b.Dy() != 20 {
+				t.Fatalf("crop is %dx%d, want 20x20", b.Dx(), b.Dy())
+			}
+			if got := color.NRGBAModel.Convert(img.At(10, 10)); got != tt.want {
+				t.Errorf("centre pixel = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+// EXIF tags read from uploads. Everything else, GPS included, is discarded.
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+)
+
+const exifDateLayout = "2006:01:02 15:04:05"
+
+// exifInfo holds the few EXIF fields worth keeping
+type exifInfo struct {
+	Orientation int
+	TakenAt     *time.Time
+	Camera      string
+}
+
+// exifPayload finds the raw TIFF-structured EXIF block of a JPEG, PNG or WebP
+// file. It returns nil when the file has none.
+func exifPayload(format string, data []byte) []byte {
+	var payload []byte
+	switch format {
+	case "jpeg":
+		payload = jpegEXIF(data)
+	case "png":
+		payload = pngChunk(data, "eXIf")
+	case "webp":
+		payload = riffChunk(data, "EXIF")
+	}
+	// Some writers keep the JPEG APP1 signature in PNG and WebP chunks too
+	return bytes.TrimPrefix(payload, []byte("Exif\x00\x00"))
+}
+
+// HasMetadata reports whether a JPEG, PNG, WebP or GIF file carries EXIF, XMP,
+// text or comment metadata that Sanitize would remove
+func HasMetadata(format string, data []byte) bool {
+	switch format {
+	case "jpeg":
+		return jpegSegment(data, 0xE1, "Exif\x00\x00") != nil ||
+			jpegSegment(data, 0xE1, "http://ns.adobe.com/xap/1.0/\x00") != nil ||
+			jpegSegment(data, 0xED, "Photoshop 3.0\x00") != nil
+	case "png":
+		return pngChunk(data, "eXIf") != nil || pngChunk(data, "iTXt") != nil ||
+			pngChunk(data, "tEXt") != nil || pngChunk(data, "zTXt") != nil
+	case "webp":
+		return riffChunk(data, "EXIF") != nil || riffChunk(data, "XMP ") != nil
+	case "gif":
+		found := false
+		walkGIF(data, func(_ []byte, metadata bool) { found = found || metadata })
+		return found
+	}
+	return false
+}
+
+func jpegEXIF(data []byte) []byte {
+	return jpegSegment(data, 0xE1, "Exif\x00\x00")
+}
+
+// jpegSegment returns the first APPn segment with the given marker whose
+// payload starts with prefix
+func jpegSegment(data []byte, want byte, prefix string) []byte {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 || marker == 0xFF {
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			return nil // image data starts, no more metadata segments
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil
+		}
+		segment := data[i+4 : end]
+		if marker == want && bytes.HasPrefix(segment, []byte(prefix)) {
+			return segment
+		}
+		i = end
+	}
+	return nil
+}
+
+func pngChunk(data []byte, chunkType string) []byte {
+	for i := 8; i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil
+		}
+		if string(data[i+4:i+8]) == chunkType {
+			return data[i+8 : i+8+length]
+		}
+		i = end
+	}
+	return nil
+}
+
+func riffChunk(data []byte, fourCC string) []byte {
+	for i := 12; i+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size
+		if size < 0 || end > len(data) {
+			return nil
+		}
+		if string(data[i:i+4]) == fourCC {
+			return data[i+8 : end]
+		}
+		i = end + size%2
+	}
+	return nil
+}
+
+// parseEXIF reads orientation, capture date and camera from a TIFF-structured
+// EXIF block. Malformed blocks yield whatever could be read before the damage.
+func parseEXIF(payload []byte) exifInfo {
+	info := exifInfo{Orientation: 1}
+	if len(payload) < 8 {
+		return info
+	}
+
+	var order binary.ByteOrder
+	switch string(payload[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return info
+	}
+	t := tiffReader{data: payload, order: order}
+	if order.Uint16(payload[2:]) != 42 {
+		return info
+	}
+
+	ifd0 := t.readIFD(order.Uint32(payload[4:]))
+	if v, ok := ifd0[tagOrientation]; ok {
+		if o := int(t.uint(v)); o >= 1 && o <= 8 {
+			info.Orientation = o
+		}
+	}
+
+	maker, model := t.ascii(ifd0[tagMake]), t.ascii(ifd0[tagModel])
+	if maker != "" && !strings.HasPrefix(strings.ToLower(model), strings.ToLower(maker)) {
+		info.Camera = strings.TrimSpace(maker + " " + model)
+	} else {
+		info.Camera = model
+	}
+
+	taken := ""
+	if v, ok := ifd0[tagExifIFD]; ok {
+		taken = t.ascii(t.readIFD(t.uint(v))[tagDateTimeOriginal])
+	}
+	if taken == "" {
+		taken = t.ascii(ifd0[tagDateTime])
+	}
+	if ts, err := time.ParseInLocation(exifDateLayout, taken, time.Local); err == nil {
+		info.TakenAt = &ts
+	}
+	return info
+}
+
+// tiffEntry is one IFD entry with its value bytes resolved
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+var tiffTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+func (t tiffReader) readIFD(offset uint32) map[uint16]tiffEntry {
+	entries := make(map[uint16]tiffEntry)
+	if offset < 8 || uint64(offset)+2 > uint64(len(t.data)) {
+		return entries
+	}
+	count := uint32(t.order.Uint16(t.data[offset:]))
+	for n := uint32(0); n < count; n++ {
+		pos := uint64(offset) + 2 + uint64(n)*12
+		if pos+12 > uint64(len(t.data)) {
+			break
+		}
+		raw := t.data[pos : pos+12]
+		entry := tiffEntry{typ: t.order.Uint16(raw[2:]), count: t.order.Uint32(raw[4:])}
+		size, ok := tiffTypeSizes[entry.typ]
+		if !ok {
+			continue
+		}
+		length := uint64(size) * uint64(entry.count)
+		if length <= 4 {
+			entry.value = raw[8 : 8+length]
+		} else {
+			start := uint64(t.order.Uint32(raw[8:]))
+			if start+length > uint64(len(t.data)) {
+				continue
+			}
+			entry.value = t.data[start : start+length]
+		}
+		entries[t.order.Uint16(raw)] = entry
+	}
+	return entries
+}
+
+func (t tiffReader) uint(e tiffEntry) uint32 {
+	switch {
+	case e.typ == 3 && len(e.value) >= 2:
+		return uint32(t.order.Uint16(e.value))
+	case e.typ == 4 && len(e.value) >= 4:
+		return t.order.Uint32(e.value)
+	}
+	return 0
+}
+
+func (t tiffReader) ascii(e tiffEntry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	value := string(e.value)
+	if i := strings.IndexByte(value, 0); i >= 0 {
+		value = value[:i]
+	}
+	return strings.TrimSpace(value)
+}
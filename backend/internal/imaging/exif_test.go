@@ -0,0 +1,163 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// tiffField is an IFD entry of a test EXIF block
+type tiffField struct {
+	tag   uint16
+	typ   uint16 // 2 ASCII, 3 SHORT, 4 LONG
+	value interface{}
+}
+
+// tiffBlock lays out a TIFF-structured EXIF block with IFD0 and, when exif
+// is given, an EXIF sub-IFD that IFD0 points at
+func tiffBlock(order binary.ByteOrder, ifd0, exif []tiffField) []byte {
+	data := make([]byte, 8)
+	if order == binary.LittleEndian {
+		copy(data, "II")
+	} else {
+		copy(data, "MM")
+	}
+	order.PutUint16(data[2:], 42)
+	order.PutUint32(data[4:], 8)
+
+	// IFD0, then the sub-IFD, then values that don't fit in an entry
+	if exif != nil {
+		ifd0 = append(ifd0, tiffField{tagExifIFD, 4, uint32(0)})
+	}
+	ifd0Size := 2 + 12*len(ifd0) + 4
+	exifOffset := 8 + ifd0Size
+	valueOffset := exifOffset
+	if exif != nil {
+		valueOffset += 2 + 12*len(exif) + 4
+	}
+	var values []byte
+	writeIFD := func(fields []tiffField) []byte {
+		ifd := make([]byte, 2)
+		order.PutUint16(ifd, uint16(len(fields)))
+		for _, f := range fields {
+			entry := make([]byte, 12)
+			order.PutUint16(entry, f.tag)
+			order.PutUint16(entry[2:], f.typ)
+			switch v := f.value.(type) {
+			case string:
+				raw := append([]byte(v), 0)
+				order.PutUint32(entry[4:], uint32(len(raw)))
+				if len(raw) <= 4 {
+					copy(entry[8:], raw)
+				} else {
+					order.PutUint32(entry[8:], uint32(valueOffset+len(values)))
+					values = append(values, raw...)
+				}
+			case uint16:
+				order.PutUint32(entry[4:], 1)
+				order.PutUint16(entry[8:], v)
+			case uint32:
+				order.PutUint32(entry[4:], 1)
+				if f.tag == tagExifIFD {
+					v = uint32(exifOffset)
+				}
+				order.PutUint32(entry[8:], v)
+			}
+			ifd = append(ifd, entry...)
+		}
+		return append(ifd, 0, 0, 0, 0)
+	}
+	data = append(data, writeIFD(ifd0)...)
+	if exif != nil {
+		data = append(data, writeIFD(exif)...)
+	}
+	return append(data, values...)
+}
+
+func TestParseEXIF(t *testing.T) {
+	taken := time.Date(2024, 5, 17, 9, 30, 0, 0, time.Local)
+	modified := time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)
+
+	full := tiffBlock(binary.LittleEndian, []tiffField{
+		{tagMake, 2, "NIKON CORPORATION"},
+		{tagModel, 2, "NIKON Z 6"},
+		{tagOrientation, 3, uint16(6)},
+		{tagDateTime, 2, "2024:06:01 12:00:00"},
+	}, []tiffField{{tagDateTimeOriginal, 2, "2024:05:17 09:30:00"}})
+
+	tests := []struct {
+		name    string
+		payload []byte
+		want    exifInfo
+	}{
+		{"little endian with sub-IFD", full, exifInfo{Orientation: 6, TakenAt: &taken, Camera: "NIKON CORPORATION NIKON Z 6"}},
+		{"big endian, model names the maker", tiffBlock(binary.BigEndian, []tiffField{
+			{tagMake, 2, "Canon"},
+			{tagModel, 2, "Canon EOS R5"},
+			{tagOrientation, 3, uint16(8)},
+		}, nil), exifInfo{Orientation: 8, Camera: "Canon EOS R5"}},
+		{"modification date as fallback", tiffBlock(binary.BigEndian, []tiffField{
+			{tagDateTime, 2, "2024:06:01 12:00:00"},
+		}, nil), exifInfo{Orientation: 1, TakenAt: &modified}},
+		{"orientation as long", tiffBlock(binary.LittleEndian, []tiffField{{tagOrientation, 4, uint32(3)}}, nil), exifInfo{Orientation: 3}},
+		{"orientation out of range", tiffBlock(binary.LittleEndian, []tiffField{{tagOrientation, 3, uint16(9)}}, nil), exifInfo{Orientation: 1}},
+		{"invalid date", tiffBlock(binary.LittleEndian, []tiffField{{tagDateTime, 2, "0000:00:00 00:00:00"}}, nil), exifInfo{Orientation: 1}},
+		{"truncated after IFD0", full[:8+2+12*5], exifInfo{Orientation: 6, Camera: ""}},
+		{"IFD past the end", []byte("II\x2a\x00\xff\x00\x00\x00"), exifInfo{Orientation: 1}},
+		{"bad byte order", []byte("XX\x2a\x00\x08\x00\x00\x00\x00\x00"), exifInfo{Orientation: 1}},
+		{"bad magic", []byte("II\x2b\x00\x08\x00\x00\x00\x00\x00"), exifInfo{Orientation: 1}},
+		{"too short", []byte("II\x2a"), exifInfo{Orientation: 1}},
+		{"empty", nil, exifInfo{Orientation: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseEXIF(tt.payload)
+			if got.Orientation != tt.want.Orientation || got.Camera != tt.want.Camera {
+				t.Errorf("orientation, camera = %d, %q, want %d, %q", got.Orientation, got.Camera, tt.want.Orientation, tt.want.Camera)
+			}
+			switch {
+			case (got.TakenAt == nil) != (tt.want.TakenAt == nil):
+				t.Errorf("taken at = %v, want %v", got.TakenAt, tt.want.TakenAt)
+			case got.TakenAt != nil && !got.TakenAt.Equal(*tt.want.TakenAt):
+				t.Errorf("taken at = %v, want %v", *got.TakenAt, *tt.want.TakenAt)
+			}
+		})
+	}
+}
+
+func TestJPEGEXIF(t *testing.T) {
+	app1 := func(payload string) []byte {
+		return append([]byte{0xFF, 0xE1, 0, byte(len(payload) + 2)}, payload...)
+	}
+	soi := []byte{0xFF, 0xD8}
+	sos := []byte{0xFF, 0xDA, 0x00, 0x02}
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"exif", concat(soi, app1("Exif\x00\x00II*\x00"), sos), "Exif\x00\x00II*\x00"},
+		{"after other segments", concat(soi, []byte{0xFF, 0xE0, 0x00, 0x04, 'J', 'F'}, app1("Exif\x00\x00MM"), sos), "Exif\x00\x00MM"},
+		{"other APP1 only", concat(soi, app1("http://ns.adobe.com/xap/1.0/\x00<x/>"), sos), ""},
+		{"after image data", concat(soi, sos, app1("Exif\x00\x00II")), ""},
+		{"length past the end", concat(soi, []byte{0xFF, 0xE1, 0x10, 0x00}, []byte("Exif\x00\x00")), ""},
+		{"length below minimum", concat(soi, []byte{0xFF, 0xE1, 0x00, 0x01}, []byte("Exif\x00\x00")), ""},
+		{"not a marker", concat(soi, []byte("garbage!")), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(jpegEXIF(tt.data)); got != tt.want {
+				t.Errorf("segment = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
@@ -0,0 +1,248 @@
+// Package imaging generates the scaled renditions served in place of uploaded originals.
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // registered so GIFs are recognised and skipped
+	"math"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the WebP decoder
+
+	"github.com/thieugt95/portal-365/backend/internal/config"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+)
+
+const (
+	// RenditionURLPrefix is the URL directory renditions are written under
+	RenditionURLPrefix = "/static/uploads/renditions"
+
+	uploadsURLPrefix = "/static/uploads/"
+)
+
+// ErrNotLocal is returned for images that are not uploads kept in storage
+var ErrNotLocal = errors.New("image is not a local upload")
+
+// Rendition describes one file of a rendition set. The set always starts with
+// the original so srcset lists can include it.
+type Rendition struct {
+	Name      string
+	Format    string // jpeg, png, webp, gif
+	URL       string
+	Width     int
+	Height    int
+	Size      int64
+	Watermark string // fingerprint of the watermark the set was drawn with
+}
+
+// Renderer scales uploaded images into the configured renditions
+type Renderer struct {
+	store   storage.Storage
+	specs   []config.ImageRendition
+	webp    bool
+	quality int
+}
+
+func NewRenderer(cfg *config.Config, store storage.Storage) *Renderer {
+	specs := append([]config.ImageRendition{}, cfg.ImageRenditions...)
+	// Largest first so each rendition is scaled from the previous one
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Width > specs[j].Width })
+
+	quality := cfg.ImageJPEGQuality
+	if quality < 1 || quality > 100 {
+		quality = 82
+	}
+
+	return &Renderer{store: store, specs: specs, webp: cfg.ImageWebP, quality: quality}
+}
+
+// SourceURL reduces an image URL to the /static/uploads/ path it is stored
+// under, dropping the scheme and host of absolute URLs. It returns "" for
+// images hosted elsewhere.
+func SourceURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || !strings.HasPrefix(u.Path, uploadsURLPrefix) || strings.Contains(u.Path, "..") {
+		return ""
+	}
+	return u.Path
+}
+
+// renditionDir returns the URL directory holding the renditions of a source,
+// e.g. /static/uploads/images/2025/01/abc.jpg -> /static/uploads/renditions/images/2025/01/abc
+func renditionDir(sourceURL string) string {
+	rel := strings.TrimPrefix(sourceURL, uploadsURLPrefix)
+	return RenditionURLPrefix + "/" + strings.TrimSuffix(rel, filepath.Ext(rel))
+}
+
+// Render decodes the upload behind sourceURL and writes its renditions next to
+// the other rendition sets, replacing any previous ones. Animated formats
+// (GIF) are served as uploaded and only get the original entry.
+func (r *Renderer) Render(ctx context.Context, sourceURL string) ([]Rendition, error) {
+	return r.RenderWatermarked(ctx, sourceURL, nil)
+}
+
+// RenderWatermarked renders like Render and draws wm over every scaled
+// rendition. The original is never touched. A nil wm renders without one.
+func (r *Renderer) RenderWatermarked(ctx context.Context, sourceURL string, wm *Watermark) ([]Rendition, error) {
+	sourceURL = SourceURL(sourceURL)
+	if sourceURL == "" {
+		return nil, ErrNotLocal
+	}
+
+	file, info, err := r.store.Get(ctx, storage.Key(sourceURL))
+	if err != nil {
+		return nil, err
+	}
+	img, format, err := image.Decode(file)
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", sourceURL, err)
+	}
+
+	bounds := img.Bounds()
+	renditions := []Rendition{{
+		Name:   "original",
+		Format: format,
+		URL:    sourceURL,
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Size:   info.Size,
+	}}
+	if wm != nil {
+		renditions[0].Watermark = wm.Fingerprint
+	}
+	if format == "gif" {
+		return renditions, nil
+	}
+
+	dirURL := renditionDir(sourceURL)
+	if err := RemoveRenditions(ctx, r.store, sourceURL); err != nil {
+		return nil, err
+	}
+
+	// Keep transparency in PNG, everything opaque becomes JPEG
+	fallback := "jpeg"
+	if o, ok := img.(interface{ Opaque() bool }); ok && !o.Opaque() {
+		fallback = "png"
+	}
+
+	current := img
+	for _, spec := range r.specs {
+		if spec.Width >= bounds.Dx() {
+			continue // never upscale
+		}
+		height := int(math.Round(float64(spec.Width) * float64(bounds.Dy()) / float64(bounds.Dx())))
+		if height < 1 {
+			height = 1
+		}
+		current = scale(current, spec.Width, height)
+
+		// Smaller renditions are scaled from the clean copy, not the watermarked one
+		out := current
+		if wm != nil {
+			out = wm.Apply(current)
+		}
+		encoded, err := r.encode(out, fallback)
+		if err != nil {
+			return nil, err
+		}
+		rendition, err := r.writeRendition(ctx, dirURL, spec.Name, fallback, encoded, spec.Width, height)
+		if err != nil {
+			return nil, err
+		}
+		rendition.Watermark = renditions[0].Watermark
+		renditions = append(renditions, rendition)
+
+		if !r.webp {
+			continue
+		}
+		// The encoder is lossless, which only pays off for graphics and flat
+		// images; photos usually come out larger than the JPEG and are skipped
+		encoded, err = r.encode(out, "webp")
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(encoded)) >= rendition.Size {
+			continue
+		}
+		rendition, err = r.writeRendition(ctx, dirURL, spec.Name, "webp", encoded, spec.Width, height)
+		if err != nil {
+			return nil, err
+		}
+		rendition.Watermark = renditions[0].Watermark
+		renditions = append(renditions, rendition)
+	}
+
+	sort.SliceStable(renditions[1:], func(i, j int) bool {
+		return renditions[1+i].Width < renditions[1+j].Width
+	})
+	return renditions, nil
+}
+
+// RemoveRenditions deletes the rendition files of a source
+func RemoveRenditions(ctx context.Context, store storage.Storage, sourceURL string) error {
+	if sourceURL = SourceURL(sourceURL); sourceURL == "" {
+		return ErrNotLocal
+	}
+	var keys []string
+	err := store.List(ctx, storage.Key(renditionDir(sourceURL))+"/", func(obj *storage.ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scale(src image.Image, width, height int) image.Image {
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+	return dst
+}
+
+func (r *Renderer) encode(img image.Image, format string) ([]byte, error) {
+	return Encode(img, format, r.quality)
+}
+
+func (r *Renderer) writeRendition(ctx context.Context, dirURL, name, format string, data []byte, width, height int) (Rendition, error) {
+	ext := map[string]string{"jpeg": ".jpg", "png": ".png", "webp": ".webp"}[format]
+	fileURL := dirURL + "/" + name + ext
+	mimeType := map[string]string{"jpeg": "image/jpeg", "png": "image/png", "webp": "image/webp"}[format]
+	if err := r.store.Put(ctx, storage.Key(fileURL), bytes.NewReader(data), int64(len(data)), mimeType); err != nil {
+		return Rendition{}, err
+	}
+	return Rendition{Name: name, Format: format, URL: fileURL, Width: width, Height: height, Size: int64(len(data))}, nil
+}
+
+// Models converts a rendition set into database rows
+func Models(sourceURL string, renditions []Rendition) []*models.ImageRendition {
+	rows := make([]*models.ImageRendition, len(renditions))
+	for i, r := range renditions {
+		rows[i] = &models.ImageRendition{
+			SourceURL: SourceURL(sourceURL),
+			Name:      r.Name,
+			Format:    r.Format,
+			URL:       r.URL,
+			Width:     r.Width,
+			Height:    r.Height,
+			FileSize:  r.Size,
+			Watermark: r.Watermark,
+		}
+	}
+	return rows
+}
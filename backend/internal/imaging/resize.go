@@ -0,0 +1,93 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+
+	"github.com/thieugt95/portal-365/backend/internal/config"
+)
+
+// FocalPoint is the part of an image that must stay in view when it is
+// cropped, as fractions of its width and height from the top left corner
+type FocalPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Center is the focal point of images nobody has set one on
+var Center = FocalPoint{X: 0.5, Y: 0.5}
+
+// Resize scales img to size. With both sides set the image is cropped around
+// its centre to the target aspect ratio first; a zero side follows the aspect
+// ratio of img. Images are never scaled up: a size larger than the (cropped)
+// source is reduced to fit it.
+func Resize(img image.Image, size config.ImageSize) image.Image {
+	return ResizeAround(img, size, Center)
+}
+
+// ResizeAround is Resize with the crop placed as close to centring focus as
+// the image edges allow
+func ResizeAround(img image.Image, size config.ImageSize, focus FocalPoint) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	width, height := size.Width, size.Height
+	switch {
+	case width == 0:
+		width = int(math.Round(float64(height) * float64(srcW) / float64(srcH)))
+	case height == 0:
+		height = int(math.Round(float64(width) * float64(srcH) / float64(srcW)))
+	}
+	width, height = max(width, 1), max(height, 1)
+
+	crop := bounds
+	if float64(srcW)*float64(height) > float64(srcH)*float64(width) {
+		cropW := int(math.Round(float64(srcH) * float64(width) / float64(height)))
+		crop.Min.X += cropOffset(srcW, cropW, focus.X)
+		crop.Max.X = crop.Min.X + cropW
+	} else {
+		cropH := int(math.Round(float64(srcW) * float64(height) / float64(width)))
+		crop.Min.Y += cropOffset(srcH, cropH, focus.Y)
+		crop.Max.Y = crop.Min.Y + cropH
+	}
+
+	if width > crop.Dx() {
+		height = max(int(math.Round(float64(height)*float64(crop.Dx())/float64(width))), 1)
+		width = crop.Dx()
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+	return dst
+}
+
+// cropOffset places a window of length window along a side of length total so
+// that the fraction focus of the side is centred, clamped to the edges
+func cropOffset(total, window int, focus float64) int {
+	offset := int(math.Round(focus*float64(total) - float64(window)/2))
+	return min(max(offset, 0), total-window)
+}
+
+// Encode writes img as jpeg, png or webp. WebP output is lossless.
+func Encode(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case "png":
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(&buf, img)
+	case "webp":
+		err = nativewebp.Encode(&buf, img, nil)
+	default:
+		err = fmt.Errorf("unsupported image format %q", format)
+	}
+	return buf.Bytes(), err
+}
@@ -0,0 +1,25 @@
+package imaging
+
+import "testing"
+
+func TestCropOffset(t *testing.T) {
+	tests := []struct {
+		name          string
+		total, window int
+		focus         float64
+		want          int
+	}{
+		{"centred", 100, 40, 0.5, 30},
+		{"towards the start", 100, 40, 0.3, 10},
+		{"clamped to the start", 100, 40, 0, 0},
+		{"clamped to the end", 100, 40, 1, 60},
+		{"window fills the side", 100, 100, 0.8, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cropOffset(tt.total, tt.window, tt.focus); got != tt.want {
+				t.Errorf("cropOffset = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
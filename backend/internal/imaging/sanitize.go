@@ -0,0 +1,318 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"time"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// MaxPixels bounds the decoded size of an upload (about 400MB as RGBA)
+	MaxPixels = 100 * 1000 * 1000
+	// OriginalJPEGQuality is used when re-encoding uploaded JPEGs
+	OriginalJPEGQuality = 90
+)
+
+// ErrTooLarge is returned for images whose pixel count exceeds MaxPixels
+var ErrTooLarge = errors.New("image dimensions are too large")
+
+// Metadata describes an uploaded image as displayed, i.e. after its EXIF
+// orientation has been applied
+type Metadata struct {
+	Format  string
+	Width   int
+	Height  int
+	TakenAt *time.Time
+	Camera  string
+}
+
+// Sanitized is an upload re-encoded without EXIF, XMP or GPS metadata
+type Sanitized struct {
+	Data []byte
+	Metadata
+}
+
+// inspect reads the dimensions and EXIF of an image without decoding its pixels
+func inspect(data []byte) (Metadata, int, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Metadata{}, 0, fmt.Errorf("decode image: %w", err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return Metadata{}, 0, ErrTooLarge
+	}
+
+	exif := parseEXIF(exifPayload(format, data))
+	meta := Metadata{Format: format, Width: cfg.Width, Height: cfg.Height, TakenAt: exif.TakenAt, Camera: exif.Camera}
+	if exif.Orientation >= 5 {
+		meta.Width, meta.Height = cfg.Height, cfg.Width
+	}
+	return meta, exif.Orientation, nil
+}
+
+// Inspect returns the upright dimensions and capture info of an image
+func Inspect(data []byte) (Metadata, error) {
+	meta, _, err := inspect(data)
+	return meta, err
+}
+
+// Decode decodes an uploaded image and rotates it upright according to its
+// EXIF orientation
+func Decode(data []byte) (image.Image, Metadata, error) {
+	meta, orientation, err := inspect(data)
+	if err != nil {
+		return nil, meta, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, meta, fmt.Errorf("decode image: %w", err)
+	}
+	return orient(img, orientation), meta, nil
+}
+
+// Sanitize rewrites an uploaded image upright and without metadata, in its
+// original format. GIFs carry no EXIF; they only lose their comment and
+// application extensions, since re-encoding would drop their animation.
+// Upright WebPs only lose their metadata chunks so lossy files are not
+// re-encoded losslessly.
+func Sanitize(data []byte) (*Sanitized, error) {
+	meta, orientation, err := inspect(data)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case meta.Format == "gif":
+		stripped, err := stripGIFMetadata(data)
+		if err != nil {
+			return nil, err
+		}
+		return &Sanitized{Data: stripped, Metadata: meta}, nil
+	case meta.Format == "webp" && orientation == 1:
+		stripped, err := stripWebPMetadata(data)
+		if err != nil {
+			return nil, err
+		}
+		return &Sanitized{Data: stripped, Metadata: meta}, nil
+	}
+
+	img, meta, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch meta.Format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: OriginalJPEGQuality})
+	case "png":
+		err = png.Encode(&buf, img)
+	case "webp":
+		err = nativewebp.Encode(&buf, img, nil)
+	default:
+		err = fmt.Errorf("unsupported image format %q", meta.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Sanitized{Data: buf.Bytes(), Metadata: meta}, nil
+}
+
+// orient applies an EXIF orientation (1-8) so the image displays upright
+func orient(src image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	in := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(in, in.Bounds(), src, b.Min, draw.Src)
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: // upside down, mirrored
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			copy(out.Pix[out.PixOffset(dx, dy):out.PixOffset(dx, dy)+4], in.Pix[in.PixOffset(x, y):in.PixOffset(x, y)+4])
+		}
+	}
+	return out
+}
+
+// stripWebPMetadata drops the EXIF and XMP chunks of a WebP file and clears
+// their flags in the extended header, leaving the image data untouched
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("invalid WebP container")
+	}
+
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errors.New("truncated WebP chunk")
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2
+		if size < 0 || i+8+size > len(data) {
+			return nil, errors.New("truncated WebP chunk")
+		}
+		if end > len(data) {
+			end = len(data)
+		}
+
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte{}, data[i:end]...)
+			if size > 0 {
+				chunk[8] &^= 0x08 | 0x04 // EXIF and XMP present flags
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
+
+// GIF block introducers and extension labels
+const (
+	gifExtension   = 0x21
+	gifImage       = 0x2C
+	gifTrailer     = 0x3B
+	gifComment     = 0xFE
+	gifApplication = 0xFF
+)
+
+// gifLoopExtensions are the application extensions that only set how often
+// an animation loops; any other, XMP included, is metadata
+var gifLoopExtensions = map[string]bool{"NETSCAPE2.0": true, "ANIMEXTS1.0": true}
+
+// walkGIF calls visit with each block of a GIF file in order, from the
+// header to the trailer, and whether the block is a comment or application
+// extension other than the loop count. Bytes after the trailer are left out.
+func walkGIF(data []byte, visit func(block []byte, metadata bool)) error {
+	truncated := errors.New("truncated GIF")
+	if len(data) < 13 || !bytes.HasPrefix(data, []byte("GIF8")) {
+		return errors.New("invalid GIF header")
+	}
+
+	// colorTable is the length of the color table a packed field announces
+	colorTable := func(packed byte) int {
+		if packed&0x80 == 0 {
+			return 0
+		}
+		return 3 << (packed&0x07 + 1)
+	}
+	// subBlocks returns the end of the data sub-blocks starting at i
+	subBlocks := func(i int) (int, error) {
+		for {
+			if i >= len(data) {
+				return 0, truncated
+			}
+			size := int(data[i])
+			i++
+			if size == 0 {
+				return i, nil
+			}
+			i += size
+		}
+	}
+
+	i := 13 + colorTable(data[10])
+	if i > len(data) {
+		return truncated
+	}
+	visit(data[:i], false)
+	for {
+		if i >= len(data) {
+			return truncated
+		}
+		start := i
+		switch data[i] {
+		case gifTrailer:
+			visit(data[i:i+1], false)
+			return nil
+		case gifExtension:
+			if i+2 > len(data) {
+				return truncated
+			}
+			label := data[i+1]
+			end, err := subBlocks(i + 2)
+			if err != nil {
+				return err
+			}
+			metadata := label == gifComment
+			if label == gifApplication {
+				// The first sub-block holds the identifier and auth code
+				identifier := ""
+				if data[i+2] >= 11 {
+					identifier = string(data[i+3 : i+14])
+				}
+				metadata = !gifLoopExtensions[identifier]
+			}
+			visit(data[start:end], metadata)
+			i = end
+		case gifImage:
+			if i+11 > len(data) {
+				return truncated
+			}
+			// Descriptor, local color table and LZW minimum code size
+			i += 10 + colorTable(data[i+9]) + 1
+			end, err := subBlocks(i)
+			if err != nil {
+				return err
+			}
+			visit(data[start:end], false)
+			i = end
+		default:
+			return fmt.Errorf("unknown GIF block 0x%02X", data[i])
+		}
+	}
+}
+
+// stripGIFMetadata drops the comment and application extensions of a GIF
+// file, except the loop count, leaving the frames untouched
+func stripGIFMetadata(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	err := walkGIF(data, func(block []byte, metadata bool) {
+		if !metadata {
+			out = append(out, block...)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
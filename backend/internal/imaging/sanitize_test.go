@@ -0,0 +1,327 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testImage is a w×h image with a distinct colour in each pixel
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 40), G: uint8(y * 40), B: 200, A: 255})
+		}
+	}
+	return img
+}
+
+// jpegWithEXIF encodes a w×h JPEG carrying the EXIF block in an APP1 segment
+func jpegWithEXIF(t *testing.T, w, h int, exif []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(w, h), nil); err != nil {
+		t.Fatal(err)
+	}
+	payload := append([]byte("Exif\x00\x00"), exif...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return concat(buf.Bytes()[:2], segment, payload, buf.Bytes()[2:])
+}
+
+// pngWithChunk encodes a w×h PNG with an extra ancillary chunk after IHDR
+func pngWithChunk(t *testing.T, w, h int, chunkType string, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(w, h)); err != nil {
+		t.Fatal(err)
+	}
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(content)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, content...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	const ihdrEnd = 8 + 25
+	return concat(buf.Bytes()[:ihdrEnd], chunk, buf.Bytes()[ihdrEnd:])
+}
+
+// webpFile wraps chunks in a RIFF WEBP container. Chunk payloads of odd size
+// are padded.
+func webpFile(chunks ...[]byte) []byte {
+	var body []byte
+	for _, chunk := range chunks {
+		body = append(body, chunk...)
+		if len(chunk)%2 == 1 {
+			body = append(body, 0)
+		}
+	}
+	out := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)+4))...)
+	return concat(out, []byte("WEBP"), body)
+}
+
+func webpChunk(fourCC string, payload []byte) []byte {
+	return concat([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(payload))), payload)
+}
+
+// gifWithExtensions encodes a looping two-frame w×h GIF with the extension
+// blocks inserted before its frames, and returns the GIF without them too
+func gifWithExtensions(t *testing.T, w, h int, extensions ...[]byte) (withExtensions, plain []byte) {
+	t.Helper()
+	palette := color.Palette{color.Black, color.White}
+	frame := image.NewPaletted(image.Rect(0, 0, w, h), palette)
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}}); err != nil {
+		t.Fatal(err)
+	}
+	plain = buf.Bytes()
+	header := 13
+	if plain[10]&0x80 != 0 {
+		header += 3 << (plain[10]&0x07 + 1)
+	}
+	return concat(plain[:header], concat(extensions...), plain[header:]), plain
+}
+
+// gifExtensionBlock is an extension block with its data in one sub-block
+func gifExtensionBlock(label byte, data string) []byte {
+	return concat([]byte{0x21, label, byte(len(data))}, []byte(data), []byte{0})
+}
+
+func TestHasMetadata(t *testing.T) {
+	exif := tiffBlock(binary.LittleEndian, []tiffField{{tagOrientation, 3, uint16(1)}}, nil)
+	var plain bytes.Buffer
+	jpeg.Encode(&plain, testImage(2, 2), nil)
+	vp8x := webpChunk("VP8X", make([]byte, 10))
+
+	tests := []struct {
+		name   string
+		format string
+		data   []byte
+		want   bool
+	}{
+		{"jpeg exif", "jpeg", jpegWithEXIF(t, 2, 2, exif), true},
+		{"jpeg plain", "jpeg", plain.Bytes(), false},
+		{"png exif", "png", pngWithChunk(t, 2, 2, "eXIf", exif), true},
+		{"png text", "png", pngWithChunk(t, 2, 2, "tEXt", []byte("Comment\x00hello")), true},
+		{"png plain", "png", pngWithChunk(t, 2, 2, "bKGD", []byte{0, 0, 0, 0, 0, 0}), false},
+		{"webp xmp", "webp", webpFile(vp8x, webpChunk("XMP ", []byte("<x/>"))), true},
+		{"webp plain", "webp", webpFile(vp8x), false},
+		{"gif comment", "gif", gifComments(t), true},
+		{"gif xmp", "gif", gifXMP(t), true},
+		{"gif plain", "gif", gifPlain(t), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasMetadata(tt.format, tt.data); got != tt.want {
+				t.Errorf("HasMetadata = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	rotated := tiffBlock(binary.BigEndian, []tiffField{
+		{tagModel, 2, "Pixel 8"},
+		{tagOrientation, 3, uint16(6)},
+	}, nil)
+	upsideDown := tiffBlock(binary.LittleEndian, []tiffField{{tagOrientation, 3, uint16(3)}}, nil)
+	rotatedJPEG := jpegWithEXIF(t, 4, 2, rotated)
+
+	animation, _ := gifWithExtensions(t, 3, 1, gifExtensionBlock(0xFE, "made with something"))
+
+	// An IHDR claiming more than MaxPixels, which is rejected before decoding
+	huge := pngWithChunk(t, 1, 1, "tEXt", []byte("a\x00b"))
+	binary.BigEndian.PutUint32(huge[16:], 20000)
+	binary.BigEndian.PutUint32(huge[20:], 20000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+
+	tests := []struct {
+		name          string
+		data          []byte
+		format        string
+		width, height int
+		camera        string
+		wantErr       error
+	}{
+		{"jpeg rotated", rotatedJPEG, "jpeg", 2, 4, "Pixel 8", nil},
+		{"png upside down", pngWithChunk(t, 3, 2, "eXIf", upsideDown), "png", 3, 2, "", nil},
+		{"png with text", pngWithChunk(t, 3, 2, "tEXt", []byte("Author\x00someone")), "png", 3, 2, "", nil},
+		{"gif with comment", animation, "gif", 3, 1, "", nil},
+		{"too large", huge, "", 0, 0, "", ErrTooLarge},
+		{"truncated jpeg", rotatedJPEG[:len(rotatedJPEG)-200], "", 0, 0, "", errAny},
+		{"not an image", []byte("definitely not an image"), "", 0, 0, "", errAny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sanitize(tt.data)
+			if tt.wantErr != nil {
+				if err == nil || (tt.wantErr != errAny && !errors.Is(err, tt.wantErr)) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Format != tt.format || got.Width != tt.width || got.Height != tt.height || got.Camera != tt.camera {
+				t.Errorf("metadata = %+v, want %s %dx%d %q", got.Metadata, tt.format, tt.width, tt.height, tt.camera)
+			}
+			if HasMetadata(got.Format, got.Data) {
+				t.Error("sanitized image still carries metadata")
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(got.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != tt.width || cfg.Height != tt.height {
+				t.Errorf("encoded %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.width, tt.height)
+			}
+			if inspected, err := Inspect(tt.data); err != nil || inspected != got.Metadata {
+				t.Errorf("Inspect = %+v, %v, want %+v", inspected, err, got.Metadata)
+			}
+		})
+	}
+}
+
+// errAny stands for any error in test tables
+var errAny = errors.New("any error")
+
+func TestOrient(t *testing.T) {
+	const w, h = 3, 2
+	src := testImage(w, h)
+	corner := src.NRGBAAt(0, 0)
+
+	tests := []struct {
+		orientation   int
+		width, height int
+		x, y          int // where the top-left source pixel lands
+	}{
+		{1, w, h, 0, 0},
+		{2, w, h, w - 1, 0},
+		{3, w, h, w - 1, h - 1},
+		{4, w, h, 0, h - 1},
+		{5, h, w, 0, 0},
+		{6, h, w, h - 1, 0},
+		{7, h, w, h - 1, w - 1},
+		{8, h, w, 0, w - 1},
+		{9, w, h, 0, 0},
+	}
+	for _, tt := range tests {
+		out := orient(src, tt.orientation)
+		b := out.Bounds()
+		if b.Dx() != tt.width || b.Dy() != tt.height {
+			t.Errorf("orientation %d: size %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), tt.width, tt.height)
+			continue
+		}
+		if got := color.NRGBAModel.Convert(out.At(tt.x, tt.y)); got != corner {
+			t.Errorf("orientation %d: pixel (%d,%d) = %v, want %v", tt.orientation, tt.x, tt.y, got, corner)
+		}
+	}
+}
+
+func TestStripWebPMetadata(t *testing.T) {
+	vp8x := webpChunk("VP8X", []byte{0x08 | 0x04 | 0x10, 0, 0, 0, 1, 0, 0, 1, 0, 0})
+	bitstream := webpChunk("VP8L", []byte{0x2f, 0, 0, 0, 0})
+	valid := webpFile(vp8x, webpChunk("EXIF", []byte("Exif\x00\x00II*\x00")), bitstream, webpChunk("XMP ", []byte("<x:xmpmeta />")))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []byte
+		wantErr bool
+	}{
+		{"drops metadata chunks and flags", valid, webpFile(webpChunk("VP8X", []byte{0x10, 0, 0, 0, 1, 0, 0, 1, 0, 0}), bitstream), false},
+		{"nothing to strip", webpFile(bitstream), webpFile(bitstream), false},
+		{"missing final padding", valid[:len(valid)-1], nil, false},
+		{"chunk past the end", webpFile(vp8x, bitstream)[:40], nil, true},
+		{"truncated chunk header", webpFile(bitstream)[:16], nil, true},
+		{"not webp", append([]byte("RIFF\x04\x00\x00\x00AVI "), bitstream...), nil, true},
+		{"too short", []byte("RIFF"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stripWebPMetadata(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if HasMetadata("webp", got) || int(binary.LittleEndian.Uint32(got[4:])) != len(got)-8 {
+				t.Errorf("stripped = %q", got)
+			}
+			if tt.want != nil && !bytes.Equal(got, tt.want) {
+				t.Errorf("stripped = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func gifComments(t *testing.T) []byte {
+	data, _ := gifWithExtensions(t, 2, 2, gifExtensionBlock(0xFE, "hello"))
+	return data
+}
+
+func gifXMP(t *testing.T) []byte {
+	data, _ := gifWithExtensions(t, 2, 2, gifExtensionBlock(0xFF, "XMP DataXMP<x:xmpmeta />"))
+	return data
+}
+
+func gifPlain(t *testing.T) []byte {
+	_, plain := gifWithExtensions(t, 2, 2)
+	return plain
+}
+
+func TestStripGIFMetadata(t *testing.T) {
+	// XMP packets are written raw, relying on a trailer that reads as sub-blocks
+	xmp := concat([]byte{0x21, 0xFF, 11}, []byte("XMP DataXMP"), []byte("<x:xmpmeta />"), []byte{0x01})
+	for b := 0xFF; b >= 0; b-- {
+		xmp = append(xmp, byte(b))
+	}
+	xmp = append(xmp, 0)
+	comment := concat([]byte{0x21, 0xFE, 3}, []byte("one"), []byte{4}, []byte("more"), []byte{0})
+	withMetadata, plain := gifWithExtensions(t, 4, 3, comment, xmp, gifExtensionBlock(0xFF, "ICCRGBG1012\x00"))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []byte
+		wantErr bool
+	}{
+		{"drops comments and application extensions", withMetadata, plain, false},
+		{"keeps the loop count", plain, plain, false},
+		{"drops data after the trailer", concat(plain, []byte("appended")), plain, false},
+		{"missing trailer", plain[:len(plain)-1], nil, true},
+		{"sub-block past the end", withMetadata[:len(withMetadata)-len(plain)+20], nil, true},
+		{"unknown block", concat(plain[:len(plain)-1], []byte{0x99, 0x3B}), nil, true},
+		{"too short", []byte("GIF89a"), nil, true},
+		{"not a gif", []byte("PNG\r\n\x1a\n and then some more bytes"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stripGIFMetadata(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("stripped = %q, want %q", got, tt.want)
+			}
+			decoded, err := gif.DecodeAll(bytes.NewReader(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(decoded.Image) != 2 || decoded.LoopCount != 0 {
+				t.Errorf("decoded %d frames looping %d times, want 2 looping forever", len(decoded.Image), decoded.LoopCount)
+			}
+		})
+	}
+}
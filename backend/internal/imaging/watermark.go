@@ -0,0 +1,116 @@
+package imaging
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+// Watermark positions
+const (
+	WatermarkTopLeft     = "top-left"
+	WatermarkTopRight    = "top-right"
+	WatermarkBottomLeft  = "bottom-left"
+	WatermarkBottomRight = "bottom-right"
+	WatermarkCenter      = "center"
+)
+
+// WatermarkPositions are the positions a watermark can be drawn at
+var WatermarkPositions = map[string]bool{
+	WatermarkTopLeft:     true,
+	WatermarkTopRight:    true,
+	WatermarkBottomLeft:  true,
+	WatermarkBottomRight: true,
+	WatermarkCenter:      true,
+}
+
+// watermarkMargin is the gap between a corner watermark and the image edges,
+// as a fraction of the image's shorter side
+const watermarkMargin = 0.03
+
+// Watermark is a logo drawn over renditions
+type Watermark struct {
+	Logo     image.Image
+	Position string
+	Opacity  float64 // 0 (invisible) to 1
+	Scale    float64 // logo width as a fraction of the image width
+
+	// Fingerprint identifies the logo and placement, so renditions drawn
+	// with an older watermark can be found and redrawn
+	Fingerprint string
+}
+
+// NewWatermark decodes a logo and checks the placement settings
+func NewWatermark(logo []byte, position string, opacity, scale float64) (*Watermark, error) {
+	if !WatermarkPositions[position] {
+		return nil, fmt.Errorf("unknown watermark position %q", position)
+	}
+	if opacity <= 0 || opacity > 1 || scale <= 0 || scale > 1 {
+		return nil, fmt.Errorf("watermark opacity and scale must be above 0 and at most 1")
+	}
+	img, _, err := image.Decode(bytes.NewReader(logo))
+	if err != nil {
+		return nil, fmt.Errorf("decode watermark logo: %w", err)
+	}
+
+	hash := sha256.New()
+	hash.Write(logo)
+	fmt.Fprintf(hash, "|%s|%s|%s", position,
+		strconv.FormatFloat(opacity, 'f', -1, 64), strconv.FormatFloat(scale, 'f', -1, 64))
+	return &Watermark{
+		Logo:        img,
+		Position:    position,
+		Opacity:     opacity,
+		Scale:       scale,
+		Fingerprint: hex.EncodeToString(hash.Sum(nil))[:16],
+	}, nil
+}
+
+// Apply returns a copy of img with the logo drawn over it. The logo keeps its
+// aspect ratio and is shrunk further if it would be taller than the image.
+func (w *Watermark) Apply(img image.Image) image.Image {
+	bounds := img.Bounds()
+	logoBounds := w.Logo.Bounds()
+	if logoBounds.Empty() {
+		return img
+	}
+
+	width := float64(bounds.Dx()) * w.Scale
+	height := width * float64(logoBounds.Dy()) / float64(logoBounds.Dx())
+	if limit := float64(bounds.Dy()) * 0.9; height > limit {
+		width, height = width*limit/height, limit
+	}
+	logoWidth, logoHeight := int(math.Round(width)), int(math.Round(height))
+	if logoWidth < 1 || logoHeight < 1 {
+		return img
+	}
+
+	margin := int(math.Round(float64(min(bounds.Dx(), bounds.Dy())) * watermarkMargin))
+	var x, y int
+	switch w.Position {
+	case WatermarkTopLeft:
+		x, y = margin, margin
+	case WatermarkTopRight:
+		x, y = bounds.Dx()-logoWidth-margin, margin
+	case WatermarkBottomLeft:
+		x, y = margin, bounds.Dy()-logoHeight-margin
+	case WatermarkCenter:
+		x, y = (bounds.Dx()-logoWidth)/2, (bounds.Dy()-logoHeight)/2
+	default:
+		x, y = bounds.Dx()-logoWidth-margin, bounds.Dy()-logoHeight-margin
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	logo := scale(w.Logo, logoWidth, logoHeight)
+	mask := image.NewUniform(color.Alpha{A: uint8(math.Round(w.Opacity * 255))})
+	draw.DrawMask(dst, image.Rect(x, y, x+logoWidth, y+logoHeight), logo, image.Point{}, mask, image.Point{}, draw.Over)
+	return dst
+}
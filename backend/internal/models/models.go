@@ -37,6 +37,29 @@ type Category struct {
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// CategoryImpact summarizes what depends on a category before it is deleted or merged
+type CategoryImpact struct {
+	CategoryID int64 `json:"category_id"`
+	Articles   int   `json:"articles"`
+	Documents  int   `json:"documents"`
+	MediaItems int   `json:"media_items"`
+	Children   int   `json:"children"`
+}
+
+// IsEmpty reports whether nothing references the category
+func (i *CategoryImpact) IsEmpty() bool {
+	return i.Articles == 0 && i.Documents == 0 && i.MediaItems == 0 && i.Children == 0
+}
+
+// SlugRedirect maps a retired slug to the entity that now owns its content
+type SlugRedirect struct {
+	ID        int64     `json:"id" db:"id"`
+	Entity    string    `json:"entity" db:"entity"` // category, tag
+	OldSlug   string    `json:"old_slug" db:"old_slug"`
+	TargetID  int64     `json:"target_id" db:"target_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
 type Tag struct {
 	ID        int64     `json:"id" db:"id"`
 	Name      string    `json:"name" db:"name"`
@@ -44,6 +67,12 @@ type Tag struct {
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
+// TagUsage is a tag together with the number of articles using it
+type TagUsage struct {
+	Tag
+	ArticleCount int `json:"article_count" db:"article_count"`
+}
+
 type ArticleStatus string
 
 const (
@@ -77,6 +106,17 @@ type ArticleTag struct {
 	TagID     int64 `db:"tag_id"`
 }
 
+// ArticleSample is the text, category and tags of a published article, used
+// to learn keyword statistics for metadata suggestions
+type ArticleSample struct {
+	ID         int64
+	CategoryID int64
+	Title      string
+	Summary    string
+	Content    string
+	TagIDs     []int64
+}
+
 type ArticleRevision struct {
 	ID        int64     `json:"id" db:"id"`
 	ArticleID int64     `json:"article_id" db:"article_id"`
@@ -173,6 +213,30 @@ type Banner struct {
 	EndDate   *time.Time `json:"end_date" db:"end_date"`
 	CreatedAt time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+	CropURL   string     `json:"crop_url,omitempty" db:"-"` // Image cropped to the placement's preset
+}
+
+// CropPreset is a named output size images are cropped to, e.g. a banner
+// placement or the social share image. Banners use the preset named after
+// their placement, or "banner".
+type CropPreset struct {
+	ID          int64     `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	Width       int       `json:"width" db:"width"`
+	Height      int       `json:"height" db:"height"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// FocalPoint marks the part of an uploaded image crops keep in view, as
+// fractions of its width and height from the top left corner
+type FocalPoint struct {
+	SourceURL string    `json:"source_url" db:"source_url"`
+	X         float64   `json:"x" db:"x"`
+	Y         float64   `json:"y" db:"y"`
+	UpdatedBy int64     `json:"updated_by" db:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
 type Setting struct {
@@ -182,6 +246,46 @@ type Setting struct {
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// WatermarkSettings configures the logo drawn over the public renditions of
+// images in the selected categories and albums. It is stored as JSON in the
+// "watermark" setting.
+type WatermarkSettings struct {
+	Enabled     bool    `json:"enabled"`
+	LogoURL     string  `json:"logo_url"` // An uploaded image, ideally a PNG with transparency
+	Position    string  `json:"position"` // top-left, top-right, bottom-left, bottom-right, center
+	Opacity     float64 `json:"opacity"`  // 0 to 1
+	Scale       float64 `json:"scale"`    // Logo width as a fraction of the image width
+	CategoryIDs []int64 `json:"category_ids"`
+	AlbumIDs    []int64 `json:"album_ids"`
+}
+
+// WatermarkJob reports the progress of the latest batch re-render of
+// watermarked renditions
+type WatermarkJob struct {
+	Running    bool       `json:"running"`
+	Total      int        `json:"total"` // Rendition sets that needed redrawing
+	Rendered   int        `json:"rendered"`
+	Failed     int        `json:"failed"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// QuarantinedFile is an upload refused as suspicious and kept, out of public
+// reach, for an administrator to review
+type QuarantinedFile struct {
+	ID         int64     `json:"id" db:"id"`
+	Filename   string    `json:"filename" db:"filename"` // name the file was uploaded under
+	Path       string    `json:"-" db:"path"`            // location in the quarantine directory
+	SHA256     string    `json:"sha256" db:"sha256"`
+	Size       int64     `json:"size" db:"size"`
+	MimeType   string    `json:"mime_type" db:"mime_type"`
+	Source     string    `json:"source" db:"source"` // document, media
+	Reason     string    `json:"reason" db:"reason"` // macros, malware
+	Detail     string    `json:"detail" db:"detail"` // signature reported by the scanner
+	UploadedBy int64     `json:"uploaded_by" db:"uploaded_by"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
 type AuditLog struct {
 	ID        int64     `json:"id" db:"id"`
 	UserID    int64     `json:"user_id" db:"user_id"`
@@ -190,6 +294,7 @@ type AuditLog struct {
 	EntityID  int64     `json:"entity_id" db:"entity_id"`
 	Details   string    `json:"details" db:"details"`
 	IPAddress string    `json:"ip_address" db:"ip_address"`
+	UserName  string    `json:"user_name,omitempty" db:"-"` // full name of the user, in listings of an entity's log
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
@@ -210,25 +315,168 @@ type ViewLog struct {
 
 // Document represents a document in the document library (Kho văn bản)
 type Document struct {
-	ID            int64      `json:"id" db:"id"`
-	Title         string     `json:"title" db:"title"`
-	Slug          string     `json:"slug" db:"slug"`
-	Description   string     `json:"description" db:"description"`
-	CategoryID    int64      `json:"category_id" db:"category_id"`
-	FilePath      string     `json:"file_path" db:"file_path"`
-	FileSize      int64      `json:"file_size" db:"file_size"`
-	MimeType      string     `json:"mime_type" db:"mime_type"` // application/pdf, application/msword, etc.
-	DownloadURL   string     `json:"download_url,omitempty" db:"-"`
-	PreviewURL    string     `json:"preview_url,omitempty" db:"-"`
-	DocumentNo    string     `json:"document_no" db:"document_no"` // Số văn bản
-	IssuedDate    *time.Time `json:"issued_date" db:"issued_date"` // Ngày ban hành
-	UploadedBy    int64      `json:"uploaded_by" db:"uploaded_by"`
-	ViewCount     int64      `json:"view_count" db:"view_count"`
-	DownloadCount int64      `json:"download_count" db:"download_count"`
-	Status        string     `json:"status" db:"status"` // draft, published, hidden
-	PublishedAt   *time.Time `json:"published_at" db:"published_at"`
-	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+	ID             int64      `json:"id" db:"id"`
+	Title          string     `json:"title" db:"title"`
+	Slug           string     `json:"slug" db:"slug"`
+	Description    string     `json:"description" db:"description"`
+	CategoryID     int64      `json:"category_id" db:"category_id"`
+	FilePath       string     `json:"file_path" db:"file_path"`
+	FileSize       int64      `json:"file_size" db:"file_size"`
+	MimeType       string     `json:"mime_type" db:"mime_type"` // application/pdf, application/msword, etc.
+	Version        int        `json:"version" db:"version"`     // number of the current file in document_versions
+	SHA256         string     `json:"sha256,omitempty" db:"-"`  // checksum of the current file, hex encoded
+	DownloadURL    string     `json:"download_url,omitempty" db:"-"`
+	PreviewURL     string     `json:"preview_url,omitempty" db:"-"`
+	DocumentNo     string     `json:"document_no" db:"document_no"` // Số văn bản
+	IssuedDate     *time.Time `json:"issued_date" db:"issued_date"` // Ngày ban hành
+	TypeID         *int64     `json:"type_id" db:"type_id"`         // Loại văn bản, a document_terms entry of kind "type"
+	TypeName       string     `json:"type_name,omitempty" db:"-"`
+	AuthorityID    *int64     `json:"authority_id" db:"authority_id"` // Cơ quan ban hành
+	AuthorityName  string     `json:"authority_name,omitempty" db:"-"`
+	SignerID       *int64     `json:"signer_id" db:"signer_id"` // Người ký
+	SignerName     string     `json:"signer_name,omitempty" db:"-"`
+	EffectiveDate  *time.Time `json:"effective_date" db:"effective_date"` // Ngày có hiệu lực
+	ExpiryDate     *time.Time `json:"expiry_date" db:"expiry_date"`       // Ngày hết hiệu lực
+	Repealed       bool       `json:"repealed" db:"repealed"`             // no longer in force before its expiry date, e.g. replaced
+	ValidityStatus string     `json:"validity_status" db:"-"`             // in_force, expired or not_yet_effective, from the dates and Repealed
+	Visibility     string     `json:"visibility" db:"visibility"`         // public, authenticated (signed-in users) or roles (users with one of RoleIDs)
+	RoleIDs        []int64    `json:"role_ids" db:"-"`                    // roles that may see the document when Visibility is roles
+	Roles          []string   `json:"roles,omitempty" db:"-"`             // names of RoleIDs
+	UploadedBy     int64      `json:"uploaded_by" db:"uploaded_by"`
+	ViewCount      int64      `json:"view_count" db:"view_count"`
+	DownloadCount  int64      `json:"download_count" db:"download_count"`
+	Status         string     `json:"status" db:"status"`                           // draft, published, hidden
+	SecurityFlags  string     `json:"security_flags,omitempty" db:"security_flags"` // active content found on upload, comma separated: javascript, embedded_files
+	TextStatus     string     `json:"text_status,omitempty" db:"-"`                 // extraction status of the file's text, in admin listings
+	Snippet        string     `json:"snippet,omitempty" db:"-"`                     // matching passage in search results, with matches in <mark>
+	PublishedAt    *time.Time `json:"published_at" db:"published_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// DocumentTerm is an entry of a managed vocabulary of document metadata: a
+// document type, an issuing authority or a signer
+type DocumentTerm struct {
+	ID        int64     `json:"id" db:"id"`
+	Kind      string    `json:"kind" db:"kind"` // type, authority, signer
+	Name      string    `json:"name" db:"name"`
+	SortOrder int       `json:"sort_order" db:"sort_order"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// DocumentRelation links a document to an earlier one it amends, replaces,
+// guides (implements) or references: "DocumentID amends RelatedID"
+type DocumentRelation struct {
+	ID         int64     `json:"id" db:"id"`
+	DocumentID int64     `json:"document_id" db:"document_id"`
+	RelatedID  int64     `json:"related_id" db:"related_id"`
+	Type       string    `json:"type" db:"type"` // amends, replaces, guides, references
+	CreatedBy  *int64    `json:"created_by" db:"created_by"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// RelatedDocument is a document at the other end of a relation, as seen from
+// a document. Relation reads from that document: "amends" when it amends the
+// related document, "amended_by" when the related document amends it.
+type RelatedDocument struct {
+	RelationID     int64      `json:"relation_id"`
+	Relation       string     `json:"relation"` // amends, replaces, guides, references, or their inverse: amended_by, replaced_by, guided_by, referenced_by
+	ID             int64      `json:"id"`
+	Title          string     `json:"title"`
+	Slug           string     `json:"slug"`
+	DocumentNo     string     `json:"document_no"`
+	TypeName       string     `json:"type_name,omitempty"`
+	IssuedDate     *time.Time `json:"issued_date"`
+	Status         string     `json:"status"`
+	ValidityStatus string     `json:"validity_status"`
+}
+
+// DocumentGraph is the network of documents reachable from one through their
+// relations, for following chains of amendments and replacements. Each edge
+// reads "From <type> To".
+type DocumentGraph struct {
+	Nodes []DocumentGraphNode `json:"nodes"`
+	Edges []DocumentGraphEdge `json:"edges"`
+}
+
+type DocumentGraphNode struct {
+	ID             int64      `json:"id"`
+	Title          string     `json:"title"`
+	Slug           string     `json:"slug"`
+	DocumentNo     string     `json:"document_no"`
+	TypeName       string     `json:"type_name,omitempty"`
+	IssuedDate     *time.Time `json:"issued_date"`
+	ValidityStatus string     `json:"validity_status"`
+	Depth          int        `json:"depth"` // number of relations from the document the graph is of
+}
+
+type DocumentGraphEdge struct {
+	From int64  `json:"from"`
+	To   int64  `json:"to"`
+	Type string `json:"type"`
+}
+
+// FacetCount is how many documents of a listing have one value of a field.
+// Label names values that are ids.
+type FacetCount struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	Count int    `json:"count"`
+}
+
+// DocumentFacets counts the documents of a filtered listing by the values of
+// each filterable field. A facet applies every filter but its own, so that
+// its other values stay selectable.
+type DocumentFacets struct {
+	Types       []FacetCount `json:"types"`
+	Authorities []FacetCount `json:"authorities"`
+	Signers     []FacetCount `json:"signers"`
+	Validity    []FacetCount `json:"validity"`
+	Years       []FacetCount `json:"years"` // year of issue
+}
+
+// DocumentVersion is one of the files a document has had, numbered from 1.
+// SHA256 is the hex checksum of the file as uploaded, for verifying copies.
+type DocumentVersion struct {
+	ID          int64     `json:"id" db:"id"`
+	DocumentID  int64     `json:"document_id" db:"document_id"`
+	Version     int       `json:"version" db:"version"`
+	FilePath    string    `json:"file_path" db:"file_path"`
+	FileSize    int64     `json:"file_size" db:"file_size"`
+	MimeType    string    `json:"mime_type" db:"mime_type"`
+	SHA256      string    `json:"sha256" db:"sha256"`
+	ChangeNote  string    `json:"change_note" db:"change_note"`
+	UploadedBy  int64     `json:"uploaded_by" db:"uploaded_by"`
+	Current     bool      `json:"current" db:"-"`
+	DownloadURL string    `json:"download_url,omitempty" db:"-"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// DocumentText is the plain text extracted from a document's file, searched
+// along with its title and description
+type DocumentText struct {
+	DocumentID  int64      `json:"document_id" db:"document_id"`
+	Status      string     `json:"status" db:"status"` // pending, done, failed, unsupported
+	Content     string     `json:"content" db:"content"`
+	Error       string     `json:"error,omitempty" db:"error"`
+	ExtractedAt *time.Time `json:"extracted_at" db:"extracted_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// ImageRendition is a scaled copy of an uploaded image. Each source also has
+// an "original" row describing the upload itself.
+type ImageRendition struct {
+	ID        int64     `json:"id" db:"id"`
+	SourceURL string    `json:"source_url" db:"source_url"`
+	Name      string    `json:"name" db:"name"`     // original, thumb, small, medium, large
+	Format    string    `json:"format" db:"format"` // jpeg, png, webp, gif
+	URL       string    `json:"url" db:"url"`
+	Width     int       `json:"width" db:"width"`
+	Height    int       `json:"height" db:"height"`
+	FileSize  int64     `json:"file_size" db:"file_size"`
+	Watermark string    `json:"watermark,omitempty" db:"watermark"` // Fingerprint of the watermark drawn on the set; empty when none
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
 // MediaItem represents a media file (video/image) in the media library
@@ -238,17 +486,108 @@ type MediaItem struct {
 	Slug         string     `json:"slug" db:"slug"`
 	Description  string     `json:"description" db:"description"`
 	CategoryID   int64      `json:"category_id" db:"category_id"`
-	MediaType    string     `json:"media_type" db:"media_type"` // video, image
+	FolderID     *int64     `json:"folder_id" db:"folder_id"`       // Admin library folder; nil when unfiled
+	NoWatermark  bool       `json:"no_watermark" db:"no_watermark"` // Opts the image out of watermarked renditions
+	MediaType    string     `json:"media_type" db:"media_type"`     // video, image
 	URL          string     `json:"url" db:"url"`
 	ThumbnailURL string     `json:"thumbnail_url" db:"thumbnail_url"`
 	FileSize     int64      `json:"file_size" db:"file_size"`
-	Duration     int        `json:"duration" db:"duration"` // For videos (seconds)
+	Duration     int        `json:"duration" db:"duration"`     // For videos (seconds)
+	Codec        string     `json:"codec,omitempty" db:"codec"` // For videos, e.g. h264, vp9
 	Width        int        `json:"width" db:"width"`
 	Height       int        `json:"height" db:"height"`
+	TakenAt      *time.Time `json:"taken_at,omitempty" db:"taken_at"` // From EXIF, when capture info is kept
+	Camera       string     `json:"camera,omitempty" db:"camera"`
 	UploadedBy   int64      `json:"uploaded_by" db:"uploaded_by"`
 	ViewCount    int64      `json:"view_count" db:"view_count"`
 	Status       string     `json:"status" db:"status"` // draft, published
 	PublishedAt  *time.Time `json:"published_at" db:"published_at"`
 	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+	Tags         []string   `json:"tags,omitempty" db:"-"`
+}
+
+// MediaFolder organizes the admin media library. Folders only group items
+// for editors; they play no part in public URLs.
+type MediaFolder struct {
+	ID        int64          `json:"id" db:"id"`
+	Name      string         `json:"name" db:"name"`
+	ParentID  *int64         `json:"parent_id" db:"parent_id"`
+	ItemCount int            `json:"item_count" db:"-"`
+	Children  []*MediaFolder `json:"children,omitempty" db:"-"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+// MediaTagUsage is a free-form media tag with the number of items carrying it
+type MediaTagUsage struct {
+	Tag   string `json:"tag" db:"tag"`
+	Count int    `json:"count" db:"count"`
+}
+
+// Album is an ordered gallery of media items, e.g. the photos of one event.
+// Without a cover the first item is shown.
+type Album struct {
+	ID           int64      `json:"id" db:"id"`
+	Title        string     `json:"title" db:"title"`
+	Slug         string     `json:"slug" db:"slug"`
+	Description  string     `json:"description" db:"description"`
+	CoverMediaID *int64     `json:"cover_media_id" db:"cover_media_id"`
+	CoverURL     string     `json:"cover_url" db:"-"` // URL of the cover, or of the first item
+	ItemCount    int        `json:"item_count" db:"-"`
+	CreatedBy    int64      `json:"created_by" db:"created_by"`
+	Status       string     `json:"status" db:"status"` // draft, published
+	PublishedAt  *time.Time `json:"published_at" db:"published_at"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// AlbumItem places a media item in an album
+type AlbumItem struct {
+	AlbumID     int64      `json:"album_id" db:"album_id"`
+	MediaItemID int64      `json:"media_item_id" db:"media_item_id"`
+	Position    int        `json:"position" db:"position"`
+	Caption     string     `json:"caption" db:"caption"`
+	Media       *MediaItem `json:"media,omitempty" db:"-"`
+}
+
+// UploadSession tracks a resumable (tus) upload until it is complete and
+// handed over to become a MediaItem
+type UploadSession struct {
+	ID          string    `json:"id" db:"id"`
+	UserID      int64     `json:"user_id" db:"user_id"`
+	Filename    string    `json:"filename" db:"filename"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	Title       string    `json:"title" db:"title"`
+	Description string    `json:"description" db:"description"`
+	CategoryID  int64     `json:"category_id" db:"category_id"`
+	Length      int64     `json:"length" db:"upload_length"`
+	Offset      int64     `json:"offset" db:"upload_offset"`
+	MediaItemID *int64    `json:"media_item_id" db:"media_item_id"`
+	ExpiresAt   time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// StoredBlob is one physical upload file, identified by the SHA-256 of its
+// content. Records that share the file each hold a reference; the file is
+// removed when the last one goes.
+type StoredBlob struct {
+	SHA256    string    `json:"sha256" db:"sha256"`
+	URL       string    `json:"url" db:"url"`
+	Size      int64     `json:"size" db:"size"`
+	MimeType  string    `json:"mime_type" db:"mime_type"`
+	RefCount  int64     `json:"ref_count" db:"ref_count"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// FileReference records that an article, page or banner uses an uploaded
+// file. Title is only filled in when listing where a file is used.
+type FileReference struct {
+	URL       string `json:"url" db:"url"`
+	OwnerType string `json:"owner_type" db:"owner_type"` // article, page, banner
+	OwnerID   int64  `json:"owner_id" db:"owner_id"`
+	Field     string `json:"field" db:"field"` // featured_image, hero_image, image, content
+	Title     string `json:"title,omitempty" db:"-"`
 }
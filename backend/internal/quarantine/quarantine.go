@@ -0,0 +1,120 @@
+// Package quarantine passes uploads through the configured malware scanner
+// and moves the files refused as suspicious into a local directory, outside
+// the storage served under /static, for an administrator to review.
+package quarantine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+	"github.com/thieugt95/portal-365/backend/internal/scan"
+)
+
+// Reasons a file is quarantined
+const (
+	ReasonMacros  = "macros"
+	ReasonMalware = "malware"
+)
+
+// ErrScanFailed is returned when the scanner could not give a verdict
+var ErrScanFailed = errors.New("malware scan failed")
+
+// Service scans uploads and holds the suspicious ones
+type Service struct {
+	repo    repositories.QuarantineRepository
+	scanner scan.Scanner
+	dir     string
+}
+
+// New returns a service keeping quarantined files in dir. With a nil
+// scanner uploads are not scanned, but files refused for other reasons are
+// still quarantined.
+func New(repos *database.Repositories, scanner scan.Scanner, dir string) *Service {
+	return &Service{repo: repos.Quarantine, scanner: scanner, dir: dir}
+}
+
+// Scan passes the file at path through the scanner
+func (s *Service) Scan(ctx context.Context, path string) (*scan.Result, error) {
+	if s.scanner == nil {
+		return &scan.Result{}, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result, err := s.scanner.Scan(ctx, file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+	return result, nil
+}
+
+// Hold moves the file at path into quarantine and records it. file describes
+// the upload; its Path, Size and CreatedAt are filled in.
+func (s *Service) Hold(ctx context.Context, path string, file *models.QuarantinedFile) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	dest := filepath.Join(s.dir, fmt.Sprintf("%s-%s.quarantine", time.Now().Format("20060102-150405"), file.SHA256))
+	if err := move(path, dest); err != nil {
+		return err
+	}
+	if info, err := os.Stat(dest); err == nil {
+		file.Size = info.Size()
+	}
+	file.Path = dest
+
+	if err := s.repo.Create(ctx, file); err != nil {
+		_ = os.Remove(dest)
+		return err
+	}
+	return nil
+}
+
+// Delete removes a quarantined file and its record
+func (s *Service) Delete(ctx context.Context, id int64) error {
+	file, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+// move renames src to dest, copying when they are on different filesystems
+func move(src, dest string) error {
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dest)
+		return err
+	}
+	return os.Remove(src)
+}
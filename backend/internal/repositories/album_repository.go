@@ -0,0 +1,352 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/models"
+)
+
+// ErrAlbumOrderMismatch is returned when a new order does not list exactly the items of the album
+var ErrAlbumOrderMismatch = errors.New("order must list every item of the album exactly once")
+
+type AlbumRepository interface {
+	Create(ctx context.Context, album *models.Album) error
+	GetByID(ctx context.Context, id int64) (*models.Album, error)
+	GetBySlug(ctx context.Context, slug string) (*models.Album, error)
+	Update(ctx context.Context, album *models.Album) error
+	Delete(ctx context.Context, id int64) error
+	List(ctx context.Context, status string, page, pageSize int) ([]models.Album, int, error)
+	ListItems(ctx context.Context, albumID int64) ([]*models.AlbumItem, error)
+	HasItem(ctx context.Context, albumID, mediaItemID int64) (bool, error)
+	AddItems(ctx context.Context, albumID int64, items []*models.AlbumItem) (int, error)
+	UpdateItemCaption(ctx context.Context, albumID, mediaItemID int64, caption string) error
+	RemoveItem(ctx context.Context, albumID, mediaItemID int64) error
+	Reorder(ctx context.Context, albumID int64, mediaItemIDs []int64) error
+	RemoveMediaItem(ctx context.Context, mediaItemID int64) error
+}
+
+type albumRepository struct {
+	db *sql.DB
+}
+
+func NewAlbumRepository(db *sql.DB) AlbumRepository {
+	return &albumRepository{db: db}
+}
+
+// albumCover is the image shown for a media item: the image itself, or a
+// video's thumbnail when it has one
+const albumCover = `CASE WHEN m.media_type = 'image' THEN m.url ELSE NULLIF(NULLIF(m.thumbnail_url, ''), m.url) END`
+
+// albumSelect reads an album with its cover, falling back to the first item
+// that has an image when no cover was chosen, and its number of items
+const albumSelect = `SELECT a.id, a.title, a.slug, a.description, a.cover_media_id, a.created_by, a.status,
+	 a.published_at, a.created_at, a.updated_at,
+	 COALESCE((SELECT ` + albumCover + ` FROM media_items m WHERE m.id = a.cover_media_id),
+	          (SELECT ` + albumCover + ` FROM album_items ai JOIN media_items m ON m.id = ai.media_item_id
+	           WHERE ai.album_id = a.id AND ` + albumCover + ` IS NOT NULL
+	           ORDER BY ai.position, ai.media_item_id LIMIT 1), ''),
+	 (SELECT COUNT(*) FROM album_items ai WHERE ai.album_id = a.id)
+	 FROM albums a`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAlbum(row rowScanner, album *models.Album) error {
+	return row.Scan(&album.ID, &album.Title, &album.Slug, &album.Description, &album.CoverMediaID,
+		&album.CreatedBy, &album.Status, &album.PublishedAt, &album.CreatedAt, &album.UpdatedAt,
+		&album.CoverURL, &album.ItemCount)
+}
+
+func (r *albumRepository) Create(ctx context.Context, album *models.Album) error {
+	now := time.Now()
+	album.CreatedAt = now
+	album.UpdatedAt = now
+
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO albums (title, slug, description, cover_media_id, created_by, status, published_at, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		album.Title, album.Slug, album.Description, album.CoverMediaID, album.CreatedBy,
+		album.Status, album.PublishedAt, album.CreatedAt, album.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	album.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *albumRepository) GetByID(ctx context.Context, id int64) (*models.Album, error) {
+	album := &models.Album{}
+	if err := scanAlbum(r.db.QueryRowContext(ctx, albumSelect+` WHERE a.id = ?`, id), album); err != nil {
+		return nil, err
+	}
+	return album, nil
+}
+
+func (r *albumRepository) GetBySlug(ctx context.Context, slug string) (*models.Album, error) {
+	album := &models.Album{}
+	if err := scanAlbum(r.db.QueryRowContext(ctx, albumSelect+` WHERE a.slug = ?`, slug), album); err != nil {
+		return nil, err
+	}
+	return album, nil
+}
+
+func (r *albumRepository) Update(ctx context.Context, album *models.Album) error {
+	album.UpdatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE albums SET title = ?, slug = ?, description = ?, cover_media_id = ?, status = ?,
+		 published_at = ?, updated_at = ? WHERE id = ?`,
+		album.Title, album.Slug, album.Description, album.CoverMediaID, album.Status,
+		album.PublishedAt, album.UpdatedAt, album.ID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Delete removes an album and its membership rows; the media items stay
+func (r *albumRepository) Delete(ctx context.Context, id int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM album_items WHERE album_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM albums WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+func (r *albumRepository) List(ctx context.Context, status string, page, pageSize int) ([]models.Album, int, error) {
+	offset := (page - 1) * pageSize
+
+	where := ` WHERE 1=1`
+	args := []interface{}{}
+	if status != "" {
+		where += ` AND a.status = ?`
+		args = append(args, status)
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM albums a`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		albumSelect+where+` ORDER BY COALESCE(a.published_at, a.created_at) DESC, a.id DESC LIMIT ? OFFSET ?`,
+		append(args, pageSize, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	albums := []models.Album{}
+	for rows.Next() {
+		var album models.Album
+		if err := scanAlbum(rows, &album); err != nil {
+			return nil, 0, err
+		}
+		albums = append(albums, album)
+	}
+	return albums, total, rows.Err()
+}
+
+// ListItems returns the items of an album in order, with their media items
+func (r *albumRepository) ListItems(ctx context.Context, albumID int64) ([]*models.AlbumItem, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT ai.album_id, ai.media_item_id, ai.position, ai.caption,
+		 m.id, m.title, m.slug, m.description, m.category_id, m.media_type, m.url, m.thumbnail_url,
+		 m.file_size, m.duration, m.codec, m.width, m.height, m.taken_at, m.camera, m.uploaded_by, m.view_count,
+		 m.status, m.published_at, m.created_at, m.updated_at
+		 FROM album_items ai JOIN media_items m ON m.id = ai.media_item_id
+		 WHERE ai.album_id = ? ORDER BY ai.position, ai.media_item_id`, albumID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*models.AlbumItem{}
+	for rows.Next() {
+		item := &models.AlbumItem{Media: &models.MediaItem{}}
+		media := item.Media
+		if err := rows.Scan(&item.AlbumID, &item.MediaItemID, &item.Position, &item.Caption,
+			&media.ID, &media.Title, &media.Slug, &media.Description, &media.CategoryID,
+			&media.MediaType, &media.URL, &media.ThumbnailURL, &media.FileSize, &media.Duration, &media.Codec, &media.Width,
+			&media.Height, &media.TakenAt, &media.Camera, &media.UploadedBy, &media.ViewCount, &media.Status, &media.PublishedAt,
+			&media.CreatedAt, &media.UpdatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *albumRepository) HasItem(ctx context.Context, albumID, mediaItemID int64) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM album_items WHERE album_id = ? AND media_item_id = ?)`,
+		albumID, mediaItemID).Scan(&exists)
+	return exists, err
+}
+
+// AddItems appends items to the end of an album in the given order. Items
+// already in the album keep their place. It returns the number added.
+func (r *albumRepository) AddItems(ctx context.Context, albumID int64, items []*models.AlbumItem) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var next int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(position) + 1, 0) FROM album_items WHERE album_id = ?`, albumID).Scan(&next); err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, item := range items {
+		result, err := tx.ExecContext(ctx,
+			`INSERT OR IGNORE INTO album_items (album_id, media_item_id, position, caption) VALUES (?, ?, ?, ?)`,
+			albumID, item.MediaItemID, next, item.Caption)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			item.AlbumID = albumID
+			item.Position = next
+			next++
+			added++
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE albums SET updated_at = ? WHERE id = ?`, time.Now(), albumID); err != nil {
+		return 0, err
+	}
+	return added, tx.Commit()
+}
+
+func (r *albumRepository) UpdateItemCaption(ctx context.Context, albumID, mediaItemID int64, caption string) error {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE album_items SET caption = ? WHERE album_id = ? AND media_item_id = ?`, caption, albumID, mediaItemID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RemoveItem takes a media item out of an album, clearing the cover if it was the cover
+func (r *albumRepository) RemoveItem(ctx context.Context, albumID, mediaItemID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`DELETE FROM album_items WHERE album_id = ? AND media_item_id = ?`, albumID, mediaItemID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE albums SET cover_media_id = NULL, updated_at = ? WHERE id = ? AND cover_media_id = ?`,
+		time.Now(), albumID, mediaItemID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Reorder sets the order of an album to mediaItemIDs, which must list each
+// of its items once
+func (r *albumRepository) Reorder(ctx context.Context, albumID int64, mediaItemIDs []int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM album_items WHERE album_id = ?`, albumID).Scan(&count); err != nil {
+		return err
+	}
+	if count != len(mediaItemIDs) {
+		return ErrAlbumOrderMismatch
+	}
+
+	seen := make(map[int64]bool, len(mediaItemIDs))
+	for position, id := range mediaItemIDs {
+		if seen[id] {
+			return ErrAlbumOrderMismatch
+		}
+		seen[id] = true
+		result, err := tx.ExecContext(ctx,
+			`UPDATE album_items SET position = ? WHERE album_id = ? AND media_item_id = ?`, position, albumID, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrAlbumOrderMismatch
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE albums SET updated_at = ? WHERE id = ?`, time.Now(), albumID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveMediaItem takes a deleted media item out of every album
+func (r *albumRepository) RemoveMediaItem(ctx context.Context, mediaItemID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM album_items WHERE media_item_id = ?`, mediaItemID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE albums SET cover_media_id = NULL WHERE cover_media_id = ?`, mediaItemID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
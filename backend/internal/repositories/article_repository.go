@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,16 +12,24 @@ import (
 )
 
 type ArticleFilter struct {
-	CategoryID   *int64
-	CategorySlug *string
-	AuthorID     *int64
-	Status       *string
-	Tag          *string
-	TagSlugs     []string // Support multiple tags
-	IsFeatured   *bool
-	FromDate     *time.Time
-	ToDate       *time.Time
-	Query        *string
+	CategoryID         *int64
+	CategorySlug       *string
+	IncludeDescendants bool // Match articles in child categories of CategoryID/CategorySlug too
+	AuthorID           *int64
+	Status             *string
+	Tag                *string
+	TagSlugs           []string // Support multiple tags
+	IsFeatured         *bool
+	FromDate           *time.Time
+	ToDate             *time.Time
+	Query              *string
+}
+
+// ArticleTags is the tag set an article is saved with: existing tags by ID
+// plus tags by name
+type ArticleTags struct {
+	IDs   []int64
+	Named []*models.Tag
 }
 
 type ArticleRepository interface {
@@ -36,6 +45,9 @@ type ArticleRepository interface {
 	AddTag(ctx context.Context, articleID, tagID int64) error
 	RemoveTag(ctx context.Context, articleID, tagID int64) error
 	GetTags(ctx context.Context, articleID int64) ([]*models.Tag, error)
+	SaveWithTags(ctx context.Context, article *models.Article, tags *ArticleTags) error
+	ListSamples(ctx context.Context, limit, contentLength int) ([]*models.ArticleSample, error)
+	SamplesVersion(ctx context.Context) (string, error)
 	CreateRevision(ctx context.Context, revision *models.ArticleRevision) error
 	GetRevisions(ctx context.Context, articleID int64) ([]*models.ArticleRevision, error)
 	RecordView(ctx context.Context, articleID int64, ipAddress, userAgent string) error
@@ -50,18 +62,7 @@ func NewArticleRepository(db *sql.DB) ArticleRepository {
 }
 
 func (r *articleRepository) Create(ctx context.Context, article *models.Article) error {
-	result, err := r.db.ExecContext(ctx,
-		`INSERT INTO articles (title, slug, summary, content, featured_image, author_id, category_id, 
-		 status, is_featured, published_at, scheduled_at) 
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		article.Title, article.Slug, article.Summary, article.Content, article.FeaturedImage,
-		article.AuthorID, article.CategoryID, article.Status, article.IsFeatured,
-		article.PublishedAt, article.ScheduledAt)
-	if err != nil {
-		return err
-	}
-	article.ID, err = result.LastInsertId()
-	return err
+	return insertArticle(ctx, r.db, article)
 }
 
 func (r *articleRepository) GetByID(ctx context.Context, id int64) (*models.Article, error) {
@@ -97,14 +98,7 @@ func (r *articleRepository) GetBySlug(ctx context.Context, slug string) (*models
 }
 
 func (r *articleRepository) Update(ctx context.Context, article *models.Article) error {
-	_, err := r.db.ExecContext(ctx,
-		`UPDATE articles SET title = ?, slug = ?, summary = ?, content = ?, featured_image = ?, 
-		 category_id = ?, status = ?, is_featured = ?, published_at = ?, scheduled_at = ?, 
-		 updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
-		article.Title, article.Slug, article.Summary, article.Content, article.FeaturedImage,
-		article.CategoryID, article.Status, article.IsFeatured, article.PublishedAt,
-		article.ScheduledAt, article.ID)
-	return err
+	return updateArticle(ctx, r.db, article)
 }
 
 func (r *articleRepository) Delete(ctx context.Context, id int64) error {
@@ -121,11 +115,19 @@ func (r *articleRepository) List(ctx context.Context, filter *ArticleFilter, pag
 
 	if filter != nil {
 		if filter.CategoryID != nil {
-			whereClauses = append(whereClauses, "category_id = ?")
+			if filter.IncludeDescendants {
+				whereClauses = append(whereClauses, "category_id IN ("+categoryTreeQuery("id = ?")+")")
+			} else {
+				whereClauses = append(whereClauses, "category_id = ?")
+			}
 			args = append(args, *filter.CategoryID)
 		}
 		if filter.CategorySlug != nil {
-			whereClauses = append(whereClauses, "category_id = (SELECT id FROM categories WHERE slug = ?)")
+			if filter.IncludeDescendants {
+				whereClauses = append(whereClauses, "category_id IN ("+categoryTreeQuery("slug = ?")+")")
+			} else {
+				whereClauses = append(whereClauses, "category_id = (SELECT id FROM categories WHERE slug = ?)")
+			}
 			args = append(args, *filter.CategorySlug)
 		}
 		if filter.AuthorID != nil {
@@ -316,6 +318,163 @@ func (r *articleRepository) GetTags(ctx context.Context, articleID int64) ([]*mo
 	return tags, rows.Err()
 }
 
+// SaveWithTags creates the article, or updates it when it has an ID, and sets
+// its tags to tags in the same transaction; nil tags keep the current set.
+// Named tags are matched by name, then slug, then a slug redirect left by a
+// rename or merge, and are created when nothing matches. Unknown tag IDs are
+// ignored.
+func (r *articleRepository) SaveWithTags(ctx context.Context, article *models.Article, tags *ArticleTags) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	save := updateArticle
+	if article.ID == 0 {
+		save = insertArticle
+	}
+	if err := save(ctx, tx, article); err != nil {
+		return err
+	}
+
+	if tags != nil {
+		if err := replaceTags(ctx, tx, article.ID, tags); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// execer runs statements on the database or within a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertArticle(ctx context.Context, db execer, article *models.Article) error {
+	result, err := db.ExecContext(ctx,
+		`INSERT INTO articles (title, slug, summary, content, featured_image, author_id, category_id, 
+		 status, is_featured, published_at, scheduled_at) 
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		article.Title, article.Slug, article.Summary, article.Content, article.FeaturedImage,
+		article.AuthorID, article.CategoryID, article.Status, article.IsFeatured,
+		article.PublishedAt, article.ScheduledAt)
+	if err != nil {
+		return err
+	}
+	article.ID, err = result.LastInsertId()
+	return err
+}
+
+func updateArticle(ctx context.Context, db execer, article *models.Article) error {
+	_, err := db.ExecContext(ctx,
+		`UPDATE articles SET title = ?, slug = ?, summary = ?, content = ?, featured_image = ?, 
+		 category_id = ?, status = ?, is_featured = ?, published_at = ?, scheduled_at = ?, 
+		 updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		article.Title, article.Slug, article.Summary, article.Content, article.FeaturedImage,
+		article.CategoryID, article.Status, article.IsFeatured, article.PublishedAt,
+		article.ScheduledAt, article.ID)
+	return err
+}
+
+func replaceTags(ctx context.Context, tx *sql.Tx, articleID int64, tags *ArticleTags) error {
+	ids := append([]int64{}, tags.IDs...)
+	for _, tag := range tags.Named {
+		id, err := upsertTag(ctx, tx, tag)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM article_tags WHERE article_id = ?`, articleID); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR IGNORE INTO article_tags (article_id, tag_id) SELECT ?, id FROM tags WHERE id = ?`,
+			articleID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func upsertTag(ctx context.Context, tx *sql.Tx, tag *models.Tag) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx,
+		`SELECT id FROM tags WHERE name = ? 
+		 UNION ALL SELECT id FROM tags WHERE slug = ? 
+		 UNION ALL SELECT t.id FROM slug_redirects r JOIN tags t ON t.id = r.target_id 
+		           WHERE r.entity = 'tag' AND r.old_slug = ? 
+		 LIMIT 1`,
+		tag.Name, tag.Slug, tag.Slug).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `INSERT INTO tags (name, slug) VALUES (?, ?)`, tag.Name, tag.Slug)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// ListSamples returns the most recently published articles with their tag IDs.
+// Content is truncated to contentLength characters.
+func (r *articleRepository) ListSamples(ctx context.Context, limit, contentLength int) ([]*models.ArticleSample, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT a.id, a.category_id, a.title, a.summary, substr(a.content, 1, ?), 
+		        COALESCE(GROUP_CONCAT(at.tag_id), '') 
+		 FROM articles a 
+		 LEFT JOIN article_tags at ON at.article_id = a.id 
+		 WHERE a.status = 'published' 
+		 GROUP BY a.id 
+		 ORDER BY a.published_at DESC 
+		 LIMIT ?`,
+		contentLength, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make([]*models.ArticleSample, 0)
+	for rows.Next() {
+		sample := &models.ArticleSample{}
+		var tagIDs string
+		if err := rows.Scan(&sample.ID, &sample.CategoryID, &sample.Title, &sample.Summary, &sample.Content, &tagIDs); err != nil {
+			return nil, err
+		}
+		for _, part := range strings.Split(tagIDs, ",") {
+			if id, err := strconv.ParseInt(part, 10, 64); err == nil {
+				sample.TagIDs = append(sample.TagIDs, id)
+			}
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, rows.Err()
+}
+
+// SamplesVersion returns a value that changes whenever an article is
+// published, saved, unpublished or deleted, or its tags change, so that what
+// is learned from ListSamples can be kept until then
+func (r *articleRepository) SamplesVersion(ctx context.Context) (string, error) {
+	var published, tagged int64
+	var updated sql.NullString
+	err := r.db.QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM articles WHERE status = 'published'), 
+		        (SELECT MAX(updated_at) FROM articles), 
+		        (SELECT COUNT(*) FROM article_tags)`).Scan(&published, &updated, &tagged)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d/%s/%d", published, updated.String, tagged), nil
+}
+
 func (r *articleRepository) CreateRevision(ctx context.Context, revision *models.ArticleRevision) error {
 	result, err := r.db.ExecContext(ctx,
 		`INSERT INTO article_revisions (article_id, title, content, user_id) VALUES (?, ?, ?, ?)`,
@@ -373,6 +532,19 @@ func (r *articleRepository) RecordView(ctx context.Context, articleID int64, ipA
 }
 
 func parseSortBy(sortBy string) string {
+	return sortClause(sortBy, map[string]bool{
+		"created_at":   true,
+		"updated_at":   true,
+		"published_at": true,
+		"title":        true,
+		"view_count":   true,
+	})
+}
+
+// sortClause turns a sort parameter such as "-published_at,title" into an
+// ORDER BY clause, keeping only the fields in validFields to prevent SQL
+// injection. It falls back to newest first.
+func sortClause(sortBy string, validFields map[string]bool) string {
 	parts := strings.Split(sortBy, ",")
 	orderParts := make([]string, 0)
 
@@ -390,15 +562,6 @@ func parseSortBy(sortBy string) string {
 			field = part[1:]
 		}
 
-		// Validate field names to prevent SQL injection
-		validFields := map[string]bool{
-			"created_at":   true,
-			"updated_at":   true,
-			"published_at": true,
-			"title":        true,
-			"view_count":   true,
-		}
-
 		if validFields[field] {
 			orderParts = append(orderParts, fmt.Sprintf("%s %s", field, direction))
 		}
@@ -3,6 +3,7 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"errors"
 
 	"github.com/thieugt95/portal-365/backend/internal/models"
 )
@@ -63,6 +64,25 @@ func (r *roleRepository) GetByName(ctx context.Context, name string) (*models.Ro
 	return role, nil
 }
 
+// categoryTreeQuery returns a subquery selecting the IDs of the category matched
+// by anchor (e.g. "id = ?" or "slug = ?") and all of its descendants.
+// UNION (rather than UNION ALL) stops the recursion if parent_id ever forms a cycle.
+func categoryTreeQuery(anchor string) string {
+	return `WITH RECURSIVE category_tree(id) AS (
+		SELECT id FROM categories WHERE ` + anchor + `
+		UNION
+		SELECT c.id FROM categories c INNER JOIN category_tree t ON c.parent_id = t.id
+	) SELECT id FROM category_tree`
+}
+
+// categoryCondition builds the category_id condition used by content listings.
+func categoryCondition(includeDescendants bool) string {
+	if includeDescendants {
+		return " AND category_id IN (" + categoryTreeQuery("id = ?") + ")"
+	}
+	return " AND category_id = ?"
+}
+
 type CategoryFilter struct {
 	IsActive *bool
 	ParentID *int64
@@ -79,8 +99,16 @@ type CategoryRepository interface {
 	List(ctx context.Context, filter *CategoryFilter) ([]models.Category, error)
 	ListWithTotal(ctx context.Context, filter *CategoryFilter) ([]models.Category, int, error)
 	GetAll(ctx context.Context) ([]*models.Category, error)
+	GetAncestors(ctx context.Context, id int64) ([]*models.Category, error)
+	GetImpact(ctx context.Context, id int64) (*models.CategoryImpact, error)
+	DeleteAndReassign(ctx context.Context, id, targetID int64) error
+	Merge(ctx context.Context, sourceID, targetID int64) error
 }
 
+// ErrInvalidCategoryTarget is returned when content cannot be moved to the requested
+// category, either because it is the category itself or one of its descendants.
+var ErrInvalidCategoryTarget = errors.New("target category must differ from the source and not be one of its descendants")
+
 type categoryRepository struct {
 	db *sql.DB
 }
@@ -114,6 +142,44 @@ func (r *categoryRepository) GetByID(ctx context.Context, id int64) (*models.Cat
 	return category, nil
 }
 
+// GetAncestors returns the category and its ancestors, root first. The depth
+// cap guards against a parent_id cycle.
+func (r *categoryRepository) GetAncestors(ctx context.Context, id int64) ([]*models.Category, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`WITH RECURSIVE ancestors(id, depth) AS (
+			SELECT id, 0 FROM categories WHERE id = ?
+			UNION ALL
+			SELECT c.parent_id, a.depth + 1 FROM categories c 
+			INNER JOIN ancestors a ON c.id = a.id 
+			WHERE c.parent_id IS NOT NULL AND a.depth < 32
+		)
+		SELECT c.id, c.name, c.slug, c.description, c.parent_id, c.sort_order, c.is_active, c.created_at, c.updated_at 
+		FROM ancestors a INNER JOIN categories c ON c.id = a.id 
+		ORDER BY a.depth DESC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := make([]*models.Category, 0)
+	for rows.Next() {
+		category := &models.Category{}
+		if err := rows.Scan(&category.ID, &category.Name, &category.Slug, &category.Description,
+			&category.ParentID, &category.SortOrder, &category.IsActive, &category.CreatedAt, &category.UpdatedAt); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(categories) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return categories, nil
+}
+
 func (r *categoryRepository) GetBySlug(ctx context.Context, slug string) (*models.Category, error) {
 	category := &models.Category{}
 	err := r.db.QueryRowContext(ctx,
@@ -260,15 +326,117 @@ func (r *categoryRepository) GetAll(ctx context.Context) ([]*models.Category, er
 	return categories, rows.Err()
 }
 
+func (r *categoryRepository) GetImpact(ctx context.Context, id int64) (*models.CategoryImpact, error) {
+	if _, err := r.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	impact := &models.CategoryImpact{CategoryID: id}
+	err := r.db.QueryRowContext(ctx,
+		`SELECT
+		   (SELECT COUNT(*) FROM articles WHERE category_id = ?),
+		   (SELECT COUNT(*) FROM documents WHERE category_id = ?),
+		   (SELECT COUNT(*) FROM media_items WHERE category_id = ?),
+		   (SELECT COUNT(*) FROM categories WHERE parent_id = ?)`,
+		id, id, id, id).Scan(&impact.Articles, &impact.Documents, &impact.MediaItems, &impact.Children)
+	if err != nil {
+		return nil, err
+	}
+	return impact, nil
+}
+
+func (r *categoryRepository) DeleteAndReassign(ctx context.Context, id, targetID int64) error {
+	return r.moveAndDelete(ctx, id, targetID, false)
+}
+
+func (r *categoryRepository) Merge(ctx context.Context, sourceID, targetID int64) error {
+	return r.moveAndDelete(ctx, sourceID, targetID, true)
+}
+
+// moveAndDelete moves all content and child categories of id to targetID and then
+// deletes id, all in one transaction. When redirect is set, the old slug (and any
+// slugs that already redirected to it) are pointed at the target.
+func (r *categoryRepository) moveAndDelete(ctx context.Context, id, targetID int64, redirect bool) error {
+	if id == targetID {
+		return ErrInvalidCategoryTarget
+	}
+
+	source, err := r.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := r.GetByID(ctx, targetID); err != nil {
+		return err
+	}
+
+	// Re-parenting children onto one of their own descendants would create a cycle
+	var inSubtree int
+	err = r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM (`+categoryTreeQuery("id = ?")+`) WHERE id = ?`,
+		id, targetID).Scan(&inSubtree)
+	if err != nil {
+		return err
+	}
+	if inSubtree > 0 {
+		return ErrInvalidCategoryTarget
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`UPDATE articles SET category_id = ?, updated_at = CURRENT_TIMESTAMP WHERE category_id = ?`,
+		`UPDATE documents SET category_id = ?, updated_at = CURRENT_TIMESTAMP WHERE category_id = ?`,
+		`UPDATE media_items SET category_id = ?, updated_at = CURRENT_TIMESTAMP WHERE category_id = ?`,
+		`UPDATE categories SET parent_id = ?, updated_at = CURRENT_TIMESTAMP WHERE parent_id = ?`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt, targetID, id); err != nil {
+			return err
+		}
+	}
+
+	if redirect {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE slug_redirects SET target_id = ? WHERE entity = 'category' AND target_id = ?`,
+			targetID, id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO slug_redirects (entity, old_slug, target_id) VALUES ('category', ?, ?)
+			 ON CONFLICT(entity, old_slug) DO UPDATE SET target_id = excluded.target_id`,
+			source.Slug, targetID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM categories WHERE id = ?`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 type TagRepository interface {
 	Create(ctx context.Context, tag *models.Tag) error
 	GetByID(ctx context.Context, id int64) (*models.Tag, error)
 	GetBySlug(ctx context.Context, slug string) (*models.Tag, error)
+	GetByName(ctx context.Context, name string) (*models.Tag, error)
+	Update(ctx context.Context, tag *models.Tag) error
 	Delete(ctx context.Context, id int64) error
 	List(ctx context.Context, page, pageSize int) ([]*models.Tag, int, error)
 	GetAll(ctx context.Context) ([]*models.Tag, error)
+	ListWithUsage(ctx context.Context, publishedOnly bool, sortBy string, limit int) ([]*models.TagUsage, error)
+	Merge(ctx context.Context, sourceID, targetID int64) error
+	DeleteUnused(ctx context.Context) (int64, error)
 }
 
+// ErrInvalidTagTarget is returned when a tag is merged into itself
+var ErrInvalidTagTarget = errors.New("cannot merge a tag into itself")
+
 type tagRepository struct {
 	db *sql.DB
 }
@@ -310,11 +478,41 @@ func (r *tagRepository) GetBySlug(ctx context.Context, slug string) (*models.Tag
 	return tag, nil
 }
 
-func (r *tagRepository) Delete(ctx context.Context, id int64) error {
-	_, err := r.db.ExecContext(ctx, `DELETE FROM tags WHERE id = ?`, id)
+func (r *tagRepository) GetByName(ctx context.Context, name string) (*models.Tag, error) {
+	tag := &models.Tag{}
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, name, slug, created_at FROM tags WHERE name = ?`, name).Scan(
+		&tag.ID, &tag.Name, &tag.Slug, &tag.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+func (r *tagRepository) Update(ctx context.Context, tag *models.Tag) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE tags SET name = ?, slug = ? WHERE id = ?`,
+		tag.Name, tag.Slug, tag.ID)
 	return err
 }
 
+// Delete removes the tag together with the slug redirects pointing at it
+func (r *tagRepository) Delete(ctx context.Context, id int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM slug_redirects WHERE entity = 'tag' AND target_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (r *tagRepository) List(ctx context.Context, page, pageSize int) ([]*models.Tag, int, error) {
 	offset := (page - 1) * pageSize
 
@@ -363,3 +561,111 @@ func (r *tagRepository) GetAll(ctx context.Context) ([]*models.Tag, error) {
 
 	return tags, rows.Err()
 }
+
+// ListWithUsage returns tags with their article counts. sortBy is "popular" for
+// most-used first, anything else sorts by name. limit <= 0 means no limit.
+func (r *tagRepository) ListWithUsage(ctx context.Context, publishedOnly bool, sortBy string, limit int) ([]*models.TagUsage, error) {
+	join := `LEFT JOIN article_tags at ON at.tag_id = t.id`
+	if publishedOnly {
+		join = `INNER JOIN article_tags at ON at.tag_id = t.id
+		         INNER JOIN articles a ON a.id = at.article_id AND a.status = 'published'`
+	}
+
+	orderBy := "t.name"
+	if sortBy == "popular" {
+		orderBy = "article_count DESC, t.name"
+	}
+
+	query := `SELECT t.id, t.name, t.slug, t.created_at, COUNT(at.article_id) AS article_count 
+	          FROM tags t ` + join + ` 
+	          GROUP BY t.id ORDER BY ` + orderBy
+	args := []interface{}{}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]*models.TagUsage, 0)
+	for rows.Next() {
+		tag := &models.TagUsage{}
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.CreatedAt, &tag.ArticleCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// Merge re-points every article of sourceID to targetID, redirects the source
+// slug to the target and deletes the source tag in a single transaction.
+func (r *tagRepository) Merge(ctx context.Context, sourceID, targetID int64) error {
+	if sourceID == targetID {
+		return ErrInvalidTagTarget
+	}
+
+	source, err := r.GetByID(ctx, sourceID)
+	if err != nil {
+		return err
+	}
+	if _, err := r.GetByID(ctx, targetID); err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`INSERT OR IGNORE INTO article_tags (article_id, tag_id) 
+		  SELECT article_id, ? FROM article_tags WHERE tag_id = ?`, []interface{}{targetID, sourceID}},
+		{`DELETE FROM article_tags WHERE tag_id = ?`, []interface{}{sourceID}},
+		{`UPDATE slug_redirects SET target_id = ? WHERE entity = 'tag' AND target_id = ?`, []interface{}{targetID, sourceID}},
+		{`INSERT INTO slug_redirects (entity, old_slug, target_id) VALUES ('tag', ?, ?)
+		  ON CONFLICT(entity, old_slug) DO UPDATE SET target_id = excluded.target_id`, []interface{}{source.Slug, targetID}},
+		{`DELETE FROM tags WHERE id = ?`, []interface{}{sourceID}},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteUnused removes tags that are not attached to any article, and the
+// slug redirects pointing at them
+func (r *tagRepository) DeleteUnused(ctx context.Context) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`DELETE FROM tags WHERE id NOT IN (SELECT DISTINCT tag_id FROM article_tags)`)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM slug_redirects WHERE entity = 'tag' AND target_id NOT IN (SELECT id FROM tags)`); err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return removed, tx.Commit()
+}
@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/models"
+)
+
+// StoredBlobRepository counts the references to each uploaded file, keyed by
+// the SHA-256 of its content
+type StoredBlobRepository interface {
+	GetBySHA256(ctx context.Context, sha256 string) (*models.StoredBlob, error)
+	Acquire(ctx context.Context, blob *models.StoredBlob) error
+	Release(ctx context.Context, url string) (int64, error)
+	ListReleased(ctx context.Context) ([]*models.StoredBlob, error)
+	Purge(ctx context.Context, url string, remove func() error) (bool, error)
+}
+
+type storedBlobRepository struct {
+	db *sql.DB
+}
+
+func NewStoredBlobRepository(db *sql.DB) StoredBlobRepository {
+	return &storedBlobRepository{db: db}
+}
+
+func (r *storedBlobRepository) GetBySHA256(ctx context.Context, sha256 string) (*models.StoredBlob, error) {
+	blob := &models.StoredBlob{}
+	err := r.db.QueryRowContext(ctx,
+		`SELECT sha256, url, size, mime_type, ref_count, created_at, updated_at
+		 FROM stored_blobs WHERE sha256 = ?`, sha256).Scan(
+		&blob.SHA256, &blob.URL, &blob.Size, &blob.MimeType, &blob.RefCount, &blob.CreatedAt, &blob.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// Acquire records blob with a single reference, or adds a reference when its
+// content is already stored. blob is updated from the stored row, so its URL
+// then points at the existing file.
+func (r *storedBlobRepository) Acquire(ctx context.Context, blob *models.StoredBlob) error {
+	now := time.Now()
+	return r.db.QueryRowContext(ctx,
+		`INSERT INTO stored_blobs (sha256, url, size, mime_type, ref_count, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, 1, ?, ?)
+		 ON CONFLICT(sha256) DO UPDATE SET ref_count = ref_count + 1, updated_at = excluded.updated_at
+		 RETURNING url, size, mime_type, ref_count, created_at, updated_at`,
+		blob.SHA256, blob.URL, blob.Size, blob.MimeType, now, now).Scan(
+		&blob.URL, &blob.Size, &blob.MimeType, &blob.RefCount, &blob.CreatedAt, &blob.UpdatedAt)
+}
+
+// Release drops one reference to the file at url and returns how many remain.
+// A file whose last reference goes is only marked released: its row stays
+// with no references until Purge removes it together with the stored object,
+// so an upload of the same content in between takes the file back instead of
+// racing its deletion. Files stored before content addressing have no row and
+// return sql.ErrNoRows.
+func (r *storedBlobRepository) Release(ctx context.Context, url string) (int64, error) {
+	var remaining int64
+	err := r.db.QueryRowContext(ctx,
+		`UPDATE stored_blobs SET ref_count = MAX(ref_count - 1, 0), updated_at = ?
+		 WHERE url = ? RETURNING ref_count`, time.Now(), url).Scan(&remaining)
+	return remaining, err
+}
+
+// ListReleased returns the files that no longer have any reference
+func (r *storedBlobRepository) ListReleased(ctx context.Context) ([]*models.StoredBlob, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT sha256, url, size, mime_type, ref_count, created_at, updated_at
+		 FROM stored_blobs WHERE ref_count <= 0 ORDER BY updated_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blobs := make([]*models.StoredBlob, 0)
+	for rows.Next() {
+		blob := &models.StoredBlob{}
+		if err := rows.Scan(&blob.SHA256, &blob.URL, &blob.Size, &blob.MimeType, &blob.RefCount, &blob.CreatedAt, &blob.UpdatedAt); err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, blob)
+	}
+	return blobs, rows.Err()
+}
+
+// Purge forgets the released file at url and calls remove to delete the
+// stored object. remove runs while the row is deleted but not yet committed,
+// so a concurrent Acquire of the same content waits for the database and then
+// stores the file anew. A file acquired again before Purge is left alone and
+// false returned; when remove fails the row is kept.
+func (r *storedBlobRepository) Purge(ctx context.Context, url string, remove func() error) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM stored_blobs WHERE url = ? AND ref_count <= 0`, url)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if err := remove(); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
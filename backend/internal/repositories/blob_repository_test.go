@@ -0,0 +1,114 @@
+package repositories_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+)
+
+// testDB opens a migrated database in a temp dir
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.Initialize(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestStoredBlobReferences(t *testing.T) {
+	ctx := context.Background()
+	blobs := database.NewRepositories(testDB(t)).Blobs
+	const first = "/static/uploads/media/2026/10/a.png"
+
+	acquire := func(url string) *models.StoredBlob {
+		t.Helper()
+		blob := &models.StoredBlob{SHA256: "abc123", URL: url, Size: 42, MimeType: "image/png"}
+		if err := blobs.Acquire(ctx, blob); err != nil {
+			t.Fatal(err)
+		}
+		return blob
+	}
+	release := func(want int64) {
+		t.Helper()
+		remaining, err := blobs.Release(ctx, first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if remaining != want {
+			t.Fatalf("references left = %d, want %d", remaining, want)
+		}
+	}
+	released := func() int {
+		t.Helper()
+		list, err := blobs.ListReleased(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(list)
+	}
+
+	if blob := acquire(first); blob.RefCount != 1 || blob.URL != first {
+		t.Fatalf("first upload = %d references at %s, want 1 at %s", blob.RefCount, blob.URL, first)
+	}
+	if blob := acquire("/static/uploads/articles/2026/10/b.png"); blob.RefCount != 2 || blob.URL != first {
+		t.Fatalf("same content = %d references at %s, want 2 at the first file", blob.RefCount, blob.URL)
+	}
+
+	release(1)
+	if n := released(); n != 0 {
+		t.Fatalf("%d files released while still referenced", n)
+	}
+	release(0)
+	release(0) // never below zero
+	if n := released(); n != 1 {
+		t.Fatalf("%d files released, want 1", n)
+	}
+	if _, err := blobs.GetBySHA256(ctx, "abc123"); err != nil {
+		t.Fatalf("released file forgotten before purge: %v", err)
+	}
+
+	// Uploading the content again takes the released file back
+	if blob := acquire("/static/uploads/media/2026/10/c.png"); blob.RefCount != 1 || blob.URL != first {
+		t.Fatalf("upload after release = %d references at %s, want 1 at the first file", blob.RefCount, blob.URL)
+	}
+	removed := false
+	purged, err := blobs.Purge(ctx, first, func() error { removed = true; return nil })
+	if err != nil || purged || removed {
+		t.Fatalf("purge of a referenced file = %v, %v, removed %v; want it left alone", purged, err, removed)
+	}
+
+	release(0)
+	failure := errors.New("storage unavailable")
+	if purged, err := blobs.Purge(ctx, first, func() error { return failure }); purged || !errors.Is(err, failure) {
+		t.Fatalf("purge with failing removal = %v, %v", purged, err)
+	}
+	if n := released(); n != 1 {
+		t.Fatalf("file forgotten although its removal failed")
+	}
+
+	purged, err = blobs.Purge(ctx, first, func() error { removed = true; return nil })
+	if err != nil || !purged || !removed {
+		t.Fatalf("purge = %v, %v, removed %v; want the file removed", purged, err, removed)
+	}
+	if _, err := blobs.GetBySHA256(ctx, "abc123"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("purged file still recorded: %v", err)
+	}
+	if _, err := blobs.Release(ctx, first); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("release of an unrecorded file = %v, want sql.ErrNoRows", err)
+	}
+
+	// A new upload of the content is stored anew
+	if blob := acquire("/static/uploads/media/2026/10/d.png"); blob.RefCount != 1 || blob.URL != "/static/uploads/media/2026/10/d.png" {
+		t.Fatalf("upload after purge = %d references at %s, want a new file", blob.RefCount, blob.URL)
+	}
+}
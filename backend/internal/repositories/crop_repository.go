@@ -0,0 +1,227 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/models"
+)
+
+type CropPresetRepository interface {
+	Create(ctx context.Context, preset *models.CropPreset) error
+	GetByID(ctx context.Context, id int64) (*models.CropPreset, error)
+	GetByName(ctx context.Context, name string) (*models.CropPreset, error)
+	List(ctx context.Context) ([]*models.CropPreset, error)
+	Update(ctx context.Context, preset *models.CropPreset) error
+	Delete(ctx context.Context, id int64) error
+}
+
+// cropPresetRepository keeps the preset table in memory for GetByName, which
+// every /img request calls. Its own writes drop the copy; presets are only
+// written through it.
+type cropPresetRepository struct {
+	db *sql.DB
+
+	mu     sync.Mutex
+	byName map[string]*models.CropPreset // nil until loaded
+}
+
+func NewCropPresetRepository(db *sql.DB) CropPresetRepository {
+	return &cropPresetRepository{db: db}
+}
+
+func (r *cropPresetRepository) Create(ctx context.Context, preset *models.CropPreset) error {
+	now := time.Now()
+	preset.CreatedAt = now
+	preset.UpdatedAt = now
+
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO crop_presets (name, description, width, height, created_at, updated_at) 
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		preset.Name, preset.Description, preset.Width, preset.Height, preset.CreatedAt, preset.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	r.invalidate()
+	preset.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *cropPresetRepository) invalidate() {
+	r.mu.Lock()
+	r.byName = nil
+	r.mu.Unlock()
+}
+
+func (r *cropPresetRepository) get(ctx context.Context, where string, arg interface{}) (*models.CropPreset, error) {
+	preset := &models.CropPreset{}
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, name, description, width, height, created_at, updated_at FROM crop_presets WHERE `+where, arg).Scan(
+		&preset.ID, &preset.Name, &preset.Description, &preset.Width, &preset.Height, &preset.CreatedAt, &preset.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return preset, nil
+}
+
+func (r *cropPresetRepository) GetByID(ctx context.Context, id int64) (*models.CropPreset, error) {
+	return r.get(ctx, "id = ?", id)
+}
+
+func (r *cropPresetRepository) GetByName(ctx context.Context, name string) (*models.CropPreset, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.byName == nil {
+		presets, err := r.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.byName = make(map[string]*models.CropPreset, len(presets))
+		for _, preset := range presets {
+			r.byName[preset.Name] = preset
+		}
+	}
+	preset, ok := r.byName[name]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *preset
+	return &copied, nil
+}
+
+func (r *cropPresetRepository) List(ctx context.Context) ([]*models.CropPreset, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, name, description, width, height, created_at, updated_at FROM crop_presets ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	presets := []*models.CropPreset{}
+	for rows.Next() {
+		preset := &models.CropPreset{}
+		if err := rows.Scan(&preset.ID, &preset.Name, &preset.Description, &preset.Width, &preset.Height,
+			&preset.CreatedAt, &preset.UpdatedAt); err != nil {
+			return nil, err
+		}
+		presets = append(presets, preset)
+	}
+	return presets, rows.Err()
+}
+
+func (r *cropPresetRepository) Update(ctx context.Context, preset *models.CropPreset) error {
+	preset.UpdatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE crop_presets SET name = ?, description = ?, width = ?, height = ?, updated_at = ? WHERE id = ?`,
+		preset.Name, preset.Description, preset.Width, preset.Height, preset.UpdatedAt, preset.ID)
+	if err != nil {
+		return err
+	}
+	r.invalidate()
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *cropPresetRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM crop_presets WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	r.invalidate()
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// FocalPointRepository stores the focal points editors set on uploaded
+// images, keyed by the /static/ URL of the image
+type FocalPointRepository interface {
+	Get(ctx context.Context, sourceURL string) (*models.FocalPoint, error)
+	GetMany(ctx context.Context, sourceURLs []string) (map[string]*models.FocalPoint, error)
+	Set(ctx context.Context, point *models.FocalPoint) error
+	Delete(ctx context.Context, sourceURL string) error
+}
+
+type focalPointRepository struct {
+	db *sql.DB
+}
+
+func NewFocalPointRepository(db *sql.DB) FocalPointRepository {
+	return &focalPointRepository{db: db}
+}
+
+func (r *focalPointRepository) Get(ctx context.Context, sourceURL string) (*models.FocalPoint, error) {
+	point := &models.FocalPoint{}
+	var updatedBy sql.NullInt64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT source_url, x, y, updated_by, updated_at FROM image_focal_points WHERE source_url = ?`, sourceURL).Scan(
+		&point.SourceURL, &point.X, &point.Y, &updatedBy, &point.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	point.UpdatedBy = updatedBy.Int64
+	return point, nil
+}
+
+func (r *focalPointRepository) GetMany(ctx context.Context, sourceURLs []string) (map[string]*models.FocalPoint, error) {
+	points := make(map[string]*models.FocalPoint)
+	if len(sourceURLs) == 0 {
+		return points, nil
+	}
+	placeholders := make([]string, len(sourceURLs))
+	args := make([]interface{}, len(sourceURLs))
+	for i, u := range sourceURLs {
+		placeholders[i] = "?"
+		args[i] = u
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT source_url, x, y, updated_by, updated_at FROM image_focal_points 
+		 WHERE source_url IN (`+strings.Join(placeholders, ",")+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		point := &models.FocalPoint{}
+		var updatedBy sql.NullInt64
+		if err := rows.Scan(&point.SourceURL, &point.X, &point.Y, &updatedBy, &point.UpdatedAt); err != nil {
+			return nil, err
+		}
+		point.UpdatedBy = updatedBy.Int64
+		points[point.SourceURL] = point
+	}
+	return points, rows.Err()
+}
+
+func (r *focalPointRepository) Set(ctx context.Context, point *models.FocalPoint) error {
+	point.UpdatedAt = time.Now()
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO image_focal_points (source_url, x, y, updated_by, updated_at) VALUES (?, ?, ?, ?, ?) 
+		 ON CONFLICT(source_url) DO UPDATE SET x = excluded.x, y = excluded.y, 
+		 updated_by = excluded.updated_by, updated_at = excluded.updated_at`,
+		point.SourceURL, point.X, point.Y, point.UpdatedBy, point.UpdatedAt)
+	return err
+}
+
+func (r *focalPointRepository) Delete(ctx context.Context, sourceURL string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM image_focal_points WHERE source_url = ?`, sourceURL)
+	return err
+}
@@ -0,0 +1,270 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/models"
+)
+
+// Types of relations between documents, read "document <type> related"
+const (
+	RelationAmends     = "amends"
+	RelationReplaces   = "replaces"
+	RelationGuides     = "guides" // guides or implements
+	RelationReferences = "references"
+)
+
+// RelationInverses names each type of relation as seen from the related
+// document
+var RelationInverses = map[string]string{
+	RelationAmends:     "amended_by",
+	RelationReplaces:   "replaced_by",
+	RelationGuides:     "guided_by",
+	RelationReferences: "referenced_by",
+}
+
+type DocumentRelationRepository interface {
+	Create(ctx context.Context, relation *models.DocumentRelation) error
+	GetByID(ctx context.Context, id int64) (*models.DocumentRelation, error)
+	// Find returns the relation of a type from documentID to relatedID
+	Find(ctx context.Context, documentID, relatedID int64, relationType string) (*models.DocumentRelation, error)
+	Delete(ctx context.Context, id int64) error
+	// ListRelated returns the documents related to a document in either
+	// direction. With a viewer, only published documents it may see are
+	// listed.
+	ListRelated(ctx context.Context, documentID int64, viewer *DocumentViewer) ([]models.RelatedDocument, error)
+	// Graph returns the documents reachable from a document through at most
+	// maxDepth relations, up to maxNodes of them, nearest first. With a
+	// viewer, only published documents it may see are reached.
+	Graph(ctx context.Context, documentID int64, maxDepth, maxNodes int, viewer *DocumentViewer) (*models.DocumentGraph, error)
+	// RepealReplaced marks the documents a published document replaces as
+	// repealed, returning how many were still in force. It does nothing
+	// while the document is not published.
+	RepealReplaced(ctx context.Context, documentID int64) (int64, error)
+}
+
+type documentRelationRepository struct {
+	db *sql.DB
+}
+
+func NewDocumentRelationRepository(db *sql.DB) DocumentRelationRepository {
+	return &documentRelationRepository{db: db}
+}
+
+func (r *documentRelationRepository) Create(ctx context.Context, relation *models.DocumentRelation) error {
+	relation.CreatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO document_relations (document_id, related_id, type, created_by, created_at) VALUES (?, ?, ?, ?, ?)`,
+		relation.DocumentID, relation.RelatedID, relation.Type, relation.CreatedBy, relation.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	relation.ID, err = result.LastInsertId()
+	return err
+}
+
+const documentRelationColumns = `id, document_id, related_id, type, created_by, created_at`
+
+func scanDocumentRelation(row rowScanner) (*models.DocumentRelation, error) {
+	relation := &models.DocumentRelation{}
+	err := row.Scan(&relation.ID, &relation.DocumentID, &relation.RelatedID, &relation.Type,
+		&relation.CreatedBy, &relation.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return relation, nil
+}
+
+func (r *documentRelationRepository) GetByID(ctx context.Context, id int64) (*models.DocumentRelation, error) {
+	return scanDocumentRelation(r.db.QueryRowContext(ctx,
+		`SELECT `+documentRelationColumns+` FROM document_relations WHERE id = ?`, id))
+}
+
+func (r *documentRelationRepository) Find(ctx context.Context, documentID, relatedID int64, relationType string) (*models.DocumentRelation, error) {
+	return scanDocumentRelation(r.db.QueryRowContext(ctx,
+		`SELECT `+documentRelationColumns+` FROM document_relations WHERE document_id = ? AND related_id = ? AND type = ?`,
+		documentID, relatedID, relationType))
+}
+
+func (r *documentRelationRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM document_relations WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *documentRelationRepository) ListRelated(ctx context.Context, documentID int64, viewer *DocumentViewer) ([]models.RelatedDocument, error) {
+	published := ""
+	var visibleArgs []interface{}
+	if viewer != nil {
+		published = ` AND documents.status = 'published'`
+		if visible, args := viewer.condition("documents"); visible != "" {
+			published += ` AND ` + visible
+			visibleArgs = args
+		}
+	}
+	// Outgoing relations first, then incoming ones, each oldest first
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT rel.id, rel.type, 0, documents.id, documents.title, documents.slug, documents.document_no,
+		 COALESCE((SELECT name FROM document_terms WHERE id = documents.type_id), ''), documents.issued_date,
+		 documents.status, `+validityStatus+`
+		 FROM document_relations rel JOIN documents ON documents.id = rel.related_id
+		 WHERE rel.document_id = ?`+published+`
+		 UNION ALL
+		 SELECT rel.id, rel.type, 1, documents.id, documents.title, documents.slug, documents.document_no,
+		 COALESCE((SELECT name FROM document_terms WHERE id = documents.type_id), ''), documents.issued_date,
+		 documents.status, `+validityStatus+`
+		 FROM document_relations rel JOIN documents ON documents.id = rel.document_id
+		 WHERE rel.related_id = ?`+published+`
+		 ORDER BY 3, 1`,
+		append(append(append([]interface{}{documentID}, visibleArgs...), documentID), visibleArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	related := []models.RelatedDocument{}
+	for rows.Next() {
+		var doc models.RelatedDocument
+		var inverse bool
+		if err := rows.Scan(&doc.RelationID, &doc.Relation, &inverse, &doc.ID, &doc.Title, &doc.Slug, &doc.DocumentNo,
+			&doc.TypeName, &doc.IssuedDate, &doc.Status, &doc.ValidityStatus); err != nil {
+			return nil, err
+		}
+		if inverse {
+			doc.Relation = RelationInverses[doc.Relation]
+		}
+		related = append(related, doc)
+	}
+	return related, rows.Err()
+}
+
+func (r *documentRelationRepository) Graph(ctx context.Context, documentID int64, maxDepth, maxNodes int, viewer *DocumentViewer) (*models.DocumentGraph, error) {
+	published := ""
+	var visibleArgs []interface{}
+	if viewer != nil {
+		published = ` AND d.status = 'published' AND o.status = 'published'`
+		for _, table := range []string{"d", "o"} {
+			if visible, args := viewer.condition(table); visible != "" {
+				published += ` AND ` + visible
+				visibleArgs = append(visibleArgs, args...)
+			}
+		}
+	}
+
+	depths := map[int64]int{documentID: 0}
+	order := []int64{documentID}
+	seenEdges := map[int64]bool{}
+	graph := &models.DocumentGraph{Nodes: []models.DocumentGraphNode{}, Edges: []models.DocumentGraphEdge{}}
+
+	// Breadth first, a level of relations at a time
+	frontier := []int64{documentID}
+	for depth := 1; depth <= maxDepth && len(frontier) > 0 && len(order) < maxNodes; depth++ {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(frontier)), ", ")
+		args := make([]interface{}, 0, 2*len(frontier))
+		for _, id := range frontier {
+			args = append(args, id)
+		}
+		args = append(append(args, args...), visibleArgs...)
+
+		rows, err := r.db.QueryContext(ctx,
+			`SELECT rel.id, rel.document_id, rel.related_id, rel.type
+			 FROM document_relations rel
+			 JOIN documents d ON d.id = rel.document_id JOIN documents o ON o.id = rel.related_id
+			 WHERE (rel.document_id IN (`+placeholders+`) OR rel.related_id IN (`+placeholders+`))`+published+`
+			 ORDER BY rel.id`, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		frontier = nil
+		for rows.Next() {
+			var id int64
+			var edge models.DocumentGraphEdge
+			if err := rows.Scan(&id, &edge.From, &edge.To, &edge.Type); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if seenEdges[id] {
+				continue
+			}
+			for _, node := range []int64{edge.From, edge.To} {
+				if _, ok := depths[node]; !ok && len(order) < maxNodes {
+					depths[node] = depth
+					order = append(order, node)
+					frontier = append(frontier, node)
+				}
+			}
+			// Edges to documents beyond maxNodes are left out
+			_, fromOK := depths[edge.From]
+			_, toOK := depths[edge.To]
+			if fromOK && toOK {
+				seenEdges[id] = true
+				graph.Edges = append(graph.Edges, edge)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(order)), ", ")
+	args := make([]interface{}, len(order))
+	for i, id := range order {
+		args[i] = id
+	}
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT documents.id, documents.title, documents.slug, documents.document_no,
+		 COALESCE((SELECT name FROM document_terms WHERE id = documents.type_id), ''), documents.issued_date, `+validityStatus+`
+		 FROM documents WHERE documents.id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodes := map[int64]models.DocumentGraphNode{}
+	for rows.Next() {
+		var node models.DocumentGraphNode
+		if err := rows.Scan(&node.ID, &node.Title, &node.Slug, &node.DocumentNo, &node.TypeName,
+			&node.IssuedDate, &node.ValidityStatus); err != nil {
+			return nil, err
+		}
+		node.Depth = depths[node.ID]
+		nodes[node.ID] = node
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, id := range order {
+		if node, ok := nodes[id]; ok {
+			graph.Nodes = append(graph.Nodes, node)
+		}
+	}
+	return graph, nil
+}
+
+func (r *documentRelationRepository) RepealReplaced(ctx context.Context, documentID int64) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE documents SET repealed = 1, updated_at = ?
+		 WHERE repealed = 0 AND id IN (SELECT related_id FROM document_relations WHERE document_id = ? AND type = ?)
+		 AND EXISTS (SELECT 1 FROM documents WHERE id = ? AND status = 'published')`,
+		time.Now(), documentID, RelationReplaces, documentID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
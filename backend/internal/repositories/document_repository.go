@@ -3,7 +3,12 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/thieugt95/portal-365/backend/internal/models"
 )
@@ -12,11 +17,118 @@ type DocumentRepository interface {
 	Create(ctx context.Context, doc *models.Document) error
 	GetByID(ctx context.Context, id int64) (*models.Document, error)
 	GetBySlug(ctx context.Context, slug string) (*models.Document, error)
+	GetByFilePath(ctx context.Context, filePath string) (*models.Document, error)
 	Update(ctx context.Context, doc *models.Document) error
 	Delete(ctx context.Context, id int64) error
-	List(ctx context.Context, status string, categoryID *int64, page, pageSize int) ([]models.Document, int, error)
-	ListPublished(ctx context.Context, categoryID *int64, page, pageSize int) ([]models.Document, int, error)
+	List(ctx context.Context, filter *DocumentFilter, page, pageSize int) ([]models.Document, int, error)
+	ListPublished(ctx context.Context, filter *DocumentFilter, page, pageSize int) ([]models.Document, int, error)
+	// PublishedFacets counts the published documents matching filter by
+	// type, authority, signer, validity and year of issue
+	PublishedFacets(ctx context.Context, filter *DocumentFilter) (*models.DocumentFacets, error)
 	IncrementViewCount(ctx context.Context, id int64) error
+	// RecordDownload counts a download of the document unless the same
+	// client downloaded it within window. It reports whether it counted.
+	RecordDownload(ctx context.Context, id int64, ipAddress, userAgent string, window time.Duration) (bool, error)
+	// AddVersion makes a newly uploaded file the document's current one,
+	// numbering the version after the latest. A file flagged for active
+	// content (securityFlags) takes the document back to draft.
+	AddVersion(ctx context.Context, version *models.DocumentVersion, securityFlags string) error
+	// ListVersions returns the versions of a document, newest first
+	ListVersions(ctx context.Context, documentID int64) ([]models.DocumentVersion, error)
+	GetVersion(ctx context.Context, documentID int64, version int) (*models.DocumentVersion, error)
+	// MoveFile points the document and its versions stored at oldURL to
+	// newURL, once the file has been copied there
+	MoveFile(ctx context.Context, documentID int64, oldURL, newURL string) error
+}
+
+// Validity statuses of a document
+const (
+	ValidityInForce         = "in_force"
+	ValidityExpired         = "expired"
+	ValidityNotYetEffective = "not_yet_effective"
+)
+
+// Visibility levels of a document
+const (
+	VisibilityPublic        = "public"
+	VisibilityAuthenticated = "authenticated" // signed-in users
+	VisibilityRoles         = "roles"         // users with one of the document's roles
+)
+
+// DocumentViewer is who documents are shown to. A zero viewer is an
+// anonymous visitor, who only sees public documents.
+type DocumentViewer struct {
+	UserID int64    // 0 when anonymous
+	Roles  []string // role names of the user
+	All    bool     // sees every document, as administrators do
+}
+
+// CanView reports whether the viewer may see a document
+func (v *DocumentViewer) CanView(doc *models.Document) bool {
+	switch {
+	case v.All || doc.Visibility == VisibilityPublic || doc.Visibility == "":
+		return true
+	case v.UserID == 0:
+		return false
+	case doc.Visibility == VisibilityAuthenticated:
+		return true
+	}
+	for _, role := range v.Roles {
+		for _, allowed := range doc.Roles {
+			if role == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// condition is the SQL condition selecting the rows of a documents table
+// the viewer may see, or "" when it sees them all. A nil viewer sees all.
+func (v *DocumentViewer) condition(table string) (string, []interface{}) {
+	switch {
+	case v == nil || v.All:
+		return "", nil
+	case v.UserID == 0:
+		return table + `.visibility = ?`, []interface{}{VisibilityPublic}
+	case len(v.Roles) == 0:
+		return table + `.visibility IN (?, ?)`, []interface{}{VisibilityPublic, VisibilityAuthenticated}
+	}
+	args := []interface{}{VisibilityPublic, VisibilityAuthenticated, VisibilityRoles}
+	for _, role := range v.Roles {
+		args = append(args, role)
+	}
+	return `(` + table + `.visibility IN (?, ?) OR ` + table + `.visibility = ? AND EXISTS (
+		SELECT 1 FROM document_roles dr JOIN roles r ON r.id = dr.role_id 
+		WHERE dr.document_id = ` + table + `.id AND r.name IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(v.Roles)), ", ") + `)))`, args
+}
+
+// DocumentFilter narrows document listings. Zero values match everything.
+type DocumentFilter struct {
+	Status             string
+	Viewer             *DocumentViewer // only documents visible to the viewer; published listings default to anonymous
+	CategoryID         *int64
+	IncludeDescendants bool // Match documents in child categories of CategoryID too
+	TypeID             *int64
+	AuthorityID        *int64
+	SignerID           *int64
+	Validity           string // in_force, expired or not_yet_effective
+	DocumentNo         string // exact document number, ignoring ASCII case and surrounding spaces
+	Year               int    // year of issue
+	Issued             DateRange
+	Effective          DateRange
+	Expiry             DateRange
+	// Query is searched in the title, description, number and extracted
+	// text, ignoring diacritics. Words must all appear; "quoted phrases"
+	// must appear as written. Results come best match first, with a snippet.
+	Query string
+}
+
+// DateRange matches dates from From to To, both included. A nil bound is
+// open; only the calendar date of the bounds counts.
+type DateRange struct {
+	From *time.Time
+	To   *time.Time
 }
 
 type documentRepository struct {
@@ -27,77 +139,205 @@ func NewDocumentRepository(db *sql.DB) DocumentRepository {
 	return &documentRepository{db: db}
 }
 
+// Create inserts a document along with its first version
 func (r *documentRepository) Create(ctx context.Context, doc *models.Document) error {
 	now := time.Now()
 	doc.CreatedAt = now
 	doc.UpdatedAt = now
+	doc.Version = 1
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	result, err := r.db.ExecContext(ctx,
+	result, err := tx.ExecContext(ctx,
 		`INSERT INTO documents (title, slug, description, category_id, file_path, 
-		 file_size, mime_type, document_no, issued_date, uploaded_by, status, published_at, 
-		 created_at, updated_at) 
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		 file_size, mime_type, document_no, issued_date, type_id, authority_id, signer_id, 
+		 effective_date, expiry_date, repealed, visibility, uploaded_by, status, security_flags, published_at, 
+		 version, created_at, updated_at) 
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		doc.Title, doc.Slug, doc.Description, doc.CategoryID, doc.FilePath,
-		doc.FileSize, doc.MimeType, doc.DocumentNo, doc.IssuedDate, doc.UploadedBy,
-		doc.Status, doc.PublishedAt, doc.CreatedAt, doc.UpdatedAt)
+		doc.FileSize, doc.MimeType, doc.DocumentNo, doc.IssuedDate, doc.TypeID, doc.AuthorityID, doc.SignerID,
+		sqlDate(doc.EffectiveDate), sqlDate(doc.ExpiryDate), doc.Repealed, documentVisibility(doc), doc.UploadedBy,
+		doc.Status, doc.SecurityFlags, doc.PublishedAt, doc.Version, doc.CreatedAt, doc.UpdatedAt)
 	if err != nil {
 		return err
 	}
 
 	doc.ID, err = result.LastInsertId()
-	return err
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO document_versions (document_id, version, file_path, file_size, mime_type, sha256, uploaded_by, created_at) 
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		doc.ID, doc.Version, doc.FilePath, doc.FileSize, doc.MimeType, doc.SHA256, doc.UploadedBy, doc.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if err := setDocumentRoles(ctx, tx, doc); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return reindexDocument(ctx, r.db, doc.ID)
 }
 
-func (r *documentRepository) GetByID(ctx context.Context, id int64) (*models.Document, error) {
-	doc := &models.Document{}
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, title, slug, description, category_id, file_path, file_size, 
-		 mime_type, document_no, issued_date, uploaded_by, view_count, download_count, status, published_at, 
-		 created_at, updated_at 
-		 FROM documents WHERE id = ?`, id).Scan(
-		&doc.ID, &doc.Title, &doc.Slug, &doc.Description, &doc.CategoryID, &doc.FilePath,
-		&doc.FileSize, &doc.MimeType, &doc.DocumentNo, &doc.IssuedDate,
-		&doc.UploadedBy, &doc.ViewCount, &doc.DownloadCount, &doc.Status, &doc.PublishedAt,
-		&doc.CreatedAt, &doc.UpdatedAt)
-	if err != nil {
-		return nil, err
+// documentVisibility is the visibility a document is saved with, public
+// unless set
+func documentVisibility(doc *models.Document) string {
+	if doc.Visibility == "" {
+		return VisibilityPublic
 	}
-	return doc, nil
+	return doc.Visibility
 }
 
-func (r *documentRepository) GetBySlug(ctx context.Context, slug string) (*models.Document, error) {
+// setDocumentRoles replaces the roles that may see a document. Only
+// documents visible to roles keep any.
+func setDocumentRoles(ctx context.Context, tx *sql.Tx, doc *models.Document) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM document_roles WHERE document_id = ?`, doc.ID); err != nil {
+		return err
+	}
+	if doc.Visibility != VisibilityRoles {
+		return nil
+	}
+	for _, roleID := range doc.RoleIDs {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR IGNORE INTO document_roles (document_id, role_id) VALUES (?, ?)`, doc.ID, roleID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlDate stores a calendar date as YYYY-MM-DD, so that it compares with
+// date('now') and with the bounds of a DateRange
+func sqlDate(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.Format("2006-01-02")
+}
+
+// validityStatus computes the validity status of a document
+const validityStatus = `CASE WHEN documents.repealed OR documents.expiry_date <= date('now', 'localtime') THEN 'expired' 
+	WHEN documents.effective_date > date('now', 'localtime') THEN 'not_yet_effective' ELSE 'in_force' END`
+
+// documentColumns are the columns scanDocument reads. They are qualified
+// because searches join documents_fts, which has columns of the same names.
+const documentColumns = `documents.id, documents.title, documents.slug, documents.description, documents.category_id, 
+	documents.file_path, documents.file_size, documents.mime_type, documents.document_no, documents.issued_date, 
+	documents.uploaded_by, documents.view_count, documents.download_count, documents.status, documents.security_flags, 
+	documents.published_at, documents.created_at, documents.updated_at, documents.version, 
+	COALESCE((SELECT v.sha256 FROM document_versions v WHERE v.document_id = documents.id AND v.version = documents.version), ''), 
+	documents.type_id, COALESCE((SELECT name FROM document_terms WHERE id = documents.type_id), ''), 
+	documents.authority_id, COALESCE((SELECT name FROM document_terms WHERE id = documents.authority_id), ''), 
+	documents.signer_id, COALESCE((SELECT name FROM document_terms WHERE id = documents.signer_id), ''), 
+	documents.effective_date, documents.expiry_date, documents.repealed, ` + validityStatus + `, documents.visibility, 
+	(SELECT json_group_array(r.id) FROM document_roles dr JOIN roles r ON r.id = dr.role_id WHERE dr.document_id = documents.id), 
+	(SELECT json_group_array(r.name) FROM document_roles dr JOIN roles r ON r.id = dr.role_id WHERE dr.document_id = documents.id)`
+
+// scanDocument reads documentColumns into doc, followed by any extra columns
+func scanDocument(row rowScanner, doc *models.Document, extra ...interface{}) error {
+	var roleIDs, roles string
+	dest := []interface{}{&doc.ID, &doc.Title, &doc.Slug, &doc.Description, &doc.CategoryID,
+		&doc.FilePath, &doc.FileSize, &doc.MimeType, &doc.DocumentNo, &doc.IssuedDate,
+		&doc.UploadedBy, &doc.ViewCount, &doc.DownloadCount, &doc.Status, &doc.SecurityFlags,
+		&doc.PublishedAt, &doc.CreatedAt, &doc.UpdatedAt, &doc.Version, &doc.SHA256,
+		&doc.TypeID, &doc.TypeName, &doc.AuthorityID, &doc.AuthorityName, &doc.SignerID, &doc.SignerName,
+		&doc.EffectiveDate, &doc.ExpiryDate, &doc.Repealed, &doc.ValidityStatus, &doc.Visibility, &roleIDs, &roles}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(roleIDs), &doc.RoleIDs); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(roles), &doc.Roles)
+}
+
+func (r *documentRepository) getBy(ctx context.Context, condition string, arg interface{}) (*models.Document, error) {
 	doc := &models.Document{}
-	err := r.db.QueryRowContext(ctx,
-		`SELECT id, title, slug, description, category_id, file_path, file_size, 
-		 mime_type, document_no, issued_date, uploaded_by, view_count, download_count, status, published_at, 
-		 created_at, updated_at 
-		 FROM documents WHERE slug = ?`, slug).Scan(
-		&doc.ID, &doc.Title, &doc.Slug, &doc.Description, &doc.CategoryID, &doc.FilePath,
-		&doc.FileSize, &doc.MimeType, &doc.DocumentNo, &doc.IssuedDate,
-		&doc.UploadedBy, &doc.ViewCount, &doc.DownloadCount, &doc.Status, &doc.PublishedAt,
-		&doc.CreatedAt, &doc.UpdatedAt)
+	err := scanDocument(r.db.QueryRowContext(ctx, `SELECT `+documentColumns+` FROM documents WHERE `+condition, arg), doc)
 	if err != nil {
 		return nil, err
 	}
 	return doc, nil
 }
 
+func (r *documentRepository) GetByID(ctx context.Context, id int64) (*models.Document, error) {
+	return r.getBy(ctx, `id = ?`, id)
+}
+
+func (r *documentRepository) GetBySlug(ctx context.Context, slug string) (*models.Document, error) {
+	return r.getBy(ctx, `slug = ?`, slug)
+}
+
+// GetByFilePath returns the oldest document serving the file at filePath
+func (r *documentRepository) GetByFilePath(ctx context.Context, filePath string) (*models.Document, error) {
+	return r.getBy(ctx, `file_path = ? ORDER BY id LIMIT 1`, filePath)
+}
+
+// Update saves a document's metadata. The file only changes through
+// AddVersion.
 func (r *documentRepository) Update(ctx context.Context, doc *models.Document) error {
 	doc.UpdatedAt = time.Now()
 
-	_, err := r.db.ExecContext(ctx,
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
 		`UPDATE documents SET title = ?, slug = ?, description = ?, category_id = ?, 
-		 file_path = ?, file_size = ?, mime_type = ?, document_no = ?, 
-		 issued_date = ?, status = ?, published_at = ?, updated_at = ? 
+		 document_no = ?, issued_date = ?, type_id = ?, authority_id = ?, signer_id = ?, 
+		 effective_date = ?, expiry_date = ?, repealed = ?, visibility = ?, status = ?, published_at = ?, updated_at = ? 
 		 WHERE id = ?`,
-		doc.Title, doc.Slug, doc.Description, doc.CategoryID, doc.FilePath,
-		doc.FileSize, doc.MimeType, doc.DocumentNo, doc.IssuedDate, doc.Status,
+		doc.Title, doc.Slug, doc.Description, doc.CategoryID,
+		doc.DocumentNo, doc.IssuedDate, doc.TypeID, doc.AuthorityID, doc.SignerID,
+		sqlDate(doc.EffectiveDate), sqlDate(doc.ExpiryDate), doc.Repealed, documentVisibility(doc), doc.Status,
 		doc.PublishedAt, doc.UpdatedAt, doc.ID)
-	return err
+	if err != nil {
+		return err
+	}
+	if err := setDocumentRoles(ctx, tx, doc); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return reindexDocument(ctx, r.db, doc.ID)
 }
 
 func (r *documentRepository) Delete(ctx context.Context, id int64) error {
-	result, err := r.db.ExecContext(ctx, `DELETE FROM documents WHERE id = ?`, id)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM document_texts WHERE document_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM document_downloads WHERE document_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM document_versions WHERE document_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM document_relations WHERE document_id = ? OR related_id = ?`, id, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM document_roles WHERE document_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM documents_fts WHERE rowid = ?`, id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM documents WHERE id = ?`, id)
 	if err != nil {
 		return err
 	}
@@ -109,40 +349,171 @@ func (r *documentRepository) Delete(ctx context.Context, id int64) error {
 	if rows == 0 {
 		return sql.ErrNoRows
 	}
-	return nil
+	return tx.Commit()
 }
 
-func (r *documentRepository) List(ctx context.Context, status string, categoryID *int64, page, pageSize int) ([]models.Document, int, error) {
-	offset := (page - 1) * pageSize
+// reindexDocument refreshes a document's row in documents_fts from the
+// document and its extracted text
+func reindexDocument(ctx context.Context, db *sql.DB, id int64) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM documents_fts WHERE rowid = ?`, id); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO documents_fts (rowid, title, description, document_no, content) 
+		 SELECT d.id, d.title, COALESCE(d.description, ''), COALESCE(d.document_no, ''), COALESCE(t.content, '') 
+		 FROM documents d LEFT JOIN document_texts t ON t.document_id = d.id 
+		 WHERE d.id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *documentRepository) List(ctx context.Context, filter *DocumentFilter, page, pageSize int) ([]models.Document, int, error) {
+	return r.list(ctx, filter, "documents.created_at DESC", page, pageSize)
+}
+
+func (r *documentRepository) ListPublished(ctx context.Context, filter *DocumentFilter, page, pageSize int) ([]models.Document, int, error) {
+	published := DocumentFilter{}
+	if filter != nil {
+		published = *filter
+	}
+	published.Status = "published"
+	if published.Viewer == nil {
+		published.Viewer = &DocumentViewer{}
+	}
+	documents, total, err := r.list(ctx, &published, "documents.published_at DESC", page, pageSize)
+	for i := range documents {
+		documents[i].TextStatus = ""
+	}
+	return documents, total, err
+}
+
+// Snippet markers, swapped for <mark> once the snippet is HTML-escaped
+const (
+	snippetOpen  = "\uE000"
+	snippetClose = "\uE001"
+)
+
+// documentCondition is one condition of a document listing. Facet names
+// the facet it filters, which leaves it out when counting that facet.
+type documentCondition struct {
+	facet string
+	sql   string
+	args  []interface{}
+}
+
+// documentQuery is the FROM clause and the conditions of a filtered
+// document listing
+type documentQuery struct {
+	from       string
+	conditions []documentCondition
+	search     bool
+}
+
+func newDocumentQuery(filter *DocumentFilter) *documentQuery {
+	q := &documentQuery{from: ` FROM documents`}
+	add := func(facet, sql string, args ...interface{}) {
+		q.conditions = append(q.conditions, documentCondition{facet: facet, sql: sql, args: args})
+	}
+
+	if match := ftsQuery(filter.Query); match != "" {
+		q.from += ` INNER JOIN documents_fts ON documents_fts.rowid = documents.id`
+		q.search = true
+		add("", `documents_fts MATCH ?`, match)
+	}
+	if filter.Status != "" {
+		add("", `documents.status = ?`, filter.Status)
+	}
+	if visible, args := filter.Viewer.condition("documents"); visible != "" {
+		add("", visible, args...)
+	}
+	if filter.CategoryID != nil {
+		add("", strings.TrimPrefix(categoryCondition(filter.IncludeDescendants), " AND "), *filter.CategoryID)
+	}
+	if filter.TypeID != nil {
+		add(TermType, `documents.type_id = ?`, *filter.TypeID)
+	}
+	if filter.AuthorityID != nil {
+		add(TermAuthority, `documents.authority_id = ?`, *filter.AuthorityID)
+	}
+	if filter.SignerID != nil {
+		add(TermSigner, `documents.signer_id = ?`, *filter.SignerID)
+	}
+	if filter.Validity != "" {
+		add("validity", validityStatus+` = ?`, filter.Validity)
+	}
+	if no := strings.TrimSpace(filter.DocumentNo); no != "" {
+		add("", `TRIM(documents.document_no) = ? COLLATE NOCASE`, no)
+	}
+	if filter.Year != 0 {
+		add("year", `substr(documents.issued_date, 1, 4) = ?`, fmt.Sprintf("%04d", filter.Year))
+	}
+	// Issue dates are stored with their time, the others as dates; the
+	// first ten characters are the date either way
+	for column, dates := range map[string]DateRange{
+		"issued_date":    filter.Issued,
+		"effective_date": filter.Effective,
+		"expiry_date":    filter.Expiry,
+	} {
+		if dates.From != nil {
+			add("", `substr(documents.`+column+`, 1, 10) >= ?`, sqlDate(dates.From))
+		}
+		if dates.To != nil {
+			add("", `substr(documents.`+column+`, 1, 10) <= ?`, sqlDate(dates.To))
+		}
+	}
+	return q
+}
 
-	// Build query
-	query := `SELECT id, title, slug, description, category_id, file_path, file_size, 
-	          mime_type, document_no, issued_date, uploaded_by, view_count, download_count, status, published_at, 
-	          created_at, updated_at FROM documents WHERE 1=1`
-	countQuery := `SELECT COUNT(*) FROM documents WHERE 1=1`
+// where returns the WHERE clause and its arguments, leaving out the
+// conditions of the given facet
+func (q *documentQuery) where(exceptFacet string) (string, []interface{}) {
+	where := ` WHERE 1=1`
 	args := []interface{}{}
+	for _, condition := range q.conditions {
+		if exceptFacet != "" && condition.facet == exceptFacet {
+			continue
+		}
+		where += ` AND ` + condition.sql
+		args = append(args, condition.args...)
+	}
+	return where, args
+}
 
-	if status != "" {
-		query += " AND status = ?"
-		countQuery += " AND status = ?"
-		args = append(args, status)
+// list runs a document listing
+func (r *documentRepository) list(ctx context.Context, filter *DocumentFilter, order string, page, pageSize int) ([]models.Document, int, error) {
+	if filter == nil {
+		filter = &DocumentFilter{}
 	}
+	offset := (page - 1) * pageSize
 
-	if categoryID != nil {
-		query += " AND category_id = ?"
-		countQuery += " AND category_id = ?"
-		args = append(args, *categoryID)
+	q := newDocumentQuery(filter)
+	where, args := q.where("")
+	snippet := `''`
+	if q.search {
+		snippet = `snippet(documents_fts, -1, '` + snippetOpen + `', '` + snippetClose + `', '…', 24)`
+		// Title and number matches count for more than matches in the text
+		order = `bm25(documents_fts, 10.0, 4.0, 10.0, 1.0), ` + order
 	}
 
 	// Get total count
 	var total int
-	err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&total)
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*)`+q.from+where, args...).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	// Get documents
-	query += " ORDER BY created_at DESC LIMIT ? OFFSET ?"
+	query := `SELECT ` + documentColumns + `, 
+	          COALESCE((SELECT status FROM document_texts WHERE document_id = documents.id), ''), ` + snippet +
+		q.from + where + ` ORDER BY ` + order + ` LIMIT ? OFFSET ?`
 	args = append(args, pageSize, offset)
 
 	rows, err := r.db.QueryContext(ctx, query, args...)
@@ -154,63 +525,120 @@ func (r *documentRepository) List(ctx context.Context, status string, categoryID
 	documents := []models.Document{}
 	for rows.Next() {
 		var doc models.Document
-		if err := rows.Scan(&doc.ID, &doc.Title, &doc.Slug, &doc.Description, &doc.CategoryID,
-			&doc.FilePath, &doc.FileSize, &doc.MimeType, &doc.DocumentNo,
-			&doc.IssuedDate, &doc.UploadedBy, &doc.ViewCount, &doc.DownloadCount, &doc.Status, &doc.PublishedAt,
-			&doc.CreatedAt, &doc.UpdatedAt); err != nil {
+		if err := scanDocument(rows, &doc, &doc.TextStatus, &doc.Snippet); err != nil {
 			return nil, 0, err
 		}
+		doc.Snippet = markSnippet(doc.Snippet)
 		documents = append(documents, doc)
 	}
 
 	return documents, total, rows.Err()
 }
 
-func (r *documentRepository) ListPublished(ctx context.Context, categoryID *int64, page, pageSize int) ([]models.Document, int, error) {
-	offset := (page - 1) * pageSize
-
-	query := `SELECT id, title, slug, description, category_id, file_path, file_size, 
-	          mime_type, document_no, issued_date, uploaded_by, view_count, download_count, status, published_at, 
-	          created_at, updated_at FROM documents WHERE status = 'published'`
-	countQuery := `SELECT COUNT(*) FROM documents WHERE status = 'published'`
-	args := []interface{}{}
-
-	if categoryID != nil {
-		query += " AND category_id = ?"
-		countQuery += " AND category_id = ?"
-		args = append(args, *categoryID)
+func (r *documentRepository) PublishedFacets(ctx context.Context, filter *DocumentFilter) (*models.DocumentFacets, error) {
+	published := DocumentFilter{}
+	if filter != nil {
+		published = *filter
+	}
+	published.Status = "published"
+	if published.Viewer == nil {
+		published.Viewer = &DocumentViewer{}
+	}
+	q := newDocumentQuery(&published)
+
+	facets := &models.DocumentFacets{}
+	var err error
+	for kind, counts := range map[string]*[]models.FacetCount{
+		TermType:      &facets.Types,
+		TermAuthority: &facets.Authorities,
+		TermSigner:    &facets.Signers,
+	} {
+		where, args := q.where(kind)
+		*counts, err = r.facet(ctx,
+			`SELECT t.id, t.name, COUNT(*)`+q.from+` INNER JOIN document_terms t ON t.id = documents.`+TermKinds[kind]+
+				where+` GROUP BY t.id ORDER BY t.sort_order, t.name`, args)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Get total count
-	var total int
-	err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&total)
+	where, args := q.where("validity")
+	facets.Validity, err = r.facet(ctx,
+		`SELECT `+validityStatus+` AS validity, '', COUNT(*)`+q.from+where+` GROUP BY validity 
+		 ORDER BY CASE validity WHEN 'in_force' THEN 0 WHEN 'not_yet_effective' THEN 1 ELSE 2 END`, args)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	// Get documents
-	query += " ORDER BY published_at DESC LIMIT ? OFFSET ?"
-	args = append(args, pageSize, offset)
+	where, args = q.where("year")
+	facets.Years, err = r.facet(ctx,
+		`SELECT substr(documents.issued_date, 1, 4) AS year, '', COUNT(*)`+q.from+where+
+			` AND documents.issued_date IS NOT NULL GROUP BY year ORDER BY year DESC`, args)
+	if err != nil {
+		return nil, err
+	}
+	return facets, nil
+}
 
+// facet runs a facet query selecting the value, label and count of each row
+func (r *documentRepository) facet(ctx context.Context, query string, args []interface{}) ([]models.FacetCount, error) {
 	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer rows.Close()
 
-	documents := []models.Document{}
+	counts := []models.FacetCount{}
 	for rows.Next() {
-		var doc models.Document
-		if err := rows.Scan(&doc.ID, &doc.Title, &doc.Slug, &doc.Description, &doc.CategoryID,
-			&doc.FilePath, &doc.FileSize, &doc.MimeType, &doc.DocumentNo,
-			&doc.IssuedDate, &doc.UploadedBy, &doc.ViewCount, &doc.DownloadCount, &doc.Status, &doc.PublishedAt,
-			&doc.CreatedAt, &doc.UpdatedAt); err != nil {
-			return nil, 0, err
+		var count models.FacetCount
+		if err := rows.Scan(&count.Value, &count.Label, &count.Count); err != nil {
+			return nil, err
 		}
-		documents = append(documents, doc)
+		counts = append(counts, count)
 	}
+	return counts, rows.Err()
+}
 
-	return documents, total, rows.Err()
+// ftsQuery turns a search box query into an FTS5 query. Every word and
+// "quoted phrase" is quoted as a phrase so that FTS5 operators and
+// punctuation in the input are taken literally; a document number such as
+// 12/2024/TT-BQP becomes the phrase of its parts. It returns "" for input
+// with nothing searchable.
+func ftsQuery(q string) string {
+	var terms []string
+	for i, part := range strings.Split(q, `"`) {
+		if i%2 == 1 {
+			// inside quotes
+			if searchable(part) {
+				terms = append(terms, `"`+part+`"`)
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			if searchable(word) {
+				terms = append(terms, `"`+word+`"`)
+			}
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// searchable reports whether s has a letter or digit for FTS5 to index
+func searchable(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsNumber(r)
+	}) >= 0
+}
+
+// markSnippet puts a snippet on one line, HTML-escapes it and highlights its
+// matches
+func markSnippet(snippet string) string {
+	if snippet == "" {
+		return ""
+	}
+	snippet = html.EscapeString(strings.Join(strings.Fields(snippet), " "))
+	snippet = strings.ReplaceAll(snippet, snippetOpen, "<mark>")
+	return strings.ReplaceAll(snippet, snippetClose, "</mark>")
 }
 
 func (r *documentRepository) IncrementViewCount(ctx context.Context, id int64) error {
@@ -218,3 +646,143 @@ func (r *documentRepository) IncrementViewCount(ctx context.Context, id int64) e
 		`UPDATE documents SET view_count = view_count + 1 WHERE id = ?`, id)
 	return err
 }
+
+func (r *documentRepository) RecordDownload(ctx context.Context, id int64, ipAddress, userAgent string, window time.Duration) (bool, error) {
+	since := fmt.Sprintf("-%d seconds", int64(window.Seconds()))
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM document_downloads WHERE document_id = ? AND downloaded_at <= datetime('now', ?)`,
+		id, since); err != nil {
+		return false, err
+	}
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO document_downloads (document_id, ip_address, user_agent) 
+		 SELECT ?, ?, ? WHERE NOT EXISTS (
+			SELECT 1 FROM document_downloads WHERE document_id = ? AND ip_address = ? AND user_agent = ?)`,
+		id, ipAddress, userAgent, id, ipAddress, userAgent)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE documents SET download_count = download_count + 1 WHERE id = ?`, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *documentRepository) AddVersion(ctx context.Context, version *models.DocumentVersion, securityFlags string) error {
+	version.CreatedAt = time.Now()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) + 1 FROM document_versions WHERE document_id = ?`,
+		version.DocumentID).Scan(&version.Version)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO document_versions (document_id, version, file_path, file_size, mime_type, sha256, change_note, uploaded_by, created_at) 
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		version.DocumentID, version.Version, version.FilePath, version.FileSize, version.MimeType,
+		version.SHA256, version.ChangeNote, version.UploadedBy, version.CreatedAt)
+	if err != nil {
+		return err
+	}
+	version.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	result, err = tx.ExecContext(ctx,
+		`UPDATE documents SET file_path = ?, file_size = ?, mime_type = ?, version = ?, security_flags = ?, 
+		 status = CASE WHEN ? != '' THEN 'draft' ELSE status END, updated_at = ? 
+		 WHERE id = ?`,
+		version.FilePath, version.FileSize, version.MimeType, version.Version, securityFlags,
+		securityFlags, version.CreatedAt, version.DocumentID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	version.Current = true
+	return tx.Commit()
+}
+
+const documentVersionColumns = `v.id, v.document_id, v.version, v.file_path, v.file_size, v.mime_type, v.sha256, 
+	v.change_note, v.uploaded_by, v.created_at, v.version = d.version`
+
+func scanDocumentVersion(row rowScanner, v *models.DocumentVersion) error {
+	return row.Scan(&v.ID, &v.DocumentID, &v.Version, &v.FilePath, &v.FileSize, &v.MimeType, &v.SHA256,
+		&v.ChangeNote, &v.UploadedBy, &v.CreatedAt, &v.Current)
+}
+
+func (r *documentRepository) ListVersions(ctx context.Context, documentID int64) ([]models.DocumentVersion, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+documentVersionColumns+` FROM document_versions v 
+		 INNER JOIN documents d ON d.id = v.document_id 
+		 WHERE v.document_id = ? ORDER BY v.version DESC`, documentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []models.DocumentVersion{}
+	for rows.Next() {
+		var v models.DocumentVersion
+		if err := scanDocumentVersion(rows, &v); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+func (r *documentRepository) GetVersion(ctx context.Context, documentID int64, version int) (*models.DocumentVersion, error) {
+	v := &models.DocumentVersion{}
+	err := scanDocumentVersion(r.db.QueryRowContext(ctx,
+		`SELECT `+documentVersionColumns+` FROM document_versions v 
+		 INNER JOIN documents d ON d.id = v.document_id 
+		 WHERE v.document_id = ? AND v.version = ?`, documentID, version), v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (r *documentRepository) MoveFile(ctx context.Context, documentID int64, oldURL, newURL string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE document_versions SET file_path = ? WHERE document_id = ? AND file_path = ?`,
+		newURL, documentID, oldURL); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE documents SET file_path = ? WHERE id = ? AND file_path = ?`,
+		newURL, documentID, oldURL); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
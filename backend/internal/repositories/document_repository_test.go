@@ -0,0 +1,84 @@
+package repositories_test
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/repositories"
+)
+
+func TestDocumentVisibility(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	if _, err := db.Exec(`INSERT INTO users (id, email, password_hash, full_name) VALUES (1, 'editor@example.com', '', 'Editor');
+		INSERT INTO categories (id, name, slug) VALUES (1, 'Documents', 'documents')`); err != nil {
+		t.Fatal(err)
+	}
+	documents := database.NewRepositories(db).Documents
+
+	// Roles 2 and 3 are the seeded Editor and Author
+	for _, doc := range []*models.Document{
+		{Title: "public", Visibility: repositories.VisibilityPublic},
+		{Title: "default"},
+		{Title: "authenticated", Visibility: repositories.VisibilityAuthenticated},
+		{Title: "editors", Visibility: repositories.VisibilityRoles, RoleIDs: []int64{2, 3}},
+		{Title: "no roles", Visibility: repositories.VisibilityRoles},
+	} {
+		doc.Slug, doc.CategoryID, doc.FilePath = strings.ReplaceAll(doc.Title, " ", "-"), 1, "/static/uploads/documents/"+doc.Title+".pdf"
+		doc.MimeType, doc.UploadedBy, doc.Status = "application/pdf", 1, "published"
+		if err := documents.Create(ctx, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		viewer *repositories.DocumentViewer
+		want   string
+	}{
+		{"anonymous", &repositories.DocumentViewer{}, "default, public"},
+		{"signed in", &repositories.DocumentViewer{UserID: 1}, "authenticated, default, public"},
+		{"signed in with an allowed role", &repositories.DocumentViewer{UserID: 1, Roles: []string{"Reviewer", "Author"}}, "authenticated, default, editors, public"},
+		{"signed in with other roles", &repositories.DocumentViewer{UserID: 1, Roles: []string{"Reviewer"}}, "authenticated, default, public"},
+		{"roles without a user", &repositories.DocumentViewer{Roles: []string{"Editor"}}, "default, public"},
+		{"administrator", &repositories.DocumentViewer{All: true}, "authenticated, default, editors, no roles, public"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listed, _, err := documents.List(ctx, &repositories.DocumentFilter{Viewer: tt.viewer}, 1, 20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := titles(listed); got != tt.want {
+				t.Errorf("listed %q, want %q", got, tt.want)
+			}
+
+			all, _, err := documents.List(ctx, nil, 1, 20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var viewable []models.Document
+			for _, doc := range all {
+				if tt.viewer.CanView(&doc) {
+					viewable = append(viewable, doc)
+				}
+			}
+			if got := titles(viewable); got != tt.want {
+				t.Errorf("CanView allows %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func titles(documents []models.Document) string {
+	names := make([]string, 0, len(documents))
+	for _, doc := range documents {
+		names = append(names, doc.Title)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/models"
+)
+
+// Kinds of document terms, each a vocabulary of its own
+const (
+	TermType      = "type"
+	TermAuthority = "authority"
+	TermSigner    = "signer"
+)
+
+// TermKinds maps each kind of term to the documents column referring to it
+var TermKinds = map[string]string{
+	TermType:      "type_id",
+	TermAuthority: "authority_id",
+	TermSigner:    "signer_id",
+}
+
+type DocumentTermRepository interface {
+	Create(ctx context.Context, term *models.DocumentTerm) error
+	GetByID(ctx context.Context, id int64) (*models.DocumentTerm, error)
+	GetByName(ctx context.Context, kind, name string) (*models.DocumentTerm, error)
+	// List returns the terms of a kind, or of every kind when kind is "",
+	// in their sort order
+	List(ctx context.Context, kind string) ([]*models.DocumentTerm, error)
+	Update(ctx context.Context, term *models.DocumentTerm) error
+	Delete(ctx context.Context, id int64) error
+	// CountDocuments returns how many documents use a term
+	CountDocuments(ctx context.Context, term *models.DocumentTerm) (int, error)
+}
+
+type documentTermRepository struct {
+	db *sql.DB
+}
+
+func NewDocumentTermRepository(db *sql.DB) DocumentTermRepository {
+	return &documentTermRepository{db: db}
+}
+
+func (r *documentTermRepository) Create(ctx context.Context, term *models.DocumentTerm) error {
+	now := time.Now()
+	term.CreatedAt = now
+	term.UpdatedAt = now
+
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO document_terms (kind, name, sort_order, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+		term.Kind, term.Name, term.SortOrder, term.CreatedAt, term.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	term.ID, err = result.LastInsertId()
+	return err
+}
+
+const documentTermColumns = `id, kind, name, sort_order, created_at, updated_at`
+
+func scanDocumentTerm(row rowScanner) (*models.DocumentTerm, error) {
+	term := &models.DocumentTerm{}
+	err := row.Scan(&term.ID, &term.Kind, &term.Name, &term.SortOrder, &term.CreatedAt, &term.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return term, nil
+}
+
+func (r *documentTermRepository) GetByID(ctx context.Context, id int64) (*models.DocumentTerm, error) {
+	return scanDocumentTerm(r.db.QueryRowContext(ctx,
+		`SELECT `+documentTermColumns+` FROM document_terms WHERE id = ?`, id))
+}
+
+func (r *documentTermRepository) GetByName(ctx context.Context, kind, name string) (*models.DocumentTerm, error) {
+	return scanDocumentTerm(r.db.QueryRowContext(ctx,
+		`SELECT `+documentTermColumns+` FROM document_terms WHERE kind = ? AND name = ?`, kind, name))
+}
+
+func (r *documentTermRepository) List(ctx context.Context, kind string) ([]*models.DocumentTerm, error) {
+	query := `SELECT ` + documentTermColumns + ` FROM document_terms`
+	args := []interface{}{}
+	if kind != "" {
+		query += ` WHERE kind = ?`
+		args = append(args, kind)
+	}
+	rows, err := r.db.QueryContext(ctx, query+` ORDER BY kind, sort_order, name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	terms := []*models.DocumentTerm{}
+	for rows.Next() {
+		term, err := scanDocumentTerm(rows)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	return terms, rows.Err()
+}
+
+func (r *documentTermRepository) Update(ctx context.Context, term *models.DocumentTerm) error {
+	term.UpdatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE document_terms SET name = ?, sort_order = ?, updated_at = ? WHERE id = ?`,
+		term.Name, term.SortOrder, term.UpdatedAt, term.ID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *documentTermRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM document_terms WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *documentTermRepository) CountDocuments(ctx context.Context, term *models.DocumentTerm) (int, error) {
+	column, ok := TermKinds[term.Kind]
+	if !ok {
+		return 0, nil
+	}
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM documents WHERE `+column+` = ?`, term.ID).Scan(&count)
+	return count, err
+}
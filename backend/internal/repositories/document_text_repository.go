@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/models"
+)
+
+// Extraction statuses of a document's text
+const (
+	TextPending     = "pending"
+	TextDone        = "done"
+	TextFailed      = "failed"
+	TextUnsupported = "unsupported"
+)
+
+type DocumentTextRepository interface {
+	Get(ctx context.Context, documentID int64) (*models.DocumentText, error)
+	// Save stores the outcome of an extraction and reindexes the document
+	Save(ctx context.Context, text *models.DocumentText) error
+	// MarkPending queues a document for extraction, keeping any text it
+	// already has searchable until the new text is saved
+	MarkPending(ctx context.Context, documentID int64) error
+	// QueueMissing queues the documents that were never extracted
+	QueueMissing(ctx context.Context) (int64, error)
+	// Requeue queues the documents whose extraction has one of the given
+	// statuses, or every document when none are given
+	Requeue(ctx context.Context, statuses ...string) (int64, error)
+	// ListPending returns the ids of documents waiting for extraction, oldest first
+	ListPending(ctx context.Context, limit int) ([]int64, error)
+}
+
+type documentTextRepository struct {
+	db *sql.DB
+}
+
+func NewDocumentTextRepository(db *sql.DB) DocumentTextRepository {
+	return &documentTextRepository{db: db}
+}
+
+func (r *documentTextRepository) Get(ctx context.Context, documentID int64) (*models.DocumentText, error) {
+	text := &models.DocumentText{}
+	err := r.db.QueryRowContext(ctx,
+		`SELECT document_id, status, content, error, extracted_at, updated_at
+		 FROM document_texts WHERE document_id = ?`, documentID).Scan(
+		&text.DocumentID, &text.Status, &text.Content, &text.Error, &text.ExtractedAt, &text.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return text, nil
+}
+
+func (r *documentTextRepository) Save(ctx context.Context, text *models.DocumentText) error {
+	text.UpdatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO document_texts (document_id, status, content, error, extracted_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(document_id) DO UPDATE SET status = excluded.status, content = excluded.content,
+		 error = excluded.error, extracted_at = excluded.extracted_at, updated_at = excluded.updated_at`,
+		text.DocumentID, text.Status, text.Content, text.Error, text.ExtractedAt, text.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	return reindexDocument(ctx, r.db, text.DocumentID)
+}
+
+func (r *documentTextRepository) MarkPending(ctx context.Context, documentID int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO document_texts (document_id, status, updated_at) VALUES (?, ?, ?)
+		 ON CONFLICT(document_id) DO UPDATE SET status = excluded.status, error = '', updated_at = excluded.updated_at`,
+		documentID, TextPending, time.Now())
+	return err
+}
+
+func (r *documentTextRepository) QueueMissing(ctx context.Context) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO document_texts (document_id, status, updated_at)
+		 SELECT id, ?, ? FROM documents WHERE id NOT IN (SELECT document_id FROM document_texts)`,
+		TextPending, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *documentTextRepository) Requeue(ctx context.Context, statuses ...string) (int64, error) {
+	query := `UPDATE document_texts SET status = ?, error = '', updated_at = ? WHERE status != ?`
+	args := []interface{}{TextPending, time.Now(), TextPending}
+	if len(statuses) > 0 {
+		query += ` AND status IN (?` + strings.Repeat(", ?", len(statuses)-1) + `)`
+		for _, status := range statuses {
+			args = append(args, status)
+		}
+	}
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *documentTextRepository) ListPending(ctx context.Context, limit int) ([]int64, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT document_id FROM document_texts WHERE status = ? ORDER BY updated_at, document_id LIMIT ?`,
+		TextPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
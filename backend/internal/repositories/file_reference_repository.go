@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/thieugt95/portal-365/backend/internal/models"
+)
+
+// FileReferenceRepository stores which articles, pages and banners use which
+// uploaded files, keyed by the /static/uploads/ URL of the file
+type FileReferenceRepository interface {
+	Replace(ctx context.Context, ownerType string, ownerID int64, refs []*models.FileReference) error
+	ListByURLs(ctx context.Context, urls []string) ([]*models.FileReference, error)
+}
+
+type fileReferenceRepository struct {
+	db *sql.DB
+}
+
+func NewFileReferenceRepository(db *sql.DB) FileReferenceRepository {
+	return &fileReferenceRepository{db: db}
+}
+
+// Replace swaps the references held by one owner in a single transaction.
+// An empty list clears them, as when the owner is deleted.
+func (r *fileReferenceRepository) Replace(ctx context.Context, ownerType string, ownerID int64, refs []*models.FileReference) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM file_references WHERE owner_type = ? AND owner_id = ?`, ownerType, ownerID); err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR IGNORE INTO file_references (url, owner_type, owner_id, field) VALUES (?, ?, ?, ?)`,
+			ref.URL, ownerType, ownerID, ref.Field); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListByURLs returns the references to any of urls with the title of each owner
+func (r *fileReferenceRepository) ListByURLs(ctx context.Context, urls []string) ([]*models.FileReference, error) {
+	refs := make([]*models.FileReference, 0)
+	if len(urls) == 0 {
+		return refs, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(urls)), ",")
+	args := make([]interface{}, len(urls))
+	for i, u := range urls {
+		args[i] = u
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT f.url, f.owner_type, f.owner_id, f.field, COALESCE(a.title, p.title, b.title, '')
+		 FROM file_references f
+		 LEFT JOIN articles a ON f.owner_type = 'article' AND a.id = f.owner_id
+		 LEFT JOIN pages p ON f.owner_type = 'page' AND p.id = f.owner_id
+		 LEFT JOIN banners b ON f.owner_type = 'banner' AND b.id = f.owner_id
+		 WHERE f.url IN (`+placeholders+`)
+		 ORDER BY f.owner_type, f.owner_id, f.field`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ref := &models.FileReference{}
+		if err := rows.Scan(&ref.URL, &ref.OwnerType, &ref.OwnerID, &ref.Field, &ref.Title); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
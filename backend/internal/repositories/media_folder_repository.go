@@ -0,0 +1,144 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/models"
+)
+
+type MediaFolderRepository interface {
+	Create(ctx context.Context, folder *models.MediaFolder) error
+	GetByID(ctx context.Context, id int64) (*models.MediaFolder, error)
+	List(ctx context.Context) ([]*models.MediaFolder, error)
+	Update(ctx context.Context, folder *models.MediaFolder) error
+	Delete(ctx context.Context, id int64) error
+	NameTaken(ctx context.Context, parentID *int64, name string, exceptID int64) (bool, error)
+	IsWithin(ctx context.Context, id, ancestorID int64) (bool, error)
+	IsEmpty(ctx context.Context, id int64) (bool, error)
+}
+
+type mediaFolderRepository struct {
+	db *sql.DB
+}
+
+func NewMediaFolderRepository(db *sql.DB) MediaFolderRepository {
+	return &mediaFolderRepository{db: db}
+}
+
+func (r *mediaFolderRepository) Create(ctx context.Context, folder *models.MediaFolder) error {
+	now := time.Now()
+	folder.CreatedAt = now
+	folder.UpdatedAt = now
+
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO media_folders (name, parent_id, created_at, updated_at) VALUES (?, ?, ?, ?)`,
+		folder.Name, folder.ParentID, folder.CreatedAt, folder.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	folder.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *mediaFolderRepository) GetByID(ctx context.Context, id int64) (*models.MediaFolder, error) {
+	folder := &models.MediaFolder{}
+	err := r.db.QueryRowContext(ctx,
+		`SELECT f.id, f.name, f.parent_id, f.created_at, f.updated_at, 
+		 (SELECT COUNT(*) FROM media_items m WHERE m.folder_id = f.id) 
+		 FROM media_folders f WHERE f.id = ?`, id).Scan(
+		&folder.ID, &folder.Name, &folder.ParentID, &folder.CreatedAt, &folder.UpdatedAt, &folder.ItemCount)
+	if err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// List returns every folder by name, each with the number of items filed
+// directly in it
+func (r *mediaFolderRepository) List(ctx context.Context) ([]*models.MediaFolder, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT f.id, f.name, f.parent_id, f.created_at, f.updated_at, 
+		 (SELECT COUNT(*) FROM media_items m WHERE m.folder_id = f.id) 
+		 FROM media_folders f ORDER BY f.name COLLATE NOCASE, f.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := []*models.MediaFolder{}
+	for rows.Next() {
+		folder := &models.MediaFolder{}
+		if err := rows.Scan(&folder.ID, &folder.Name, &folder.ParentID, &folder.CreatedAt,
+			&folder.UpdatedAt, &folder.ItemCount); err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+	return folders, rows.Err()
+}
+
+func (r *mediaFolderRepository) Update(ctx context.Context, folder *models.MediaFolder) error {
+	folder.UpdatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE media_folders SET name = ?, parent_id = ?, updated_at = ? WHERE id = ?`,
+		folder.Name, folder.ParentID, folder.UpdatedAt, folder.ID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *mediaFolderRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM media_folders WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// NameTaken reports whether another folder under the same parent already has
+// the name, compared without case
+func (r *mediaFolderRepository) NameTaken(ctx context.Context, parentID *int64, name string, exceptID int64) (bool, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM media_folders 
+		 WHERE parent_id IS ? AND name = ? COLLATE NOCASE AND id != ?`,
+		parentID, name, exceptID).Scan(&count)
+	return count > 0, err
+}
+
+// IsWithin reports whether id is ancestorID or one of the folders below it,
+// which would make a cycle if ancestorID were moved under id
+func (r *mediaFolderRepository) IsWithin(ctx context.Context, id, ancestorID int64) (bool, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM (`+mediaFolderTree+`) WHERE id = ?`, ancestorID, id).Scan(&count)
+	return count > 0, err
+}
+
+// IsEmpty reports whether a folder holds neither media items nor subfolders
+func (r *mediaFolderRepository) IsEmpty(ctx context.Context, id int64) (bool, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM media_items WHERE folder_id = ?) + 
+		 (SELECT COUNT(*) FROM media_folders WHERE parent_id = ?)`, id, id).Scan(&count)
+	return count == 0, err
+}
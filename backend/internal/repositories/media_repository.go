@@ -3,20 +3,56 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/thieugt95/portal-365/backend/internal/models"
 )
 
+// Orientations accepted by MediaItemFilter
+const (
+	OrientationLandscape = "landscape"
+	OrientationPortrait  = "portrait"
+	OrientationSquare    = "square"
+)
+
+// MediaItemFilter narrows admin media listings. Zero values match everything.
+type MediaItemFilter struct {
+	MediaType          string
+	Status             string
+	CategoryID         *int64
+	IncludeDescendants bool // Match media in child categories of CategoryID too
+	FolderID           *int64
+	IncludeSubfolders  bool     // Match media in folders below FolderID too
+	Unfiled            bool     // Only media outside any folder
+	Tags               []string // Items must carry all of them
+	Query              string   // Searched in title and description
+	UploadedBy         *int64
+	FromDate           *time.Time // Uploaded at or after
+	ToDate             *time.Time // Uploaded before
+	MinWidth           int
+	MaxWidth           int
+	MinHeight          int
+	MaxHeight          int
+	Orientation        string // landscape, portrait or square
+}
+
 type MediaItemRepository interface {
 	Create(ctx context.Context, media *models.MediaItem) error
 	GetByID(ctx context.Context, id int64) (*models.MediaItem, error)
 	GetBySlug(ctx context.Context, slug string) (*models.MediaItem, error)
+	GetByURL(ctx context.Context, url string) (*models.MediaItem, error)
 	Update(ctx context.Context, media *models.MediaItem) error
 	Delete(ctx context.Context, id int64) error
-	List(ctx context.Context, mediaType, status string, categoryID *int64, page, pageSize int) ([]models.MediaItem, int, error)
-	ListPublished(ctx context.Context, mediaType string, categoryID *int64, page, pageSize int) ([]models.MediaItem, int, error)
+	List(ctx context.Context, filter *MediaItemFilter, page, pageSize int, sortBy string) ([]models.MediaItem, int, error)
+	ListPublished(ctx context.Context, mediaType string, categoryID *int64, includeDescendants bool, page, pageSize int) ([]models.MediaItem, int, error)
 	IncrementViewCount(ctx context.Context, id int64) error
+	UseThumbnail(ctx context.Context, url, thumbnailURL string) error
+	MoveToFolder(ctx context.Context, ids []int64, folderID *int64) (int64, error)
+	SetTags(ctx context.Context, id int64, tags []string) error
+	GetTags(ctx context.Context, ids []int64) (map[int64][]string, error)
+	ListTags(ctx context.Context, prefix string, limit int) ([]models.MediaTagUsage, error)
 }
 
 type mediaItemRepository struct {
@@ -33,13 +69,13 @@ func (r *mediaItemRepository) Create(ctx context.Context, media *models.MediaIte
 	media.UpdatedAt = now
 
 	result, err := r.db.ExecContext(ctx,
-		`INSERT INTO media_items (title, slug, description, category_id, media_type, url, 
-		 thumbnail_url, duration, width, height, uploaded_by, status, published_at, 
+		`INSERT INTO media_items (title, slug, description, category_id, folder_id, no_watermark, media_type, url, 
+		 thumbnail_url, file_size, duration, codec, width, height, taken_at, camera, uploaded_by, status, published_at, 
 		 created_at, updated_at) 
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		media.Title, media.Slug, media.Description, media.CategoryID, media.MediaType,
-		media.URL, media.ThumbnailURL, media.Duration, media.Width, media.Height,
-		media.UploadedBy, media.Status, media.PublishedAt, media.CreatedAt, media.UpdatedAt)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		media.Title, media.Slug, media.Description, media.CategoryID, media.FolderID, media.NoWatermark, media.MediaType,
+		media.URL, media.ThumbnailURL, media.FileSize, media.Duration, media.Codec, media.Width, media.Height,
+		media.TakenAt, media.Camera, media.UploadedBy, media.Status, media.PublishedAt, media.CreatedAt, media.UpdatedAt)
 	if err != nil {
 		return err
 	}
@@ -51,13 +87,13 @@ func (r *mediaItemRepository) Create(ctx context.Context, media *models.MediaIte
 func (r *mediaItemRepository) GetByID(ctx context.Context, id int64) (*models.MediaItem, error) {
 	media := &models.MediaItem{}
 	err := r.db.QueryRowContext(ctx,
-		`SELECT id, title, slug, description, category_id, media_type, url, thumbnail_url, 
-		 file_size, duration, width, height, uploaded_by, view_count, status, published_at, 
+		`SELECT id, title, slug, description, category_id, folder_id, no_watermark, media_type, url, thumbnail_url, 
+		 file_size, duration, codec, width, height, taken_at, camera, uploaded_by, view_count, status, published_at, 
 		 created_at, updated_at 
 		 FROM media_items WHERE id = ?`, id).Scan(
-		&media.ID, &media.Title, &media.Slug, &media.Description, &media.CategoryID,
-		&media.MediaType, &media.URL, &media.ThumbnailURL, &media.FileSize, &media.Duration, &media.Width,
-		&media.Height, &media.UploadedBy, &media.ViewCount, &media.Status, &media.PublishedAt,
+		&media.ID, &media.Title, &media.Slug, &media.Description, &media.CategoryID, &media.FolderID, &media.NoWatermark,
+		&media.MediaType, &media.URL, &media.ThumbnailURL, &media.FileSize, &media.Duration, &media.Codec, &media.Width,
+		&media.Height, &media.TakenAt, &media.Camera, &media.UploadedBy, &media.ViewCount, &media.Status, &media.PublishedAt,
 		&media.CreatedAt, &media.UpdatedAt)
 	if err != nil {
 		return nil, err
@@ -68,13 +104,31 @@ func (r *mediaItemRepository) GetByID(ctx context.Context, id int64) (*models.Me
 func (r *mediaItemRepository) GetBySlug(ctx context.Context, slug string) (*models.MediaItem, error) {
 	media := &models.MediaItem{}
 	err := r.db.QueryRowContext(ctx,
-		`SELECT id, title, slug, description, category_id, media_type, url, thumbnail_url, 
-		 file_size, duration, width, height, uploaded_by, view_count, status, published_at, 
+		`SELECT id, title, slug, description, category_id, folder_id, no_watermark, media_type, url, thumbnail_url, 
+		 file_size, duration, codec, width, height, taken_at, camera, uploaded_by, view_count, status, published_at, 
 		 created_at, updated_at 
 		 FROM media_items WHERE slug = ?`, slug).Scan(
-		&media.ID, &media.Title, &media.Slug, &media.Description, &media.CategoryID,
-		&media.MediaType, &media.URL, &media.ThumbnailURL, &media.FileSize, &media.Duration, &media.Width,
-		&media.Height, &media.UploadedBy, &media.ViewCount, &media.Status, &media.PublishedAt,
+		&media.ID, &media.Title, &media.Slug, &media.Description, &media.CategoryID, &media.FolderID, &media.NoWatermark,
+		&media.MediaType, &media.URL, &media.ThumbnailURL, &media.FileSize, &media.Duration, &media.Codec, &media.Width,
+		&media.Height, &media.TakenAt, &media.Camera, &media.UploadedBy, &media.ViewCount, &media.Status, &media.PublishedAt,
+		&media.CreatedAt, &media.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// GetByURL returns the oldest item serving the file at url
+func (r *mediaItemRepository) GetByURL(ctx context.Context, url string) (*models.MediaItem, error) {
+	media := &models.MediaItem{}
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, title, slug, description, category_id, folder_id, no_watermark, media_type, url, thumbnail_url, 
+		 file_size, duration, codec, width, height, taken_at, camera, uploaded_by, view_count, status, published_at, 
+		 created_at, updated_at 
+		 FROM media_items WHERE url = ? ORDER BY id LIMIT 1`, url).Scan(
+		&media.ID, &media.Title, &media.Slug, &media.Description, &media.CategoryID, &media.FolderID, &media.NoWatermark,
+		&media.MediaType, &media.URL, &media.ThumbnailURL, &media.FileSize, &media.Duration, &media.Codec, &media.Width,
+		&media.Height, &media.TakenAt, &media.Camera, &media.UploadedBy, &media.ViewCount, &media.Status, &media.PublishedAt,
 		&media.CreatedAt, &media.UpdatedAt)
 	if err != nil {
 		return nil, err
@@ -86,18 +140,27 @@ func (r *mediaItemRepository) Update(ctx context.Context, media *models.MediaIte
 	media.UpdatedAt = time.Now()
 
 	_, err := r.db.ExecContext(ctx,
-		`UPDATE media_items SET title = ?, slug = ?, description = ?, category_id = ?, 
+		`UPDATE media_items SET title = ?, slug = ?, description = ?, category_id = ?, no_watermark = ?, 
 		 media_type = ?, url = ?, thumbnail_url = ?, duration = ?, width = ?, height = ?, 
 		 status = ?, published_at = ?, updated_at = ? 
 		 WHERE id = ?`,
-		media.Title, media.Slug, media.Description, media.CategoryID, media.MediaType,
+		media.Title, media.Slug, media.Description, media.CategoryID, media.NoWatermark, media.MediaType,
 		media.URL, media.ThumbnailURL, media.Duration, media.Width, media.Height,
 		media.Status, media.PublishedAt, media.UpdatedAt, media.ID)
 	return err
 }
 
 func (r *mediaItemRepository) Delete(ctx context.Context, id int64) error {
-	result, err := r.db.ExecContext(ctx, `DELETE FROM media_items WHERE id = ?`, id)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM media_tags WHERE media_item_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM media_items WHERE id = ?`, id)
 	if err != nil {
 		return err
 	}
@@ -109,54 +172,133 @@ func (r *mediaItemRepository) Delete(ctx context.Context, id int64) error {
 	if rows == 0 {
 		return sql.ErrNoRows
 	}
-	return nil
+	return tx.Commit()
 }
 
-func (r *mediaItemRepository) List(ctx context.Context, mediaType, status string, categoryID *int64, page, pageSize int) ([]models.MediaItem, int, error) {
-	offset := (page - 1) * pageSize
-
-	query := `SELECT id, title, slug, description, category_id, media_type, url, thumbnail_url, 
-	          file_size, duration, width, height, uploaded_by, view_count, status, published_at, 
-	          created_at, updated_at FROM media_items WHERE 1=1`
-	countQuery := `SELECT COUNT(*) FROM media_items WHERE 1=1`
+// mediaFolderTree selects a folder and all folders below it
+const mediaFolderTree = `WITH RECURSIVE folder_tree(id) AS (
+		SELECT id FROM media_folders WHERE id = ?
+		UNION
+		SELECT f.id FROM media_folders f INNER JOIN folder_tree t ON f.parent_id = t.id
+	) SELECT id FROM folder_tree`
+
+// mediaSortFields are the columns media listings can be sorted by
+var mediaSortFields = map[string]bool{
+	"created_at":   true,
+	"updated_at":   true,
+	"published_at": true,
+	"taken_at":     true,
+	"title":        true,
+	"file_size":    true,
+	"width":        true,
+	"height":       true,
+	"view_count":   true,
+}
 
-	// Separate args for count and query
-	countArgs := []interface{}{}
-	queryArgs := []interface{}{}
+func (r *mediaItemRepository) List(ctx context.Context, filter *MediaItemFilter, page, pageSize int, sortBy string) ([]models.MediaItem, int, error) {
+	offset := (page - 1) * pageSize
 
-	if mediaType != "" {
-		query += " AND media_type = ?"
-		countQuery += " AND media_type = ?"
-		countArgs = append(countArgs, mediaType)
-		queryArgs = append(queryArgs, mediaType)
-	}
+	whereClauses := []string{}
+	args := []interface{}{}
 
-	if status != "" {
-		query += " AND status = ?"
-		countQuery += " AND status = ?"
-		countArgs = append(countArgs, status)
-		queryArgs = append(queryArgs, status)
+	if filter != nil {
+		if filter.MediaType != "" {
+			whereClauses = append(whereClauses, "media_type = ?")
+			args = append(args, filter.MediaType)
+		}
+		if filter.Status != "" {
+			whereClauses = append(whereClauses, "status = ?")
+			args = append(args, filter.Status)
+		}
+		if filter.CategoryID != nil {
+			whereClauses = append(whereClauses, strings.TrimPrefix(categoryCondition(filter.IncludeDescendants), " AND "))
+			args = append(args, *filter.CategoryID)
+		}
+		if filter.Unfiled {
+			whereClauses = append(whereClauses, "folder_id IS NULL")
+		} else if filter.FolderID != nil {
+			if filter.IncludeSubfolders {
+				whereClauses = append(whereClauses, "folder_id IN ("+mediaFolderTree+")")
+			} else {
+				whereClauses = append(whereClauses, "folder_id = ?")
+			}
+			args = append(args, *filter.FolderID)
+		}
+		if len(filter.Tags) > 0 {
+			// Items must carry every listed tag
+			placeholders := make([]string, len(filter.Tags))
+			for i, tag := range filter.Tags {
+				placeholders[i] = "?"
+				args = append(args, tag)
+			}
+			whereClauses = append(whereClauses, fmt.Sprintf(
+				"id IN (SELECT media_item_id FROM media_tags WHERE tag IN (%s) GROUP BY media_item_id HAVING COUNT(*) = ?)",
+				strings.Join(placeholders, ",")))
+			args = append(args, len(filter.Tags))
+		}
+		if filter.Query != "" {
+			whereClauses = append(whereClauses, "(title LIKE ? OR description LIKE ?)")
+			searchPattern := "%" + filter.Query + "%"
+			args = append(args, searchPattern, searchPattern)
+		}
+		if filter.UploadedBy != nil {
+			whereClauses = append(whereClauses, "uploaded_by = ?")
+			args = append(args, *filter.UploadedBy)
+		}
+		if filter.FromDate != nil {
+			whereClauses = append(whereClauses, "created_at >= ?")
+			args = append(args, *filter.FromDate)
+		}
+		if filter.ToDate != nil {
+			whereClauses = append(whereClauses, "created_at < ?")
+			args = append(args, *filter.ToDate)
+		}
+		if filter.MinWidth > 0 {
+			whereClauses = append(whereClauses, "width >= ?")
+			args = append(args, filter.MinWidth)
+		}
+		if filter.MaxWidth > 0 {
+			whereClauses = append(whereClauses, "width <= ?")
+			args = append(args, filter.MaxWidth)
+		}
+		if filter.MinHeight > 0 {
+			whereClauses = append(whereClauses, "height >= ?")
+			args = append(args, filter.MinHeight)
+		}
+		if filter.MaxHeight > 0 {
+			whereClauses = append(whereClauses, "height <= ?")
+			args = append(args, filter.MaxHeight)
+		}
+		switch filter.Orientation {
+		case OrientationLandscape:
+			whereClauses = append(whereClauses, "width > height AND height > 0")
+		case OrientationPortrait:
+			whereClauses = append(whereClauses, "height > width AND width > 0")
+		case OrientationSquare:
+			whereClauses = append(whereClauses, "width = height AND width > 0")
+		}
 	}
 
-	if categoryID != nil {
-		query += " AND category_id = ?"
-		countQuery += " AND category_id = ?"
-		countArgs = append(countArgs, *categoryID)
-		queryArgs = append(queryArgs, *categoryID)
+	whereClause := ""
+	if len(whereClauses) > 0 {
+		whereClause = "WHERE " + strings.Join(whereClauses, " AND ")
 	}
 
 	// Get total count
 	var total int
-	err := r.db.QueryRowContext(ctx, countQuery, countArgs...).Scan(&total)
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM media_items `+whereClause, args...).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	// Get media items
-	query += " ORDER BY created_at DESC LIMIT ? OFFSET ?"
-	queryArgs = append(queryArgs, pageSize, offset)
+	// Get media items; id breaks ties so pages stay stable
+	query := fmt.Sprintf(`SELECT id, title, slug, description, category_id, folder_id, no_watermark, media_type, url, thumbnail_url, 
+	          file_size, duration, codec, width, height, taken_at, camera, uploaded_by, view_count, status, published_at, 
+	          created_at, updated_at FROM media_items %s ORDER BY %s, id DESC LIMIT ? OFFSET ?`,
+		whereClause, sortClause(sortBy, mediaSortFields))
+	args = append(args, pageSize, offset)
 
-	rows, err := r.db.QueryContext(ctx, query, queryArgs...)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -166,8 +308,8 @@ func (r *mediaItemRepository) List(ctx context.Context, mediaType, status string
 	for rows.Next() {
 		var media models.MediaItem
 		if err := rows.Scan(&media.ID, &media.Title, &media.Slug, &media.Description,
-			&media.CategoryID, &media.MediaType, &media.URL, &media.ThumbnailURL,
-			&media.FileSize, &media.Duration, &media.Width, &media.Height, &media.UploadedBy,
+			&media.CategoryID, &media.FolderID, &media.NoWatermark, &media.MediaType, &media.URL, &media.ThumbnailURL,
+			&media.FileSize, &media.Duration, &media.Codec, &media.Width, &media.Height, &media.TakenAt, &media.Camera, &media.UploadedBy,
 			&media.ViewCount, &media.Status, &media.PublishedAt,
 			&media.CreatedAt, &media.UpdatedAt); err != nil {
 			return nil, 0, err
@@ -178,11 +320,11 @@ func (r *mediaItemRepository) List(ctx context.Context, mediaType, status string
 	return items, total, rows.Err()
 }
 
-func (r *mediaItemRepository) ListPublished(ctx context.Context, mediaType string, categoryID *int64, page, pageSize int) ([]models.MediaItem, int, error) {
+func (r *mediaItemRepository) ListPublished(ctx context.Context, mediaType string, categoryID *int64, includeDescendants bool, page, pageSize int) ([]models.MediaItem, int, error) {
 	offset := (page - 1) * pageSize
 
-	query := `SELECT id, title, slug, description, category_id, media_type, url, thumbnail_url, 
-	          file_size, duration, width, height, uploaded_by, view_count, status, published_at, 
+	query := `SELECT id, title, slug, description, category_id, folder_id, no_watermark, media_type, url, thumbnail_url, 
+	          file_size, duration, codec, width, height, taken_at, camera, uploaded_by, view_count, status, published_at, 
 	          created_at, updated_at FROM media_items WHERE status = 'published'`
 	countQuery := `SELECT COUNT(*) FROM media_items WHERE status = 'published'`
 	args := []interface{}{}
@@ -194,8 +336,8 @@ func (r *mediaItemRepository) ListPublished(ctx context.Context, mediaType strin
 	}
 
 	if categoryID != nil {
-		query += " AND category_id = ?"
-		countQuery += " AND category_id = ?"
+		query += categoryCondition(includeDescendants)
+		countQuery += categoryCondition(includeDescendants)
 		args = append(args, *categoryID)
 	}
 
@@ -220,8 +362,8 @@ func (r *mediaItemRepository) ListPublished(ctx context.Context, mediaType strin
 	for rows.Next() {
 		var media models.MediaItem
 		if err := rows.Scan(&media.ID, &media.Title, &media.Slug, &media.Description,
-			&media.CategoryID, &media.MediaType, &media.URL, &media.ThumbnailURL,
-			&media.FileSize, &media.Duration, &media.Width, &media.Height, &media.UploadedBy,
+			&media.CategoryID, &media.FolderID, &media.NoWatermark, &media.MediaType, &media.URL, &media.ThumbnailURL,
+			&media.FileSize, &media.Duration, &media.Codec, &media.Width, &media.Height, &media.TakenAt, &media.Camera, &media.UploadedBy,
 			&media.ViewCount, &media.Status, &media.PublishedAt,
 			&media.CreatedAt, &media.UpdatedAt); err != nil {
 			return nil, 0, err
@@ -237,3 +379,119 @@ func (r *mediaItemRepository) IncrementViewCount(ctx context.Context, id int64)
 		`UPDATE media_items SET view_count = view_count + 1 WHERE id = ?`, id)
 	return err
 }
+
+// UseThumbnail points the image items stored at url that still show the
+// original, or nothing, at thumbnailURL
+func (r *mediaItemRepository) UseThumbnail(ctx context.Context, url, thumbnailURL string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE media_items SET thumbnail_url = ? 
+		 WHERE url = ? AND media_type = 'image' AND (thumbnail_url = url OR thumbnail_url = '')`,
+		thumbnailURL, url)
+	return err
+}
+
+// MoveToFolder files media items into a folder, or takes them out of any
+// folder when folderID is nil. Only the folder changes: URLs stay the same.
+func (r *mediaItemRepository) MoveToFolder(ctx context.Context, ids []int64, folderID *int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	placeholders := make([]string, len(ids))
+	args := []interface{}{folderID, time.Now()}
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE media_items SET folder_id = ?, updated_at = ? WHERE id IN (`+strings.Join(placeholders, ",")+`)`, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SetTags replaces the tags of a media item. Tags are compared without case;
+// the first spelling given is kept.
+func (r *mediaItemRepository) SetTags(ctx context.Context, id int64, tags []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM media_tags WHERE media_item_id = ?`, id); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR IGNORE INTO media_tags (media_item_id, tag) VALUES (?, ?)`, id, tag); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTags returns the tags of several media items, keyed by item ID
+func (r *mediaItemRepository) GetTags(ctx context.Context, ids []int64) (map[int64][]string, error) {
+	tags := make(map[int64][]string)
+	if len(ids) == 0 {
+		return tags, nil
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT media_item_id, tag FROM media_tags WHERE media_item_id IN (`+strings.Join(placeholders, ",")+`) 
+		 ORDER BY tag`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return nil, err
+		}
+		tags[id] = append(tags[id], tag)
+	}
+	return tags, rows.Err()
+}
+
+// ListTags returns the tags in use, most used first, optionally only those
+// starting with prefix
+func (r *mediaItemRepository) ListTags(ctx context.Context, prefix string, limit int) ([]models.MediaTagUsage, error) {
+	query := `SELECT tag, COUNT(*) FROM media_tags`
+	args := []interface{}{}
+	if prefix != "" {
+		query += ` WHERE tag LIKE ?`
+		args = append(args, prefix+"%")
+	}
+	query += ` GROUP BY tag ORDER BY COUNT(*) DESC, tag`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.MediaTagUsage{}
+	for rows.Next() {
+		var usage models.MediaTagUsage
+		if err := rows.Scan(&usage.Tag, &usage.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, usage)
+	}
+	return tags, rows.Err()
+}
@@ -672,6 +672,9 @@ func (r *settingRepository) GetAll(ctx context.Context) ([]*models.Setting, erro
 type AuditLogRepository interface {
 	Create(ctx context.Context, log *models.AuditLog) error
 	List(ctx context.Context, userID *int64, page, pageSize int) ([]*models.AuditLog, int, error)
+	// ListByEntity returns the log of one entity, newest first, with the
+	// names of the users
+	ListByEntity(ctx context.Context, entity string, entityID int64, page, pageSize int) ([]*models.AuditLog, int, error)
 }
 
 type auditLogRepository struct {
@@ -733,3 +736,35 @@ func (r *auditLogRepository) List(ctx context.Context, userID *int64, page, page
 
 	return logs, total, rows.Err()
 }
+
+func (r *auditLogRepository) ListByEntity(ctx context.Context, entity string, entityID int64, page, pageSize int) ([]*models.AuditLog, int, error) {
+	var total int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM audit_logs WHERE entity = ? AND entity_id = ?`, entity, entityID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT a.id, a.user_id, a.action, a.entity, a.entity_id, COALESCE(a.details, ''), COALESCE(a.ip_address, ''), 
+		 COALESCE(u.full_name, ''), a.created_at 
+		 FROM audit_logs a LEFT JOIN users u ON u.id = a.user_id 
+		 WHERE a.entity = ? AND a.entity_id = ? ORDER BY a.created_at DESC, a.id DESC LIMIT ? OFFSET ?`,
+		entity, entityID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	logs := make([]*models.AuditLog, 0)
+	for rows.Next() {
+		log := &models.AuditLog{}
+		if err := rows.Scan(&log.ID, &log.UserID, &log.Action, &log.Entity, &log.EntityID,
+			&log.Details, &log.IPAddress, &log.UserName, &log.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		logs = append(logs, log)
+	}
+
+	return logs, total, rows.Err()
+}
@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/models"
+)
+
+type QuarantineRepository interface {
+	Create(ctx context.Context, file *models.QuarantinedFile) error
+	GetByID(ctx context.Context, id int64) (*models.QuarantinedFile, error)
+	List(ctx context.Context, page, pageSize int) ([]*models.QuarantinedFile, int, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+type quarantineRepository struct {
+	db *sql.DB
+}
+
+func NewQuarantineRepository(db *sql.DB) QuarantineRepository {
+	return &quarantineRepository{db: db}
+}
+
+func (r *quarantineRepository) Create(ctx context.Context, file *models.QuarantinedFile) error {
+	file.CreatedAt = time.Now()
+
+	var uploadedBy interface{}
+	if file.UploadedBy > 0 {
+		uploadedBy = file.UploadedBy
+	}
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO quarantined_files (filename, path, sha256, size, mime_type, source, reason, detail, uploaded_by, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		file.Filename, file.Path, file.SHA256, file.Size, file.MimeType, file.Source, file.Reason, file.Detail,
+		uploadedBy, file.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	file.ID, err = result.LastInsertId()
+	return err
+}
+
+const quarantineColumns = `id, filename, path, sha256, size, mime_type, source, reason, detail, COALESCE(uploaded_by, 0), created_at`
+
+func scanQuarantinedFile(row rowScanner) (*models.QuarantinedFile, error) {
+	file := &models.QuarantinedFile{}
+	err := row.Scan(&file.ID, &file.Filename, &file.Path, &file.SHA256, &file.Size, &file.MimeType,
+		&file.Source, &file.Reason, &file.Detail, &file.UploadedBy, &file.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (r *quarantineRepository) GetByID(ctx context.Context, id int64) (*models.QuarantinedFile, error) {
+	return scanQuarantinedFile(r.db.QueryRowContext(ctx,
+		`SELECT `+quarantineColumns+` FROM quarantined_files WHERE id = ?`, id))
+}
+
+func (r *quarantineRepository) List(ctx context.Context, page, pageSize int) ([]*models.QuarantinedFile, int, error) {
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM quarantined_files`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+quarantineColumns+` FROM quarantined_files ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`,
+		pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	files := []*models.QuarantinedFile{}
+	for rows.Next() {
+		file, err := scanQuarantinedFile(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		files = append(files, file)
+	}
+	return files, total, rows.Err()
+}
+
+func (r *quarantineRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM quarantined_files WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/thieugt95/portal-365/backend/internal/models"
+)
+
+// SlugRedirectRepository keeps old slugs resolvable after categories or tags are
+// renamed or merged away.
+type SlugRedirectRepository interface {
+	Create(ctx context.Context, redirect *models.SlugRedirect) error
+	Resolve(ctx context.Context, entity, oldSlug string) (int64, error)
+}
+
+type slugRedirectRepository struct {
+	db *sql.DB
+}
+
+func NewSlugRedirectRepository(db *sql.DB) SlugRedirectRepository {
+	return &slugRedirectRepository{db: db}
+}
+
+func (r *slugRedirectRepository) Create(ctx context.Context, redirect *models.SlugRedirect) error {
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO slug_redirects (entity, old_slug, target_id) VALUES (?, ?, ?)
+		 ON CONFLICT(entity, old_slug) DO UPDATE SET target_id = excluded.target_id`,
+		redirect.Entity, redirect.OldSlug, redirect.TargetID)
+	if err != nil {
+		return err
+	}
+	redirect.ID, err = result.LastInsertId()
+	return err
+}
+
+// Resolve returns the ID of the entity an old slug now points to, or sql.ErrNoRows
+func (r *slugRedirectRepository) Resolve(ctx context.Context, entity, oldSlug string) (int64, error) {
+	var targetID int64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT target_id FROM slug_redirects WHERE entity = ? AND old_slug = ?`,
+		entity, oldSlug).Scan(&targetID)
+	return targetID, err
+}
@@ -0,0 +1,123 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/thieugt95/portal-365/backend/internal/models"
+)
+
+// ImageRenditionRepository stores the scaled copies generated for uploaded images,
+// keyed by the /static/ URL of the original.
+type ImageRenditionRepository interface {
+	Replace(ctx context.Context, sourceURL string, renditions []*models.ImageRendition) error
+	ListBySource(ctx context.Context, sourceURL string) ([]*models.ImageRendition, error)
+	ListBySources(ctx context.Context, sourceURLs []string) (map[string][]*models.ImageRendition, error)
+	DeleteBySource(ctx context.Context, sourceURL string) error
+	Watermarks(ctx context.Context) (map[string]string, error)
+}
+
+type imageRenditionRepository struct {
+	db *sql.DB
+}
+
+func NewImageRenditionRepository(db *sql.DB) ImageRenditionRepository {
+	return &imageRenditionRepository{db: db}
+}
+
+// Replace swaps the rendition set of a source in a single transaction
+func (r *imageRenditionRepository) Replace(ctx context.Context, sourceURL string, renditions []*models.ImageRendition) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM image_renditions WHERE source_url = ?`, sourceURL); err != nil {
+		return err
+	}
+	for _, rendition := range renditions {
+		result, err := tx.ExecContext(ctx,
+			`INSERT INTO image_renditions (source_url, name, format, url, width, height, file_size, watermark) 
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			sourceURL, rendition.Name, rendition.Format, rendition.URL, rendition.Width, rendition.Height, rendition.FileSize,
+			rendition.Watermark)
+		if err != nil {
+			return err
+		}
+		if rendition.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *imageRenditionRepository) ListBySource(ctx context.Context, sourceURL string) ([]*models.ImageRendition, error) {
+	bySource, err := r.ListBySources(ctx, []string{sourceURL})
+	if err != nil {
+		return nil, err
+	}
+	return bySource[sourceURL], nil
+}
+
+// ListBySources returns the renditions of several sources at once, ordered by width
+func (r *imageRenditionRepository) ListBySources(ctx context.Context, sourceURLs []string) (map[string][]*models.ImageRendition, error) {
+	result := make(map[string][]*models.ImageRendition)
+	if len(sourceURLs) == 0 {
+		return result, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(sourceURLs)), ",")
+	args := make([]interface{}, len(sourceURLs))
+	for i, u := range sourceURLs {
+		args[i] = u
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, source_url, name, format, url, width, height, file_size, watermark, created_at 
+		 FROM image_renditions WHERE source_url IN (`+placeholders+`) 
+		 ORDER BY source_url, width, format`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rendition := &models.ImageRendition{}
+		if err := rows.Scan(&rendition.ID, &rendition.SourceURL, &rendition.Name, &rendition.Format, &rendition.URL,
+			&rendition.Width, &rendition.Height, &rendition.FileSize, &rendition.Watermark, &rendition.CreatedAt); err != nil {
+			return nil, err
+		}
+		result[rendition.SourceURL] = append(result[rendition.SourceURL], rendition)
+	}
+
+	return result, rows.Err()
+}
+
+func (r *imageRenditionRepository) DeleteBySource(ctx context.Context, sourceURL string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM image_renditions WHERE source_url = ?`, sourceURL)
+	return err
+}
+
+// Watermarks returns the watermark fingerprint each rendered source was
+// rendered with, empty for sources rendered without one
+func (r *imageRenditionRepository) Watermarks(ctx context.Context) (map[string]string, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT source_url, MAX(watermark) FROM image_renditions GROUP BY source_url ORDER BY source_url`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]string)
+	for rows.Next() {
+		var source, watermark string
+		if err := rows.Scan(&source, &watermark); err != nil {
+			return nil, err
+		}
+		result[source] = watermark
+	}
+	return result, rows.Err()
+}
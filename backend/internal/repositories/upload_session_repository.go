@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/models"
+)
+
+// UploadSessionRepository stores the progress of resumable uploads
+type UploadSessionRepository interface {
+	Create(ctx context.Context, session *models.UploadSession) error
+	GetByID(ctx context.Context, id string) (*models.UploadSession, error)
+	UpdateOffset(ctx context.Context, id string, offset int64, expiresAt time.Time) error
+	Complete(ctx context.Context, id string, mediaItemID int64) error
+	Delete(ctx context.Context, id string) error
+	ListExpired(ctx context.Context, now time.Time) ([]*models.UploadSession, error)
+}
+
+type uploadSessionRepository struct {
+	db *sql.DB
+}
+
+func NewUploadSessionRepository(db *sql.DB) UploadSessionRepository {
+	return &uploadSessionRepository{db: db}
+}
+
+func (r *uploadSessionRepository) Create(ctx context.Context, session *models.UploadSession) error {
+	now := time.Now()
+	session.CreatedAt = now
+	session.UpdatedAt = now
+
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO upload_sessions (id, user_id, filename, content_type, title, description, category_id,
+		 upload_length, upload_offset, expires_at, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.ID, session.UserID, session.Filename, session.ContentType, session.Title,
+		session.Description, session.CategoryID, session.Length, session.Offset,
+		session.ExpiresAt, session.CreatedAt, session.UpdatedAt)
+	return err
+}
+
+func (r *uploadSessionRepository) GetByID(ctx context.Context, id string) (*models.UploadSession, error) {
+	session := &models.UploadSession{}
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, user_id, filename, content_type, title, description, category_id,
+		 upload_length, upload_offset, media_item_id, expires_at, created_at, updated_at
+		 FROM upload_sessions WHERE id = ?`, id).Scan(
+		&session.ID, &session.UserID, &session.Filename, &session.ContentType,
+		&session.Title, &session.Description, &session.CategoryID, &session.Length, &session.Offset,
+		&session.MediaItemID, &session.ExpiresAt, &session.CreatedAt, &session.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *uploadSessionRepository) UpdateOffset(ctx context.Context, id string, offset int64, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE upload_sessions SET upload_offset = ?, expires_at = ?, updated_at = ? WHERE id = ?`,
+		offset, expiresAt, time.Now(), id)
+	return err
+}
+
+func (r *uploadSessionRepository) Complete(ctx context.Context, id string, mediaItemID int64) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE upload_sessions SET media_item_id = ?, updated_at = ? WHERE id = ?`,
+		mediaItemID, time.Now(), id)
+	return err
+}
+
+func (r *uploadSessionRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM upload_sessions WHERE id = ?`, id)
+	return err
+}
+
+// ListExpired returns sessions past their expiry, finished or not
+func (r *uploadSessionRepository) ListExpired(ctx context.Context, now time.Time) ([]*models.UploadSession, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, user_id, filename, content_type, title, description, category_id,
+		 upload_length, upload_offset, media_item_id, expires_at, created_at, updated_at
+		 FROM upload_sessions WHERE expires_at < ?`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]*models.UploadSession, 0)
+	for rows.Next() {
+		session := &models.UploadSession{}
+		if err := rows.Scan(&session.ID, &session.UserID, &session.Filename, &session.ContentType,
+			&session.Title, &session.Description, &session.CategoryID, &session.Length, &session.Offset,
+			&session.MediaItemID, &session.ExpiresAt, &session.CreatedAt, &session.UpdatedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// WatermarkRepository finds the uploaded images a watermark selection covers
+type WatermarkRepository interface {
+	Covered(ctx context.Context, sourceURLs []string, categoryIDs, albumIDs []int64) (map[string]bool, error)
+}
+
+type watermarkRepository struct {
+	db *sql.DB
+}
+
+func NewWatermarkRepository(db *sql.DB) WatermarkRepository {
+	return &watermarkRepository{db: db}
+}
+
+// Covered reports which of the sources are watermarked: media items in the
+// categories (or below them) or in the albums, and files used by articles in
+// the categories. Sources of a media item that opted out are never covered.
+func (r *watermarkRepository) Covered(ctx context.Context, sourceURLs []string, categoryIDs, albumIDs []int64) (map[string]bool, error) {
+	result := make(map[string]bool)
+	if len(sourceURLs) == 0 || (len(categoryIDs) == 0 && len(albumIDs) == 0) {
+		return result, nil
+	}
+
+	sources := strings.TrimSuffix(strings.Repeat("?,", len(sourceURLs)), ",")
+	categories := strings.TrimSuffix(strings.Repeat("?,", len(categoryIDs)), ",")
+	albums := strings.TrimSuffix(strings.Repeat("?,", len(albumIDs)), ",")
+
+	var args []interface{}
+	addSources := func() {
+		for _, u := range sourceURLs {
+			args = append(args, u)
+		}
+	}
+	for _, id := range categoryIDs {
+		args = append(args, id)
+	}
+	addSources()
+	addSources()
+	for _, id := range albumIDs {
+		args = append(args, id)
+	}
+	addSources()
+	addSources()
+
+	rows, err := r.db.QueryContext(ctx,
+		`WITH RECURSIVE category_tree(id) AS (
+			SELECT id FROM categories WHERE id IN (`+categories+`)
+			UNION
+			SELECT c.id FROM categories c INNER JOIN category_tree t ON c.parent_id = t.id
+		)
+		SELECT url FROM media_items
+		 WHERE url IN (`+sources+`) AND category_id IN (SELECT id FROM category_tree)
+		UNION
+		SELECT f.url FROM file_references f
+		 INNER JOIN articles a ON f.owner_type = 'article' AND a.id = f.owner_id
+		 WHERE f.url IN (`+sources+`) AND a.category_id IN (SELECT id FROM category_tree)
+		UNION
+		SELECT m.url FROM album_items ai INNER JOIN media_items m ON m.id = ai.media_item_id
+		 WHERE ai.album_id IN (`+albums+`) AND m.url IN (`+sources+`)
+		EXCEPT
+		SELECT url FROM media_items WHERE url IN (`+sources+`) AND no_watermark = 1`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var source string
+		if err := rows.Scan(&source); err != nil {
+			return nil, err
+		}
+		result[source] = true
+	}
+	return result, rows.Err()
+}
@@ -1,26 +1,63 @@
 package routes
 
 import (
-	"path/filepath"
+	"context"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/thieugt95/portal-365/backend/internal/config"
 	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/docindex"
 	"github.com/thieugt95/portal-365/backend/internal/handlers"
+	"github.com/thieugt95/portal-365/backend/internal/imaging"
 	"github.com/thieugt95/portal-365/backend/internal/middleware"
+	"github.com/thieugt95/portal-365/backend/internal/quarantine"
+	"github.com/thieugt95/portal-365/backend/internal/scan"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+	"github.com/thieugt95/portal-365/backend/internal/watermark"
 )
 
-func Setup(r *gin.Engine, cfg *config.Config, repos *database.Repositories) {
+// Workers are the background jobs behind the routes
+type Workers struct {
+	marks   *watermark.Service
+	texts   *docindex.Service
+	uploads *handlers.ResumableUploadHandler
+}
+
+// Start runs the background jobs until ctx is cancelled. Documents still
+// waiting for text extraction from before a restart are picked up now.
+func (w *Workers) Start(ctx context.Context) {
+	w.marks.Bind(ctx)
+	w.texts.Bind(ctx)
+	w.texts.Schedule()
+	go w.uploads.ExpireSessions(ctx, time.Hour)
+}
+
+func Setup(r *gin.Engine, cfg *config.Config, repos *database.Repositories, store storage.Storage) *Workers {
+	// Renditions are watermarked per the watermark settings, shared by every
+	// handler that renders images or changes which images are watermarked
+	marks := watermark.New(repos, store, imaging.NewRenderer(cfg, store))
+
+	// Uploads kept as uploaded go through clamd when it is configured;
+	// suspicious ones are moved to the quarantine directory
+	var scanner scan.Scanner
+	if cfg.ClamdAddress != "" {
+		scanner = scan.NewClamd(cfg.ClamdAddress, cfg.ClamdTimeout)
+	}
+	guard := quarantine.New(repos, scanner, cfg.QuarantineDir)
+
+	// Document text is extracted for search in the background
+	texts := docindex.New(repos, store)
+
+	// Resumable (tus) media uploads, whose stale sessions expire in the background
+	uploads := handlers.NewResumableUploadHandler(cfg, repos, store, marks, guard)
+
 	// Static file serving for uploads with Range request support for videos
-	r.GET("/static/*filepath", func(c *gin.Context) {
-		filePath := c.Param("filepath")
-		fullPath := filepath.Join("./storage", filePath)
+	r.GET("/static/*filepath", handlers.NewStaticHandler(cfg, store).Serve)
 
-		// Serve file with Range request support (important for video preview)
-		c.Header("Accept-Ranges", "bytes")
-		c.File(fullPath)
-	})
+	// Images resized and cropped on demand to a preset or whitelisted size
+	r.GET("/img/:size/*filepath", handlers.NewImageHandler(cfg, repos, store, marks).Serve)
 
 	// Health check
 	r.GET("/api/v1/healthz", handlers.HealthCheck)
@@ -45,13 +82,14 @@ func Setup(r *gin.Engine, cfg *config.Config, repos *database.Repositories) {
 			public.GET("/categories/:slug", categoryHandler.GetBySlug)
 
 			public.GET("/tags", handlers.NewTagHandler(repos).List)
+			public.GET("/tags/cloud", handlers.NewTagHandler(repos).Cloud)
 			public.GET("/tags/:slug", handlers.NewTagHandler(repos).GetBySlug)
 
 			// Home data
 			homeHandler := handlers.NewHomeHandler(repos)
 			public.GET("/home", homeHandler.GetHomeData)
 
-			articlesHandler := handlers.NewArticleHandler(repos)
+			articlesHandler := handlers.NewArticleHandler(repos, marks)
 			public.GET("/articles", articlesHandler.ListPublic)
 			public.GET("/articles/:slug", articlesHandler.GetBySlug)
 			public.GET("/articles/:slug/related", articlesHandler.GetRelated)
@@ -71,6 +109,7 @@ func Setup(r *gin.Engine, cfg *config.Config, repos *database.Repositories) {
 			public.GET("/menus", menuHandler.List) // Public menu listing
 
 			public.GET("/search", handlers.NewSearchHandler(repos).Search)
+			public.GET("/breadcrumbs", handlers.NewBreadcrumbHandler(repos).Get)
 
 			// Introduction pages (public)
 			introHandler := handlers.NewIntroductionHandler(repos)
@@ -78,26 +117,43 @@ func Setup(r *gin.Engine, cfg *config.Config, repos *database.Repositories) {
 			public.GET("/introduction/:key", introHandler.GetIntroductionPage)
 
 			// Activities
-			activityHandler := handlers.NewActivityHandler(repos)
+			activityHandler := handlers.NewActivityHandler(repos, marks)
 			public.GET("/activities", activityHandler.List)
 			public.GET("/activities/:slug", activityHandler.GetBySlug)
 
-			// Documents (public)
-			documentHandler := handlers.NewDocumentsHandler(repos)
-			public.GET("/documents", documentHandler.ListPublic)
-			public.GET("/documents/:slug", documentHandler.GetBySlug)
+			// Documents (public). Signed-in users also see the documents
+			// restricted to them.
+			documentHandler := handlers.NewDocumentsHandler(cfg, repos, store, guard, texts)
+			publicDocuments := public.Group("/documents")
+			publicDocuments.Use(middleware.OptionalAuth(cfg))
+			{
+				publicDocuments.GET("", documentHandler.ListPublic)
+				publicDocuments.GET("/:slug", documentHandler.GetBySlug)
+				publicDocuments.GET("/:slug/download", documentHandler.Download)
+				publicDocuments.HEAD("/:slug/download", documentHandler.Download)
+				publicDocuments.GET("/:slug/preview", documentHandler.Preview)
+				publicDocuments.HEAD("/:slug/preview", documentHandler.Preview)
+				publicDocuments.GET("/:slug/versions/:version/download", documentHandler.DownloadVersion)
+				publicDocuments.HEAD("/:slug/versions/:version/download", documentHandler.DownloadVersion)
+			}
+			public.GET("/document-terms", handlers.NewDocumentTermsHandler(repos).List)
 
 			// Media Items (public)
-			mediaItemHandler := handlers.NewMediaItemHandler(repos)
+			mediaItemHandler := handlers.NewMediaItemHandler(cfg, repos, store, marks, guard)
 			public.GET("/media-items", mediaItemHandler.ListPublic)
 			public.GET("/media-items/:slug", mediaItemHandler.GetBySlug)
 
+			// Albums (public)
+			albumHandler := handlers.NewAlbumHandler(repos, marks)
+			public.GET("/albums", albumHandler.ListPublic)
+			public.GET("/albums/:slug", albumHandler.GetBySlug)
+
 			commentsHandler := handlers.NewCommentHandler(repos)
 			public.GET("/comments/article/:article_id", commentsHandler.GetByArticle)
 			public.POST("/comments", commentsHandler.Create)
 
 			// Banners (public)
-			bannerHandler := handlers.NewBannerHandlerImpl(repos)
+			bannerHandler := handlers.NewBannerHandlerImpl(cfg, repos, store, marks)
 			public.GET("/banners", bannerHandler.GetByPlacement)
 		}
 
@@ -110,15 +166,16 @@ func Setup(r *gin.Engine, cfg *config.Config, repos *database.Repositories) {
 			protected.GET("/auth/me", handlers.NewAuthHandler(cfg, repos).Me)
 
 			// Upload (for rich text editor images)
-			protected.POST("/admin/uploads", handlers.NewUploadHandler().UploadImage)
+			protected.POST("/admin/uploads", handlers.NewUploadHandler(repos, store, marks).UploadImage)
 
 			// Articles (Author, Editor, Admin)
 			articles := protected.Group("/admin/articles")
 			articles.Use(middleware.RequireRoles("Admin", "Editor", "Author"))
 			{
-				handler := handlers.NewArticleHandler(repos)
+				handler := handlers.NewArticleHandler(repos, marks)
 				articles.GET("", handler.List)
 				articles.POST("", handler.Create)
+				articles.POST("/suggest-metadata", handler.SuggestMetadata)
 				articles.GET("/:id", handler.GetByID)
 				articles.PUT("/:id", handler.Update)
 				articles.DELETE("/:id", handler.Delete)
@@ -137,6 +194,8 @@ func Setup(r *gin.Engine, cfg *config.Config, repos *database.Repositories) {
 				handler := handlers.NewCategoryHandler(repos)
 				categories.POST("", handler.Create)
 				categories.PUT("/:id", handler.Update)
+				categories.GET("/:id/impact", handler.GetImpact)
+				categories.POST("/:id/merge", handler.Merge)
 				categories.DELETE("/:id", handler.Delete)
 			}
 
@@ -146,41 +205,113 @@ func Setup(r *gin.Engine, cfg *config.Config, repos *database.Repositories) {
 			{
 				handler := handlers.NewTagHandler(repos)
 				tags.POST("", handler.Create)
+				tags.POST("/cleanup", handler.Cleanup)
+				tags.PUT("/:id", handler.Update)
 				tags.DELETE("/:id", handler.Delete)
+				tags.POST("/:id/merge", handler.Merge)
 			}
 
 			// Media
 			media := protected.Group("/admin/media")
 			media.Use(middleware.RequireRoles("Admin", "Editor", "Author"))
 			{
-				handler := handlers.NewMediaItemHandler(repos)
+				handler := handlers.NewMediaItemHandler(cfg, repos, store, marks, guard)
 				media.GET("", handler.List)
+				media.GET("/tags", handler.Tags)
 				media.POST("/upload", handler.Upload)
 				media.GET("/:id", handler.GetByID)
 				media.DELETE("/:id", handler.Delete)
+
+				// Resumable (tus) uploads
+				media.OPTIONS("/uploads", uploads.Options)
+				media.POST("/uploads", uploads.Create)
+				media.HEAD("/uploads/:id", uploads.Head)
+				media.PATCH("/uploads/:id", uploads.Patch)
+				media.DELETE("/uploads/:id", uploads.Delete)
 			}
 
 			// Documents (Admin, Editor)
 			documents := protected.Group("/admin/documents")
 			documents.Use(middleware.RequireRoles("Admin", "Editor"))
 			{
-				handler := handlers.NewDocumentsHandler(repos)
+				handler := handlers.NewDocumentsHandler(cfg, repos, store, guard, texts)
 				documents.GET("", handler.List)
 				documents.POST("", handler.Create)
 				documents.POST("/upload", handler.Upload)
 				documents.PUT("/:id", handler.Update)
 				documents.DELETE("/:id", handler.Delete)
+				documents.GET("/:id/text", handler.GetText)
+				documents.POST("/:id/extract", handler.Extract)
+				documents.GET("/:id/versions", handler.ListVersions)
+				documents.POST("/:id/versions", handler.UploadVersion)
+				documents.GET("/:id/relations", handler.ListRelations)
+				documents.POST("/:id/relations", handler.CreateRelation)
+				documents.DELETE("/:id/relations/:relationId", handler.DeleteRelation)
+				documents.GET("/:id/access-log", handler.AccessLog)
+			}
+
+			// Document types, issuing authorities and signers (Admin, Editor)
+			documentTerms := protected.Group("/admin/document-terms")
+			documentTerms.Use(middleware.RequireRoles("Admin", "Editor"))
+			{
+				handler := handlers.NewDocumentTermsHandler(repos)
+				documentTerms.GET("", handler.List)
+				documentTerms.POST("", handler.Create)
+				documentTerms.PUT("/:id", handler.Update)
+				documentTerms.DELETE("/:id", handler.Delete)
 			}
 
 			// Media Items (Admin, Editor)
 			mediaItems := protected.Group("/admin/media-items")
 			mediaItems.Use(middleware.RequireRoles("Admin", "Editor"))
 			{
-				handler := handlers.NewMediaItemHandler(repos)
+				handler := handlers.NewMediaItemHandler(cfg, repos, store, marks, guard)
 				mediaItems.GET("", handler.List)
 				mediaItems.POST("", handler.Create)
 				mediaItems.PUT("/:id", handler.Update)
 				mediaItems.DELETE("/:id", handler.Delete)
+				mediaItems.POST("/move", handler.Move)
+			}
+
+			// Media library folders (Admin, Editor)
+			mediaFolders := protected.Group("/admin/media-folders")
+			mediaFolders.Use(middleware.RequireRoles("Admin", "Editor"))
+			{
+				handler := handlers.NewMediaFolderHandler(repos)
+				mediaFolders.GET("", handler.List)
+				mediaFolders.POST("", handler.Create)
+				mediaFolders.PUT("/:id", handler.Update)
+				mediaFolders.DELETE("/:id", handler.Delete)
+			}
+
+			// Crop presets and image focal points (Admin, Editor)
+			crops := protected.Group("/admin")
+			crops.Use(middleware.RequireRoles("Admin", "Editor"))
+			{
+				handler := handlers.NewCropHandler(cfg, repos, store, marks)
+				crops.GET("/crop-presets", handler.ListPresets)
+				crops.POST("/crop-presets", handler.CreatePreset)
+				crops.PUT("/crop-presets/:id", handler.UpdatePreset)
+				crops.DELETE("/crop-presets/:id", handler.DeletePreset)
+				crops.GET("/images/focal-point", handler.GetFocalPoint)
+				crops.PUT("/images/focal-point", handler.SetFocalPoint)
+				crops.DELETE("/images/focal-point", handler.DeleteFocalPoint)
+			}
+
+			// Albums (Admin, Editor)
+			albums := protected.Group("/admin/albums")
+			albums.Use(middleware.RequireRoles("Admin", "Editor"))
+			{
+				handler := handlers.NewAlbumHandler(repos, marks)
+				albums.GET("", handler.List)
+				albums.POST("", handler.Create)
+				albums.GET("/:id", handler.GetByID)
+				albums.PUT("/:id", handler.Update)
+				albums.DELETE("/:id", handler.Delete)
+				albums.POST("/:id/items", handler.AddItems)
+				albums.PUT("/:id/items/:media_id", handler.UpdateItem)
+				albums.DELETE("/:id/items/:media_id", handler.RemoveItem)
+				albums.PUT("/:id/order", handler.Reorder)
 			}
 
 			// Comments (Admin, Moderator)
@@ -197,7 +328,7 @@ func Setup(r *gin.Engine, cfg *config.Config, repos *database.Repositories) {
 			banners := protected.Group("/admin/banners")
 			banners.Use(middleware.RequireRoles("Admin", "Editor"))
 			{
-				handler := handlers.NewBannerHandlerImpl(repos)
+				handler := handlers.NewBannerHandlerImpl(cfg, repos, store, marks)
 				banners.GET("", handler.List)
 				banners.POST("", handler.Create)
 				banners.POST("/upload", handler.CreateWithUpload) // New: Upload with image
@@ -243,6 +374,25 @@ func Setup(r *gin.Engine, cfg *config.Config, repos *database.Repositories) {
 				settings.PUT("/:key", handler.Update)
 			}
 
+			// Watermark (Admin)
+			watermarks := protected.Group("/admin/watermark")
+			watermarks.Use(middleware.RequireRoles("Admin"))
+			{
+				handler := handlers.NewWatermarkHandler(repos, marks)
+				watermarks.GET("", handler.Get)
+				watermarks.PUT("", handler.Update)
+				watermarks.POST("/render", handler.Render)
+			}
+
+			// Quarantined uploads (Admin)
+			quarantined := protected.Group("/admin/quarantine")
+			quarantined.Use(middleware.RequireRoles("Admin"))
+			{
+				handler := handlers.NewQuarantineHandler(repos, guard)
+				quarantined.GET("", handler.List)
+				quarantined.DELETE("/:id", handler.Delete)
+			}
+
 			// Users (Admin)
 			users := protected.Group("/admin/users")
 			users.Use(middleware.RequireRoles("Admin"))
@@ -258,9 +408,9 @@ func Setup(r *gin.Engine, cfg *config.Config, repos *database.Repositories) {
 				users.PUT("/:id/password", handler.ChangePassword)
 			}
 
-			// Roles (Admin)
+			// Roles (Admin, Editor), which editors restrict documents to
 			roles := protected.Group("/admin/roles")
-			roles.Use(middleware.RequireRoles("Admin"))
+			roles.Use(middleware.RequireRoles("Admin", "Editor"))
 			{
 				handler := handlers.NewRoleHandler(repos)
 				roles.GET("", handler.List)
@@ -293,7 +443,7 @@ func Setup(r *gin.Engine, cfg *config.Config, repos *database.Repositories) {
 			activities := protected.Group("/admin/activities")
 			activities.Use(middleware.RequireRoles("Admin", "Editor"))
 			{
-				handler := handlers.NewActivityHandler(repos)
+				handler := handlers.NewActivityHandler(repos, marks)
 				activities.POST("", handler.Create)
 				activities.PUT("/:id", handler.Update)
 				activities.DELETE("/:id", handler.Delete)
@@ -301,4 +451,6 @@ func Setup(r *gin.Engine, cfg *config.Config, repos *database.Repositories) {
 			}
 		}
 	}
+
+	return &Workers{marks: marks, texts: texts, uploads: uploads}
 }
@@ -0,0 +1,256 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// Compound File Binary (OLE2) layout
+const (
+	cfbHeaderSize   = 512
+	cfbDirEntrySize = 128
+	cfbDIFATInline  = 109
+	cfbEndOfChain   = 0xFFFFFFFE
+	cfbMaxRegSect   = 0xFFFFFFFA
+	cfbStreamObject = 2
+	miniStreamLimit = 4096 // streams below this size live in the mini stream
+)
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// oleStreams names the stream a legacy Office document must have
+type oleStreams struct {
+	kind     string
+	required []string // any one of them
+}
+
+var (
+	wordStreams  = oleStreams{kind: "Word", required: []string{"worddocument"}}
+	excelStreams = oleStreams{kind: "Excel", required: []string{"workbook", "book"}}
+)
+
+// macroEntries are storages and streams that hold a VBA project
+var macroEntries = map[string]bool{
+	"macros":           true, // Word
+	"_vba_project_cur": true, // Excel
+	"vba":              true,
+	"_vba_project":     true,
+}
+
+// cfbEntry is a directory entry of a compound file
+type cfbEntry struct {
+	name  string
+	kind  byte
+	start uint32
+	size  uint64
+}
+
+// compoundFile reads the sector chains of an OLE2 file
+type compoundFile struct {
+	r          io.ReaderAt
+	size       int64
+	sectorSize int64
+	fat        []uint32
+}
+
+// checkOLE checks that a file is a compound file holding a legacy Word or
+// Excel document and that it carries no macros
+func checkOLE(r io.ReaderAt, size int64, want oleStreams) error {
+	header := make([]byte, cfbHeaderSize)
+	if size < cfbHeaderSize {
+		return malformed("not a %s document", want.kind)
+	}
+	if _, err := r.ReadAt(header, 0); err != nil && err != io.EOF {
+		return err
+	}
+	if !bytes.Equal(header[:8], cfbSignature) {
+		return malformed("not a %s document", want.kind)
+	}
+
+	cf := &compoundFile{r: r, size: size}
+	switch shift := binary.LittleEndian.Uint16(header[0x1E:]); shift {
+	case 9, 12:
+		cf.sectorSize = 1 << shift
+	default:
+		return malformed("unknown sector size 2^%d", shift)
+	}
+	if err := cf.loadFAT(header); err != nil {
+		return err
+	}
+
+	dir, err := cf.chain(binary.LittleEndian.Uint32(header[0x30:]))
+	if err != nil {
+		return err
+	}
+	found := false
+	var workbook *cfbEntry
+	for off := 0; off+cfbDirEntrySize <= len(dir); off += cfbDirEntrySize {
+		entry := parseDirEntry(dir[off : off+cfbDirEntrySize])
+		if entry.kind == 0 {
+			continue
+		}
+		name := strings.ToLower(entry.name)
+		if macroEntries[name] {
+			return ErrMacros
+		}
+		for _, required := range want.required {
+			if name == required && entry.kind == cfbStreamObject {
+				found = true
+				if name == "workbook" || name == "book" {
+					e := entry
+					workbook = &e
+				}
+			}
+		}
+	}
+	if !found {
+		return malformed("compound file holds no %s document", want.kind)
+	}
+
+	// Excel 4.0 macros are sheets of the workbook rather than a VBA project.
+	// Version 3 files only use the low 32 bits of stream sizes.
+	if workbook != nil && cf.sectorSize == 512 {
+		workbook.size &= 0xFFFFFFFF
+	}
+	if workbook != nil && workbook.size >= miniStreamLimit {
+		stream, err := cf.chain(workbook.start)
+		if err != nil {
+			return err
+		}
+		if uint64(len(stream)) > workbook.size {
+			stream = stream[:workbook.size]
+		}
+		if hasMacroSheet(stream) {
+			return ErrMacros
+		}
+	}
+	return nil
+}
+
+// loadFAT reads the sector allocation table, following the DIFAT chain for
+// files with more FAT sectors than the header lists
+func (cf *compoundFile) loadFAT(header []byte) error {
+	var fatSectors []uint32
+	for i := 0; i < cfbDIFATInline; i++ {
+		sect := binary.LittleEndian.Uint32(header[0x4C+4*i:])
+		if sect <= cfbMaxRegSect {
+			fatSectors = append(fatSectors, sect)
+		}
+	}
+	next := binary.LittleEndian.Uint32(header[0x44:])
+	perSector := int(cf.sectorSize/4) - 1
+	for seen := 0; next <= cfbMaxRegSect; seen++ {
+		if seen > int(cf.size/cf.sectorSize) {
+			return malformed("DIFAT chain loops")
+		}
+		data, err := cf.sector(next)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < perSector; i++ {
+			if sect := binary.LittleEndian.Uint32(data[4*i:]); sect <= cfbMaxRegSect {
+				fatSectors = append(fatSectors, sect)
+			}
+		}
+		next = binary.LittleEndian.Uint32(data[4*perSector:])
+	}
+
+	for _, sect := range fatSectors {
+		data, err := cf.sector(sect)
+		if err != nil {
+			return err
+		}
+		for i := 0; i+4 <= len(data); i += 4 {
+			cf.fat = append(cf.fat, binary.LittleEndian.Uint32(data[i:]))
+		}
+	}
+	return nil
+}
+
+// sector reads one sector; sector 0 follows the header
+func (cf *compoundFile) sector(n uint32) ([]byte, error) {
+	off := (int64(n) + 1) * cf.sectorSize
+	if off+cf.sectorSize > cf.size {
+		return nil, malformed("sector %d is past the end of the file", n)
+	}
+	data := make([]byte, cf.sectorSize)
+	if _, err := cf.r.ReadAt(data, off); err != nil && !(err == io.EOF && off+cf.sectorSize == cf.size) {
+		return nil, err
+	}
+	return data, nil
+}
+
+// chain reads the sectors of a chain starting at start
+func (cf *compoundFile) chain(start uint32) ([]byte, error) {
+	var data []byte
+	limit := int(cf.size / cf.sectorSize)
+	for sect, n := start, 0; sect != cfbEndOfChain; n++ {
+		if sect > cfbMaxRegSect || int(sect) >= len(cf.fat) || n > limit {
+			return nil, malformed("broken sector chain")
+		}
+		block, err := cf.sector(sect)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, block...)
+		sect = cf.fat[sect]
+	}
+	return data, nil
+}
+
+func parseDirEntry(raw []byte) cfbEntry {
+	nameLen := int(binary.LittleEndian.Uint16(raw[0x40:]))
+	if nameLen > 64 {
+		nameLen = 64
+	}
+	units := make([]uint16, 0, nameLen/2)
+	for i := 0; i+1 < nameLen; i += 2 {
+		if u := binary.LittleEndian.Uint16(raw[i:]); u != 0 {
+			units = append(units, u)
+		}
+	}
+	return cfbEntry{
+		name:  string(utf16.Decode(units)),
+		kind:  raw[0x42],
+		start: binary.LittleEndian.Uint32(raw[0x74:]),
+		size:  binary.LittleEndian.Uint64(raw[0x78:]),
+	}
+}
+
+// BIFF8 records read from the workbook globals
+const (
+	biffEOF        = 0x000A
+	biffFilePass   = 0x002F
+	biffBoundSheet = 0x0085
+	biffMacroSheet = 0x01 // BoundSheet8 sheet type of an Excel 4.0 macro sheet
+)
+
+// hasMacroSheet walks the globals substream of a BIFF8 workbook for sheets
+// of the Excel 4.0 macro type. Encrypted workbooks cannot be read and pass.
+func hasMacroSheet(stream []byte) bool {
+	for off := 0; off+4 <= len(stream); {
+		recordType := binary.LittleEndian.Uint16(stream[off:])
+		length := int(binary.LittleEndian.Uint16(stream[off+2:]))
+		body := off + 4
+		if body+length > len(stream) {
+			return false
+		}
+		switch recordType {
+		case biffFilePass:
+			return false
+		case biffBoundSheet:
+			if length >= 6 && stream[body+5] == biffMacroSheet {
+				return true
+			}
+		case biffEOF:
+			if off > 0 {
+				return false
+			}
+		}
+		off = body + length
+	}
+	return false
+}
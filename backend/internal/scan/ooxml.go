@@ -0,0 +1,189 @@
+package scan
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"path"
+	"strings"
+)
+
+// Limits guarding against zip bombs
+const (
+	maxZipEntries = 10000
+	maxPartSize   = 64 << 20  // a single XML part
+	maxUnzipped   = 512 << 20 // all entries together, as declared
+)
+
+// ooxmlPackage is what an OOXML package's main part must look like
+type ooxmlPackage struct {
+	dir          string   // folder of the main part, such as word/
+	contentTypes []string // accepted content types of the main part
+	macroTypes   []string // content types of the macro-enabled variants
+}
+
+var wordPackage = ooxmlPackage{
+	dir: "word/",
+	contentTypes: []string{
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.template.main+xml",
+	},
+	macroTypes: []string{
+		"application/vnd.ms-word.document.macroenabled.main+xml",
+		"application/vnd.ms-word.template.macroenabledtemplate.main+xml",
+	},
+}
+
+var excelPackage = ooxmlPackage{
+	dir: "xl/",
+	contentTypes: []string{
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.template.main+xml",
+	},
+	macroTypes: []string{
+		"application/vnd.ms-excel.sheet.macroenabled.main+xml",
+		"application/vnd.ms-excel.template.macroenabled.main+xml",
+		"application/vnd.ms-excel.addin.macroenabled.main+xml",
+		"application/vnd.ms-excel.sheet.binary.macroenabled.main",
+	},
+}
+
+// officeDocumentRel is the relationship type pointing at the main part
+const officeDocumentRel = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument"
+
+type contentTypes struct {
+	Defaults []struct {
+		Extension   string `xml:"Extension,attr"`
+		ContentType string `xml:"ContentType,attr"`
+	} `xml:"Default"`
+	Overrides []struct {
+		PartName    string `xml:"PartName,attr"`
+		ContentType string `xml:"ContentType,attr"`
+	} `xml:"Override"`
+}
+
+type relationships struct {
+	Relationships []struct {
+		Type   string `xml:"Type,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// checkOOXML checks that a file is a well-formed OOXML package of the given
+// kind: a readable ZIP whose package relationships point at a main part of
+// the right content type, with no VBA project in it
+func checkOOXML(r io.ReaderAt, size int64, kind ooxmlPackage) error {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return malformed("not a ZIP package: %v", err)
+	}
+	if len(archive.File) > maxZipEntries {
+		return malformed("package has %d entries", len(archive.File))
+	}
+
+	entries := make(map[string]*zip.File, len(archive.File))
+	var total uint64
+	for _, f := range archive.File {
+		name := strings.ToLower(f.Name)
+		if strings.HasSuffix(name, "vbaproject.bin") || strings.HasSuffix(name, "vbadata.xml") {
+			return ErrMacros
+		}
+		total += f.UncompressedSize64
+		if total > maxUnzipped {
+			return malformed("package expands beyond %d MB", maxUnzipped>>20)
+		}
+		entries[name] = f
+	}
+
+	var types contentTypes
+	if err := decodePart(entries, "[content_types].xml", &types); err != nil {
+		return err
+	}
+	for _, d := range types.Defaults {
+		if strings.Contains(strings.ToLower(d.ContentType), "vbaproject") {
+			return ErrMacros
+		}
+	}
+	for _, o := range types.Overrides {
+		if strings.Contains(strings.ToLower(o.ContentType), "vbaproject") {
+			return ErrMacros
+		}
+	}
+
+	var rels relationships
+	if err := decodePart(entries, "_rels/.rels", &rels); err != nil {
+		return err
+	}
+	main := ""
+	for _, rel := range rels.Relationships {
+		if rel.Type == officeDocumentRel {
+			main = strings.ToLower(path.Clean(strings.TrimPrefix(rel.Target, "/")))
+			break
+		}
+	}
+	if main == "" || !strings.HasPrefix(main, kind.dir) {
+		return malformed("package has no %s main document", strings.TrimSuffix(kind.dir, "/"))
+	}
+	if _, ok := entries[main]; !ok {
+		return malformed("main document %s is missing", main)
+	}
+
+	contentType := ""
+	for _, o := range types.Overrides {
+		if strings.EqualFold(strings.TrimPrefix(o.PartName, "/"), main) {
+			contentType = strings.ToLower(o.ContentType)
+		}
+	}
+	for _, t := range kind.macroTypes {
+		if contentType == t {
+			return ErrMacros
+		}
+	}
+	accepted := false
+	for _, t := range kind.contentTypes {
+		accepted = accepted || contentType == t
+	}
+	if !accepted {
+		return malformed("main document has content type %q", contentType)
+	}
+
+	// The main part must itself be well-formed XML
+	return decodePart(entries, main, nil)
+}
+
+// decodePart reads an XML part of the package into v, or only checks that it
+// is well-formed when v is nil
+func decodePart(entries map[string]*zip.File, name string, v interface{}) error {
+	f, ok := entries[name]
+	if !ok {
+		return malformed("package has no %s", name)
+	}
+	if f.UncompressedSize64 > maxPartSize {
+		return malformed("%s is larger than %d MB", name, maxPartSize>>20)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return malformed("reading %s: %v", name, err)
+	}
+	defer rc.Close()
+
+	// The reader checks the declared size and the checksum at EOF
+	decoder := xml.NewDecoder(io.LimitReader(rc, maxPartSize))
+	if v != nil {
+		err = decoder.Decode(v)
+	} else {
+		for err == nil {
+			_, err = decoder.Token()
+		}
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	if err == nil {
+		_, err = io.Copy(io.Discard, rc)
+	}
+	if err != nil {
+		return malformed("%s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package scan
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"strconv"
+)
+
+// Limits on the PDF streams inflated while looking for active content
+const (
+	maxPDFStream   = 16 << 20
+	maxPDFInflated = 128 << 20
+)
+
+// pdfNames are the name objects that raise each flag
+var pdfNames = map[string]string{
+	"JavaScript":    FlagJavaScript,
+	"JS":            FlagJavaScript,
+	"EmbeddedFile":  FlagEmbeddedFiles,
+	"EmbeddedFiles": FlagEmbeddedFiles,
+}
+
+// inspectPDF checks the PDF header and flags JavaScript and embedded files.
+// Names are matched after #xx escapes are decoded, both in the file and in
+// the Flate-compressed streams that object streams hide them in.
+func inspectPDF(r io.ReaderAt, size int64) ([]string, error) {
+	data := make([]byte, size)
+	if _, err := r.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	head := data[:min(len(data), 1024)]
+	if !bytes.Contains(head, []byte("%PDF-")) {
+		return nil, malformed("not a PDF document")
+	}
+
+	found := make(map[string]bool)
+	scanPDFNames(data, found)
+
+	inflated := 0
+	for off := 0; inflated < maxPDFInflated; {
+		i := bytes.Index(data[off:], []byte("stream"))
+		if i < 0 {
+			break
+		}
+		pos := off + i
+		start := pos + len("stream")
+		off = start
+		if pos >= 3 && string(data[pos-3:pos]) == "end" {
+			continue
+		}
+		if start < len(data) && data[start] == '\r' {
+			start++
+		}
+		if start < len(data) && data[start] == '\n' {
+			start++
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(data[start:]))
+		if err != nil {
+			continue
+		}
+		body, _ := io.ReadAll(io.LimitReader(zr, maxPDFStream))
+		zr.Close()
+		inflated += len(body)
+		scanPDFNames(body, found)
+	}
+
+	var flags []string
+	for _, flag := range []string{FlagJavaScript, FlagEmbeddedFiles} {
+		if found[flag] {
+			flags = append(flags, flag)
+		}
+	}
+	return flags, nil
+}
+
+// scanPDFNames records the flags raised by the name objects in data
+func scanPDFNames(data []byte, found map[string]bool) {
+	for i := 0; i < len(data); i++ {
+		if data[i] != '/' {
+			continue
+		}
+		j := i + 1
+		for j < len(data) && !isPDFDelimiter(data[j]) {
+			j++
+		}
+		if flag, ok := pdfNames[decodePDFName(data[i+1:j])]; ok {
+			found[flag] = true
+		}
+		i = j - 1
+	}
+}
+
+// decodePDFName resolves the #xx escapes of a name
+func decodePDFName(raw []byte) string {
+	if bytes.IndexByte(raw, '#') < 0 {
+		return string(raw)
+	}
+	name := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if b, err := strconv.ParseUint(string(raw[i+1:i+3]), 16, 8); err == nil {
+				name = append(name, byte(b))
+				i += 2
+				continue
+			}
+		}
+		name = append(name, raw[i])
+	}
+	return string(name)
+}
+
+func isPDFDelimiter(b byte) bool {
+	switch b {
+	case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
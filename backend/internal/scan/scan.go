@@ -0,0 +1,73 @@
+// Package scan checks uploaded documents against the format they claim to
+// be, finds active content such as macros and PDF JavaScript, and hands files
+// to an external malware scanner.
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrMalformed is returned for files that are not a well-formed instance of their declared type
+	ErrMalformed = errors.New("malformed document")
+	// ErrMacros is returned for Office documents carrying VBA or Excel 4.0 macros
+	ErrMacros = errors.New("document contains macros")
+	// ErrUnsupported is returned for MIME types Inspect has no check for
+	ErrUnsupported = errors.New("unsupported document type")
+)
+
+// Flags raised on documents that are accepted but should be reviewed before
+// they are published
+const (
+	FlagJavaScript    = "javascript"
+	FlagEmbeddedFiles = "embedded_files"
+)
+
+// Document MIME types
+const (
+	MIMEPDF  = "application/pdf"
+	MIMEDOC  = "application/msword"
+	MIMEDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MIMEXLS  = "application/vnd.ms-excel"
+	MIMEXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// Inspect checks that a file is the document type it is declared as and
+// returns the flags it raises. Office documents with macros fail with
+// ErrMacros; other failures wrap ErrMalformed.
+func Inspect(r io.ReaderAt, size int64, mimeType string) ([]string, error) {
+	switch mimeType {
+	case MIMEPDF:
+		return inspectPDF(r, size)
+	case MIMEDOCX:
+		return nil, checkOOXML(r, size, wordPackage)
+	case MIMEXLSX:
+		return nil, checkOOXML(r, size, excelPackage)
+	case MIMEDOC:
+		return nil, checkOLE(r, size, wordStreams)
+	case MIMEXLS:
+		return nil, checkOLE(r, size, excelStreams)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupported, mimeType)
+}
+
+// malformed wraps ErrMalformed with a description of the problem
+func malformed(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrMalformed, fmt.Sprintf(format, args...))
+}
+
+// Result is the verdict of a malware scanner
+type Result struct {
+	Infected  bool
+	Signature string // name of the detected threat
+}
+
+// Scanner is a malware scanner uploads are passed through before they are
+// stored. Implementations return an error when the file could not be
+// scanned, which callers treat as a refusal.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+}
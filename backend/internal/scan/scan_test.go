@@ -0,0 +1,309 @@
+package scan
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+const (
+	docxMain = "application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"
+	xlsxMain = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"
+	relsXML  = `<?xml version="1.0"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="` + officeDocumentRel + `" Target="%s"/></Relationships>`
+)
+
+// ooxmlFile zips the given parts into an OOXML package
+func ooxmlFile(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range parts {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// ooxmlParts are the parts of a minimal package whose main part is main with
+// the given content type
+func ooxmlParts(main, contentType string) map[string]string {
+	return map[string]string{
+		"[Content_Types].xml": `<?xml version="1.0"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/` + main + `" ContentType="` + contentType + `"/></Types>`,
+		"_rels/.rels": fmt.Sprintf(relsXML, main),
+		main:          `<?xml version="1.0"?><document><body/></document>`,
+	}
+}
+
+// cfbStream is a stream or storage of a test compound file
+type cfbStream struct {
+	name string
+	kind byte // 1 storage, 2 stream
+	data []byte
+}
+
+// compoundDocument builds a version 3 compound file: the FAT in sector 0,
+// the directory in sector 1 and the stream data after them
+func compoundDocument(entries []cfbStream) []byte {
+	const sectorSize = 512
+	var sectors [][]byte
+	fat := make([]uint32, sectorSize/4)
+	for i := range fat {
+		fat[i] = 0xFFFFFFFF
+	}
+	fat[0] = 0xFFFFFFFD
+	fat[1] = cfbEndOfChain
+
+	dir := make([]byte, sectorSize)
+	writeEntry := func(slot int, name string, kind byte, start uint32, size uint64) {
+		raw := dir[slot*cfbDirEntrySize : (slot+1)*cfbDirEntrySize]
+		units := utf16.Encode([]rune(name))
+		for i, u := range units {
+			binary.LittleEndian.PutUint16(raw[2*i:], u)
+		}
+		binary.LittleEndian.PutUint16(raw[0x40:], uint16(2*len(units)+2))
+		raw[0x42] = kind
+		binary.LittleEndian.PutUint32(raw[0x74:], start)
+		binary.LittleEndian.PutUint64(raw[0x78:], size)
+	}
+	writeEntry(0, "Root Entry", 5, cfbEndOfChain, 0)
+
+	next := uint32(2)
+	for i, entry := range entries {
+		start := uint32(cfbEndOfChain)
+		if len(entry.data) > 0 {
+			start = next
+			for off := 0; off < len(entry.data); off += sectorSize {
+				sector := make([]byte, sectorSize)
+				copy(sector, entry.data[off:])
+				sectors = append(sectors, sector)
+				fat[next] = next + 1
+				next++
+			}
+			fat[next-1] = cfbEndOfChain
+		}
+		writeEntry(i+1, entry.name, entry.kind, start, uint64(len(entry.data)))
+	}
+
+	header := make([]byte, cfbHeaderSize)
+	copy(header, cfbSignature)
+	binary.LittleEndian.PutUint16(header[0x1A:], 3)
+	binary.LittleEndian.PutUint16(header[0x1C:], 0xFFFE)
+	binary.LittleEndian.PutUint16(header[0x1E:], 9)
+	binary.LittleEndian.PutUint32(header[0x2C:], 1)
+	binary.LittleEndian.PutUint32(header[0x30:], 1)
+	binary.LittleEndian.PutUint32(header[0x44:], cfbEndOfChain)
+	for i := 0; i < cfbDIFATInline; i++ {
+		binary.LittleEndian.PutUint32(header[0x4C+4*i:], 0xFFFFFFFF)
+	}
+	binary.LittleEndian.PutUint32(header[0x4C:], 0)
+
+	fatSector := make([]byte, sectorSize)
+	for i, v := range fat {
+		binary.LittleEndian.PutUint32(fatSector[4*i:], v)
+	}
+
+	out := append(header, fatSector...)
+	out = append(out, dir...)
+	for _, sector := range sectors {
+		out = append(out, sector...)
+	}
+	return out
+}
+
+// workbookStream is a BIFF8 globals substream listing one sheet of the given
+// type, padded past the mini stream limit so it lives in regular sectors
+func workbookStream(sheetType byte) []byte {
+	var buf bytes.Buffer
+	record := func(recordType uint16, body []byte) {
+		binary.Write(&buf, binary.LittleEndian, recordType)
+		binary.Write(&buf, binary.LittleEndian, uint16(len(body)))
+		buf.Write(body)
+	}
+	record(0x0809, make([]byte, 16)) // BOF
+	record(biffBoundSheet, []byte{0, 0, 0, 0, 0, sheetType, 1, 0, 'S'})
+	record(biffEOF, nil)
+	for buf.Len() < miniStreamLimit {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+func deflate(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestInspectPDF(t *testing.T) {
+	compressed := append([]byte("%PDF-1.7\n1 0 obj <</Length 40 /Filter /FlateDecode>>\nstream\n"),
+		deflate(t, "<</Type /EmbeddedFile /Subtype /text>>")...)
+	compressed = append(compressed, []byte("\nendstream endobj\n%%EOF")...)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		flags   []string
+		wantErr error
+	}{
+		{"clean", []byte("%PDF-1.4\n1 0 obj <</Type /Catalog /Pages 2 0 R>> endobj\n%%EOF"), nil, nil},
+		{"javascript", []byte("%PDF-1.4\n1 0 obj <</S /JavaScript /JS (app.alert(1))>> endobj"), []string{FlagJavaScript}, nil},
+		{"escaped name", []byte("%PDF-1.4\n1 0 obj <</S /J#61vaScript>> endobj"), []string{FlagJavaScript}, nil},
+		{"both flags", []byte("%PDF-1.4 <</JS 1 /EmbeddedFiles 2>>"), []string{FlagJavaScript, FlagEmbeddedFiles}, nil},
+		{"compressed stream", compressed, []string{FlagEmbeddedFiles}, nil},
+		{"name prefix only", []byte("%PDF-1.4 <</JavaScriptX 1 /JSON 2>>"), nil, nil},
+		{"header after junk", append(bytes.Repeat([]byte{' '}, 100), []byte("%PDF-1.4")...), nil, nil},
+		{"truncated header", []byte("%PD"), nil, ErrMalformed},
+		{"empty", []byte{}, nil, ErrMalformed},
+		{"not a pdf", []byte("<html><body>/JavaScript</body></html>"), nil, ErrMalformed},
+		{"broken stream", []byte("%PDF-1.4\nstream\n\x78\x9c\xff\xff garbage\nendstream"), nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, err := Inspect(bytes.NewReader(tt.data), int64(len(tt.data)), MIMEPDF)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(flags, tt.flags) {
+				t.Errorf("flags = %v, want %v", flags, tt.flags)
+			}
+		})
+	}
+}
+
+func TestInspectOOXML(t *testing.T) {
+	valid := ooxmlFile(t, ooxmlParts("word/document.xml", docxMain))
+
+	withVBA := ooxmlParts("word/document.xml", docxMain)
+	withVBA["word/vbaProject.bin"] = "\x00"
+
+	macroType := ooxmlParts("word/document.xml", "application/vnd.ms-word.document.macroEnabled.main+xml")
+
+	badXML := ooxmlParts("word/document.xml", docxMain)
+	badXML["word/document.xml"] = `<document><body></document>`
+
+	noMain := ooxmlParts("word/document.xml", docxMain)
+	delete(noMain, "word/document.xml")
+
+	noRels := ooxmlParts("word/document.xml", docxMain)
+	delete(noRels, "_rels/.rels")
+
+	tests := []struct {
+		name     string
+		data     []byte
+		mimeType string
+		wantErr  error
+	}{
+		{"docx", valid, MIMEDOCX, nil},
+		{"xlsx", ooxmlFile(t, ooxmlParts("xl/workbook.xml", xlsxMain)), MIMEXLSX, nil},
+		{"docx declared as xlsx", valid, MIMEXLSX, ErrMalformed},
+		{"vba project", ooxmlFile(t, withVBA), MIMEDOCX, ErrMacros},
+		{"macro-enabled content type", ooxmlFile(t, macroType), MIMEDOCX, ErrMacros},
+		{"wrong main content type", ooxmlFile(t, ooxmlParts("word/document.xml", xlsxMain)), MIMEDOCX, ErrMalformed},
+		{"malformed main part", ooxmlFile(t, badXML), MIMEDOCX, ErrMalformed},
+		{"missing main part", ooxmlFile(t, noMain), MIMEDOCX, ErrMalformed},
+		{"missing relationships", ooxmlFile(t, noRels), MIMEDOCX, ErrMalformed},
+		{"truncated", valid[:len(valid)/2], MIMEDOCX, ErrMalformed},
+		{"not a zip", []byte("PK\x03\x04 but nothing else"), MIMEDOCX, ErrMalformed},
+		{"empty", []byte{}, MIMEXLSX, ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Inspect(bytes.NewReader(tt.data), int64(len(tt.data)), tt.mimeType)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInspectOLE(t *testing.T) {
+	doc := compoundDocument([]cfbStream{{name: "WordDocument", kind: cfbStreamObject, data: []byte("text")}})
+	badSignature := append([]byte{}, doc...)
+	badSignature[0] = 0
+	badSectorSize := append([]byte{}, doc...)
+	badSectorSize[0x1E] = 7
+
+	tests := []struct {
+		name     string
+		data     []byte
+		mimeType string
+		wantErr  error
+	}{
+		{"doc", doc, MIMEDOC, nil},
+		{"doc with macros", compoundDocument([]cfbStream{
+			{name: "WordDocument", kind: cfbStreamObject, data: []byte("text")},
+			{name: "Macros", kind: 1},
+		}), MIMEDOC, ErrMacros},
+		{"xls", compoundDocument([]cfbStream{{name: "Workbook", kind: cfbStreamObject, data: workbookStream(0)}}), MIMEXLS, nil},
+		{"xls with vba", compoundDocument([]cfbStream{
+			{name: "Workbook", kind: cfbStreamObject, data: workbookStream(0)},
+			{name: "_VBA_PROJECT_CUR", kind: 1},
+		}), MIMEXLS, ErrMacros},
+		{"xls with macro sheet", compoundDocument([]cfbStream{{name: "Workbook", kind: cfbStreamObject, data: workbookStream(biffMacroSheet)}}), MIMEXLS, ErrMacros},
+		{"doc declared as xls", doc, MIMEXLS, ErrMalformed},
+		{"bad signature", badSignature, MIMEDOC, ErrMalformed},
+		{"unknown sector size", badSectorSize, MIMEDOC, ErrMalformed},
+		{"truncated header", doc[:100], MIMEDOC, ErrMalformed},
+		{"truncated directory", doc[:cfbHeaderSize+512+10], MIMEDOC, ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Inspect(bytes.NewReader(tt.data), int64(len(tt.data)), tt.mimeType)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInspectUnsupported(t *testing.T) {
+	if _, err := Inspect(bytes.NewReader(nil), 0, "text/plain"); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("err = %v, want %v", err, ErrUnsupported)
+	}
+}
+
+func TestParseClamdReply(t *testing.T) {
+	tests := []struct {
+		reply   string
+		want    *Result
+		wantErr bool
+	}{
+		{"stream: OK", &Result{}, false},
+		{"stream: Eicar-Test-Signature FOUND", &Result{Infected: true, Signature: "Eicar-Test-Signature"}, false},
+		{"INSTREAM size limit exceeded. ERROR", nil, true},
+		{"", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reply, func(t *testing.T) {
+			got, err := parseClamdReply(tt.reply)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("result = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
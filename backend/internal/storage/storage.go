@@ -0,0 +1,171 @@
+// Package storage keeps uploaded files in a pluggable backend: a directory on
+// the local filesystem or a bucket on an S3-compatible object store.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/config"
+)
+
+// URLPrefix is the URL path stored objects are served under. An object's key
+// is its URL without this prefix, e.g. /static/uploads/images/a.jpg is stored
+// as uploads/images/a.jpg.
+const URLPrefix = "/static/"
+
+// PrivateURLPrefix is the URL path of private objects, such as the files of
+// restricted documents. They are never served under /static/, only by
+// handlers that check who asks; /private/documents/a.pdf is stored as
+// private/documents/a.pdf.
+const PrivateURLPrefix = "/private/"
+
+// privateKeyPrefix starts the keys of private objects
+const privateKeyPrefix = "private/"
+
+// Driver names accepted by Open
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+var (
+	// ErrNotFound is returned when no object is stored under a key
+	ErrNotFound = errors.New("storage: object not found")
+	// ErrNotSupported is returned by drivers that cannot presign URLs
+	ErrNotSupported = errors.New("storage: not supported by this driver")
+	// ErrInvalidKey is returned for empty keys and keys escaping the root
+	ErrInvalidKey = errors.New("storage: invalid key")
+)
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+}
+
+// Object is an open stored object. Seeking is cheap, so it can be handed to
+// http.ServeContent to answer Range requests.
+type Object interface {
+	io.ReadSeekCloser
+}
+
+// ReaderAt adapts an object for readers that jump around, such as the video
+// probe. The adapter is not safe for concurrent use.
+func ReaderAt(obj Object) io.ReaderAt {
+	if ra, ok := obj.(io.ReaderAt); ok {
+		return ra
+	}
+	return &seekReaderAt{obj: obj}
+}
+
+type seekReaderAt struct {
+	obj Object
+}
+
+func (r *seekReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := r.obj.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.obj, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Storage stores objects under slash-separated keys
+type Storage interface {
+	// Put stores size bytes read from r under key, replacing any previous object
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object stored under key
+	Get(ctx context.Context, key string) (Object, *ObjectInfo, error)
+	// Stat describes the object stored under key
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Delete removes the object stored under key. Missing objects are not an error.
+	Delete(ctx context.Context, key string) error
+	// PresignedURL returns a URL that fetches the object without credentials until it expires
+	PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error)
+	// List calls fn with every object whose key starts with prefix
+	List(ctx context.Context, prefix string, fn func(*ObjectInfo) error) error
+}
+
+// New opens the backend selected by STORAGE_DRIVER
+func New(cfg *config.Config) (Storage, error) {
+	return Open(cfg.StorageDriver, cfg)
+}
+
+// Open opens the named backend with the settings in cfg
+func Open(driver string, cfg *config.Config) (Storage, error) {
+	switch driver {
+	case DriverLocal, "":
+		return NewFilesystem(cfg.StorageDir), nil
+	case DriverS3:
+		return NewS3(S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("storage: unknown driver %q", driver)
+	}
+}
+
+// Key returns the key of the object at a /static/ or /private/ URL, or ""
+// for other URLs. Private objects have no /static/ URL.
+func Key(url string) string {
+	var key string
+	var err error
+	switch {
+	case strings.HasPrefix(url, URLPrefix):
+		key, err = cleanKey(strings.TrimPrefix(url, URLPrefix))
+		if IsPrivate(key) {
+			return ""
+		}
+	case strings.HasPrefix(url, PrivateURLPrefix):
+		key, err = cleanKey(strings.TrimPrefix(url, "/"))
+	default:
+		return ""
+	}
+	if err != nil {
+		return ""
+	}
+	return key
+}
+
+// URL returns the URL of an object: the /static/ URL it is served at, or
+// its /private/ URL
+func URL(key string) string {
+	if IsPrivate(key) {
+		return "/" + key
+	}
+	return URLPrefix + key
+}
+
+// IsPrivate reports whether a key is that of a private object
+func IsPrivate(key string) bool {
+	return strings.HasPrefix(key, privateKeyPrefix)
+}
+
+// cleanKey normalises a key and rejects ones that would leave the root
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || strings.Contains(key, "..") {
+		return "", ErrInvalidKey
+	}
+	return strings.TrimPrefix(cleaned, "/"), nil
+}
@@ -0,0 +1,75 @@
+// Package usage finds the uploaded files that articles, pages and banners
+// refer to, from their image fields and the links in their HTML content.
+package usage
+
+import (
+	"html"
+	"regexp"
+
+	"github.com/thieugt95/portal-365/backend/internal/imaging"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+)
+
+// Owner types
+const (
+	OwnerArticle = "article"
+	OwnerPage    = "page"
+	OwnerBanner  = "banner"
+)
+
+// Fields a file can be referenced from
+const (
+	FieldFeaturedImage = "featured_image"
+	FieldHeroImage     = "hero_image"
+	FieldImage         = "image"
+	FieldContent       = "content"
+)
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:src|href|poster)\s*=\s*["']([^"']+)["']`)
+
+// ContentURLs lists the uploaded files linked from HTML content, each once
+func ContentURLs(content string) []string {
+	seen := make(map[string]bool)
+	var urls []string
+	for _, match := range linkPattern.FindAllStringSubmatch(content, -1) {
+		if u := imaging.SourceURL(html.UnescapeString(match[1])); u != "" && !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// Article returns the files used by an article's featured image and content
+func Article(article *models.Article) []*models.FileReference {
+	refs := field(nil, FieldFeaturedImage, article.FeaturedImage)
+	return content(refs, article.Content)
+}
+
+// Page returns the files used by a page's hero image and content
+func Page(page *models.Page) []*models.FileReference {
+	var refs []*models.FileReference
+	if page.HeroImageURL != nil {
+		refs = field(refs, FieldHeroImage, *page.HeroImageURL)
+	}
+	return content(refs, page.Content)
+}
+
+// Banner returns the file shown by a banner
+func Banner(banner *models.Banner) []*models.FileReference {
+	return field(nil, FieldImage, banner.ImageURL)
+}
+
+func field(refs []*models.FileReference, name, value string) []*models.FileReference {
+	if u := imaging.SourceURL(value); u != "" {
+		refs = append(refs, &models.FileReference{URL: u, Field: name})
+	}
+	return refs
+}
+
+func content(refs []*models.FileReference, body string) []*models.FileReference {
+	for _, u := range ContentURLs(body) {
+		refs = append(refs, &models.FileReference{URL: u, Field: FieldContent})
+	}
+	return refs
+}
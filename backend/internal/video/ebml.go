@@ -0,0 +1,266 @@
+package video
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Matroska element IDs, with their length markers as they appear in files
+const (
+	idEBML          = 0x1A45DFA3
+	idDocType       = 0x4282
+	idSegment       = 0x18538067
+	idInfo          = 0x1549A966
+	idTimecodeScale = 0x2AD7B1
+	idDuration      = 0x4489
+	idTracks        = 0x1654AE6B
+	idTrackEntry    = 0xAE
+	idTrackType     = 0x83
+	idCodecID       = 0x86
+	idVideo         = 0xE0
+	idPixelWidth    = 0xB0
+	idPixelHeight   = 0xBA
+	idDisplayWidth  = 0x54B0
+	idDisplayHeight = 0x54BA
+	idDisplayUnit   = 0x54B2
+	idCluster       = 0x1F43B675
+)
+
+// maxEBMLHeaderSize bounds the Info and Tracks elements read into memory
+const maxEBMLHeaderSize = 4 << 20
+
+var matroskaCodecs = map[string]string{
+	"V_VP8":            "vp8",
+	"V_VP9":            "vp9",
+	"V_AV1":            "av1",
+	"V_MPEG4/ISO/AVC":  "h264",
+	"V_MPEGH/ISO/HEVC": "hevc",
+	"V_MPEG4/ISO/ASP":  "mpeg4",
+	"V_MJPEG":          "mjpeg",
+}
+
+// vint decodes an EBML variable-length integer. IDs keep their length marker,
+// sizes drop it; a size with all value bits set means "unknown".
+func vint(data []byte, keepMarker bool) (value uint64, length int, unknown bool) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0, false
+	}
+	length = 1
+	for mask := byte(0x80); data[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if len(data) < length {
+		return 0, 0, false
+	}
+
+	first := uint64(data[0])
+	if !keepMarker {
+		first &^= 0x80 >> (length - 1)
+	}
+	value = first
+	allOnes := first == uint64(0xFF>>length)
+	for _, b := range data[1:length] {
+		value = value<<8 | uint64(b)
+		allOnes = allOnes && b == 0xFF
+	}
+	return value, length, !keepMarker && allOnes
+}
+
+// elementHeader reads the ID and data size of the element at off
+func elementHeader(r io.ReaderAt, off, size int64) (id uint64, dataOff, dataSize int64, err error) {
+	n := int64(12)
+	if off+n > size {
+		n = size - off
+	}
+	head, err := readAt(r, off, n, size)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	id, idLen, _ := vint(head, true)
+	if idLen == 0 {
+		return 0, 0, 0, ErrMalformed
+	}
+	length, sizeLen, unknown := vint(head[idLen:], false)
+	if sizeLen == 0 {
+		return 0, 0, 0, ErrMalformed
+	}
+	dataOff = off + int64(idLen+sizeLen)
+	if unknown {
+		return id, dataOff, -1, nil
+	}
+	return id, dataOff, int64(length), nil
+}
+
+// walkElements calls fn for each element in an in-memory master element
+func walkElements(data []byte, fn func(id uint64, payload []byte)) {
+	for len(data) > 0 {
+		id, idLen, _ := vint(data, true)
+		if idLen == 0 {
+			return
+		}
+		length, sizeLen, unknown := vint(data[idLen:], false)
+		start := idLen + sizeLen
+		if sizeLen == 0 || unknown || uint64(len(data)-start) < length {
+			return
+		}
+		fn(id, data[start:start+int(length)])
+		data = data[start+int(length):]
+	}
+}
+
+func ebmlUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+func ebmlFloat(data []byte) float64 {
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data))
+	}
+	return 0
+}
+
+// probeEBML reads the doc type from the EBML header, then the Info and
+// Tracks elements of the first segment, stopping at the first cluster
+func probeEBML(r io.ReaderAt, size int64) (*Info, error) {
+	id, dataOff, dataSize, err := elementHeader(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	if id != idEBML || dataSize < 0 || dataSize > 4096 {
+		return nil, ErrMalformed
+	}
+	header, err := readAt(r, dataOff, dataSize, size)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{}
+	walkElements(header, func(id uint64, payload []byte) {
+		if id == idDocType {
+			info.Container = strings.TrimRight(string(payload), "\x00")
+		}
+	})
+	if info.Container != "webm" && info.Container != "matroska" {
+		return nil, ErrUnknownContainer
+	}
+
+	id, segmentOff, segmentSize, err := elementHeader(r, dataOff+dataSize, size)
+	if err != nil {
+		return nil, err
+	}
+	if id != idSegment {
+		return nil, ErrMalformed
+	}
+	segmentEnd := size
+	if segmentSize >= 0 && segmentOff+segmentSize < size {
+		segmentEnd = segmentOff + segmentSize
+	}
+
+	timecodeScale := uint64(1000000)
+	var duration float64
+	foundTracks, foundVideo := false, false
+
+	for off := segmentOff; off < segmentEnd; {
+		id, childOff, childSize, err := elementHeader(r, off, segmentEnd)
+		if err != nil || childSize < 0 || id == idCluster {
+			break // live recordings end their headers with an unsized cluster
+		}
+
+		switch id {
+		case idInfo, idTracks:
+			if childSize > maxEBMLHeaderSize {
+				return nil, ErrMalformed
+			}
+			payload, err := readAt(r, childOff, childSize, segmentEnd)
+			if err != nil {
+				return nil, err
+			}
+			if id == idInfo {
+				walkElements(payload, func(id uint64, value []byte) {
+					switch id {
+					case idTimecodeScale:
+						if scale := ebmlUint(value); scale > 0 {
+							timecodeScale = scale
+						}
+					case idDuration:
+						duration = ebmlFloat(value)
+					}
+				})
+			} else {
+				foundTracks = true
+				walkElements(payload, func(id uint64, entry []byte) {
+					if id == idTrackEntry && !foundVideo {
+						foundVideo = parseTrackEntry(entry, info)
+					}
+				})
+			}
+		}
+		off = childOff + childSize
+	}
+
+	if !foundTracks {
+		return nil, ErrMalformed
+	}
+	if !foundVideo {
+		return nil, ErrNoVideo
+	}
+	if duration > 0 && !math.IsInf(duration, 0) && !math.IsNaN(duration) {
+		info.Duration = time.Duration(duration * float64(timecodeScale))
+	}
+	return info, nil
+}
+
+// parseTrackEntry fills info from a video track and reports whether it was one
+func parseTrackEntry(entry []byte, info *Info) bool {
+	var trackType uint64
+	var codecID string
+	var pixelWidth, pixelHeight, displayWidth, displayHeight, displayUnit uint64
+
+	walkElements(entry, func(id uint64, value []byte) {
+		switch id {
+		case idTrackType:
+			trackType = ebmlUint(value)
+		case idCodecID:
+			codecID = strings.TrimRight(string(value), "\x00")
+		case idVideo:
+			walkElements(value, func(id uint64, value []byte) {
+				switch id {
+				case idPixelWidth:
+					pixelWidth = ebmlUint(value)
+				case idPixelHeight:
+					pixelHeight = ebmlUint(value)
+				case idDisplayWidth:
+					displayWidth = ebmlUint(value)
+				case idDisplayHeight:
+					displayHeight = ebmlUint(value)
+				case idDisplayUnit:
+					displayUnit = ebmlUint(value)
+				}
+			})
+		}
+	})
+	if trackType != 1 {
+		return false
+	}
+
+	info.Width, info.Height = int(pixelWidth), int(pixelHeight)
+	// Display size overrides pixels for anamorphic video, when given in pixels
+	if displayUnit == 0 && displayWidth > 0 && displayHeight > 0 {
+		info.Width, info.Height = int(displayWidth), int(displayHeight)
+	}
+	if name, ok := matroskaCodecs[codecID]; ok {
+		info.Codec = name
+	} else {
+		info.Codec = strings.ToLower(strings.TrimPrefix(codecID, "V_"))
+	}
+	return true
+}
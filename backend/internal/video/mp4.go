@@ -0,0 +1,229 @@
+package video
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxMoovSize bounds the movie header read into memory
+const maxMoovSize = 64 << 20
+
+// Top-level box types that may open an MP4 or QuickTime file
+var isoLeadingBoxes = map[string]bool{
+	"ftyp": true, "moov": true, "mdat": true, "free": true,
+	"skip": true, "wide": true, "pnot": true,
+}
+
+var mp4Codecs = map[string]string{
+	"avc1": "h264", "avc3": "h264",
+	"hev1": "hevc", "hvc1": "hevc",
+	"av01": "av1", "vp09": "vp9", "vp08": "vp8",
+	"mp4v": "mpeg4", "jpeg": "mjpeg",
+	"apcn": "prores", "apch": "prores", "apcs": "prores", "apco": "prores", "ap4h": "prores",
+}
+
+func isISOBox(typ string) bool {
+	return isoLeadingBoxes[typ]
+}
+
+// probeMP4 walks the top-level boxes for the file type and the movie header,
+// which may sit after the media data
+func probeMP4(r io.ReaderAt, size int64) (*Info, error) {
+	info := &Info{Container: "quicktime"} // files without ftyp predate MP4
+	var moov []byte
+
+	for off := int64(0); off+8 <= size; {
+		header, err := readAt(r, off, 8, size)
+		if err != nil {
+			return nil, err
+		}
+		boxSize, headerSize := int64(binary.BigEndian.Uint32(header)), int64(8)
+		typ := string(header[4:8])
+		switch boxSize {
+		case 0:
+			boxSize = size - off
+		case 1:
+			large, err := readAt(r, off+8, 8, size)
+			if err != nil {
+				return nil, err
+			}
+			boxSize, headerSize = int64(binary.BigEndian.Uint64(large)), 16
+		}
+		if boxSize < headerSize || off+boxSize > size {
+			return nil, ErrMalformed
+		}
+
+		switch typ {
+		case "ftyp":
+			brand, err := readAt(r, off+headerSize, 4, size)
+			if err != nil {
+				return nil, err
+			}
+			if string(brand) != "qt  " {
+				info.Container = "mp4"
+			}
+		case "moov":
+			if boxSize-headerSize > maxMoovSize {
+				return nil, ErrMalformed
+			}
+			if moov, err = readAt(r, off+headerSize, boxSize-headerSize, size); err != nil {
+				return nil, err
+			}
+		}
+		if moov != nil {
+			break
+		}
+		off += boxSize
+	}
+
+	if moov == nil {
+		return nil, ErrMalformed
+	}
+	found, err := parseMoov(moov, info)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrNoVideo
+	}
+	return info, nil
+}
+
+// walkBoxes calls fn for each box in data, stopping at the first error
+func walkBoxes(data []byte, fn func(typ string, payload []byte) error) error {
+	for len(data) >= 8 {
+		size, headerSize := uint64(binary.BigEndian.Uint32(data)), uint64(8)
+		typ := string(data[4:8])
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return ErrMalformed
+			}
+			size, headerSize = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			return ErrMalformed
+		}
+		if err := fn(typ, data[headerSize:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// parseMoov fills info from the movie header and its first video track,
+// reporting whether there was one
+func parseMoov(moov []byte, info *Info) (bool, error) {
+	foundVideo := false
+	err := walkBoxes(moov, func(typ string, payload []byte) error {
+		switch typ {
+		case "mvhd":
+			info.Duration = mvhdDuration(payload)
+		case "trak":
+			if foundVideo {
+				return nil
+			}
+			track := parseTrak(payload)
+			if track.handler == "vide" {
+				foundVideo = true
+				info.Width, info.Height, info.Codec = track.width, track.height, track.codec
+			}
+		}
+		return nil
+	})
+	return foundVideo, err
+}
+
+func mvhdDuration(p []byte) time.Duration {
+	var timescale, duration uint64
+	switch {
+	case len(p) >= 32 && p[0] == 1:
+		timescale = uint64(binary.BigEndian.Uint32(p[20:]))
+		duration = binary.BigEndian.Uint64(p[24:])
+	case len(p) >= 20:
+		timescale = uint64(binary.BigEndian.Uint32(p[12:]))
+		duration = uint64(binary.BigEndian.Uint32(p[16:]))
+	}
+	// All ones means the duration is unknown, e.g. in fragmented files
+	if timescale == 0 || duration == 0xFFFFFFFF || duration == 0xFFFFFFFFFFFFFFFF {
+		return 0
+	}
+	return time.Duration(duration/timescale)*time.Second + time.Duration(duration%timescale)*time.Second/time.Duration(timescale)
+}
+
+type mp4Track struct {
+	handler       string
+	width, height int
+	codec         string
+}
+
+func parseTrak(trak []byte) mp4Track {
+	var track mp4Track
+	_ = walkBoxes(trak, func(typ string, payload []byte) error {
+		switch typ {
+		case "tkhd":
+			track.width, track.height = tkhdSize(payload)
+		case "mdia":
+			_ = walkBoxes(payload, func(typ string, payload []byte) error {
+				switch typ {
+				case "hdlr":
+					if len(payload) >= 12 {
+						track.handler = string(payload[8:12])
+					}
+				case "minf":
+					track.codec = sampleEntryCodec(payload)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return track
+}
+
+// tkhdSize returns the display size of a track, swapped when its matrix
+// rotates it by 90 degrees
+func tkhdSize(p []byte) (int, int) {
+	offset := 40 // matrix in version 0, followed by 16.16 width and height
+	if len(p) > 0 && p[0] == 1 {
+		offset = 52
+	}
+	if len(p) < offset+44 {
+		return 0, 0
+	}
+	matrix := p[offset : offset+36]
+	width := int(binary.BigEndian.Uint32(p[offset+36:]) >> 16)
+	height := int(binary.BigEndian.Uint32(p[offset+40:]) >> 16)
+	a, d := binary.BigEndian.Uint32(matrix[0:]), binary.BigEndian.Uint32(matrix[16:])
+	if a == 0 && d == 0 {
+		width, height = height, width
+	}
+	return width, height
+}
+
+// sampleEntryCodec reads the format of the first sample description in minf/stbl/stsd
+func sampleEntryCodec(minf []byte) string {
+	codec := ""
+	_ = walkBoxes(minf, func(typ string, payload []byte) error {
+		if typ != "stbl" {
+			return nil
+		}
+		return walkBoxes(payload, func(typ string, payload []byte) error {
+			if typ == "stsd" && len(payload) >= 16 {
+				fourCC := string(payload[12:16])
+				if name, ok := mp4Codecs[fourCC]; ok {
+					codec = name
+				} else {
+					codec = strings.TrimSpace(fourCC)
+				}
+			}
+			return nil
+		})
+	})
+	return codec
+}
@@ -0,0 +1,98 @@
+// Package video reads duration, resolution and codec from uploaded video
+// containers without external tools.
+package video
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var (
+	// ErrUnknownContainer is returned for files that are not a supported video container
+	ErrUnknownContainer = errors.New("unrecognised video container")
+	// ErrMalformed is returned when a recognised container has damaged or missing headers
+	ErrMalformed = errors.New("malformed video container")
+	// ErrNoVideo is returned for containers without a video track
+	ErrNoVideo = errors.New("file has no video track")
+)
+
+// Info describes the first video track of a file
+type Info struct {
+	Container string // mp4, quicktime, webm, matroska, avi, mpeg
+	Duration  time.Duration
+	Width     int
+	Height    int
+	Codec     string
+}
+
+// Seconds returns the duration rounded to whole seconds
+func (i *Info) Seconds() int {
+	return int(i.Duration.Round(time.Second) / time.Second)
+}
+
+// mimeContainers lists the containers accepted for each declared video MIME
+// type. QuickTime uploads are often plain ISO MP4 files with a .mov name.
+var mimeContainers = map[string][]string{
+	"video/mp4":       {"mp4"},
+	"video/quicktime": {"quicktime", "mp4"},
+	"video/webm":      {"webm"},
+	"video/x-msvideo": {"avi"},
+	"video/mpeg":      {"mpeg"},
+}
+
+// Probe detects the container of a file and reads its headers
+func Probe(r io.ReaderAt, size int64) (*Info, error) {
+	head := make([]byte, 16)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	if len(head) < 12 {
+		return nil, ErrUnknownContainer
+	}
+
+	switch {
+	case isISOBox(string(head[4:8])):
+		return probeMP4(r, size)
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return probeEBML(r, size)
+	case string(head[:4]) == "RIFF" && string(head[8:12]) == "AVI ":
+		return probeAVI(r, size)
+	case bytes.HasPrefix(head, []byte{0x00, 0x00, 0x01, 0xBA}),
+		bytes.HasPrefix(head, []byte{0x00, 0x00, 0x01, 0xB3}),
+		head[0] == 0x47 && isTransportStream(r, size):
+		return probeMPEG(r, size)
+	}
+	return nil, ErrUnknownContainer
+}
+
+// ProbeMIME probes a file and checks its container against the declared MIME type
+func ProbeMIME(r io.ReaderAt, size int64, mimeType string) (*Info, error) {
+	info, err := Probe(r, size)
+	if err != nil {
+		return nil, err
+	}
+	for _, container := range mimeContainers[mimeType] {
+		if info.Container == container {
+			return info, nil
+		}
+	}
+	return nil, fmt.Errorf("file is a %s container, not %s", info.Container, mimeType)
+}
+
+// readAt reads exactly n bytes at off, failing with ErrMalformed when the
+// file is shorter
+func readAt(r io.ReaderAt, off, n, size int64) ([]byte, error) {
+	if off < 0 || n < 0 || off+n > size {
+		return nil, ErrMalformed
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, off); err != nil && !(err == io.EOF && off+n == size) {
+		return nil, err
+	}
+	return buf, nil
+}
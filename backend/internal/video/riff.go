@@ -0,0 +1,155 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxHeaderListSize bounds the AVI hdrl list read into memory
+const maxHeaderListSize = 1 << 20
+
+// mpegScanSize is how far into an MPEG stream the sequence header is looked for
+const mpegScanSize = 256 << 10
+
+var aviCodecs = map[string]string{
+	"h264": "h264", "x264": "h264", "avc1": "h264",
+	"hevc": "hevc", "h265": "hevc",
+	"xvid": "mpeg4", "divx": "mpeg4", "dx50": "mpeg4", "fmp4": "mpeg4",
+	"mjpg": "mjpeg",
+}
+
+// probeAVI reads the main AVI header and the first video stream format from
+// the hdrl list at the start of the file
+func probeAVI(r io.ReaderAt, size int64) (*Info, error) {
+	info := &Info{Container: "avi"}
+
+	var hdrl []byte
+	for off := int64(12); off+12 <= size; {
+		header, err := readAt(r, off, 12, size)
+		if err != nil {
+			return nil, err
+		}
+		chunkSize := int64(binary.LittleEndian.Uint32(header[4:]))
+		if string(header[:4]) == "LIST" && string(header[8:12]) == "hdrl" {
+			if chunkSize < 4 || chunkSize > maxHeaderListSize {
+				return nil, ErrMalformed
+			}
+			if hdrl, err = readAt(r, off+12, chunkSize-4, size); err != nil {
+				return nil, err
+			}
+			break
+		}
+		off += 8 + chunkSize + chunkSize%2
+	}
+	if hdrl == nil {
+		return nil, ErrMalformed
+	}
+
+	foundVideo := false
+	walkRIFF(hdrl, func(id string, payload []byte) {
+		switch {
+		case id == "avih" && len(payload) >= 40:
+			usPerFrame := binary.LittleEndian.Uint32(payload[0:])
+			totalFrames := binary.LittleEndian.Uint32(payload[16:])
+			info.Duration = time.Duration(uint64(usPerFrame)*uint64(totalFrames)) * time.Microsecond
+			info.Width = int(binary.LittleEndian.Uint32(payload[32:]))
+			info.Height = int(binary.LittleEndian.Uint32(payload[36:]))
+		case id == "LIST" && len(payload) >= 4 && string(payload[:4]) == "strl" && !foundVideo:
+			foundVideo = parseStreamList(payload[4:], info)
+		}
+	})
+	if !foundVideo {
+		return nil, ErrNoVideo
+	}
+	return info, nil
+}
+
+// parseStreamList reads the codec of a video stream list and reports whether it was one
+func parseStreamList(strl []byte, info *Info) bool {
+	isVideo := false
+	var handler, compression string
+	walkRIFF(strl, func(id string, payload []byte) {
+		switch {
+		case id == "strh" && len(payload) >= 8:
+			isVideo = string(payload[:4]) == "vids"
+			handler = string(payload[4:8])
+		case id == "strf" && len(payload) >= 20:
+			compression = string(payload[16:20]) // BITMAPINFOHEADER biCompression
+		}
+	})
+	if !isVideo {
+		return false
+	}
+
+	fourCC := compression
+	if strings.Trim(fourCC, "\x00 ") == "" {
+		fourCC = handler
+	}
+	fourCC = strings.ToLower(strings.Trim(fourCC, "\x00 "))
+	if name, ok := aviCodecs[fourCC]; ok {
+		info.Codec = name
+	} else {
+		info.Codec = fourCC
+	}
+	return true
+}
+
+func walkRIFF(data []byte, fn func(id string, payload []byte)) {
+	for len(data) >= 8 {
+		size := int(binary.LittleEndian.Uint32(data[4:]))
+		if size < 0 || 8+size > len(data) {
+			return
+		}
+		fn(string(data[:4]), data[8:8+size])
+		next := 8 + size + size%2
+		if next > len(data) {
+			return
+		}
+		data = data[next:]
+	}
+}
+
+// isTransportStream checks for the sync byte of consecutive 188-byte packets
+func isTransportStream(r io.ReaderAt, size int64) bool {
+	for _, off := range []int64{188, 376} {
+		b, err := readAt(r, off, 1, size)
+		if err != nil || b[0] != 0x47 {
+			return false
+		}
+	}
+	return true
+}
+
+// probeMPEG reads the frame size from the first MPEG-1/2 sequence header. MPEG
+// streams carry no overall duration, and transport streams holding other
+// codecs only yield their container.
+func probeMPEG(r io.ReaderAt, size int64) (*Info, error) {
+	info := &Info{Container: "mpeg"}
+
+	n := int64(mpegScanSize)
+	if n > size {
+		n = size
+	}
+	data, err := readAt(r, 0, n, size)
+	if err != nil {
+		return nil, err
+	}
+
+	i := bytes.Index(data, []byte{0x00, 0x00, 0x01, 0xB3})
+	if i < 0 || i+7 > len(data) {
+		return info, nil
+	}
+	seq := data[i+4:]
+	info.Width = int(seq[0])<<4 | int(seq[1])>>4
+	info.Height = int(seq[1]&0x0F)<<8 | int(seq[2])
+
+	// A sequence extension (start code B5, extension ID 1) marks MPEG-2
+	info.Codec = "mpeg1video"
+	if j := bytes.Index(seq, []byte{0x00, 0x00, 0x01, 0xB5}); j >= 0 && j+4 < len(seq) && seq[j+4]>>4 == 1 {
+		info.Codec = "mpeg2video"
+	}
+	return info, nil
+}
@@ -0,0 +1,235 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// box builds an ISO BMFF box from its type and payload parts
+func box(typ string, parts ...[]byte) []byte {
+	payload := bytes.Join(parts, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	return append(append(out, typ...), payload...)
+}
+
+func u32(values ...uint32) []byte {
+	var out []byte
+	for _, v := range values {
+		out = binary.BigEndian.AppendUint32(out, v)
+	}
+	return out
+}
+
+// mp4Trak is a trak box for a track of the given handler, display size and
+// sample format; rotated puts a 90 degree matrix in the track header
+func mp4Trak(handler string, width, height uint32, format string, rotated bool) []byte {
+	a, d := uint32(0x00010000), uint32(0x00010000)
+	if rotated {
+		a, d = 0, 0
+	}
+	tkhd := append(make([]byte, 40), u32(a, 0, 0, 0, d, 0, 0, 0, 0x40000000, width<<16, height<<16)...)
+	hdlr := append(u32(0, 0), append([]byte(handler), make([]byte, 13)...)...)
+	stsd := append(u32(0, 1), box(format, make([]byte, 8))...)
+	return box("trak",
+		box("tkhd", tkhd),
+		box("mdia", box("hdlr", hdlr), box("minf", box("stbl", box("stsd", stsd)))))
+}
+
+// mp4Moov is a movie header lasting duration/timescale seconds with the given tracks
+func mp4Moov(timescale, duration uint32, traks ...[]byte) []byte {
+	mvhd := append(u32(0, 0, 0, timescale, duration), make([]byte, 80)...)
+	return box("moov", append([][]byte{box("mvhd", mvhd)}, traks...)...)
+}
+
+// ebml builds a Matroska element with an eight byte size
+func ebml(id uint64, parts ...[]byte) []byte {
+	payload := bytes.Join(parts, nil)
+	var out []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(out) > 0 {
+			out = append(out, b)
+		}
+	}
+	size := binary.BigEndian.AppendUint64(nil, uint64(len(payload)))
+	size[0] = 0x01
+	return append(append(out, size...), payload...)
+}
+
+func ebmlFloat64(v float64) []byte {
+	return binary.BigEndian.AppendUint64(nil, math.Float64bits(v))
+}
+
+// matroskaFile is a file of the given doc type whose segment holds children
+func matroskaFile(docType string, children ...[]byte) []byte {
+	return append(ebml(idEBML, ebml(idDocType, []byte(docType))), ebml(idSegment, children...)...)
+}
+
+func matroskaTrack(trackType byte, codec string, width, height byte) []byte {
+	return ebml(idTrackEntry,
+		ebml(idTrackType, []byte{trackType}),
+		ebml(idCodecID, []byte(codec)),
+		ebml(idVideo, ebml(idPixelWidth, []byte{0x02, width}), ebml(idPixelHeight, []byte{0x01, height})))
+}
+
+// riffChunk builds a RIFF chunk, padded to an even size
+func riffChunk(id string, parts ...[]byte) []byte {
+	payload := bytes.Join(parts, nil)
+	out := append([]byte(id), binary.LittleEndian.AppendUint32(nil, uint32(len(payload)))...)
+	out = append(out, payload...)
+	if len(payload)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+func le32(values ...uint32) []byte {
+	var out []byte
+	for _, v := range values {
+		out = binary.LittleEndian.AppendUint32(out, v)
+	}
+	return out
+}
+
+// aviFile is an AVI lasting frames*usPerFrame with one stream of the given kind
+func aviFile(streamType, fourCC string, usPerFrame, frames uint32) []byte {
+	avih := append(le32(usPerFrame, 0, 0, 0, frames, 0, 0, 0, 320, 240), make([]byte, 16)...)
+	strh := append([]byte(streamType+fourCC), make([]byte, 48)...)
+	strf := append(le32(40, 320, 240, 0), append([]byte(fourCC), make([]byte, 20)...)...)
+	hdrl := riffChunk("LIST", []byte("hdrl"), riffChunk("avih", avih),
+		riffChunk("LIST", []byte("strl"), riffChunk("strh", strh), riffChunk("strf", strf)))
+	body := append([]byte("AVI "), hdrl...)
+	body = append(body, riffChunk("LIST", []byte("movi"))...)
+	return riffChunk("RIFF", body)
+}
+
+func TestProbe(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom"), u32(512), []byte("isomavc1"))
+	video := mp4Trak("vide", 1920, 1080, "avc1", false)
+	audio := mp4Trak("soun", 0, 0, "mp4a", false)
+	mp4 := bytes.Join([][]byte{ftyp, mp4Moov(1000, 12500, audio, video), box("mdat", make([]byte, 64))}, nil)
+
+	webm := matroskaFile("webm",
+		ebml(idInfo, ebml(idTimecodeScale, []byte{0x0F, 0x42, 0x40}), ebml(idDuration, ebmlFloat64(2500))),
+		ebml(idTracks, matroskaTrack(2, "A_OPUS", 0, 0), matroskaTrack(1, "V_VP9", 0x80, 0x68)))
+
+	mpeg2 := append([]byte{0x00, 0x00, 0x01, 0xBA}, make([]byte, 10)...)
+	mpeg2 = append(mpeg2, 0x00, 0x00, 0x01, 0xB3, 0x2D, 0x02, 0x40, 0x33, 0xFF, 0xFF, 0xE0)
+	mpeg2 = append(mpeg2, 0x00, 0x00, 0x01, 0xB5, 0x14, 0x8A)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *Info
+		wantErr error
+	}{
+		{"mp4", mp4, &Info{Container: "mp4", Duration: 12500 * time.Millisecond, Width: 1920, Height: 1080, Codec: "h264"}, nil},
+		{"mp4 with moov last", bytes.Join([][]byte{ftyp, box("mdat", make([]byte, 64)), mp4Moov(600, 300, video)}, nil),
+			&Info{Container: "mp4", Duration: 500 * time.Millisecond, Width: 1920, Height: 1080, Codec: "h264"}, nil},
+		{"quicktime rotated", bytes.Join([][]byte{box("ftyp", []byte("qt  "), u32(0)), mp4Moov(1, 3, mp4Trak("vide", 1920, 1080, "apch", true))}, nil),
+			&Info{Container: "quicktime", Duration: 3 * time.Second, Width: 1080, Height: 1920, Codec: "prores"}, nil},
+		{"mp4 unknown sample format", bytes.Join([][]byte{ftyp, mp4Moov(1, 0, mp4Trak("vide", 64, 48, "xyz ", false))}, nil),
+			&Info{Container: "mp4", Width: 64, Height: 48, Codec: "xyz"}, nil},
+		{"mp4 audio only", bytes.Join([][]byte{ftyp, mp4Moov(1000, 1000, audio)}, nil), nil, ErrNoVideo},
+		{"mp4 without moov", bytes.Join([][]byte{ftyp, box("mdat", make([]byte, 16))}, nil), nil, ErrMalformed},
+		{"mp4 truncated", mp4[:len(ftyp)+40], nil, ErrMalformed},
+		{"mp4 box past the end", append(append(append([]byte{}, ftyp...), u32(1<<20)...), "moov"...), nil, ErrMalformed},
+		{"webm", webm, &Info{Container: "webm", Duration: 2500 * time.Millisecond, Width: 640, Height: 360, Codec: "vp9"}, nil},
+		{"matroska", matroskaFile("matroska", ebml(idTracks, matroskaTrack(1, "V_MPEG4/ISO/AVC", 0x00, 0xD0))),
+			&Info{Container: "matroska", Width: 512, Height: 464, Codec: "h264"}, nil},
+		{"matroska audio only", matroskaFile("webm", ebml(idTracks, matroskaTrack(2, "A_VORBIS", 0, 0))), nil, ErrNoVideo},
+		{"matroska without tracks", matroskaFile("webm", ebml(idInfo)), nil, ErrMalformed},
+		{"matroska unknown doc type", matroskaFile("mka3d"), nil, ErrUnknownContainer},
+		{"webm truncated", webm[:len(webm)-20], nil, ErrMalformed},
+		{"avi", aviFile("vids", "H264", 40000, 250), &Info{Container: "avi", Duration: 10 * time.Second, Width: 320, Height: 240, Codec: "h264"}, nil},
+		{"avi xvid", aviFile("vids", "XVID", 33367, 30), &Info{Container: "avi", Duration: 1001010 * time.Microsecond, Width: 320, Height: 240, Codec: "mpeg4"}, nil},
+		{"avi audio only", aviFile("auds", "\x01\x00\x00\x00", 40000, 25), nil, ErrNoVideo},
+		{"avi without header list", riffChunk("RIFF", []byte("AVI "), riffChunk("JUNK", make([]byte, 8))), nil, ErrMalformed},
+		{"mpeg-2 program stream", mpeg2, &Info{Container: "mpeg", Width: 720, Height: 576, Codec: "mpeg2video"}, nil},
+		{"mpeg without sequence header", append([]byte{0x00, 0x00, 0x01, 0xBA}, make([]byte, 20)...), &Info{Container: "mpeg"}, nil},
+		{"too short", []byte("ftyp"), nil, ErrUnknownContainer},
+		{"text", []byte("this is not a video at all"), nil, ErrUnknownContainer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Probe(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want != nil && *got != *tt.want {
+				t.Errorf("info = %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeMIME(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom"), u32(512))
+	mp4 := append(ftyp, mp4Moov(1000, 1000, mp4Trak("vide", 640, 480, "avc1", false))...)
+
+	tests := []struct {
+		mimeType string
+		wantErr  bool
+	}{
+		{"video/mp4", false},
+		{"video/quicktime", false},
+		{"video/webm", true},
+		{"video/x-msvideo", true},
+		{"application/octet-stream", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mimeType, func(t *testing.T) {
+			_, err := ProbeMIME(bytes.NewReader(mp4), int64(len(mp4)), tt.mimeType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSeconds(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		want     int
+	}{
+		{0, 0},
+		{499 * time.Millisecond, 0},
+		{500 * time.Millisecond, 1},
+		{90*time.Second + 600*time.Millisecond, 91},
+	}
+	for _, tt := range tests {
+		if got := (&Info{Duration: tt.duration}).Seconds(); got != tt.want {
+			t.Errorf("Seconds(%v) = %d, want %d", tt.duration, got, tt.want)
+		}
+	}
+}
+
+func TestVint(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		keepMarker bool
+		value      uint64
+		length     int
+		unknown    bool
+	}{
+		{"one byte size", []byte{0x81}, false, 1, 1, false},
+		{"two byte size", []byte{0x40, 0x02}, false, 2, 2, false},
+		{"id keeps marker", []byte{0x1A, 0x45, 0xDF, 0xA3}, true, idEBML, 4, false},
+		{"unknown size", []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, false, 1<<56 - 1, 8, true},
+		{"truncated", []byte{0x40}, false, 0, 0, false},
+		{"zero byte", []byte{0x00, 0x81}, false, 0, 0, false},
+		{"empty", nil, false, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, length, unknown := vint(tt.data, tt.keepMarker)
+			if value != tt.value || length != tt.length || unknown != tt.unknown {
+				t.Errorf("vint = (%d, %d, %v), want (%d, %d, %v)", value, length, unknown, tt.value, tt.length, tt.unknown)
+			}
+		})
+	}
+}
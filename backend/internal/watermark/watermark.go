@@ -0,0 +1,406 @@
+// Package watermark draws the configured logo over the public renditions of
+// images in the selected categories and albums, and keeps rendition sets in
+// step when the settings change or an image joins or leaves the selection.
+package watermark
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thieugt95/portal-365/backend/internal/database"
+	"github.com/thieugt95/portal-365/backend/internal/imaging"
+	"github.com/thieugt95/portal-365/backend/internal/models"
+	"github.com/thieugt95/portal-365/backend/internal/singleflight"
+	"github.com/thieugt95/portal-365/backend/internal/storage"
+)
+
+// SettingKey is the setting the watermark configuration is stored under
+const SettingKey = "watermark"
+
+// batchSize caps the sources looked up in one coverage query
+const batchSize = 200
+
+var (
+	// ErrRunning is returned when a re-render is started while one is running
+	ErrRunning = errors.New("a watermark re-render is already running")
+	// ErrInvalidLogo is returned for logos that cannot be read or drawn
+	ErrInvalidLogo = errors.New("invalid watermark")
+)
+
+// Service renders images with the watermark they are due and redraws
+// rendition sets whose watermark is out of date
+type Service struct {
+	repos    *database.Repositories
+	store    storage.Storage
+	renderer *imaging.Renderer
+	flight   singleflight.Group
+
+	mu      sync.Mutex
+	ctx     context.Context // background work stops when it is cancelled
+	logoKey string
+	logo    *imaging.Watermark
+	job     models.WatermarkJob
+	pending bool // another run was asked for while one was going
+
+	queue     []string // images waiting for their watermark to be checked
+	rendering bool     // a goroutine is working through the queue
+}
+
+func New(repos *database.Repositories, store storage.Storage, renderer *imaging.Renderer) *Service {
+	return &Service{repos: repos, store: store, renderer: renderer, ctx: context.Background()}
+}
+
+// Bind runs background re-renders and rechecks under ctx from now on,
+// so cancelling ctx stops them
+func (s *Service) Bind(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ctx = ctx
+}
+
+// Defaults are the settings used until the watermark is configured
+func Defaults() *models.WatermarkSettings {
+	return &models.WatermarkSettings{
+		Position:    imaging.WatermarkBottomRight,
+		Opacity:     0.5,
+		Scale:       0.2,
+		CategoryIDs: []int64{},
+		AlbumIDs:    []int64{},
+	}
+}
+
+// Settings returns the stored watermark settings
+func (s *Service) Settings(ctx context.Context) (*models.WatermarkSettings, error) {
+	setting, err := s.repos.Settings.Get(ctx, SettingKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Defaults(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	settings := Defaults()
+	if err := json.Unmarshal([]byte(setting.Value), settings); err != nil {
+		return nil, fmt.Errorf("invalid %s setting: %w", SettingKey, err)
+	}
+	return settings, nil
+}
+
+// Save checks that the logo can be drawn with the settings and stores them.
+// Existing renditions are not touched; Start redraws them.
+func (s *Service) Save(ctx context.Context, settings *models.WatermarkSettings) error {
+	if settings.Enabled || settings.LogoURL != "" {
+		if _, err := s.load(ctx, settings); err != nil {
+			return err
+		}
+	}
+	value, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return s.repos.Settings.Set(ctx, &models.Setting{Key: SettingKey, Value: string(value)})
+}
+
+// load decodes the logo of the settings, reusing the last one decoded
+func (s *Service) load(ctx context.Context, settings *models.WatermarkSettings) (*imaging.Watermark, error) {
+	source := imaging.SourceURL(settings.LogoURL)
+	if source == "" {
+		return nil, fmt.Errorf("%w: the logo must be an uploaded image", ErrInvalidLogo)
+	}
+	key := fmt.Sprintf("%s|%s|%v|%v", source, settings.Position, settings.Opacity, settings.Scale)
+
+	s.mu.Lock()
+	if s.logoKey == key {
+		logo := s.logo
+		s.mu.Unlock()
+		return logo, nil
+	}
+	s.mu.Unlock()
+
+	file, _, err := s.store.Get(ctx, storage.Key(source))
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading the logo: %v", ErrInvalidLogo, err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading the logo: %v", ErrInvalidLogo, err)
+	}
+	logo, err := imaging.NewWatermark(data, settings.Position, settings.Opacity, settings.Scale)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidLogo, err)
+	}
+
+	s.mu.Lock()
+	s.logoKey, s.logo = key, logo
+	s.mu.Unlock()
+	return logo, nil
+}
+
+// due returns the watermark each source should be rendered with, nil for
+// sources left clean or when watermarking is off
+func (s *Service) due(ctx context.Context, sources []string) (map[string]*imaging.Watermark, error) {
+	result := make(map[string]*imaging.Watermark)
+	settings, err := s.Settings(ctx)
+	if err != nil || !settings.Enabled {
+		return result, err
+	}
+	logo, err := s.load(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+	for start := 0; start < len(sources); start += batchSize {
+		end := min(start+batchSize, len(sources))
+		covered, err := s.repos.Watermarks.Covered(ctx, sources[start:end], settings.CategoryIDs, settings.AlbumIDs)
+		if err != nil {
+			return nil, err
+		}
+		for source := range covered {
+			result[source] = logo
+		}
+	}
+	return result, nil
+}
+
+// Due returns the watermark an image is drawn with, nil when it is left clean.
+// Crops made on demand use it to match the image's renditions.
+func (s *Service) Due(ctx context.Context, imageURL string) (*imaging.Watermark, error) {
+	source := imaging.SourceURL(imageURL)
+	if source == "" {
+		return nil, imaging.ErrNotLocal
+	}
+	due, err := s.due(ctx, []string{source})
+	if err != nil {
+		return nil, err
+	}
+	return due[source], nil
+}
+
+// Render generates the renditions of an image, watermarked when it is in the
+// selection. If the watermark cannot be worked out the image is rendered
+// clean; the next run catches it up.
+func (s *Service) Render(ctx context.Context, imageURL string) ([]imaging.Rendition, error) {
+	source := imaging.SourceURL(imageURL)
+	if source == "" {
+		return nil, imaging.ErrNotLocal
+	}
+	due, err := s.due(ctx, []string{source})
+	if err != nil {
+		log.Printf("Failed to look up the watermark for %s: %v", source, err)
+	}
+	return s.renderer.RenderWatermarked(ctx, source, due[source])
+}
+
+// redraw renders and records one source's renditions, once at a time per source
+func (s *Service) redraw(ctx context.Context, source string, logo *imaging.Watermark) error {
+	_, err, _ := s.flight.Do(source, func() (interface{}, error) {
+		renditions, err := s.renderer.RenderWatermarked(ctx, source, logo)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.repos.Renditions.Replace(ctx, source, imaging.Models(source, renditions))
+	})
+	return err
+}
+
+// Renditions renders the renditions of an image, or redraws them when they
+// don't carry the watermark the image is now due, and returns them ordered by
+// width. Media thumbnails still showing the original are pointed at the
+// smallest one. Uploads call it once their item is saved, so the watermark
+// follows the item's category.
+func (s *Service) Renditions(ctx context.Context, imageURL string) ([]*models.ImageRendition, error) {
+	source := imaging.SourceURL(imageURL)
+	if source == "" {
+		return nil, imaging.ErrNotLocal
+	}
+	return s.refresh(ctx, source, true)
+}
+
+// Recheck redraws, in the background, the renditions of images whose place
+// in the selection a save may have changed, when they no longer carry the
+// watermark they are due. Files without renditions are left alone.
+func (s *Service) Recheck(imageURLs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, imageURL := range imageURLs {
+		if source := imaging.SourceURL(imageURL); source != "" {
+			s.queue = append(s.queue, source)
+		}
+	}
+	if len(s.queue) > 0 && !s.rendering {
+		s.rendering = true
+		go s.drain(s.ctx)
+	}
+}
+
+// drain works through the queue one image at a time until it is empty or ctx
+// is cancelled
+func (s *Service) drain(ctx context.Context) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 || ctx.Err() != nil {
+			s.rendering = false
+			s.mu.Unlock()
+			return
+		}
+		source := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		if _, err := s.refresh(ctx, source, false); err != nil {
+			log.Printf("Failed to render renditions of %s: %v", source, err)
+		}
+	}
+}
+
+// refresh brings the renditions of one source in step with its watermark.
+// Sources without renditions are only rendered when create is set.
+func (s *Service) refresh(ctx context.Context, source string, create bool) ([]*models.ImageRendition, error) {
+	existing, err := s.repos.Renditions.ListBySource(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) == 0 && !create {
+		return nil, nil
+	}
+	due, err := s.due(ctx, []string{source})
+	if err != nil {
+		log.Printf("Failed to look up the watermark for %s: %v", source, err)
+	}
+	if len(existing) == 0 || existing[0].Watermark != fingerprint(due[source]) {
+		if err := s.redraw(ctx, source, due[source]); err != nil {
+			return nil, err
+		}
+		if existing, err = s.repos.Renditions.ListBySource(ctx, source); err != nil {
+			return nil, err
+		}
+	}
+	for _, rendition := range existing {
+		if rendition.Name != "original" && rendition.Format != "webp" {
+			return existing, s.repos.MediaItems.UseThumbnail(ctx, source, rendition.URL)
+		}
+	}
+	return existing, nil
+}
+
+// Start redraws, in the background, every rendition set whose watermark is
+// out of date, or every set when force is true
+func (s *Service) Start(force bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.job.Running {
+		return ErrRunning
+	}
+	s.start(force)
+	return nil
+}
+
+// Schedule brings every rendition set in step with the settings in the
+// background. It is called after the settings are saved; saves that move
+// single images in or out of the selection use Recheck. A call made during a
+// run starts another one when that run ends.
+func (s *Service) Schedule() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.job.Running {
+		s.pending = true
+		return
+	}
+	s.start(false)
+}
+
+// start begins a run; s.mu must be held
+func (s *Service) start(force bool) {
+	now := time.Now()
+	s.job = models.WatermarkJob{Running: true, StartedAt: &now}
+	go s.run(s.ctx, force)
+}
+
+// Status reports the progress of the latest batch re-render
+func (s *Service) Status() models.WatermarkJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.job
+}
+
+func (s *Service) run(ctx context.Context, force bool) {
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		now := time.Now()
+		s.job.Running, s.job.FinishedAt = false, &now
+		if s.pending {
+			s.pending = false
+			s.start(false)
+		}
+	}()
+
+	if err := s.Sync(ctx, force, func(source string, err error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err != nil {
+			s.job.Failed++
+		} else {
+			s.job.Rendered++
+		}
+	}, func(total int) {
+		s.mu.Lock()
+		s.job.Total = total
+		s.mu.Unlock()
+	}); err != nil {
+		log.Printf("Watermark re-render stopped: %v", err)
+	}
+}
+
+// Sync redraws the rendition sets whose watermark is out of date, or all of
+// them when force is true. planned is told how many sets will be redrawn and
+// done is called after each one.
+func (s *Service) Sync(ctx context.Context, force bool, done func(source string, err error), planned func(total int)) error {
+	rendered, err := s.repos.Renditions.Watermarks(ctx)
+	if err != nil {
+		return err
+	}
+	sources := make([]string, 0, len(rendered))
+	for source := range rendered {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	due, err := s.due(ctx, sources)
+	if err != nil {
+		return err
+	}
+
+	var stale []string
+	for _, source := range sources {
+		if force || rendered[source] != fingerprint(due[source]) {
+			stale = append(stale, source)
+		}
+	}
+	if planned != nil {
+		planned(len(stale))
+	}
+	for _, source := range stale {
+		err := s.redraw(ctx, source, due[source])
+		if err != nil {
+			log.Printf("Failed to redraw renditions of %s: %v", source, err)
+		}
+		if done != nil {
+			done(source, err)
+		}
+	}
+	return nil
+}
+
+func fingerprint(logo *imaging.Watermark) string {
+	if logo == nil {
+		return ""
+	}
+	return logo.Fingerprint
+}
@@ -4,6 +4,7 @@ interface Banner {
   id: number;
   title: string;
   image_url: string;
+  crop_url?: string;
   link_url: string;
   placement: string;
   sort_order: number;
@@ -82,7 +83,7 @@ export default function HomeBannerArea() {
     const BannerContent = (
       <div className="relative aspect-[16/9] w-full overflow-hidden rounded-lg">
         <img
-          src={banner.image_url}
+          src={banner.crop_url || banner.image_url}
           alt={banner.title}
           className="h-full w-full object-cover"
           loading="lazy"
@@ -121,7 +122,7 @@ export default function HomeBannerArea() {
             const SlideContent = (
               <div className="h-full w-full flex-shrink-0">
                 <img
-                  src={banner.image_url}
+                  src={banner.crop_url || banner.image_url}
                   alt={banner.title}
                   className="h-full w-full object-cover"
                   loading="lazy"
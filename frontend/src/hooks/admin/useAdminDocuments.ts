@@ -14,13 +14,79 @@ export interface Document {
   download_url?: string;
   preview_url?: string;
   status: 'draft' | 'published' | 'hidden';
+  security_flags?: string;
+  text_status?: 'pending' | 'done' | 'failed' | 'unsupported';
+  version: number;
+  sha256?: string;
   category_id?: number;
+  document_no?: string;
+  type_id?: number;
+  type_name?: string;
+  authority_id?: number;
+  authority_name?: string;
+  signer_id?: number;
+  signer_name?: string;
+  effective_date?: string;
+  expiry_date?: string;
+  repealed: boolean;
+  validity_status: 'in_force' | 'expired' | 'not_yet_effective';
+  visibility: DocumentVisibility;
+  role_ids: number[];
+  roles?: string[];
   uploaded_by: number;
   download_count: number;
   created_at: string;
   updated_at: string;
 }
 
+// Who may see a document: everyone, signed-in users, or users with one of
+// its roles
+export type DocumentVisibility = 'public' | 'authenticated' | 'roles';
+
+// An audited access to a restricted document
+export interface DocumentAccessEntry {
+  id: number;
+  user_id: number;
+  user_name?: string;
+  action: 'view' | 'download' | 'preview' | 'access_denied';
+  details: string;
+  ip_address: string;
+  created_at: string;
+}
+
+// A file a document has had; versions are numbered from 1
+export interface DocumentVersion {
+  id: number;
+  document_id: number;
+  version: number;
+  file_path: string;
+  file_size: number;
+  mime_type: string;
+  sha256: string;
+  change_note: string;
+  uploaded_by: number;
+  current: boolean;
+  download_url?: string;
+  created_at: string;
+}
+
+export type DocumentRelationType = 'amends' | 'replaces' | 'guides' | 'references';
+
+// A document at the other end of a relation; relation reads from the
+// document whose relations were listed, e.g. amended_by
+export interface RelatedDocument {
+  relation_id: number;
+  relation: string;
+  id: number;
+  title: string;
+  slug: string;
+  document_no: string;
+  type_name?: string;
+  issued_date?: string;
+  status: string;
+  validity_status: string;
+}
+
 export interface DocumentListResponse {
   data: Document[];
   pagination: {
@@ -46,6 +112,9 @@ export const adminDocsKeys = {
   lists: () => [...adminDocsKeys.all, 'list'] as const,
   list: (params: DocumentListParams) => [...adminDocsKeys.lists(), params] as const,
   detail: (id: number) => [...adminDocsKeys.all, 'detail', id] as const,
+  versions: (id: number) => [...adminDocsKeys.all, 'versions', id] as const,
+  relations: (id: number) => [...adminDocsKeys.all, 'relations', id] as const,
+  accessLog: (id: number, page: number) => [...adminDocsKeys.all, 'access-log', id, page] as const,
 };
 
 // Get admin documents list
@@ -83,9 +152,9 @@ export function useUploadDocument() {
   return useMutation<
     { data: Document },
     AxiosError,
-    { file: File; title: string; category_id: number; description?: string }
+    { file: File; title: string; category_id: number; description?: string; visibility?: DocumentVisibility; role_ids?: number[] }
   >({
-    mutationFn: async ({ file, title, category_id, description }) => {
+    mutationFn: async ({ file, title, category_id, description, visibility, role_ids }) => {
       const formData = new FormData();
       formData.append('file', file);
       formData.append('title', title);
@@ -93,6 +162,10 @@ export function useUploadDocument() {
       if (description) {
         formData.append('description', description);
       }
+      if (visibility) {
+        formData.append('visibility', visibility);
+      }
+      role_ids?.forEach((id) => formData.append('role_ids', id.toString()));
 
       const response = await http.post('/admin/documents/upload', formData, {
         headers: {
@@ -141,3 +214,110 @@ export function useUpdateDocument() {
     },
   });
 }
+
+// Queue a document's text for extraction again
+export function useExtractDocumentText() {
+  const queryClient = useQueryClient();
+
+  return useMutation<void, AxiosError, number>({
+    mutationFn: async (id: number) => {
+      await http.post(`/admin/documents/${id}/extract`);
+    },
+    onSuccess: () => {
+      queryClient.invalidateQueries({ queryKey: adminDocsKeys.lists() });
+    },
+  });
+}
+
+// Get the version history of a document, newest first
+export function useDocumentVersions(id: number) {
+  return useQuery<{ data: DocumentVersion[] }, AxiosError>({
+    queryKey: adminDocsKeys.versions(id),
+    queryFn: async () => {
+      const response = await http.get(`/admin/documents/${id}/versions`);
+      return response.data;
+    },
+    enabled: !!id,
+  });
+}
+
+// Upload a corrected file as the next version of a document
+export function useUploadDocumentVersion() {
+  const queryClient = useQueryClient();
+
+  return useMutation<
+    { data: { document: Document; version: DocumentVersion } },
+    AxiosError,
+    { id: number; file: File; change_note: string }
+  >({
+    mutationFn: async ({ id, file, change_note }) => {
+      const formData = new FormData();
+      formData.append('file', file);
+      formData.append('change_note', change_note);
+
+      const response = await http.post(`/admin/documents/${id}/versions`, formData, {
+        headers: {
+          'Content-Type': 'multipart/form-data',
+        },
+      });
+      return response.data;
+    },
+    onSuccess: (_, variables) => {
+      queryClient.invalidateQueries({ queryKey: adminDocsKeys.lists() });
+      queryClient.invalidateQueries({ queryKey: adminDocsKeys.versions(variables.id) });
+    },
+  });
+}
+
+// Get the documents a document is related to, in both directions
+export function useDocumentRelations(id: number) {
+  return useQuery<{ data: RelatedDocument[] }, AxiosError>({
+    queryKey: adminDocsKeys.relations(id),
+    queryFn: async () => {
+      const response = await http.get(`/admin/documents/${id}/relations`);
+      return response.data;
+    },
+    enabled: !!id,
+  });
+}
+
+// Relate a document to another; replacing a document repeals it once published
+export function useCreateDocumentRelation() {
+  const queryClient = useQueryClient();
+
+  return useMutation<void, AxiosError, { id: number; related_id: number; type: DocumentRelationType }>({
+    mutationFn: async ({ id, related_id, type }) => {
+      await http.post(`/admin/documents/${id}/relations`, { related_id, type });
+    },
+    onSuccess: () => {
+      // Both ends of the relation, and a repealed document, change
+      queryClient.invalidateQueries({ queryKey: adminDocsKeys.all });
+    },
+  });
+}
+
+// Remove a relation of a document
+export function useDeleteDocumentRelation() {
+  const queryClient = useQueryClient();
+
+  return useMutation<void, AxiosError, { id: number; relation_id: number }>({
+    mutationFn: async ({ id, relation_id }) => {
+      await http.delete(`/admin/documents/${id}/relations/${relation_id}`);
+    },
+    onSuccess: () => {
+      queryClient.invalidateQueries({ queryKey: adminDocsKeys.all });
+    },
+  });
+}
+
+// Get the audited accesses to a document, newest first
+export function useDocumentAccessLog(id: number, page = 1) {
+  return useQuery<{ data: DocumentAccessEntry[]; pagination: DocumentListResponse['pagination'] }, AxiosError>({
+    queryKey: adminDocsKeys.accessLog(id, page),
+    queryFn: async () => {
+      const response = await http.get(`/admin/documents/${id}/access-log`, { params: { page } });
+      return response.data;
+    },
+    enabled: !!id,
+  });
+}
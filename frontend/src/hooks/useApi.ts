@@ -4,7 +4,7 @@
  */
 
 import { useQuery, useMutation, useQueryClient, UseQueryOptions } from '@tanstack/react-query';
-import { api } from '@/api/client';
+import { api, getAuthToken } from '@/api/client';
 import type {
   DtoCreateArticleRequest,
   DtoUpdateArticleRequest,
@@ -458,7 +458,24 @@ export const documentKeys = {
   },
 };
 
-export const useDocuments = (params?: { page?: number; page_size?: number; category_id?: number }) => {
+// Signed-in users also see the documents restricted to them, so their token
+// goes along with the public document requests
+const documentHeaders = (): HeadersInit => {
+  const token = getAuthToken();
+  return token ? { Authorization: `Bearer ${token}` } : {};
+};
+
+// Metadata filters of the document library, matching its facets
+export interface DocumentFilters {
+  type_id?: string;
+  authority_id?: string;
+  signer_id?: string;
+  validity?: string;
+  year?: string;
+  document_no?: string;
+}
+
+export const useDocuments = (params?: { page?: number; page_size?: number; category_id?: number; q?: string } & DocumentFilters) => {
   return useQuery({
     queryKey: documentKeys.list(params),
     queryFn: async () => {
@@ -467,14 +484,32 @@ export const useDocuments = (params?: { page?: number; page_size?: number; categ
       if (params?.page) queryParams.append('page', params.page.toString());
       if (params?.page_size) queryParams.append('page_size', params.page_size.toString());
       if (params?.category_id) queryParams.append('category_id', params.category_id.toString());
+      if (params?.q) queryParams.append('q', params.q);
+      for (const key of ['type_id', 'authority_id', 'signer_id', 'validity', 'year', 'document_no'] as const) {
+        const value = params?.[key];
+        if (value) queryParams.append(key, value);
+      }
       
-      const response = await fetch(`${API_BASE}/documents?${queryParams}`);
+      const response = await fetch(`${API_BASE}/documents?${queryParams}`, { headers: documentHeaders() });
       return response.json();
     },
     staleTime: 60000,
   });
 };
 
+// A published document with its version history, newest first
+export const useDocument = (slug?: string) => {
+  return useQuery({
+    queryKey: documentKeys.detail(slug || ''),
+    queryFn: async () => {
+      const response = await fetch(`${API_BASE}/documents/${slug}`, { headers: documentHeaders() });
+      return response.json();
+    },
+    enabled: !!slug,
+    staleTime: 60000,
+  });
+};
+
 export const useAdminDocuments = (params?: { page?: number; page_size?: number; status?: string; category_id?: number }) => {
   return useQuery({
     queryKey: documentKeys.admin.list(params),
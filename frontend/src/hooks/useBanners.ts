@@ -6,6 +6,7 @@ export interface Banner {
   title: string;
   placement: string;
   image_url: string;
+  crop_url?: string;
   link_url?: string;
   alt?: string;
   is_active: boolean;
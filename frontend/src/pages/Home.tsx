@@ -778,7 +778,7 @@ export default function Home() {
                     className="block w-full h-full"
                   >
                     <img
-                      src={getFullImageUrl(banner.image_url)}
+                      src={getFullImageUrl(banner.crop_url || banner.image_url)}
                       alt={banner.alt || banner.title || 'Banner 1'}
                       className="w-full h-full object-cover object-center transition-transform duration-300 group-hover:scale-105"
                       loading="lazy"
@@ -786,7 +786,7 @@ export default function Home() {
                   </a>
                 ) : (
                   <img
-                    src={getFullImageUrl(banner.image_url)}
+                    src={getFullImageUrl(banner.crop_url || banner.image_url)}
                     alt={banner.alt || banner.title || 'Banner 1'}
                     className="w-full h-full object-cover object-center"
                     loading="lazy"
@@ -888,7 +888,7 @@ export default function Home() {
                     className="block w-full h-full"
                   >
                     <img
-                      src={getFullImageUrl(banner.image_url)}
+                      src={getFullImageUrl(banner.crop_url || banner.image_url)}
                       alt={banner.alt || banner.title || 'Banner 2'}
                       className="w-full h-full object-cover object-center transition-transform duration-300 group-hover:scale-105"
                       loading="lazy"
@@ -896,7 +896,7 @@ export default function Home() {
                   </a>
                 ) : (
                   <img
-                    src={getFullImageUrl(banner.image_url)}
+                    src={getFullImageUrl(banner.crop_url || banner.image_url)}
                     alt={banner.alt || banner.title || 'Banner 2'}
                     className="w-full h-full object-cover object-center"
                     loading="lazy"
@@ -0,0 +1,165 @@
+import { useEffect, useState } from 'react';
+import { Lock } from 'lucide-react';
+import Modal from '../../../components/common/Modal';
+import LoadingSpinner from '../../../components/common/LoadingSpinner';
+import {
+  Document,
+  DocumentVisibility,
+  useDocumentAccessLog,
+  useUpdateDocument,
+} from '../../../hooks/admin/useAdminDocuments';
+import { useRoles } from '../../../hooks/useUsers';
+
+interface AccessModalProps {
+  document: Document | null;
+  onClose: () => void;
+}
+
+const VISIBILITY_LABELS: Record<DocumentVisibility, string> = {
+  public: 'Công khai',
+  authenticated: 'Cán bộ đăng nhập',
+  roles: 'Theo vai trò',
+};
+
+const ACTION_LABELS: Record<string, string> = {
+  view: 'Xem thông tin',
+  download: 'Tải xuống',
+  preview: 'Xem trước',
+  access_denied: 'Bị từ chối',
+};
+
+// Who may see a document, and the audited accesses to it while restricted
+export default function AccessModal({ document, onClose }: AccessModalProps) {
+  const [visibility, setVisibility] = useState<DocumentVisibility>('public');
+  const [roleIds, setRoleIds] = useState<number[]>([]);
+  const [page, setPage] = useState(1);
+  const { data: roles } = useRoles();
+  const { data: log, isLoading } = useDocumentAccessLog(document?.id ?? 0, page);
+  const updateMutation = useUpdateDocument();
+
+  useEffect(() => {
+    setVisibility(document?.visibility || 'public');
+    setRoleIds(document?.role_ids || []);
+    setPage(1);
+  }, [document]);
+
+  const entries = log?.data || [];
+  const totalPages = log?.pagination?.total_pages || 1;
+
+  const toggleRole = (id: number) => {
+    setRoleIds((ids) => (ids.includes(id) ? ids.filter((roleId) => roleId !== id) : [...ids, id]));
+  };
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    if (!document) return;
+
+    try {
+      await updateMutation.mutateAsync({
+        id: document.id,
+        data: { ...document, visibility, role_ids: visibility === 'roles' ? roleIds : [] },
+      });
+      onClose();
+    } catch (err: any) {
+      const errorMessage = err.response?.data?.error?.message || err.message || 'Không thể lưu quyền truy cập';
+      alert(`Lỗi: ${errorMessage}`);
+    }
+  };
+
+  const userAgent = (details: string) => {
+    try {
+      return JSON.parse(details).user_agent || '';
+    } catch {
+      return '';
+    }
+  };
+
+  return (
+    <Modal isOpen={!!document} onClose={onClose} title={document ? `Quyền truy cập: ${document.title}` : undefined}>
+      <form onSubmit={handleSubmit} className="space-y-3 mb-6 p-4 bg-gray-50 rounded-lg">
+        <h4 className="font-semibold text-gray-900">Ai được xem văn bản</h4>
+        <select
+          value={visibility}
+          onChange={(e) => setVisibility(e.target.value as DocumentVisibility)}
+          className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-green-500 focus:border-transparent"
+        >
+          {(Object.keys(VISIBILITY_LABELS) as DocumentVisibility[]).map((value) => (
+            <option key={value} value={value}>
+              {VISIBILITY_LABELS[value]}
+            </option>
+          ))}
+        </select>
+        {visibility === 'roles' && (
+          <div className="flex flex-wrap gap-3">
+            {(roles || []).map((role) => (
+              <label key={role.id} className="inline-flex items-center gap-1 text-sm text-gray-700">
+                <input type="checkbox" checked={roleIds.includes(role.id)} onChange={() => toggleRole(role.id)} />
+                {role.name}
+              </label>
+            ))}
+          </div>
+        )}
+        {visibility !== 'public' && (
+          <p className="text-xs text-gray-500">
+            Tệp được lưu riêng, không truy cập được qua đường dẫn công khai; mọi lượt xem và tải xuống được ghi lại.
+          </p>
+        )}
+        <button
+          type="submit"
+          disabled={(visibility === 'roles' && roleIds.length === 0) || updateMutation.isPending}
+          className="inline-flex items-center gap-2 px-4 py-2 bg-green-600 text-white rounded-lg hover:bg-green-700 disabled:opacity-50 disabled:cursor-not-allowed"
+        >
+          <Lock className="w-4 h-4" />
+          {updateMutation.isPending ? 'Đang lưu...' : 'Lưu'}
+        </button>
+      </form>
+
+      <h4 className="font-semibold text-gray-900 mb-2">Nhật ký truy cập</h4>
+      {isLoading ? (
+        <div className="p-8 text-center">
+          <LoadingSpinner />
+        </div>
+      ) : entries.length === 0 ? (
+        <p className="text-sm text-gray-500 text-center py-4">Chưa có lượt truy cập nào được ghi lại</p>
+      ) : (
+        <>
+          <ul className="divide-y divide-gray-200">
+            {entries.map((entry) => (
+              <li key={entry.id} className="py-2 text-sm">
+                <div className="flex justify-between gap-4">
+                  <span className="font-medium text-gray-900">{entry.user_name || `#${entry.user_id}`}</span>
+                  <span className="text-gray-500">{new Date(entry.created_at).toLocaleString('vi-VN')}</span>
+                </div>
+                <div className={`text-xs ${entry.action === 'access_denied' ? 'text-red-600' : 'text-gray-600'}`}>
+                  {ACTION_LABELS[entry.action] || entry.action} · {entry.ip_address}
+                </div>
+                <div className="text-xs text-gray-400 truncate">{userAgent(entry.details)}</div>
+              </li>
+            ))}
+          </ul>
+          {totalPages > 1 && (
+            <div className="flex justify-between mt-3">
+              <button
+                onClick={() => setPage(Math.max(1, page - 1))}
+                disabled={page === 1}
+                className="px-3 py-1 border border-gray-300 rounded text-sm disabled:opacity-50"
+              >
+                Trước
+              </button>
+              <span className="text-sm text-gray-500">
+                {page} / {totalPages}
+              </span>
+              <button
+                onClick={() => setPage(Math.min(totalPages, page + 1))}
+                disabled={page === totalPages}
+                className="px-3 py-1 border border-gray-300 rounded text-sm disabled:opacity-50"
+              >
+                Sau
+              </button>
+            </div>
+          )}
+        </>
+      )}
+    </Modal>
+  );
+}
@@ -1,37 +1,36 @@
 import { useState } from 'react';
-import { Upload, Trash2, Download, FileText, Search, Eye, AlertCircle } from 'lucide-react';
+import { Upload, Trash2, Download, FileText, Search, Eye, AlertCircle, RefreshCw, History, Link2, Lock } from 'lucide-react';
 import AdminLayout from '../../../components/admin/AdminLayout';
 import LoadingSpinner from '../../../components/common/LoadingSpinner';
-import { useAdminDocsList, useUploadDocument, useDeleteDocument } from '../../../hooks/admin/useAdminDocuments';
+import {
+  Document,
+  DocumentVisibility,
+  useAdminDocsList,
+  useUploadDocument,
+  useDeleteDocument,
+  useExtractDocumentText,
+} from '../../../hooks/admin/useAdminDocuments';
 import { AxiosError } from 'axios';
-
-interface Document {
-  id: number;
-  title: string;
-  slug: string;
-  description?: string;
-  file_path: string;
-  file_size: number;
-  mime_type: string;
-  download_url?: string;
-  preview_url?: string;
-  status: 'draft' | 'published' | 'hidden';
-  category_id?: number;
-  uploaded_by: number;
-  download_count: number;
-  created_at: string;
-  updated_at: string;
-}
+import VersionsModal from './VersionsModal';
+import RelationsModal from './RelationsModal';
+import AccessModal from './AccessModal';
 
 export default function DocumentsList() {
   const [page, setPage] = useState(1);
   const [search, setSearch] = useState('');
   const [fileType, setFileType] = useState('all');
+  const [versionsDoc, setVersionsDoc] = useState<Document | null>(null);
+  const [relationsDoc, setRelationsDoc] = useState<Document | null>(null);
+  const [accessDoc, setAccessDoc] = useState<Document | null>(null);
+  // Restricted uploads are stored privately from the start; roles are
+  // chosen afterwards under the document's access settings
+  const [uploadVisibility, setUploadVisibility] = useState<DocumentVisibility>('public');
 
   // Fetch documents from ADMIN API
-  const { data, isLoading, isError, error, refetch } = useAdminDocsList({ page, page_size: 20 });
+  const { data, isLoading, isError, error, refetch } = useAdminDocsList({ page, page_size: 20, q: search || undefined });
   const uploadMutation = useUploadDocument();
   const deleteMutation = useDeleteDocument();
+  const extractMutation = useExtractDocumentText();
 
   const documents: Document[] = data?.data || [];
   const pagination = data?.pagination || { page: 1, page_size: 20, total: 0, total_pages: 0 };
@@ -77,7 +76,8 @@ export default function DocumentsList() {
       await uploadMutation.mutateAsync({
         file,
         title: file.name.replace(/\.[^/.]+$/, ''),
-        category_id: 11 // "Kho văn bản" category
+        category_id: 11, // "Kho văn bản" category
+        visibility: uploadVisibility,
       });
       alert('Upload thành công!');
       e.target.value = ''; // Reset file input
@@ -98,6 +98,14 @@ export default function DocumentsList() {
     }
   };
 
+  const handleExtract = async (id: number) => {
+    try {
+      await extractMutation.mutateAsync(id);
+    } catch (err: any) {
+      alert(err.message || 'Không thể trích xuất lại nội dung');
+    }
+  };
+
   const formatFileSize = (bytes: number) => {
     if (bytes === 0) return '0 Bytes';
     const k = 1024;
@@ -125,6 +133,18 @@ export default function DocumentsList() {
     );
   };
 
+  // Active content found in the file on upload; flagged documents start as drafts
+  const securityFlagLabels: Record<string, string> = {
+    javascript: 'Có JavaScript',
+    embedded_files: 'Có tệp nhúng',
+  };
+
+  // Whether the text of the file can be searched yet
+  const textStatusBadges: Record<string, { label: string; className: string }> = {
+    pending: { label: 'Đang trích xuất nội dung', className: 'bg-blue-100 text-blue-800' },
+    failed: { label: 'Lỗi trích xuất nội dung', className: 'bg-red-100 text-red-800' },
+  };
+
   return (
     <AdminLayout title="Quản lý Văn bản">
       <div className="space-y-6">
@@ -134,17 +154,28 @@ export default function DocumentsList() {
             <h1 className="text-2xl font-bold text-gray-900">Kho Văn bản</h1>
             <p className="text-gray-600 mt-1">Quản lý văn bản PDF, DOC, DOCX</p>
           </div>
-          <label className="inline-flex items-center gap-2 px-4 py-2 bg-green-600 text-white rounded-lg hover:bg-green-700 transition-colors cursor-pointer disabled:opacity-50 disabled:cursor-not-allowed">
-            <Upload className="w-5 h-5" />
-            {uploadMutation.isPending ? 'Đang tải lên...' : 'Upload văn bản'}
-            <input
-              type="file"
-              accept=".pdf,.doc,.docx,.xls,.xlsx"
-              onChange={handleFileUpload}
-              disabled={uploadMutation.isPending}
-              className="hidden"
-            />
-          </label>
+          <div className="flex items-center gap-2">
+            <select
+              value={uploadVisibility}
+              onChange={(e) => setUploadVisibility(e.target.value as DocumentVisibility)}
+              className="px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-green-500 focus:border-transparent"
+              title="Ai được xem văn bản tải lên"
+            >
+              <option value="public">Công khai</option>
+              <option value="authenticated">Cán bộ đăng nhập</option>
+            </select>
+            <label className="inline-flex items-center gap-2 px-4 py-2 bg-green-600 text-white rounded-lg hover:bg-green-700 transition-colors cursor-pointer disabled:opacity-50 disabled:cursor-not-allowed">
+              <Upload className="w-5 h-5" />
+              {uploadMutation.isPending ? 'Đang tải lên...' : 'Upload văn bản'}
+              <input
+                type="file"
+                accept=".pdf,.doc,.docx,.xls,.xlsx"
+                onChange={handleFileUpload}
+                disabled={uploadMutation.isPending}
+                className="hidden"
+              />
+            </label>
+          </div>
         </div>
 
         {/* Filters */}
@@ -156,7 +187,10 @@ export default function DocumentsList() {
                 type="text"
                 placeholder="Tìm kiếm văn bản..."
                 value={search}
-                onChange={(e) => setSearch(e.target.value)}
+                onChange={(e) => {
+                  setSearch(e.target.value);
+                  setPage(1);
+                }}
                 className="w-full pl-10 pr-4 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-green-500 focus:border-transparent"
               />
             </div>
@@ -248,7 +282,22 @@ export default function DocumentsList() {
                         <div className="flex items-center">
                           <span className="text-2xl mr-3">{getFileIcon(doc.mime_type)}</span>
                           <div>
-                            <div className="text-sm font-medium text-gray-900">{doc.title}</div>
+                            <div className="text-sm font-medium text-gray-900">
+                              {doc.title}
+                              {doc.version > 1 && (
+                                <span className="ml-2 text-xs font-normal text-gray-500">v{doc.version}</span>
+                              )}
+                            </div>
+                            {(doc.type_name || doc.document_no) && (
+                              <div className="text-xs text-gray-600">
+                                {[doc.type_name, doc.document_no].filter(Boolean).join(' · ')}
+                                {doc.validity_status === 'expired' && (
+                                  <span className="ml-2 px-2 py-0.5 font-semibold rounded-full bg-red-100 text-red-700">
+                                    Hết hiệu lực
+                                  </span>
+                                )}
+                              </div>
+                            )}
                             {doc.description && (
                               <div className="text-sm text-gray-500 truncate max-w-md">{doc.description}</div>
                             )}
@@ -263,6 +312,31 @@ export default function DocumentsList() {
                       </td>
                       <td className="px-6 py-4 whitespace-nowrap">
                         {getStatusBadge(doc.status)}
+                        {doc.visibility && doc.visibility !== 'public' && (
+                          <span
+                            className="ml-1 inline-flex items-center gap-1 px-2 py-1 text-xs font-semibold rounded-full bg-purple-100 text-purple-800"
+                            title="Chỉ người được phép mới xem được"
+                          >
+                            <Lock className="w-3 h-3" />
+                            {doc.visibility === 'roles' ? doc.roles?.join(', ') : 'Nội bộ'}
+                          </span>
+                        )}
+                        {doc.security_flags?.split(',').map((flag) => (
+                          <span
+                            key={flag}
+                            className="ml-1 px-2 py-1 text-xs font-semibold rounded-full bg-yellow-100 text-yellow-800"
+                            title="Cần kiểm tra trước khi xuất bản"
+                          >
+                            ⚠ {securityFlagLabels[flag] || flag}
+                          </span>
+                        ))}
+                        {doc.text_status && textStatusBadges[doc.text_status] && (
+                          <span
+                            className={`ml-1 px-2 py-1 text-xs font-semibold rounded-full ${textStatusBadges[doc.text_status].className}`}
+                          >
+                            {textStatusBadges[doc.text_status].label}
+                          </span>
+                        )}
                       </td>
                       <td className="px-6 py-4 whitespace-nowrap text-sm text-gray-500">
                         {new Date(doc.created_at).toLocaleDateString('vi-VN')}
@@ -270,7 +344,7 @@ export default function DocumentsList() {
                       <td className="px-6 py-4 whitespace-nowrap text-right text-sm font-medium">
                         <div className="flex items-center justify-end gap-2">
                           <a
-                            href={`http://localhost:8080${doc.file_path}`}
+                            href={`http://localhost:8080${doc.preview_url || doc.file_path}`}
                             target="_blank"
                             rel="noopener noreferrer"
                             className="text-blue-600 hover:text-blue-900"
@@ -279,13 +353,44 @@ export default function DocumentsList() {
                             <Eye className="w-4 h-4" />
                           </a>
                           <a
-                            href={`http://localhost:8080${doc.file_path}`}
+                            href={`http://localhost:8080${doc.download_url || doc.file_path}`}
                             download={doc.title}
                             className="text-green-600 hover:text-green-900"
                             title="Tải xuống"
                           >
                             <Download className="w-4 h-4" />
                           </a>
+                          <button
+                            onClick={() => setVersionsDoc(doc)}
+                            className="text-gray-600 hover:text-gray-900"
+                            title="Phiên bản"
+                          >
+                            <History className="w-4 h-4" />
+                          </button>
+                          <button
+                            onClick={() => setAccessDoc(doc)}
+                            className="text-gray-600 hover:text-gray-900"
+                            title="Quyền truy cập"
+                          >
+                            <Lock className="w-4 h-4" />
+                          </button>
+                          <button
+                            onClick={() => setRelationsDoc(doc)}
+                            className="text-gray-600 hover:text-gray-900"
+                            title="Văn bản liên quan"
+                          >
+                            <Link2 className="w-4 h-4" />
+                          </button>
+                          {doc.text_status !== 'unsupported' && (
+                            <button
+                              onClick={() => handleExtract(doc.id)}
+                              disabled={extractMutation.isPending || doc.text_status === 'pending'}
+                              className="text-gray-600 hover:text-gray-900 disabled:opacity-50"
+                              title="Trích xuất lại nội dung để tìm kiếm"
+                            >
+                              <RefreshCw className="w-4 h-4" />
+                            </button>
+                          )}
                           <button
                             onClick={() => handleDelete(doc.id)}
                             disabled={deleteMutation.isPending}
@@ -353,6 +458,10 @@ export default function DocumentsList() {
           )}
         </div>
       </div>
+
+      <VersionsModal document={versionsDoc} onClose={() => setVersionsDoc(null)} formatFileSize={formatFileSize} />
+      <RelationsModal document={relationsDoc} onClose={() => setRelationsDoc(null)} />
+      <AccessModal document={accessDoc} onClose={() => setAccessDoc(null)} />
     </AdminLayout>
   );
 }
@@ -0,0 +1,145 @@
+import { useState } from 'react';
+import { Link2, Trash2 } from 'lucide-react';
+import Modal from '../../../components/common/Modal';
+import LoadingSpinner from '../../../components/common/LoadingSpinner';
+import {
+  DocumentRelationType,
+  useAdminDocsList,
+  useCreateDocumentRelation,
+  useDeleteDocumentRelation,
+  useDocumentRelations,
+} from '../../../hooks/admin/useAdminDocuments';
+
+interface RelationsModalProps {
+  document: { id: number; title: string } | null;
+  onClose: () => void;
+}
+
+const RELATION_LABELS: Record<string, string> = {
+  amends: 'Sửa đổi, bổ sung',
+  replaces: 'Thay thế',
+  guides: 'Hướng dẫn, quy định chi tiết',
+  references: 'Dẫn chiếu',
+  amended_by: 'Được sửa đổi, bổ sung bởi',
+  replaced_by: 'Bị thay thế bởi',
+  guided_by: 'Được hướng dẫn bởi',
+  referenced_by: 'Được dẫn chiếu bởi',
+};
+
+// Relations of a document to earlier ones it amends, replaces, guides or references
+export default function RelationsModal({ document, onClose }: RelationsModalProps) {
+  const [relatedId, setRelatedId] = useState('');
+  const [type, setType] = useState<DocumentRelationType>('amends');
+  const { data, isLoading } = useDocumentRelations(document?.id ?? 0);
+  const { data: candidates } = useAdminDocsList({ page_size: 100 }, { enabled: !!document });
+  const createMutation = useCreateDocumentRelation();
+  const deleteMutation = useDeleteDocumentRelation();
+
+  const related = data?.data || [];
+  const others = (candidates?.data || []).filter((doc) => doc.id !== document?.id);
+
+  const handleClose = () => {
+    setRelatedId('');
+    setType('amends');
+    onClose();
+  };
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    if (!document || !relatedId) return;
+
+    try {
+      await createMutation.mutateAsync({ id: document.id, related_id: Number(relatedId), type });
+      setRelatedId('');
+    } catch (err: any) {
+      const errorMessage = err.response?.data?.error?.message || err.message || 'Không thể liên kết văn bản';
+      alert(`Lỗi: ${errorMessage}`);
+    }
+  };
+
+  const handleDelete = async (relationId: number) => {
+    if (!document || !confirm('Gỡ liên kết này?')) return;
+    try {
+      await deleteMutation.mutateAsync({ id: document.id, relation_id: relationId });
+    } catch (err: any) {
+      alert(`Lỗi: ${err.response?.data?.error?.message || err.message}`);
+    }
+  };
+
+  return (
+    <Modal isOpen={!!document} onClose={handleClose} title={document ? `Văn bản liên quan: ${document.title}` : undefined}>
+      <form onSubmit={handleSubmit} className="space-y-3 mb-6 p-4 bg-gray-50 rounded-lg">
+        <h4 className="font-semibold text-gray-900">Thêm liên kết</h4>
+        <div className="grid md:grid-cols-2 gap-3">
+          <select
+            value={type}
+            onChange={(e) => setType(e.target.value as DocumentRelationType)}
+            className="px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-green-500 focus:border-transparent"
+          >
+            {(['amends', 'replaces', 'guides', 'references'] as const).map((value) => (
+              <option key={value} value={value}>
+                {RELATION_LABELS[value]}
+              </option>
+            ))}
+          </select>
+          <select
+            value={relatedId}
+            onChange={(e) => setRelatedId(e.target.value)}
+            className="px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-green-500 focus:border-transparent"
+          >
+            <option value="">Chọn văn bản...</option>
+            {others.map((doc) => (
+              <option key={doc.id} value={doc.id}>
+                {doc.document_no ? `${doc.document_no} – ${doc.title}` : doc.title}
+              </option>
+            ))}
+          </select>
+        </div>
+        {type === 'replaces' && (
+          <p className="text-xs text-gray-500">Văn bản bị thay thế sẽ chuyển sang hết hiệu lực khi văn bản này được xuất bản.</p>
+        )}
+        <button
+          type="submit"
+          disabled={!relatedId || createMutation.isPending}
+          className="inline-flex items-center gap-2 px-4 py-2 bg-green-600 text-white rounded-lg hover:bg-green-700 disabled:opacity-50 disabled:cursor-not-allowed"
+        >
+          <Link2 className="w-4 h-4" />
+          {createMutation.isPending ? 'Đang lưu...' : 'Liên kết'}
+        </button>
+      </form>
+
+      {isLoading ? (
+        <div className="p-8 text-center">
+          <LoadingSpinner />
+        </div>
+      ) : related.length === 0 ? (
+        <p className="text-sm text-gray-500 text-center py-4">Chưa có văn bản liên quan</p>
+      ) : (
+        <ul className="divide-y divide-gray-200">
+          {related.map((doc) => (
+            <li key={`${doc.relation_id}-${doc.relation}`} className="py-3 flex items-start justify-between gap-4">
+              <div className="min-w-0">
+                <div className="text-xs font-semibold text-gray-500">{RELATION_LABELS[doc.relation] || doc.relation}</div>
+                <div className="text-sm font-medium text-gray-900">
+                  {doc.document_no && `${doc.document_no} – `}
+                  {doc.title}
+                </div>
+                <div className="text-xs text-gray-500">
+                  {doc.status !== 'published' && `${doc.status} · `}
+                  {doc.validity_status === 'expired' ? 'Hết hiệu lực' : doc.validity_status === 'not_yet_effective' ? 'Chưa có hiệu lực' : 'Còn hiệu lực'}
+                </div>
+              </div>
+              <button
+                onClick={() => handleDelete(doc.relation_id)}
+                className="text-red-600 hover:text-red-900 flex-shrink-0"
+                title="Gỡ liên kết"
+              >
+                <Trash2 className="w-4 h-4" />
+              </button>
+            </li>
+          ))}
+        </ul>
+      )}
+    </Modal>
+  );
+}
@@ -0,0 +1,110 @@
+import { useState } from 'react';
+import { Download, Upload } from 'lucide-react';
+import Modal from '../../../components/common/Modal';
+import LoadingSpinner from '../../../components/common/LoadingSpinner';
+import { useDocumentVersions, useUploadDocumentVersion } from '../../../hooks/admin/useAdminDocuments';
+
+interface VersionsModalProps {
+  document: { id: number; title: string } | null;
+  onClose: () => void;
+  formatFileSize: (bytes: number) => string;
+}
+
+// Version history of a document, with a form to upload a corrected file
+export default function VersionsModal({ document, onClose, formatFileSize }: VersionsModalProps) {
+  const [file, setFile] = useState<File | null>(null);
+  const [changeNote, setChangeNote] = useState('');
+  const { data, isLoading } = useDocumentVersions(document?.id ?? 0);
+  const uploadMutation = useUploadDocumentVersion();
+
+  const versions = data?.data || [];
+
+  const handleClose = () => {
+    setFile(null);
+    setChangeNote('');
+    onClose();
+  };
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    if (!document || !file || !changeNote.trim()) return;
+
+    try {
+      await uploadMutation.mutateAsync({ id: document.id, file, change_note: changeNote.trim() });
+      setFile(null);
+      setChangeNote('');
+    } catch (err: any) {
+      const errorMessage = err.response?.data?.error?.message || err.message || 'Upload thất bại';
+      alert(`Lỗi: ${errorMessage}`);
+    }
+  };
+
+  return (
+    <Modal isOpen={!!document} onClose={handleClose} title={document ? `Phiên bản: ${document.title}` : undefined}>
+      <form onSubmit={handleSubmit} className="space-y-3 mb-6 p-4 bg-gray-50 rounded-lg">
+        <h4 className="font-semibold text-gray-900">Tải lên phiên bản mới</h4>
+        <input
+          type="file"
+          accept=".pdf,.doc,.docx,.xls,.xlsx"
+          onChange={(e) => setFile(e.target.files?.[0] || null)}
+          className="block w-full text-sm"
+        />
+        <textarea
+          value={changeNote}
+          onChange={(e) => setChangeNote(e.target.value)}
+          placeholder="Nội dung thay đổi (bắt buộc)"
+          maxLength={1000}
+          rows={2}
+          className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-green-500 focus:border-transparent"
+        />
+        <button
+          type="submit"
+          disabled={!file || !changeNote.trim() || uploadMutation.isPending}
+          className="inline-flex items-center gap-2 px-4 py-2 bg-green-600 text-white rounded-lg hover:bg-green-700 disabled:opacity-50 disabled:cursor-not-allowed"
+        >
+          <Upload className="w-4 h-4" />
+          {uploadMutation.isPending ? 'Đang tải lên...' : 'Tải lên'}
+        </button>
+      </form>
+
+      {isLoading ? (
+        <div className="p-8 text-center">
+          <LoadingSpinner />
+        </div>
+      ) : (
+        <ul className="divide-y divide-gray-200">
+          {versions.map((version) => (
+            <li key={version.id} className="py-3 flex items-start justify-between gap-4">
+              <div className="min-w-0">
+                <div className="text-sm font-medium text-gray-900">
+                  Phiên bản {version.version}
+                  {version.current && (
+                    <span className="ml-2 px-2 py-0.5 text-xs font-semibold rounded-full bg-green-100 text-green-800">
+                      Hiện hành
+                    </span>
+                  )}
+                </div>
+                {version.change_note && <div className="text-sm text-gray-700">{version.change_note}</div>}
+                <div className="text-xs text-gray-500">
+                  {new Date(version.created_at).toLocaleString('vi-VN')} · {formatFileSize(version.file_size)}
+                </div>
+                {version.sha256 && (
+                  <div className="text-xs text-gray-400 font-mono break-all" title="Mã kiểm tra SHA-256">
+                    SHA-256: {version.sha256}
+                  </div>
+                )}
+              </div>
+              <a
+                href={`http://localhost:8080${version.download_url || version.file_path}`}
+                className="text-green-600 hover:text-green-900 flex-shrink-0"
+                title="Tải xuống"
+              >
+                <Download className="w-4 h-4" />
+              </a>
+            </li>
+          ))}
+        </ul>
+      )}
+    </Modal>
+  );
+}
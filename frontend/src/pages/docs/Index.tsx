@@ -1,6 +1,6 @@
 import { useState } from 'react';
 import { useLocation } from 'react-router-dom';
-import { Search, FileText, Download, Eye, Calendar } from 'lucide-react';
+import { Search, FileText, Download, Eye, Calendar, Lock } from 'lucide-react';
 import Header from '../../components/Header';
 import DynamicNavbar from '../../components/DynamicNavbar';
 import SiteFooter from '../../components/layout/SiteFooter';
@@ -9,24 +9,67 @@ import Pagination from '../../components/common/Pagination';
 import Modal from '../../components/common/Modal';
 import LoadingSpinner from '../../components/common/LoadingSpinner';
 import { getBreadcrumbs } from '../../config/navigation';
-import { useDocuments } from '../../hooks/useApi';
+import { useDocuments, useDocument, DocumentFilters } from '../../hooks/useApi';
 
 const ITEMS_PER_PAGE = 12;
 
+const VALIDITY_LABELS: Record<string, string> = {
+  in_force: 'Còn hiệu lực',
+  not_yet_effective: 'Chưa có hiệu lực',
+  expired: 'Hết hiệu lực',
+};
+
+// Relations read from the previewed document, e.g. "Bị thay thế bởi" another
+const RELATION_LABELS: Record<string, string> = {
+  amends: 'Sửa đổi, bổ sung',
+  replaces: 'Thay thế',
+  guides: 'Hướng dẫn, quy định chi tiết',
+  references: 'Dẫn chiếu',
+  amended_by: 'Được sửa đổi, bổ sung bởi',
+  replaced_by: 'Bị thay thế bởi',
+  guided_by: 'Được hướng dẫn bởi',
+  referenced_by: 'Được dẫn chiếu bởi',
+};
+
+const VALIDITY_BADGES: Record<string, string> = {
+  in_force: 'bg-green-100 text-green-700',
+  not_yet_effective: 'bg-yellow-100 text-yellow-700',
+  expired: 'bg-red-100 text-red-700',
+};
+
+// Facet dropdowns: filter key, facet in the response, label
+const FACET_FILTERS: { key: keyof DocumentFilters; facet: string; label: string }[] = [
+  { key: 'type_id', facet: 'types', label: 'Loại văn bản' },
+  { key: 'authority_id', facet: 'authorities', label: 'Cơ quan ban hành' },
+  { key: 'signer_id', facet: 'signers', label: 'Người ký' },
+  { key: 'validity', facet: 'validity', label: 'Hiệu lực' },
+  { key: 'year', facet: 'years', label: 'Năm ban hành' },
+];
+
 export default function DocsIndex() {
   const location = useLocation();
   const [searchQuery, setLocalSearch] = useState('');
+  const [submittedQuery, setSubmittedQuery] = useState('');
   const [selectedType, setSelectedType] = useState('all');
   const [currentPage, setCurrentPage] = useState(1);
   const [previewDoc, setPreviewDoc] = useState<any>(null);
+  const [filters, setFilters] = useState<DocumentFilters>({});
+  const [documentNo, setDocumentNo] = useState('');
 
   // Fetch documents from API
+  // The search runs on the server, through the text of the files too
   const { data, isLoading, error } = useDocuments({ 
     page: currentPage, 
-    page_size: ITEMS_PER_PAGE 
+    page_size: ITEMS_PER_PAGE,
+    q: submittedQuery || undefined,
+    ...filters,
   });
+  const { data: previewDetail } = useDocument(previewDoc?.slug);
+  const previewVersions: any[] = previewDetail?.data?.versions || [];
+  const previewRelated: any[] = previewDetail?.data?.related || [];
 
   const documents = data?.data || [];
+  const facets = data?.facets || {};
   const pagination = data?.pagination || { page: 1, page_size: ITEMS_PER_PAGE, total: 0, total_pages: 1 };
 
   // Get breadcrumbs from navigation config
@@ -34,16 +77,29 @@ export default function DocsIndex() {
 
   // Filter documents
   const filteredDocs = documents.filter((doc: any) => {
-    const matchesSearch = !searchQuery || 
-      doc.title?.toLowerCase().includes(searchQuery.toLowerCase()) ||
-      doc.description?.toLowerCase().includes(searchQuery.toLowerCase());
-    
-    const matchesType = selectedType === 'all' || 
+    return selectedType === 'all' || 
       doc.file_type?.toLowerCase().includes(selectedType.toLowerCase());
-    
-    return matchesSearch && matchesType;
   });
 
+  const handleSearch = (e: React.FormEvent) => {
+    e.preventDefault();
+    setSubmittedQuery(searchQuery.trim());
+    setCurrentPage(1);
+  };
+
+  const setFilter = (key: keyof DocumentFilters, value: string) => {
+    setFilters((current) => ({ ...current, [key]: value || undefined }));
+    setCurrentPage(1);
+  };
+
+  const handleDocumentNo = (e: React.FormEvent) => {
+    e.preventDefault();
+    setFilter('document_no', documentNo.trim());
+  };
+
+  const facetLabel = (facet: string, option: { value: string; label?: string }) =>
+    facet === 'validity' ? VALIDITY_LABELS[option.value] || option.value : option.label || option.value;
+
   const formatFileSize = (bytes: number) => {
     if (!bytes || bytes === 0) return '0 Bytes';
     const k = 1024;
@@ -79,16 +135,16 @@ export default function DocsIndex() {
         {/* Search & Filters */}
         <div className="bg-white rounded-lg shadow-md p-6 mb-8">
           <div className="grid md:grid-cols-3 gap-4">
-            <div className="md:col-span-2 relative">
+            <form onSubmit={handleSearch} className="md:col-span-2 relative">
               <Search className="absolute left-3 top-1/2 -translate-y-1/2 w-5 h-5 text-gray-400" />
               <input
-                type="text"
+                type="search"
                 value={searchQuery}
                 onChange={(e) => setLocalSearch(e.target.value)}
-                placeholder="Tìm kiếm văn bản..."
+                placeholder='Tìm trong tiêu đề và nội dung văn bản, "cụm từ chính xác"...'
                 className="w-full pl-10 pr-4 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-green-500 focus:border-transparent"
               />
-            </div>
+            </form>
             <select
               value={selectedType}
               onChange={(e) => setSelectedType(e.target.value)}
@@ -100,6 +156,37 @@ export default function DocsIndex() {
               <option value="docx">DOCX</option>
             </select>
           </div>
+
+          {/* Metadata facets, with the number of matching documents */}
+          <div className="grid md:grid-cols-3 lg:grid-cols-6 gap-4 mt-4">
+            {FACET_FILTERS.map(({ key, facet, label }) => (
+              <select
+                key={key}
+                value={filters[key] || ''}
+                onChange={(e) => setFilter(key, e.target.value)}
+                className="px-3 py-2 border border-gray-300 rounded-lg text-sm focus:ring-2 focus:ring-green-500 focus:border-transparent"
+              >
+                <option value="">{label}: tất cả</option>
+                {(facets[facet] || []).map((option: { value: string; label?: string; count: number }) => (
+                  <option key={option.value} value={option.value}>
+                    {facetLabel(facet, option)} ({option.count})
+                  </option>
+                ))}
+              </select>
+            ))}
+            <form onSubmit={handleDocumentNo}>
+              <input
+                type="search"
+                value={documentNo}
+                onChange={(e) => {
+                  setDocumentNo(e.target.value);
+                  if (!e.target.value) setFilter('document_no', '');
+                }}
+                placeholder="Số văn bản, vd. 12/2024/QĐ-BQP"
+                className="w-full px-3 py-2 border border-gray-300 rounded-lg text-sm focus:ring-2 focus:ring-green-500 focus:border-transparent"
+              />
+            </form>
+          </div>
         </div>
 
         {/* Documents Grid */}
@@ -144,8 +231,48 @@ export default function DocsIndex() {
                     <h3 className="font-bold text-gray-900 mb-3 line-clamp-2 group-hover:text-blue-600 transition-colors min-h-[3rem]">
                       {doc.title}
                     </h3>
+
+                    {/* Type, number, issuer and validity */}
+                    <div className="flex flex-wrap items-center gap-2 text-xs mb-3">
+                      {doc.type_name && (
+                        <span className="px-2 py-0.5 bg-blue-100 text-blue-700 rounded-full font-semibold">{doc.type_name}</span>
+                      )}
+                      {doc.document_no && <span className="text-gray-700 font-medium">Số: {doc.document_no}</span>}
+                      {doc.validity_status && (
+                        <span className={`px-2 py-0.5 rounded-full font-semibold ${VALIDITY_BADGES[doc.validity_status] || ''}`}>
+                          {VALIDITY_LABELS[doc.validity_status] || doc.validity_status}
+                        </span>
+                      )}
+                      {doc.visibility && doc.visibility !== 'public' && (
+                        <span
+                          className="inline-flex items-center gap-1 px-2 py-0.5 bg-purple-100 text-purple-700 rounded-full font-semibold"
+                          title="Văn bản nội bộ, chỉ người được phép mới xem được"
+                        >
+                          <Lock className="w-3 h-3" />
+                          Nội bộ
+                        </span>
+                      )}
+                    </div>
+                    {(doc.authority_name || doc.signer_name || doc.effective_date) && (
+                      <div className="text-xs text-gray-500 mb-3 space-y-0.5">
+                        {doc.authority_name && <div>Cơ quan ban hành: {doc.authority_name}</div>}
+                        {doc.signer_name && <div>Người ký: {doc.signer_name}</div>}
+                        {doc.effective_date && (
+                          <div>
+                            Hiệu lực: {new Date(doc.effective_date).toLocaleDateString('vi-VN')}
+                            {doc.expiry_date && ` – ${new Date(doc.expiry_date).toLocaleDateString('vi-VN')}`}
+                          </div>
+                        )}
+                      </div>
+                    )}
                     
-                    {doc.description && (
+                    {doc.snippet ? (
+                      // The snippet is HTML-escaped by the server, with matches in <mark>
+                      <p
+                        className="text-sm text-gray-600 mb-4 line-clamp-3 [&_mark]:bg-yellow-200 [&_mark]:text-gray-900"
+                        dangerouslySetInnerHTML={{ __html: doc.snippet }}
+                      />
+                    ) : doc.description && (
                       <p className="text-sm text-gray-600 mb-4 line-clamp-2">
                         {doc.description}
                       </p>
@@ -175,8 +302,7 @@ export default function DocsIndex() {
                         <span>Xem</span>
                       </button>
                       <a
-                        href={`http://localhost:8080${doc.file_path || doc.file_url}`}
-                        download={doc.title}
+                        href={`http://localhost:8080${doc.download_url}`}
                         className="flex items-center justify-center gap-2 px-4 py-2.5 bg-gradient-to-r from-green-600 to-emerald-600 text-white rounded-lg hover:from-green-700 hover:to-emerald-700 transition-all duration-200 shadow-sm hover:shadow-md font-medium"
                       >
                         <Download className="w-4 h-4" />
@@ -207,7 +333,7 @@ export default function DocsIndex() {
           <div className="bg-white rounded-lg shadow p-12 text-center">
             <FileText className="w-16 h-16 text-gray-300 mx-auto mb-4" />
             <p className="text-gray-500">
-              {searchQuery || selectedType !== 'all' 
+              {submittedQuery || selectedType !== 'all' || Object.values(filters).some(Boolean)
                 ? 'Không tìm thấy văn bản phù hợp' 
                 : 'Chưa có văn bản nào'}
             </p>
@@ -236,8 +362,7 @@ export default function DocsIndex() {
                   </div>
                 </div>
                 <a
-                  href={`http://localhost:8080${previewDoc.file_path || previewDoc.file_url}`}
-                  download={previewDoc.title}
+                  href={`http://localhost:8080${previewDoc.download_url}`}
                   className="flex items-center gap-2 px-4 py-2 bg-gradient-to-r from-green-600 to-emerald-600 text-white rounded-lg hover:from-green-700 hover:to-emerald-700 transition-all shadow-sm hover:shadow-md font-medium"
                 >
                   <Download className="w-4 h-4" />
@@ -246,11 +371,68 @@ export default function DocsIndex() {
               </div>
             </div>
 
+            {/* Version history, once the document has been corrected */}
+            {previewVersions.length > 1 && (
+              <div className="rounded-lg border border-gray-200 p-4">
+                <h5 className="font-semibold text-gray-900 mb-2">Lịch sử phiên bản</h5>
+                <ul className="divide-y divide-gray-100">
+                  {previewVersions.map((version) => (
+                    <li key={version.id} className="py-2 flex items-start justify-between gap-4 text-sm">
+                      <div>
+                        <span className="font-medium text-gray-900">Phiên bản {version.version}</span>
+                        {version.current && <span className="ml-2 text-green-700">(hiện hành)</span>}
+                        <span className="ml-2 text-gray-500">{new Date(version.created_at).toLocaleDateString('vi-VN')}</span>
+                        {version.change_note && <p className="text-gray-600">{version.change_note}</p>}
+                        {version.sha256 && (
+                          <p className="text-xs text-gray-400 font-mono break-all">SHA-256: {version.sha256}</p>
+                        )}
+                      </div>
+                      <a
+                        href={`http://localhost:8080${version.download_url}`}
+                        className="flex-shrink-0 text-green-600 hover:text-green-800"
+                        title="Tải về phiên bản này"
+                      >
+                        <Download className="w-4 h-4" />
+                      </a>
+                    </li>
+                  ))}
+                </ul>
+              </div>
+            )}
+
+            {/* Documents this one amends, replaces, guides or references, and the reverse */}
+            {previewRelated.length > 0 && (
+              <div className="rounded-lg border border-gray-200 p-4">
+                <h5 className="font-semibold text-gray-900 mb-2">Văn bản liên quan</h5>
+                <ul className="divide-y divide-gray-100">
+                  {previewRelated.map((related) => (
+                    <li key={`${related.relation_id}-${related.relation}`} className="py-2 text-sm">
+                      <span className="text-gray-500">{RELATION_LABELS[related.relation] || related.relation}: </span>
+                      <a
+                        href={`http://localhost:8080/api/v1/documents/${related.slug}/preview`}
+                        target="_blank"
+                        rel="noopener noreferrer"
+                        className="font-medium text-blue-600 hover:text-blue-800"
+                      >
+                        {related.document_no && `${related.document_no} – `}
+                        {related.title}
+                      </a>
+                      {related.validity_status && (
+                        <span className={`ml-2 px-2 py-0.5 text-xs rounded-full font-semibold ${VALIDITY_BADGES[related.validity_status] || ''}`}>
+                          {VALIDITY_LABELS[related.validity_status] || related.validity_status}
+                        </span>
+                      )}
+                    </li>
+                  ))}
+                </ul>
+              </div>
+            )}
+
             {/* PDF Viewer */}
             <div className="w-full h-[70vh] rounded-lg overflow-hidden border border-gray-200 bg-gray-50">
               {(previewDoc.file_path || previewDoc.file_url)?.toLowerCase().endsWith('.pdf') ? (
                 <iframe
-                  src={`http://localhost:8080${previewDoc.file_path || previewDoc.file_url}`}
+                  src={`http://localhost:8080${previewDoc.preview_url}`}
                   className="w-full h-full border-0"
                   title={previewDoc.title}
                 />
@@ -260,8 +442,7 @@ export default function DocsIndex() {
                   <p className="text-gray-600 mb-2 font-medium">Không thể xem trước loại file này</p>
                   <p className="text-sm text-gray-500 mb-6">Vui lòng tải về để xem nội dung</p>
                   <a
-                    href={`http://localhost:8080${previewDoc.file_path || previewDoc.file_url}`}
-                    download={previewDoc.title}
+                    href={`http://localhost:8080${previewDoc.download_url}`}
                     className="flex items-center gap-2 px-6 py-3 bg-gradient-to-r from-green-600 to-emerald-600 text-white rounded-lg hover:from-green-700 hover:to-emerald-700 transition-all shadow-sm hover:shadow-md font-medium"
                   >
                     <Download className="w-5 h-5" />